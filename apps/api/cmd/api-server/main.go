@@ -5,8 +5,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	// Embed the timezone database so schedule timezones work on minimal images
+	_ "time/tzdata"
 
 	"github.com/dendianugerah/velld/internal"
+	"github.com/dendianugerah/velld/internal/audit"
 	"github.com/dendianugerah/velld/internal/auth"
 	"github.com/dendianugerah/velld/internal/backup"
 	"github.com/dendianugerah/velld/internal/common"
@@ -84,18 +88,46 @@ func main() {
 	protected.Use(authMiddleware.RequireAuth)
 	protected.HandleFunc("/auth/profile", authHandler.GetProfile).Methods("GET", "OPTIONS")
 
+	backupDir := os.Getenv("BACKUP_DIR")
+	if backupDir == "" {
+		backupDir = "./backups"
+	}
+
+	cacheDir := os.Getenv("BACKUP_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "velld-s3-downloads")
+	}
+
+	cacheMaxSizeMB := int64(2048)
+	if sizeStr := os.Getenv("BACKUP_CACHE_MAX_SIZE_MB"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size < 0 {
+			log.Fatalf("Invalid BACKUP_CACHE_MAX_SIZE_MB: %q", sizeStr)
+		}
+		cacheMaxSizeMB = size
+	}
+
+	downloadCache, err := backup.NewDownloadCache(cacheDir, cacheMaxSizeMB*1024*1024)
+	if err != nil {
+		log.Fatalf("Failed to initialize download cache: %v", err)
+	}
+
 	backupRepo := backup.NewBackupRepository(db)
 	settingsRepo := settings.NewSettingsRepository(db)
 	notificationRepo := notification.NewNotificationRepository(db)
 	settingsService := settings.NewSettingsService(settingsRepo, cryptoService)
+	auditRepo := audit.NewAuditRepository(db)
+	auditService := audit.NewAuditService(auditRepo)
 
 	backupService := backup.NewBackupService(
 		connRepo,
-		"./backups",
+		backupDir,
 		backupRepo,
 		settingsService,
 		notificationRepo,
 		cryptoService,
+		downloadCache,
+		auditService,
 	)
 
 	// Create connHandler after backupService is available
@@ -117,18 +149,80 @@ func main() {
 	protected.HandleFunc("/backups/schedule", backupHandler.ScheduleBackup).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups", backupHandler.CreateBackup).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups", backupHandler.ListBackups).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/export", backupHandler.ExportBackups).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/upload", backupHandler.UploadBackup).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/trash", backupHandler.ListTrash).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/trash/{id}/recover", backupHandler.RecoverBackup).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/trash/{id}", backupHandler.PurgeBackup).Methods("DELETE", "OPTIONS")
 	protected.HandleFunc("/backups/{id}", backupHandler.GetBackup).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}", backupHandler.DeleteBackup).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/metadata", backupHandler.UpdateBackupMetadata).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/pin", backupHandler.PinBackup).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/legal-hold", backupHandler.SetLegalHold).Methods("PUT", "OPTIONS")
 	protected.HandleFunc("/backups/{id}/download", backupHandler.DownloadBackup).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/mask", backupHandler.MaskBackup).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups/restore", backupHandler.RestoreBackup).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/restore/confirmation", backupHandler.ConfirmRestore).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/restores", backupHandler.ListRestoreJobs).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/restores/preflight", backupHandler.PreflightRestore).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/restores/{id}", backupHandler.GetRestoreJob).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/restores/{id}/revert/confirmation", backupHandler.ConfirmRevertRestoreJob).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/restores/{id}/revert", backupHandler.RevertRestoreJob).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups/compare/{sourceId}/{targetId}", backupHandler.CompareBackups).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/backups/{connection_id}/schedule/disable", backupHandler.DisableBackupSchedule).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups/{connection_id}/schedule", backupHandler.UpdateBackupSchedule).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/lifecycle", backupHandler.GetLifecycleRule).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/lifecycle", backupHandler.UpdateLifecycleRule).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/retention", backupHandler.GetRetentionRule).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/retention", backupHandler.UpdateRetentionRule).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/retention/dry-run", backupHandler.PreviewRetention).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/rpo", backupHandler.GetRPOPolicy).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/rpo", backupHandler.UpdateRPOPolicy).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/rpo/report", backupHandler.GetRPOReport).Methods("GET", "OPTIONS")
+
+	protected.HandleFunc("/schedules", backupHandler.ListSchedules).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/schedules", backupHandler.CreateSchedule).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/schedules/preview", backupHandler.PreviewSchedule).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}", backupHandler.GetSchedule).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}", backupHandler.UpdateSchedule).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}", backupHandler.DeleteSchedule).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}/run", backupHandler.RunSchedule).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}/runs", backupHandler.ListScheduleRuns).Methods("GET", "OPTIONS")
+
+	protected.HandleFunc("/policies", backupHandler.ListPolicies).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/policies", backupHandler.CreatePolicy).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/policies/{id}", backupHandler.GetPolicy).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/policies/{id}", backupHandler.UpdatePolicy).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/policies/{id}", backupHandler.DeletePolicy).Methods("DELETE", "OPTIONS")
+
+	protected.HandleFunc("/blackouts", backupHandler.ListBlackoutWindows).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/blackouts", backupHandler.CreateBlackoutWindow).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/blackouts/{id}", backupHandler.UpdateBlackoutWindow).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/blackouts/{id}", backupHandler.DeleteBlackoutWindow).Methods("DELETE", "OPTIONS")
+
+	protected.HandleFunc("/refresh-pipelines", backupHandler.ListRefreshPipelines).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/refresh-pipelines", backupHandler.CreateRefreshPipeline).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/refresh-pipelines/{id}", backupHandler.GetRefreshPipeline).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/refresh-pipelines/{id}", backupHandler.UpdateRefreshPipeline).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/refresh-pipelines/{id}", backupHandler.DeleteRefreshPipeline).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/refresh-pipelines/{id}/run", backupHandler.RunRefreshPipeline).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/refresh-pipelines/{id}/runs", backupHandler.ListRefreshRuns).Methods("GET", "OPTIONS")
+
+	protected.HandleFunc("/masking-profiles", backupHandler.ListMaskingProfiles).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/masking-profiles", backupHandler.CreateMaskingProfile).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/masking-profiles/{id}", backupHandler.GetMaskingProfile).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/masking-profiles/{id}", backupHandler.UpdateMaskingProfile).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/masking-profiles/{id}", backupHandler.DeleteMaskingProfile).Methods("DELETE", "OPTIONS")
 
 	settingsHandler := settings.NewSettingsHandler(settingsService)
 
 	protected.HandleFunc("/settings", settingsHandler.GetSettings).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/settings", settingsHandler.UpdateSettings).Methods("PUT", "OPTIONS")
 
+	auditHandler := audit.NewAuditHandler(auditService)
+
+	protected.HandleFunc("/audit-log", auditHandler.ListEntries).Methods("GET", "OPTIONS")
+
 	notificationService := notification.NewNotificationService(notificationRepo)
 	notificationHandler := notification.NewNotificationHandler(notificationService)
 
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/google/uuid"
+)
+
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) CreateEntry(e *Entry) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	var details *string
+	if len(e.Details) > 0 {
+		str := string(e.Details)
+		details = &str
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO audit_log (
+			id, user_id, actor, action, resource_type, resource_id, details, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		e.ID, e.UserID, e.Actor, e.Action, e.ResourceType, e.ResourceID, details,
+		e.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *AuditRepository) ListEntries(opts ListOptions) ([]*Entry, int, error) {
+	whereClause := "WHERE user_id = $1"
+	args := []interface{}{opts.UserID}
+	if opts.ResourceID != "" {
+		args = append(args, opts.ResourceID)
+		whereClause += fmt.Sprintf(" AND resource_id = $%d", len(args))
+	}
+	if opts.Action != "" {
+		args = append(args, opts.Action)
+		whereClause += fmt.Sprintf(" AND action = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM audit_log "+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, user_id, actor, action, resource_type, resource_id, COALESCE(details, ''), created_at
+		FROM audit_log
+		%s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d`, whereClause, len(args)+1, len(args)+2)
+	args = append(args, opts.Limit, opts.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := make([]*Entry, 0)
+	for rows.Next() {
+		e := &Entry{}
+		var details, createdAtStr string
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Actor, &e.Action, &e.ResourceType, &e.ResourceID,
+			&details, &createdAtStr); err != nil {
+			return nil, 0, err
+		}
+		if details != "" {
+			e.Details = []byte(details)
+		}
+		if e.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+			return nil, 0, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, total, rows.Err()
+}
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+type AuditService struct {
+	repo *AuditRepository
+}
+
+func NewAuditService(repo *AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record writes an audit entry. Details are stored as JSON.
+func (s *AuditService) Record(userID uuid.UUID, actor string, action Action, resourceType, resourceID string, details map[string]interface{}) error {
+	entry := &Entry{
+		UserID:       userID,
+		Actor:        actor,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+	}
+	if len(details) > 0 {
+		data, err := json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %v", err)
+		}
+		entry.Details = data
+	}
+	return s.repo.CreateEntry(entry)
+}
+
+func (s *AuditService) ListEntries(opts ListOptions) ([]*Entry, int, error) {
+	return s.repo.ListEntries(opts)
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Action string
+
+const (
+	BackupPinned            Action = "backup.pinned"
+	BackupUnpinned          Action = "backup.unpinned"
+	BackupLegalHoldPlaced   Action = "backup.legal_hold_placed"
+	BackupLegalHoldReleased Action = "backup.legal_hold_released"
+	BackupTrashed           Action = "backup.trashed"
+	BackupRecovered         Action = "backup.recovered"
+	BackupPurged            Action = "backup.purged"
+	BackupRestored          Action = "backup.restored"
+)
+
+// ActorSystem marks entries recorded by background jobs rather than a user
+const ActorSystem = "system"
+
+// Entry records who did what to which resource. UserID is the owner of the
+// resource, Actor is the user ID that acted or ActorSystem.
+type Entry struct {
+	ID           uuid.UUID       `json:"id"`
+	UserID       uuid.UUID       `json:"user_id"`
+	Actor        string          `json:"actor"`
+	Action       Action          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	Details      json.RawMessage `json:"details,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+type ListOptions struct {
+	UserID     uuid.UUID
+	ResourceID string
+	Action     string
+	Limit      int
+	Offset     int
+}
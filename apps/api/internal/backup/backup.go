@@ -3,8 +3,8 @@ package backup
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -78,15 +78,13 @@ func (h *BackupHandler) ListBackups(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	search := r.URL.Query().Get("search")
-	offset := (page - 1) * limit
-
-	opts := BackupListOptions{
-		UserID: userID,
-		Limit:  limit,
-		Offset: offset,
-		Search: search,
+	opts, err := parseBackupListOptions(r.URL.Query(), userID)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	opts.Limit = limit
+	opts.Offset = (page - 1) * limit
 
 	backups, total, err := h.backupService.GetAllBackupsWithPagination(opts)
 	if err != nil {
@@ -191,6 +189,10 @@ func (h *BackupHandler) GetBackupStats(w http.ResponseWriter, r *http.Request) {
 	response.SendSuccess(w, "Backup statistics retrieved successfully", stats)
 }
 
+// DownloadBackup streams a backup file. Local copies are served with Range
+// and conditional request support. Backups that only live in S3 are proxied
+// straight from the object stream, or with ?mode=redirect the client is sent
+// to a short-lived presigned URL so the API server stays out of the data path.
 func (h *BackupHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	backupID := vars["id"]
@@ -211,62 +213,125 @@ func (h *BackupHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure backup file is available (local or download from S3)
-	filePath, isTemp, err := h.backupService.ensureBackupFileAvailable(backup, userID)
-	if err != nil {
-		response.SendError(w, http.StatusInternalServerError, err.Error())
+	filename := filepath.Base(backup.Path)
+
+	if file, err := os.Open(backup.Path); err == nil {
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			response.SendError(w, http.StatusInternalServerError, "Failed to stat backup file")
+			return
+		}
+
+		setDownloadHeaders(w, filename, fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+		http.ServeContent(w, r, filename, info.ModTime(), file)
+		return
+	}
+
+	if backup.S3ObjectKey == nil || *backup.S3ObjectKey == "" {
+		response.SendError(w, http.StatusNotFound, "Backup file not found locally and no S3 object key available")
 		return
 	}
 
-	// Clean up temp file after download if needed
-	if isTemp {
-		defer func() {
-			if err := os.Remove(filePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp file %s: %v\n", filePath, err)
-			}
-		}()
+	if r.URL.Query().Get("mode") == "redirect" {
+		url, err := h.backupService.presignS3Backup(r.Context(), backup, userID)
+		if err != nil {
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+		return
 	}
 
-	file, err := os.Open(filePath)
+	object, info, err := h.backupService.openS3Backup(r.Context(), backup, userID)
 	if err != nil {
-		response.SendError(w, http.StatusInternalServerError, "Failed to open backup file")
+		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	defer file.Close()
+	defer object.Close()
 
-	filename := filepath.Base(backup.Path)
-	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	etag := ""
+	if info.ETag != "" {
+		etag = fmt.Sprintf("%q", info.ETag)
+	}
+	setDownloadHeaders(w, filename, etag)
+	http.ServeContent(w, r, filename, info.LastModified, object)
+}
+
+func setDownloadHeaders(w http.ResponseWriter, filename, etag string) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
 	w.Header().Set("Content-Type", "application/octet-stream")
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+}
 
-	_, err = io.Copy(w, file)
+func (h *BackupHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
 	if err != nil {
-		response.SendError(w, http.StatusInternalServerError, "Failed to send file")
+		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-}
 
-func (h *BackupHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
 	var req RestoreRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if req.BackupID == "" {
-		response.SendError(w, http.StatusBadRequest, "backup_id is required")
+	if err := validateRestoreRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if req.ConnectionID == "" {
-		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+	job, err := h.backupService.StartRestore(userID, &req)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Backup or connection not found")
+		case errors.Is(err, errRestoreSelection), errors.Is(err, errMaskingProfileInvalid):
+			response.SendError(w, http.StatusBadRequest, err.Error())
+		case err == errRestoreConfirmation, err == errRestoreTargetBusy:
+			response.SendError(w, http.StatusConflict, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Restore queued successfully", job)
+}
+
+// ConfirmRestore issues the token a restore needs to drop and recreate its
+// target database
+func (h *BackupHandler) ConfirmRestore(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	err := h.backupService.RestoreBackup(req.BackupID, req.ConnectionID)
+	if err := validateRestoreRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	confirmation, err := h.backupService.IssueRestoreConfirmation(userID, &req)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup or connection not found")
+			return
+		}
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	response.SendSuccess(w, "Backup restored successfully", nil)
+	response.SendSuccess(w, "Restore confirmation issued successfully", confirmation)
 }
@@ -0,0 +1,361 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// activeUntil reports whether the window covers t and, if so, when it ends
+func (w *BlackoutWindow) activeUntil(t time.Time) (time.Time, bool) {
+	if w.StartsAt != nil && w.EndsAt != nil {
+		if !t.Before(*w.StartsAt) && t.Before(*w.EndsAt) {
+			return *w.EndsAt, true
+		}
+		return time.Time{}, false
+	}
+
+	if w.CronSchedule == nil || w.DurationMinutes <= 0 {
+		return time.Time{}, false
+	}
+
+	schedule, err := parseCronSchedule(*w.CronSchedule, w.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// The window is open if it started within the last duration
+	duration := time.Duration(w.DurationMinutes) * time.Minute
+	start := schedule.Next(t.Add(-duration))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+	return start.Add(duration), true
+}
+
+// blackoutHold describes why and until when a schedule may not run
+type blackoutHold struct {
+	// Window is the active window that ends last
+	Window *BlackoutWindow
+	Until  time.Time
+	// Defer is set when any active window defers runs instead of skipping them
+	Defer bool
+}
+
+// activeBlackout returns the blackout covering a schedule at t, or nil when
+// the schedule may run
+func (s *BackupService) activeBlackout(schedule *BackupSchedule, t time.Time) (*blackoutHold, error) {
+	conn, err := s.connStorage.GetConnection(schedule.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	windows, err := s.backupRepo.GetBlackoutWindowsForSchedule(conn.UserID, schedule.ConnectionID, schedule.ID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blackout windows: %w", err)
+	}
+
+	var hold *blackoutHold
+	for _, window := range windows {
+		end, ok := window.activeUntil(t)
+		if !ok {
+			continue
+		}
+		if hold == nil {
+			hold = &blackoutHold{}
+		}
+		if hold.Window == nil || end.After(hold.Until) {
+			hold.Window = window
+			hold.Until = end
+		}
+		if window.Action == BlackoutActionDefer {
+			hold.Defer = true
+		}
+	}
+
+	return hold, nil
+}
+
+// holdForBlackout checks whether a scheduled run falls inside a blackout
+// window. Blocked runs are skipped or deferred to the end of the blackout and
+// recorded in the schedule history; true is returned when the run must not
+// proceed now.
+func (s *BackupService) holdForBlackout(schedule *BackupSchedule, scheduledTime time.Time) bool {
+	hold, err := s.activeBlackout(schedule, scheduledTime)
+	if err != nil {
+		fmt.Printf("Warning: Failed to check blackout windows for schedule %s: %v\n", schedule.ID, err)
+		return false
+	}
+	if hold == nil {
+		return false
+	}
+
+	status := ScheduleRunSkipped
+	reason := fmt.Sprintf("blackout window %q active until %s", hold.Window.Name, hold.Until.Format(time.RFC3339))
+
+	if hold.Defer {
+		deferred, err := s.deferScheduleRun(schedule, hold.Until)
+		switch {
+		case err != nil:
+			fmt.Printf("Warning: Failed to defer run of schedule %s: %v\n", schedule.ID, err)
+			reason += " (the run could not be deferred)"
+		case deferred:
+			status = ScheduleRunDeferred
+			reason = fmt.Sprintf("deferred to %s by blackout window %q", hold.Until.Format(time.RFC3339), hold.Window.Name)
+		default:
+			reason += " (a deferred run is already pending)"
+		}
+	}
+
+	fmt.Printf("Schedule %s run %s: %s\n", schedule.ID, status, reason)
+	s.recordScheduleRun(&ScheduleRun{
+		ScheduleID:    schedule.ID.String(),
+		ConnectionID:  schedule.ConnectionID,
+		TriggeredBy:   RunTriggerSchedule,
+		Status:        status,
+		Reason:        &reason,
+		ScheduledTime: scheduledTime,
+	})
+	return true
+}
+
+// deferScheduleRun stores a run of a schedule at the end of a blackout for
+// the leader to fire, returning false if a deferred run is already pending
+func (s *BackupService) deferScheduleRun(schedule *BackupSchedule, at time.Time) (bool, error) {
+	return s.backupRepo.DeferScheduleRun(schedule.ID.String(), at)
+}
+
+// cancelDeferredRun drops a pending deferred run of a schedule
+func (s *BackupService) cancelDeferredRun(scheduleID string) {
+	if err := s.backupRepo.ClearDeferredRun(scheduleID); err != nil {
+		fmt.Printf("Warning: Failed to cancel deferred run of schedule %s: %v\n", scheduleID, err)
+	}
+}
+
+func (s *BackupService) recordScheduleRun(run *ScheduleRun) {
+	if run.ID == uuid.Nil {
+		run.ID = uuid.New()
+	}
+	if err := s.backupRepo.CreateScheduleRun(run); err != nil {
+		fmt.Printf("Warning: Failed to record run of schedule %s: %v\n", run.ScheduleID, err)
+	}
+}
+
+func (s *BackupService) ListBlackoutWindows(userID uuid.UUID) ([]*BlackoutWindow, error) {
+	return s.backupRepo.GetBlackoutWindowsByUserID(userID)
+}
+
+func (s *BackupService) CreateBlackoutWindow(userID uuid.UUID, req *BlackoutWindowRequest) (*BlackoutWindow, error) {
+	window := &BlackoutWindow{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Enabled:   true,
+		CreatedAt: time.Now(),
+	}
+	if err := s.applyBlackoutWindowRequest(window, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.CreateBlackoutWindow(window); err != nil {
+		return nil, fmt.Errorf("failed to save blackout window: %v", err)
+	}
+
+	return window, nil
+}
+
+func (s *BackupService) UpdateBlackoutWindow(id string, req *BlackoutWindowRequest) (*BlackoutWindow, error) {
+	window, err := s.backupRepo.GetBlackoutWindow(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyBlackoutWindowRequest(window, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.UpdateBlackoutWindow(window); err != nil {
+		return nil, err
+	}
+
+	return window, nil
+}
+
+func (s *BackupService) DeleteBlackoutWindow(id string) error {
+	return s.backupRepo.DeleteBlackoutWindow(id)
+}
+
+// applyBlackoutWindowRequest copies a request onto a window, scoping
+// schedule windows to the schedule's connection
+func (s *BackupService) applyBlackoutWindowRequest(window *BlackoutWindow, req *BlackoutWindowRequest) error {
+	window.ConnectionID = nonEmpty(req.ConnectionID)
+	window.ScheduleID = nonEmpty(req.ScheduleID)
+
+	if window.ScheduleID != nil {
+		schedule, err := s.backupRepo.GetBackupScheduleByID(*window.ScheduleID)
+		if err != nil {
+			return err
+		}
+		window.ConnectionID = &schedule.ConnectionID
+	} else if window.ConnectionID != nil {
+		if _, err := s.connStorage.GetConnection(*window.ConnectionID); err != nil {
+			return err
+		}
+	}
+
+	window.Name = strings.TrimSpace(req.Name)
+	window.CronSchedule = nonEmpty(req.CronSchedule)
+	window.DurationMinutes = req.DurationMinutes
+	window.Timezone = strings.TrimSpace(req.Timezone)
+	window.StartsAt = req.StartsAt
+	window.EndsAt = req.EndsAt
+	window.Action = req.Action
+	if window.Action == "" {
+		window.Action = BlackoutActionSkip
+	}
+	if req.Enabled != nil {
+		window.Enabled = *req.Enabled
+	}
+	window.UpdatedAt = time.Now()
+	return nil
+}
+
+func validateBlackoutWindowRequest(req *BlackoutWindowRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.Action != "" && req.Action != BlackoutActionSkip && req.Action != BlackoutActionDefer {
+		return fmt.Errorf("action must be %q or %q", BlackoutActionSkip, BlackoutActionDefer)
+	}
+
+	recurring := req.CronSchedule != nil && strings.TrimSpace(*req.CronSchedule) != ""
+	oneOff := req.StartsAt != nil || req.EndsAt != nil
+
+	switch {
+	case recurring && oneOff:
+		return fmt.Errorf("set either cron_schedule or starts_at/ends_at, not both")
+	case recurring:
+		if _, err := parseCronSchedule(*req.CronSchedule, strings.TrimSpace(req.Timezone)); err != nil {
+			return err
+		}
+		if req.DurationMinutes <= 0 {
+			return fmt.Errorf("duration_minutes must be greater than 0 for recurring windows")
+		}
+	case oneOff:
+		if req.StartsAt == nil || req.EndsAt == nil {
+			return fmt.Errorf("starts_at and ends_at are both required for one-off windows")
+		}
+		if !req.EndsAt.After(*req.StartsAt) {
+			return fmt.Errorf("ends_at must be after starts_at")
+		}
+	default:
+		return fmt.Errorf("either cron_schedule or starts_at/ends_at is required")
+	}
+	return nil
+}
+
+func nonEmpty(value *string) *string {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	return &trimmed
+}
+
+func (h *BackupHandler) ListBlackoutWindows(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	windows, err := h.backupService.ListBlackoutWindows(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Blackout windows retrieved successfully", windows)
+}
+
+func (h *BackupHandler) CreateBlackoutWindow(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req BlackoutWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateBlackoutWindowRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	window, err := h.backupService.CreateBlackoutWindow(userID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection or schedule not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Blackout window created successfully", window)
+}
+
+func (h *BackupHandler) UpdateBlackoutWindow(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req BlackoutWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateBlackoutWindowRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	window, err := h.backupService.UpdateBlackoutWindow(id, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Blackout window not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Blackout window updated successfully", window)
+}
+
+func (h *BackupHandler) DeleteBlackoutWindow(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := h.backupService.DeleteBlackoutWindow(id); err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Blackout window not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Blackout window deleted successfully", nil)
+}
@@ -0,0 +1,209 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadCache keeps backups downloaded from S3 on local disk so repeated
+// restores and diffs of recent backups don't download them again.
+//
+// Concurrent requests for the same key share a single download, files are
+// reference counted while callers use them, and unreferenced files are evicted
+// least-recently-used first once the cache grows beyond maxBytes.
+type DownloadCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+}
+
+type cacheEntry struct {
+	name     string
+	path     string
+	size     int64
+	refs     int
+	lastUsed time.Time
+	ready    chan struct{} // closed once the download has finished
+	done     bool
+	err      error
+}
+
+// NewDownloadCache creates a cache in dir that holds at most maxBytes of
+// unreferenced files. Files left over from a previous run are indexed so they
+// can be reused.
+func NewDownloadCache(dir string, maxBytes int64) (*DownloadCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download cache directory: %w", err)
+	}
+
+	c := &DownloadCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*cacheEntry),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read download cache directory: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+
+		// Remove partial downloads from an interrupted run
+		if strings.Contains(file.Name(), ".part-") {
+			os.Remove(path)
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		ready := make(chan struct{})
+		close(ready)
+		c.entries[file.Name()] = &cacheEntry{
+			name:     file.Name(),
+			path:     path,
+			size:     info.Size(),
+			lastUsed: info.ModTime(),
+			ready:    ready,
+			done:     true,
+		}
+		c.size += info.Size()
+	}
+
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// Acquire returns the local path of the file cached under key, calling fetch
+// to download it into the given path on a miss. The returned release function
+// must be called once the caller no longer reads the file.
+func (c *DownloadCache) Acquire(key string, fetch func(path string) error) (string, func(), error) {
+	name := cacheFileName(key)
+
+	c.mu.Lock()
+	if entry, ok := c.entries[name]; ok {
+		entry.refs++
+		c.mu.Unlock()
+
+		<-entry.ready
+		if entry.err != nil {
+			c.release(entry)
+			return "", nil, entry.err
+		}
+		return entry.path, c.releaseFunc(entry), nil
+	}
+
+	entry := &cacheEntry{
+		name:  name,
+		path:  filepath.Join(c.dir, name),
+		refs:  1,
+		ready: make(chan struct{}),
+	}
+	c.entries[name] = entry
+	c.mu.Unlock()
+
+	partPath := fmt.Sprintf("%s.part-%d", entry.path, time.Now().UnixNano())
+	err := fetch(partPath)
+	if err == nil {
+		err = os.Rename(partPath, entry.path)
+	}
+
+	var size int64
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(entry.path); err == nil {
+			size = info.Size()
+		}
+	}
+
+	c.mu.Lock()
+	entry.done = true
+	entry.lastUsed = time.Now()
+	if err != nil {
+		os.Remove(partPath)
+		entry.err = err
+		delete(c.entries, name)
+	} else {
+		entry.size = size
+		c.size += size
+	}
+	close(entry.ready)
+	c.evictLocked()
+	c.mu.Unlock()
+
+	if err != nil {
+		c.release(entry)
+		return "", nil, err
+	}
+
+	return entry.path, c.releaseFunc(entry), nil
+}
+
+func (c *DownloadCache) releaseFunc(entry *cacheEntry) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { c.release(entry) })
+	}
+}
+
+func (c *DownloadCache) release(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.refs--
+	entry.lastUsed = time.Now()
+	c.evictLocked()
+}
+
+// evictLocked removes the least recently used unreferenced files until the
+// cache fits in maxBytes. Files still in use are never removed.
+func (c *DownloadCache) evictLocked() {
+	for c.size > c.maxBytes {
+		var oldest *cacheEntry
+		for _, entry := range c.entries {
+			if !entry.done || entry.refs > 0 {
+				continue
+			}
+			if oldest == nil || entry.lastUsed.Before(oldest.lastUsed) {
+				oldest = entry
+			}
+		}
+
+		if oldest == nil {
+			return
+		}
+
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: Failed to evict cached download %s: %v\n", oldest.path, err)
+		}
+		delete(c.entries, oldest.name)
+		c.size -= oldest.size
+	}
+}
+
+// cacheFileName maps a cache key to a stable file name, keeping the original
+// extension so tools that sniff it keep working
+func cacheFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + filepath.Ext(key)
+}
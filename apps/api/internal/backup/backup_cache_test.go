@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fetchBytes returns a fetch function writing size bytes and counting calls
+func fetchBytes(size int, calls *int) func(path string) error {
+	return func(path string) error {
+		*calls++
+		return os.WriteFile(path, []byte(strings.Repeat("x", size)), 0644)
+	}
+}
+
+func TestDownloadCacheEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		// acquire lists the keys acquired in order, each 10 bytes large
+		acquire []string
+		// hold keeps the first acquired file referenced
+		hold bool
+		kept []string
+		gone []string
+	}{
+		{
+			name:     "fits",
+			maxBytes: 30,
+			acquire:  []string{"a.sql", "b.sql", "c.sql"},
+			kept:     []string{"a.sql", "b.sql", "c.sql"},
+		},
+		{
+			name:     "least recently used goes first",
+			maxBytes: 20,
+			acquire:  []string{"a.sql", "b.sql", "c.sql"},
+			kept:     []string{"b.sql", "c.sql"},
+			gone:     []string{"a.sql"},
+		},
+		{
+			name:     "reuse refreshes recency",
+			maxBytes: 20,
+			acquire:  []string{"a.sql", "b.sql", "a.sql", "c.sql"},
+			kept:     []string{"a.sql", "c.sql"},
+			gone:     []string{"b.sql"},
+		},
+		{
+			name:     "files in use are kept",
+			maxBytes: 20,
+			acquire:  []string{"a.sql", "b.sql", "c.sql"},
+			hold:     true,
+			kept:     []string{"a.sql", "c.sql"},
+			gone:     []string{"b.sql"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := NewDownloadCache(t.TempDir(), tt.maxBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calls := 0
+			for i, key := range tt.acquire {
+				path, release, err := cache.Acquire(key, fetchBytes(10, &calls))
+				if err != nil {
+					t.Fatalf("Acquire(%q): %v", key, err)
+				}
+				if filepath.Ext(path) != filepath.Ext(key) {
+					t.Errorf("Acquire(%q) = %s, want the key's extension", key, path)
+				}
+				if !(tt.hold && i == 0) {
+					release()
+				}
+			}
+
+			for _, key := range tt.kept {
+				if _, err := os.Stat(filepath.Join(cache.dir, cacheFileName(key))); err != nil {
+					t.Errorf("%s was evicted: %v", key, err)
+				}
+			}
+			for _, key := range tt.gone {
+				if _, err := os.Stat(filepath.Join(cache.dir, cacheFileName(key))); !os.IsNotExist(err) {
+					t.Errorf("%s was not evicted", key)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadCacheHit(t *testing.T) {
+	cache, err := NewDownloadCache(t.TempDir(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	first, release, err := cache.Acquire("backups/db.sql", fetchBytes(10, &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	release() // releasing twice must not drop another reference
+
+	second, release, err := cache.Acquire("backups/db.sql", fetchBytes(10, &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if first != second {
+		t.Errorf("paths differ: %s and %s", first, second)
+	}
+	if calls != 1 {
+		t.Errorf("fetched %d times, want 1", calls)
+	}
+}
+
+func TestDownloadCacheFailedFetch(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDownloadCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchErr := errors.New("download failed")
+	_, _, err = cache.Acquire("db.sql", func(path string) error {
+		os.WriteFile(path, []byte("partial"), 0644)
+		return fetchErr
+	})
+	if !errors.Is(err, fetchErr) {
+		t.Fatalf("Acquire error = %v, want %v", err, fetchErr)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("failed download left %d files behind", len(files))
+	}
+
+	// The failure is not cached
+	calls := 0
+	if _, release, err := cache.Acquire("db.sql", fetchBytes(10, &calls)); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+	if calls != 1 {
+		t.Errorf("fetched %d times after a failure, want 1", calls)
+	}
+}
+
+func TestNewDownloadCacheIndexesExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	kept := cacheFileName("db.sql")
+	partial := kept + ".part-1"
+	for _, name := range []string{kept, partial} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache, err := NewDownloadCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, partial)); !os.IsNotExist(err) {
+		t.Error("partial download was not removed")
+	}
+
+	calls := 0
+	_, release, err := cache.Acquire("db.sql", fetchBytes(10, &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if calls != 0 {
+		t.Error("file left by a previous run was downloaded again")
+	}
+}
@@ -0,0 +1,346 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Limits on backup labels and notes
+const (
+	maxBackupLabels      = 50
+	maxLabelKeyLength    = 64
+	maxLabelValueLength  = 256
+	maxBackupNotesLength = 4096
+)
+
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-/]*$`)
+
+// Export formats of the backup catalog
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+)
+
+var backupExportHeader = []string{
+	"id", "connection_id", "database_type", "database_name", "schedule_id", "status",
+	"path", "s3_bucket", "s3_object_key", "storage_tier", "compression", "size",
+	"started_time", "completed_time", "created_at", "pinned", "legal_hold", "labels", "notes",
+	"masked", "imported", "checksum", "format",
+}
+
+// UpdateBackupMetadata changes the labels and notes of a backup
+func (s *BackupService) UpdateBackupMetadata(userID uuid.UUID, id string, req *UpdateBackupMetadataRequest) (*Backup, error) {
+	backup, err := s.backupRepo.GetBackup(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.backupOwner(backup, userID); err != nil {
+		return nil, err
+	}
+
+	labels := backup.Labels
+	if req.Labels != nil {
+		labels = normalizeLabels(*req.Labels)
+	}
+	notes := backup.Notes
+	if req.Notes != nil {
+		trimmed := strings.TrimSpace(*req.Notes)
+		notes = &trimmed
+		if trimmed == "" {
+			notes = nil
+		}
+	}
+
+	if err := s.backupRepo.UpdateBackupMetadata(id, labels, notes); err != nil {
+		return nil, err
+	}
+	return s.backupRepo.GetBackup(id)
+}
+
+// ExportBackups returns every backup of the catalog matching the options
+func (s *BackupService) ExportBackups(opts BackupListOptions) ([]*BackupList, error) {
+	return s.backupRepo.GetAllBackups(opts)
+}
+
+func normalizeLabels(labels map[string]string) map[string]string {
+	normalized := make(map[string]string, len(labels))
+	for key, value := range labels {
+		normalized[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return normalized
+}
+
+func validateBackupMetadata(req *UpdateBackupMetadataRequest) error {
+	if req.Labels != nil {
+		if len(*req.Labels) > maxBackupLabels {
+			return fmt.Errorf("a backup can have at most %d labels", maxBackupLabels)
+		}
+		for key, value := range *req.Labels {
+			key = strings.TrimSpace(key)
+			if len(key) > maxLabelKeyLength || !labelKeyPattern.MatchString(key) {
+				return fmt.Errorf("invalid label key %q: use up to %d letters, digits, '_', '.', '-' or '/'", key, maxLabelKeyLength)
+			}
+			if len(strings.TrimSpace(value)) > maxLabelValueLength {
+				return fmt.Errorf("value of label %q is longer than %d characters", key, maxLabelValueLength)
+			}
+		}
+	}
+	if req.Notes != nil && len(strings.TrimSpace(*req.Notes)) > maxBackupNotesLength {
+		return fmt.Errorf("notes are longer than %d characters", maxBackupNotesLength)
+	}
+	return nil
+}
+
+// parseBackupListOptions reads the catalog filters from the query string.
+// Labels are given as label=key or label=key=value and may be repeated. from
+// and to accept RFC3339 times or dates; a date in to includes the whole day.
+func parseBackupListOptions(query url.Values, userID uuid.UUID) (BackupListOptions, error) {
+	opts := BackupListOptions{
+		UserID:       userID,
+		Search:       query.Get("search"),
+		ConnectionID: query.Get("connection_id"),
+		DatabaseName: query.Get("database"),
+		Status:       query.Get("status"),
+		ScheduleID:   query.Get("schedule_id"),
+		Sort:         BackupSortCreatedAt,
+		Order:        SortOrderDesc,
+	}
+
+	for _, label := range query["label"] {
+		key, value, hasValue := strings.Cut(label, "=")
+		filter := LabelFilter{Key: strings.TrimSpace(key)}
+		if filter.Key == "" {
+			return opts, fmt.Errorf("invalid label filter %q", label)
+		}
+		if hasValue {
+			value = strings.TrimSpace(value)
+			filter.Value = &value
+		}
+		opts.Labels = append(opts.Labels, filter)
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, _, err := parseCatalogTime(from)
+		if err != nil {
+			return opts, fmt.Errorf("invalid from: %v", err)
+		}
+		opts.CreatedAfter = &t
+	}
+	if to := query.Get("to"); to != "" {
+		t, dateOnly, err := parseCatalogTime(to)
+		if err != nil {
+			return opts, fmt.Errorf("invalid to: %v", err)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		opts.CreatedBefore = &t
+	}
+
+	var err error
+	if opts.MinSize, err = parseSizeParam(query, "min_size"); err != nil {
+		return opts, err
+	}
+	if opts.MaxSize, err = parseSizeParam(query, "max_size"); err != nil {
+		return opts, err
+	}
+
+	if sortBy := query.Get("sort"); sortBy != "" {
+		if _, ok := backupListSortColumns[sortBy]; !ok {
+			return opts, fmt.Errorf("invalid sort %q", sortBy)
+		}
+		opts.Sort = sortBy
+	}
+	if order := strings.ToLower(query.Get("order")); order != "" {
+		if order != SortOrderAsc && order != SortOrderDesc {
+			return opts, fmt.Errorf("invalid order %q: use asc or desc", order)
+		}
+		opts.Order = order
+	}
+
+	return opts, nil
+}
+
+func parseSizeParam(query url.Values, name string) (*int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return &size, nil
+}
+
+func parseCatalogTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%q is neither an RFC3339 time nor a date", value)
+	}
+	return t, true, nil
+}
+
+// formatLabels renders labels as sorted key=value pairs for the CSV export
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+func backupExportRecord(backup *BackupList) []string {
+	return []string{
+		backup.ID.String(),
+		backup.ConnectionID,
+		backup.DatabaseType,
+		backup.DatabaseName,
+		stringOrEmpty(backup.ScheduleID),
+		backup.Status,
+		backup.Path,
+		stringOrEmpty(backup.S3Bucket),
+		stringOrEmpty(backup.S3ObjectKey),
+		backup.StorageTier,
+		backup.Compression,
+		strconv.FormatInt(backup.Size, 10),
+		backup.StartedTime,
+		backup.CompletedTime,
+		backup.CreatedAt,
+		strconv.FormatBool(backup.Pinned),
+		strconv.FormatBool(backup.LegalHold),
+		escapeCSVFormula(formatLabels(backup.Labels)),
+		escapeCSVFormula(stringOrEmpty(backup.Notes)),
+		strconv.FormatBool(backup.Masked),
+		strconv.FormatBool(backup.Imported),
+		stringOrEmpty(backup.Checksum),
+		stringOrEmpty(backup.Format),
+	}
+}
+
+// escapeCSVFormula keeps spreadsheets from evaluating user entered text that
+// starts like a formula
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func (h *BackupHandler) UpdateBackupMetadata(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	var req UpdateBackupMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateBackupMetadata(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backup, err := h.backupService.UpdateBackupMetadata(userID, backupID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup updated successfully", backup)
+}
+
+// ExportBackups downloads the filtered backup catalog as CSV or JSON. It takes
+// the same filters as ListBackups but isn't paginated.
+func (h *BackupHandler) ExportBackups(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, err := parseBackupListOptions(r.URL.Query(), userID)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = ExportFormatCSV
+	}
+	if format != ExportFormatCSV && format != ExportFormatJSON {
+		response.SendError(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	backups, err := h.backupService.ExportBackups(opts)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("backups_%s.%s", time.Now().Format("20060102_150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == ExportFormatJSON {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(backups); err != nil {
+			fmt.Printf("Warning: Failed to write backup export: %v\n", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	if err := writer.Write(backupExportHeader); err != nil {
+		fmt.Printf("Warning: Failed to write backup export: %v\n", err)
+		return
+	}
+	for _, backup := range backups {
+		if err := writer.Write(backupExportRecord(backup)); err != nil {
+			fmt.Printf("Warning: Failed to write backup export: %v\n", err)
+			return
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		fmt.Printf("Warning: Failed to write backup export: %v\n", err)
+	}
+}
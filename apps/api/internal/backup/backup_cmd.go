@@ -58,6 +58,42 @@ func (s *BackupService) setupSSHTunnelIfNeeded(conn *connection.StoredConnection
 	return tunnel, "127.0.0.1", tunnel.GetLocalPort(), nil
 }
 
+// createDumpCmd builds the dump command for the connection's database type.
+// A nil command means the backup tool could not be found.
+func (s *BackupService) createDumpCmd(conn *connection.StoredConnection, outputPath string, options BackupOptions) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	switch conn.Type {
+	case "postgresql":
+		cmd = s.createPgDumpCmd(conn, outputPath)
+	case "mysql", "mariadb":
+		cmd = s.createMySQLDumpCmd(conn, outputPath)
+	case "mongodb":
+		cmd = s.createMongoDumpCmd(conn, outputPath)
+	case "redis":
+		cmd = s.createRedisDumpCmd(conn, outputPath)
+	default:
+		return nil, fmt.Errorf("unsupported database type for backup: %s", conn.Type)
+	}
+
+	// mongodump writes a directory rather than a single file
+	if options.Compression != CompressionNone && conn.Type == "mongodb" {
+		return nil, fmt.Errorf("compressed backups are not supported for %s", conn.Type)
+	}
+
+	if cmd != nil && options.SchemaOnly {
+		switch conn.Type {
+		case "postgresql":
+			cmd.Args = append(cmd.Args, "--schema-only")
+		case "mysql", "mariadb":
+			cmd.Args = append(cmd.Args, "--no-data")
+		default:
+			return nil, fmt.Errorf("schema-only backups are not supported for %s", conn.Type)
+		}
+	}
+
+	return cmd, nil
+}
+
 func (s *BackupService) createPgDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
 	binaryPath := s.findDatabaseBinaryPath("postgresql")
 	if binaryPath == "" {
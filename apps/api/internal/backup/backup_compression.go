@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats a dump file can be stored in. An empty compression
+// keeps the plain dump.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+func validateCompression(compression string) error {
+	switch compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("invalid compression %q: must be %q or %q", compression, CompressionGzip, CompressionZstd)
+}
+
+// compressionExtension returns the suffix added to compressed backup files
+func compressionExtension(compression string) string {
+	switch compression {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// dumpPath returns where the dump tool writes a backup before it is
+// compressed into backupPath
+func dumpPath(backupPath, compression string) string {
+	return strings.TrimSuffix(backupPath, compressionExtension(compression))
+}
+
+// compressBackupFile compresses the dump at src into dst and removes src
+func compressBackupFile(src, dst, compression string) error {
+	if compression == CompressionNone {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := compressStream(out, in, compression); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("failed to compress backup: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
+
+func compressStream(w io.Writer, r io.Reader, compression string) error {
+	var encoder io.WriteCloser
+	switch compression {
+	case CompressionGzip:
+		encoder = gzip.NewWriter(w)
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		encoder = zw
+	default:
+		return validateCompression(compression)
+	}
+
+	if _, err := io.Copy(encoder, r); err != nil {
+		encoder.Close()
+		return err
+	}
+	return encoder.Close()
+}
+
+// openDecompressed opens a backup file for reading its plain dump. The
+// returned function closes it.
+func openDecompressed(path, compression string) (io.Reader, func(), error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch compression {
+	case CompressionNone:
+		return in, func() { in.Close() }, nil
+	case CompressionGzip:
+		gr, err := gzip.NewReader(in)
+		if err != nil {
+			in.Close()
+			return nil, nil, fmt.Errorf("failed to read gzip backup: %w", err)
+		}
+		return gr, func() { gr.Close(); in.Close() }, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(in)
+		if err != nil {
+			in.Close()
+			return nil, nil, fmt.Errorf("failed to read zstd backup: %w", err)
+		}
+		return zr, func() { zr.Close(); in.Close() }, nil
+	default:
+		in.Close()
+		return nil, nil, validateCompression(compression)
+	}
+}
+
+// decompressedBackupFile returns the path of a plain copy of a backup file for
+// tools that read dumps directly. Uncompressed files are returned as is; the
+// release function removes the temporary copy otherwise.
+func decompressedBackupFile(path, compression string) (string, func(), error) {
+	if compression == CompressionNone {
+		return path, func() {}, nil
+	}
+
+	decoder, closeDecoder, err := openDecompressed(path, compression)
+	if err != nil {
+		return "", nil, err
+	}
+	defer closeDecoder()
+
+	out, err := os.CreateTemp("", "velld-restore-*.sql")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, err := io.Copy(out, decoder); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", nil, err
+	}
+
+	return out.Name(), func() { os.Remove(out.Name()) }, nil
+}
+
+// fileChecksum returns the hex SHA-256 of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// backupChecksum checksums a finished backup file. A backup without a
+// checksum is still usable, so failures only leave it unset.
+func backupChecksum(path string) *string {
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		fmt.Printf("Warning: Failed to checksum backup %s: %v\n", path, err)
+		return nil
+	}
+	return &checksum
+}
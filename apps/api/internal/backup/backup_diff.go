@@ -53,31 +53,33 @@ func (h *BackupHandler) CompareBackups(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure both backup files are available (local or download from S3)
-	sourceFilePath, sourceIsTemp, err := h.backupService.ensureBackupFileAvailable(sourceBackup, userID)
+	sourceFilePath, releaseSource, err := h.backupService.ensureBackupFileAvailable(sourceBackup, userID)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to access source backup: %v", err))
 		return
 	}
+	defer releaseSource()
 
-	targetFilePath, targetIsTemp, err := h.backupService.ensureBackupFileAvailable(targetBackup, userID)
+	targetFilePath, releaseTarget, err := h.backupService.ensureBackupFileAvailable(targetBackup, userID)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to access target backup: %v", err))
 		return
 	}
+	defer releaseTarget()
 
-	// Clean up temp files after comparison
-	defer func() {
-		if sourceIsTemp {
-			if err := os.Remove(sourceFilePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp source file %s: %v\n", sourceFilePath, err)
-			}
-		}
-		if targetIsTemp {
-			if err := os.Remove(targetFilePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp target file %s: %v\n", targetFilePath, err)
-			}
-		}
-	}()
+	sourceFilePath, releaseSourcePlain, err := decompressedBackupFile(sourceFilePath, sourceBackup.Compression)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read source backup: %v", err))
+		return
+	}
+	defer releaseSourcePlain()
+
+	targetFilePath, releaseTargetPlain, err := decompressedBackupFile(targetFilePath, targetBackup.Compression)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read target backup: %v", err))
+		return
+	}
+	defer releaseTargetPlain()
 
 	sourceContent, err := readBackupFile(sourceFilePath)
 	if err != nil {
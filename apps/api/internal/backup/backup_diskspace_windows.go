@@ -0,0 +1,9 @@
+package backup
+
+import "errors"
+
+// freeDiskSpace isn't implemented on Windows, where the preflight skips its
+// disk space check
+func freeDiskSpace(path string) (int64, error) {
+	return 0, errors.New("free disk space can't be checked on Windows")
+}
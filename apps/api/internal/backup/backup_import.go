@@ -0,0 +1,361 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+)
+
+const (
+	// formatSniffBytes is how much of a dump is read to detect its format
+	formatSniffBytes = 64 * 1024
+	// maxUploadFieldBytes limits the form fields sent with an upload
+	maxUploadFieldBytes = 16 * 1024
+)
+
+var (
+	errImportInvalid = errors.New("invalid backup upload")
+	errImportNoSpace = errors.New("not enough disk space to store the upload")
+)
+
+// Magic bytes of compressed and non-SQL dumps
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	rdbMagic  = []byte("REDIS")
+)
+
+var (
+	// sqlDumpPattern matches the statements plain dumps start with
+	sqlDumpPattern = regexp.MustCompile(`(?im)^\s*(?:--|/\*|\\connect\s|(?:SET|CREATE|INSERT|COPY|DROP|ALTER|USE|LOCK\s+TABLES|START\s+TRANSACTION|BEGIN|SELECT)\b)`)
+	// pgDumpMarker and mysqlDumpMarker match the headers and statements only
+	// one dump tool writes
+	pgDumpMarker    = regexp.MustCompile(`(?m)^-- (?:PostgreSQL database (?:cluster )?dump|Dumped by pg_dump)|^SET standard_conforming_strings|^\\connect |^COPY .+ FROM stdin;`)
+	mysqlDumpMarker = regexp.MustCompile(`(?m)^-- (?:MySQL|MariaDB) dump|^/\*!\d{5} |\) ENGINE=`)
+)
+
+// importFormats lists the dump formats each database type restores from
+var importFormats = map[string][]string{
+	"postgresql": {BackupFormatSQL, BackupFormatPgCustom},
+	"mysql":      {BackupFormatSQL},
+	"mariadb":    {BackupFormatSQL},
+	"mongodb":    {BackupFormatMongoArchive},
+	"redis":      {BackupFormatRDB},
+}
+
+// ImportBackup stores an uploaded dump as a backup of a connection. The file
+// is streamed to disk, its format detected and checked against the
+// connection, and it is then stored and uploaded like a backup Velld took.
+func (s *BackupService) ImportBackup(userID uuid.UUID, req *ImportBackupRequest, file io.Reader, sizeHint int64) (*Backup, error) {
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	formats, ok := importFormats[conn.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: backups can't be imported for %s connections", errImportInvalid, conn.Type)
+	}
+
+	// The upload lands next to the backups, so storing it is a rename
+	root := s.localBackupRoot(conn)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create connection backup folder: %v", err)
+	}
+	if sizeHint > 0 {
+		if free, err := freeDiskSpace(root); err == nil && free < sizeHint {
+			return nil, errImportNoSpace
+		}
+	}
+
+	tmp, err := os.CreateTemp(root, ".velld-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to store upload: %v", err)
+	}
+	tmpPath := tmp.Name()
+	stored := false
+	defer func() {
+		if !stored {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive upload: %v", err)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("%w: the uploaded file is empty", errImportInvalid)
+	}
+
+	compression, format, family, err := detectDumpFormat(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(formats, format) {
+		return nil, fmt.Errorf("%w: a %s dump can't be restored into a %s connection", errImportInvalid, format, conn.Type)
+	}
+	if family != "" && restoreFamily(family) != restoreFamily(conn.Type) {
+		return nil, fmt.Errorf("%w: the dump was taken from %s, not %s", errImportInvalid, family, conn.Type)
+	}
+	if format == BackupFormatSQL {
+		if err := checkDumpSingleDatabase(tmpPath, compression, conn.Type); err != nil {
+			return nil, err
+		}
+	}
+
+	takenAt := time.Now()
+	if req.TakenAt != nil {
+		takenAt = *req.TakenAt
+	}
+	database := strings.TrimSpace(req.DatabaseName)
+	if database == "" {
+		database = conn.DatabaseName
+	}
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	backup := &Backup{
+		ID:            uuid.New(),
+		ConnectionID:  conn.ID,
+		DatabaseName:  database,
+		Status:        "completed",
+		StorageTier:   StorageTierLocal,
+		Compression:   compression,
+		Size:          size,
+		StartedTime:   takenAt,
+		CompletedTime: &takenAt,
+		// Retention counts the age of an imported backup from when it was taken
+		CreatedAt: takenAt,
+		UpdatedAt: time.Now(),
+		Checksum:  &checksum,
+		Imported:  true,
+		Format:    &format,
+	}
+	if name := filepath.Base(req.Filename); req.Filename != "" && name != "." && name != string(filepath.Separator) {
+		backup.OriginalFilename = &name
+	}
+
+	backupPath, err := s.prepareBackupPath(conn, backup)
+	if err != nil {
+		return nil, err
+	}
+	// Temporary files are private, backups are readable like the dump tools write them
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return nil, fmt.Errorf("failed to store upload: %v", err)
+	}
+	if err := os.Rename(tmpPath, backupPath); err != nil {
+		return nil, fmt.Errorf("failed to store upload: %v", err)
+	}
+	stored = true
+
+	// The row goes in before the upload, so an S3 object never exists
+	// without a catalog entry; object lock may keep it from being deleted
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		os.Remove(backupPath)
+		return nil, fmt.Errorf("failed to save backup: %v", err)
+	}
+
+	if err := s.uploadToS3IfEnabled(backup, conn, backupRunOptions{}); err != nil {
+		fmt.Printf("Warning: Failed to upload backup to S3: %v\n", err)
+	}
+	if backup.S3ObjectKey != nil {
+		if err := s.backupRepo.UpdateBackupStorage(backup); err != nil {
+			fmt.Printf("Warning: Failed to record S3 location of backup %s: %v\n", backup.ID, err)
+		}
+	}
+
+	if req.Metadata.Labels != nil || req.Metadata.Notes != nil {
+		return s.UpdateBackupMetadata(userID, backup.ID.String(), &req.Metadata)
+	}
+	return backup, nil
+}
+
+// detectDumpFormat reads the start of a dump and returns how it is
+// compressed, its format and, for SQL dumps that say so, the database type
+// it was taken from
+func detectDumpFormat(path string) (compression, format, family string, err error) {
+	compression = CompressionNone
+	switch {
+	case hasFilePrefix(path, gzipMagic):
+		compression = CompressionGzip
+	case hasFilePrefix(path, zstdMagic):
+		compression = CompressionZstd
+	}
+
+	reader, closeReader, err := openDecompressed(path, compression)
+	if err != nil {
+		return "", "", "", fmt.Errorf("%w: %v", errImportInvalid, err)
+	}
+	defer closeReader()
+
+	head := make([]byte, formatSniffBytes)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", "", "", fmt.Errorf("%w: failed to read the dump: %v", errImportInvalid, err)
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, pgCustomDumpMagic):
+		return compression, BackupFormatPgCustom, "postgresql", nil
+	case bytes.HasPrefix(head, mongoArchiveMagic):
+		return compression, BackupFormatMongoArchive, "mongodb", nil
+	case bytes.HasPrefix(head, rdbMagic):
+		return compression, BackupFormatRDB, "redis", nil
+	case bytes.IndexByte(head, 0) < 0 && sqlDumpPattern.Match(head):
+		switch {
+		case pgDumpMarker.Match(head):
+			family = "postgresql"
+		case mysqlDumpMarker.Match(head):
+			family = "mysql"
+		}
+		return compression, BackupFormatSQL, family, nil
+	}
+	return "", "", "", fmt.Errorf("%w: the file isn't a plain SQL dump, pg_dump custom archive, MongoDB archive or Redis RDB file", errImportInvalid)
+}
+
+// checkDumpSingleDatabase rejects SQL dumps that create or switch databases
+// by name. Restoring one would write into the databases it names, which may
+// be production, rather than the database the restore targets.
+func checkDumpSingleDatabase(path, compression, dbType string) error {
+	reader, closeReader, err := openDecompressed(path, compression)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errImportInvalid, err)
+	}
+	defer closeReader()
+
+	switches, err := dumpDatabaseSwitches(reader, dbType)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errImportInvalid, err)
+	}
+	if len(switches) > 0 {
+		return fmt.Errorf("%w: the dump selects databases by name (%s), so a restore wouldn't stay in its target database. Dump a single database without pg_dumpall, --create or --databases",
+			errImportInvalid, strings.Join(switches, "; "))
+	}
+	return nil
+}
+
+// setImportField copies one form field of an upload onto the request
+func setImportField(req *ImportBackupRequest, name, value string) error {
+	switch name {
+	case "connection_id":
+		req.ConnectionID = strings.TrimSpace(value)
+	case "database_name":
+		req.DatabaseName = strings.TrimSpace(value)
+	case "taken_at":
+		takenAt, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("taken_at must be an RFC 3339 time")
+		}
+		if takenAt.After(time.Now()) {
+			return fmt.Errorf("taken_at must not be in the future")
+		}
+		req.TakenAt = &takenAt
+	case "notes":
+		req.Metadata.Notes = &value
+	case "labels":
+		var labels map[string]string
+		if err := json.Unmarshal([]byte(value), &labels); err != nil {
+			return fmt.Errorf("labels must be a JSON object of strings")
+		}
+		req.Metadata.Labels = &labels
+	}
+	return nil
+}
+
+// UploadBackup imports a dump sent as multipart/form-data. The form fields
+// connection_id, database_name, taken_at, notes and labels must come before
+// the file part, which is streamed to disk without being buffered.
+func (h *BackupHandler) UploadBackup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, "expected a multipart/form-data upload")
+		return
+	}
+
+	var req ImportBackupRequest
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			response.SendError(w, http.StatusBadRequest, fmt.Sprintf("failed to read upload: %v", err))
+			return
+		}
+
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, maxUploadFieldBytes+1))
+			if err != nil {
+				response.SendError(w, http.StatusBadRequest, fmt.Sprintf("failed to read upload: %v", err))
+				return
+			}
+			if len(value) > maxUploadFieldBytes {
+				response.SendError(w, http.StatusBadRequest, fmt.Sprintf("form field %s is too long", part.FormName()))
+				return
+			}
+			if err := setImportField(&req, part.FormName(), string(value)); err != nil {
+				response.SendError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			continue
+		}
+
+		if req.ConnectionID == "" {
+			response.SendError(w, http.StatusBadRequest, "connection_id is required and must come before the file")
+			return
+		}
+		if err := validateBackupMetadata(&req.Metadata); err != nil {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Filename = part.FileName()
+
+		backup, err := h.backupService.ImportBackup(userID, &req, part, r.ContentLength)
+		if err != nil {
+			switch {
+			case err == sql.ErrNoRows:
+				response.SendError(w, http.StatusNotFound, "Connection not found")
+			case errors.Is(err, errImportInvalid):
+				response.SendError(w, http.StatusBadRequest, err.Error())
+			case err == errImportNoSpace:
+				response.SendError(w, http.StatusInsufficientStorage, err.Error())
+			default:
+				response.SendError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		response.SendSuccess(w, "Backup imported successfully", backup)
+		return
+	}
+
+	response.SendError(w, http.StatusBadRequest, "file is required")
+}
@@ -0,0 +1,192 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeDump writes content to a file in dir, compressed as asked
+func writeDump(t *testing.T, dir string, content []byte, compression string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	switch compression {
+	case CompressionGzip:
+		writer := gzip.NewWriter(&buf)
+		writer.Write(content)
+		writer.Close()
+	case CompressionZstd:
+		writer, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(content)
+		writer.Close()
+	default:
+		buf.Write(content)
+	}
+
+	path := filepath.Join(dir, "dump")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDetectDumpFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     []byte
+		compression string
+		format      string
+		family      string
+		wantErr     bool
+	}{
+		{
+			name:    "pg_dump plain",
+			content: []byte("--\n-- PostgreSQL database dump\n--\n\nSET statement_timeout = 0;\n"),
+			format:  BackupFormatSQL,
+			family:  "postgresql",
+		},
+		{
+			name:        "gzipped mysqldump",
+			content:     []byte("-- MySQL dump 10.13  Distrib 8.0.36\n/*!40101 SET NAMES utf8mb4 */;\n"),
+			compression: CompressionGzip,
+			format:      BackupFormatSQL,
+			family:      "mysql",
+		},
+		{
+			name:        "zstd compressed SQL of unknown origin",
+			content:     []byte("BEGIN;\nINSERT INTO t VALUES (1);\nCOMMIT;\n"),
+			compression: CompressionZstd,
+			format:      BackupFormatSQL,
+		},
+		{
+			name:    "pg_dump custom archive",
+			content: append([]byte("PGDMP"), 1, 14, 0),
+			format:  BackupFormatPgCustom,
+			family:  "postgresql",
+		},
+		{
+			name:        "gzipped mongodump archive",
+			content:     append(append([]byte{}, mongoArchiveMagic...), 0, 0, 0),
+			compression: CompressionGzip,
+			format:      BackupFormatMongoArchive,
+			family:      "mongodb",
+		},
+		{
+			name:    "redis rdb",
+			content: []byte("REDIS0011\xfa\x09redis-ver"),
+			format:  BackupFormatRDB,
+			family:  "redis",
+		},
+		{
+			name:    "text that isn't SQL",
+			content: []byte("hello world\n"),
+			wantErr: true,
+		},
+		{
+			name:    "binary with SQL-looking text",
+			content: []byte("SELECT 1;\x00\x01\x02"),
+			wantErr: true,
+		},
+		{
+			name:    "empty file",
+			content: nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeDump(t, t.TempDir(), tt.content, tt.compression)
+			compression, format, family, err := detectDumpFormat(path)
+			if tt.wantErr {
+				if !errors.Is(err, errImportInvalid) {
+					t.Fatalf("error = %v, want errImportInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantCompression := tt.compression
+			if wantCompression == "" {
+				wantCompression = CompressionNone
+			}
+			if compression != wantCompression || format != tt.format || family != tt.family {
+				t.Errorf("detectDumpFormat = %q, %q, %q, want %q, %q, %q",
+					compression, format, family, wantCompression, tt.format, tt.family)
+			}
+		})
+	}
+}
+
+func TestDumpDatabaseSwitches(t *testing.T) {
+	tests := []struct {
+		name   string
+		dump   string
+		dbType string
+		want   []string
+	}{
+		{
+			name:   "single postgres database",
+			dump:   "SET statement_timeout = 0;\nCREATE TABLE public.users (id integer);\n",
+			dbType: "postgresql",
+		},
+		{
+			name:   "pg_dump --create",
+			dump:   "CREATE DATABASE app WITH TEMPLATE = template0;\n\\connect app\nCREATE TABLE users (id integer);\n",
+			dbType: "postgresql",
+			want:   []string{"CREATE DATABASE app WITH TEMPLATE = template0;", "\\connect app"},
+		},
+		{
+			name:   "COPY data is skipped",
+			dump:   "COPY public.notes (body) FROM stdin;\nCREATE DATABASE x;\n\\c x\n\\.\nSELECT 1;\n",
+			dbType: "postgresql",
+		},
+		{
+			name:   "mysqldump --databases",
+			dump:   "/*!40000 DROP DATABASE IF EXISTS `app`*/;\nCREATE DATABASE /*!32312 IF NOT EXISTS*/ `app`;\nUSE `app`;\n",
+			dbType: "mysql",
+			want:   []string{"CREATE DATABASE /*!32312 IF NOT EXISTS*/ `app`;", "USE `app`;"},
+		},
+		{
+			name:   "mysql switch inside a version comment",
+			dump:   "/*!40000 USE `app` */;\n",
+			dbType: "mysql",
+			want:   []string{"USE `app`"},
+		},
+		{
+			name:   "strings that look like switches",
+			dump:   "INSERT INTO notes VALUES ('\nUSE app;\nCREATE DATABASE x;\n');\n",
+			dbType: "mysql",
+		},
+		{
+			name:   "reports at most a few statements",
+			dump:   strings.Repeat("USE `app`;\n", maxDatabaseSwitches+2),
+			dbType: "mysql",
+			want:   strings.Split(strings.Repeat("USE `app`;\n", maxDatabaseSwitches), "\n")[:maxDatabaseSwitches],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dumpDatabaseSwitches(strings.NewReader(tt.dump), tt.dbType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dumpDatabaseSwitches = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
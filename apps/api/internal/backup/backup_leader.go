@@ -0,0 +1,243 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// schedulerLeaseName identifies the lease replicas compete for
+	schedulerLeaseName = "backup-scheduler"
+	// schedulerLeaseTTL is how long a lease outlives its last renewal, so a
+	// crashed leader is replaced after at most this long
+	schedulerLeaseTTL = 45 * time.Second
+	// schedulerSyncInterval is how often the lease is renewed and cron jobs
+	// are reconciled with the schedules in the database
+	schedulerSyncInterval = 15 * time.Second
+	// scheduleClaimRetention is how long fire time claims are kept
+	scheduleClaimRetention = 7 * 24 * time.Hour
+)
+
+// Scheduler runs the cron jobs of backup schedules on exactly one replica.
+//
+// Replicas sharing a metadata database compete for a lease; the holder
+// registers a cron job for every enabled schedule and keeps them in sync with
+// the database, the others stay idle until the lease expires. Schedule changes
+// are only persisted by HTTP handlers and picked up by the leader on its next
+// sync. Every fire time is also claimed in the database before it runs, so a
+// run is never executed twice while leadership changes hands.
+type Scheduler struct {
+	repo       *BackupRepository
+	instanceID string
+
+	// fire runs a schedule for a fire time this replica has claimed
+	fire func(scheduleID string, fireTime time.Time)
+	// onElected runs when this replica becomes leader
+	onElected func()
+
+	cron    *cron.Cron
+	refresh chan struct{}
+
+	mu      sync.Mutex
+	leader  bool
+	entries map[string]cronEntry // map[scheduleID]entry
+}
+
+type cronEntry struct {
+	id cron.EntryID
+	// spec is the cron expression and timezone the job was registered with
+	spec string
+}
+
+func NewScheduler(repo *BackupRepository, fire func(scheduleID string, fireTime time.Time), onElected func()) *Scheduler {
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		repo:       repo,
+		instanceID: fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+		fire:       fire,
+		onElected:  onElected,
+		cron:       cron.New(cron.WithSeconds()),
+		refresh:    make(chan struct{}, 1),
+		entries:    make(map[string]cronEntry),
+	}
+}
+
+// Start tries to take the lease once before returning, so a single replica
+// has its jobs registered right away, then keeps renewing it in the background
+func (sc *Scheduler) Start() {
+	sc.tick()
+	sc.cron.Start()
+	go sc.run()
+}
+
+// Refresh asks the scheduler to pick up schedule changes without waiting for
+// the next sync
+func (sc *Scheduler) Refresh() {
+	select {
+	case sc.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// IsLeader reports whether this replica currently holds the scheduler lease
+func (sc *Scheduler) IsLeader() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.leader
+}
+
+// Claim records that this replica runs a schedule's fire time, returning
+// false when another replica already did
+func (sc *Scheduler) Claim(scheduleID string, fireTime time.Time) bool {
+	claimed, err := sc.repo.ClaimScheduleFire(scheduleID, fireTime, sc.instanceID)
+	if err != nil {
+		fmt.Printf("Warning: Failed to claim run of schedule %s at %s: %v\n",
+			scheduleID, fireTime.Format(time.RFC3339), err)
+		return false
+	}
+	return claimed
+}
+
+func (sc *Scheduler) run() {
+	ticker := time.NewTicker(schedulerSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-sc.refresh:
+		}
+		sc.tick()
+	}
+}
+
+func (sc *Scheduler) tick() {
+	held, err := sc.repo.AcquireLease(schedulerLeaseName, sc.instanceID, schedulerLeaseTTL)
+	if err != nil {
+		// Without a renewal the lease may expire, so stop acting as leader
+		fmt.Printf("Warning: Failed to renew scheduler lease: %v\n", err)
+		held = false
+	}
+
+	sc.mu.Lock()
+	wasLeader := sc.leader
+	sc.leader = held
+	sc.mu.Unlock()
+
+	switch {
+	case held && !wasLeader:
+		fmt.Printf("Scheduler %s acquired the lease and is running schedules\n", sc.instanceID)
+		sc.onElected()
+	case !held && wasLeader:
+		fmt.Printf("Scheduler %s lost the lease and stopped running schedules\n", sc.instanceID)
+		sc.removeAll()
+	}
+
+	if held {
+		sc.sync()
+		sc.fireDeferred()
+	}
+}
+
+// fireDeferred runs the schedule runs blackout windows deferred to a time
+// that has passed. They are stored on the schedule rather than kept in
+// memory, so a restart or a new leader still runs them.
+func (sc *Scheduler) fireDeferred() {
+	due, err := sc.repo.GetDueDeferredRuns(time.Now())
+	if err != nil {
+		fmt.Printf("Error loading deferred runs: %v\n", err)
+		return
+	}
+
+	for scheduleID, at := range due {
+		fireTime := at.Truncate(time.Second)
+		claimed := sc.Claim(scheduleID, fireTime)
+
+		// Cleared before firing, since the run may be deferred again
+		if err := sc.repo.ClearDeferredRun(scheduleID); err != nil {
+			fmt.Printf("Warning: Failed to clear deferred run of schedule %s: %v\n", scheduleID, err)
+			continue
+		}
+		if claimed {
+			go sc.fire(scheduleID, fireTime)
+		}
+	}
+}
+
+// sync registers, updates and removes cron jobs to match the enabled
+// schedules in the database
+func (sc *Scheduler) sync() {
+	schedules, err := sc.repo.GetAllActiveSchedules()
+	if err != nil {
+		fmt.Printf("Error loading schedules: %v\n", err)
+		return
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	active := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		scheduleID := schedule.ID.String()
+		spec := schedule.Timezone + " " + schedule.CronSchedule
+		active[scheduleID] = true
+
+		if entry, exists := sc.entries[scheduleID]; exists {
+			if entry.spec == spec {
+				continue
+			}
+			sc.cron.Remove(entry.id)
+			delete(sc.entries, scheduleID)
+		}
+
+		cronSchedule, err := parseCronSchedule(schedule.CronSchedule, schedule.Timezone)
+		if err != nil {
+			fmt.Printf("Error registering schedule %s: %v\n", scheduleID, err)
+			continue
+		}
+
+		var entryID cron.EntryID
+		entryID = sc.cron.Schedule(cronSchedule, cron.FuncJob(func() {
+			// IsLeader takes sc.mu, which sync holds while setting entryID
+			if !sc.IsLeader() {
+				return
+			}
+			// Claim the slot the job was scheduled for rather than the wall
+			// clock, so replicas with skewed clocks claim the same run
+			fireTime := sc.cron.Entry(entryID).Prev
+			if fireTime.IsZero() {
+				fireTime = time.Now().Truncate(time.Second)
+			}
+			if sc.Claim(scheduleID, fireTime) {
+				sc.fire(scheduleID, fireTime)
+			}
+		}))
+		sc.entries[scheduleID] = cronEntry{id: entryID, spec: spec}
+	}
+
+	for scheduleID, entry := range sc.entries {
+		if !active[scheduleID] {
+			sc.cron.Remove(entry.id)
+			delete(sc.entries, scheduleID)
+		}
+	}
+
+	if err := sc.repo.DeleteScheduleClaimsBefore(time.Now().Add(-scheduleClaimRetention)); err != nil {
+		fmt.Printf("Warning: Failed to prune schedule claims: %v\n", err)
+	}
+}
+
+func (sc *Scheduler) removeAll() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for scheduleID, entry := range sc.entries {
+		sc.cron.Remove(entry.id)
+		delete(sc.entries, scheduleID)
+	}
+}
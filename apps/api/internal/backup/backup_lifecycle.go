@@ -0,0 +1,314 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/audit"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/gorilla/mux"
+)
+
+// lifecycleInterval is how often lifecycle rules are enforced
+const lifecycleInterval = time.Hour
+
+// runLifecycleWorker periodically moves backups between storage tiers
+func (s *BackupService) runLifecycleWorker() {
+	ticker := time.NewTicker(lifecycleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Only the replica running schedules enforces lifecycle rules
+		if s.scheduler.IsLeader() {
+			s.enforceLifecycleRules()
+		}
+	}
+}
+
+func (s *BackupService) enforceLifecycleRules() {
+	rules, err := s.backupRepo.GetEnabledLifecycleRules()
+	if err != nil {
+		fmt.Printf("Error fetching lifecycle rules: %v\n", err)
+		return
+	}
+
+	for _, rule := range rules {
+		if err := s.applyLifecycleRule(rule); err != nil {
+			fmt.Printf("Error applying lifecycle rule for connection %s: %v\n", rule.ConnectionID, err)
+		}
+	}
+}
+
+func (s *BackupService) applyLifecycleRule(rule *LifecycleRule) error {
+	conn, err := s.connStorage.GetConnection(rule.ConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user settings: %w", err)
+	}
+
+	// Without S3 the local file is the only copy, so only expiry applies
+	var s3Storage *S3Storage
+	if s3Configured(userSettings) {
+		s3Storage, err = s.newS3StorageFromSettings(userSettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	backups, err := s.backupRepo.GetBackupsByConnectionID(rule.ConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get backups: %w", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	for _, backup := range backups {
+		if backup.Status != "completed" {
+			continue
+		}
+
+		age := now.Sub(backup.CreatedAt)
+
+		if rule.ArchiveDays > 0 && age > days(rule.ArchiveDays) && !backup.protected() {
+			if err := s.trashBackup(backup, conn, TrashReasonLifecycle, audit.ActorSystem); err != nil {
+				fmt.Printf("Warning: Failed to move expired backup %s to trash: %v\n", backup.ID, err)
+			}
+			continue
+		}
+
+		if s3Storage == nil {
+			continue
+		}
+
+		if rule.S3Days > 0 && age > days(rule.S3Days) && backup.StorageTier != StorageTierArchive && rule.archives() {
+			if err := s.archiveBackup(ctx, backup, conn, s3Storage, rule); err != nil {
+				if errors.Is(err, errObjectLocked) {
+					// Archived once its retention expires
+					fmt.Printf("Skipping archive of backup %s: S3 %v\n", backup.ID, err)
+				} else {
+					fmt.Printf("Warning: Failed to archive backup %s: %v\n", backup.ID, err)
+				}
+			}
+			continue
+		}
+
+		if rule.LocalDays > 0 && age > days(rule.LocalDays) && backup.StorageTier == StorageTierLocal {
+			if err := s.offloadBackup(ctx, backup, conn, s3Storage); err != nil {
+				fmt.Printf("Warning: Failed to move backup %s to S3: %v\n", backup.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// offloadBackup makes sure a backup is in S3 and removes the local copy
+func (s *BackupService) offloadBackup(ctx context.Context, backup *Backup, conn *connection.StoredConnection, s3Storage *S3Storage) error {
+	if err := s.ensureBackupInS3(ctx, backup, conn, s3Storage); err != nil {
+		return err
+	}
+
+	if err := os.Remove(backup.Path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove local file: %w", err)
+	}
+
+	backup.StorageTier = StorageTierS3
+	if err := s.backupRepo.UpdateBackupStorage(backup); err != nil {
+		return fmt.Errorf("failed to update backup storage: %w", err)
+	}
+
+	fmt.Printf("Moved backup %s to S3 tier (lifecycle)\n", backup.ID)
+	return nil
+}
+
+// archiveBackup moves a backup's S3 object to the archive bucket and/or
+// storage class and removes any local copy
+func (s *BackupService) archiveBackup(ctx context.Context, backup *Backup, conn *connection.StoredConnection, s3Storage *S3Storage, rule *LifecycleRule) error {
+	if err := s.ensureBackupInS3(ctx, backup, conn, s3Storage); err != nil {
+		return err
+	}
+
+	source := s3Storage.WithBucket(backup.s3BucketName())
+	destination := source
+	if rule.ArchiveBucket != nil && *rule.ArchiveBucket != "" {
+		destination = s3Storage.WithBucket(*rule.ArchiveBucket)
+		if err := destination.EnsureBucket(ctx); err != nil {
+			return err
+		}
+	}
+
+	storageClass := ""
+	if rule.ArchiveStorageClass != nil {
+		storageClass = *rule.ArchiveStorageClass
+	}
+
+	if err := source.TransitionObject(ctx, *backup.S3ObjectKey, destination, storageClass); err != nil {
+		return err
+	}
+
+	if err := os.Remove(backup.Path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: Failed to remove local file %s: %v\n", backup.Path, err)
+	}
+
+	if destination.Bucket() != s3Storage.Bucket() {
+		bucket := destination.Bucket()
+		backup.S3Bucket = &bucket
+	}
+	backup.StorageTier = StorageTierArchive
+	if err := s.backupRepo.UpdateBackupStorage(backup); err != nil {
+		return fmt.Errorf("failed to update backup storage: %w", err)
+	}
+
+	fmt.Printf("Moved backup %s to archive tier (lifecycle)\n", backup.ID)
+	return nil
+}
+
+// ensureBackupInS3 uploads a local-only backup so it can leave local disk
+func (s *BackupService) ensureBackupInS3(ctx context.Context, backup *Backup, conn *connection.StoredConnection, s3Storage *S3Storage) error {
+	if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" {
+		return nil
+	}
+
+	if _, err := os.Stat(backup.Path); err != nil {
+		return fmt.Errorf("backup has no S3 copy and local file is missing: %w", err)
+	}
+
+	relativeKey, err := s3RelativeKey(conn, backup)
+	if err != nil {
+		return fmt.Errorf("failed to render S3 object key: %w", err)
+	}
+
+	// Lock the object as long as an upload at the end of the run would have
+	opts := backupRunOptions{}
+	if backup.ScheduleID != nil {
+		schedule, err := s.backupRepo.GetBackupScheduleByID(*backup.ScheduleID)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to get backup schedule: %w", err)
+		}
+		if schedule != nil {
+			opts.ScheduleID = backup.ScheduleID
+			opts.RetentionDays = schedule.RetentionDays
+		}
+	}
+	retainUntil, err := s.objectRetainUntil(backup, opts)
+	if err != nil {
+		return fmt.Errorf("failed to compute object lock retention: %w", err)
+	}
+
+	objectKey, err := s3Storage.UploadFileAs(ctx, backup.Path, relativeKey, retainUntil)
+	if err != nil {
+		return fmt.Errorf("failed to upload backup to S3: %w", err)
+	}
+
+	backup.S3ObjectKey = &objectKey
+	return s.backupRepo.UpdateBackupStorage(backup)
+}
+
+func (r *LifecycleRule) archives() bool {
+	return (r.ArchiveStorageClass != nil && *r.ArchiveStorageClass != "") ||
+		(r.ArchiveBucket != nil && *r.ArchiveBucket != "")
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+func (s *BackupService) GetLifecycleRule(connectionID string) (*LifecycleRule, error) {
+	return s.backupRepo.GetLifecycleRule(connectionID)
+}
+
+func (s *BackupService) UpdateLifecycleRule(connectionID string, req *UpdateLifecycleRuleRequest) (*LifecycleRule, error) {
+	if _, err := s.connStorage.GetConnection(connectionID); err != nil {
+		return nil, err
+	}
+
+	rule := &LifecycleRule{
+		ConnectionID:        connectionID,
+		Enabled:             req.Enabled,
+		LocalDays:           req.LocalDays,
+		S3Days:              req.S3Days,
+		ArchiveDays:         req.ArchiveDays,
+		ArchiveStorageClass: req.ArchiveStorageClass,
+		ArchiveBucket:       req.ArchiveBucket,
+	}
+
+	if err := s.backupRepo.SaveLifecycleRule(rule); err != nil {
+		return nil, fmt.Errorf("failed to save lifecycle rule: %v", err)
+	}
+
+	return s.backupRepo.GetLifecycleRule(connectionID)
+}
+
+func validateLifecycleRule(req *UpdateLifecycleRuleRequest) error {
+	if req.LocalDays < 0 || req.S3Days < 0 || req.ArchiveDays < 0 {
+		return fmt.Errorf("lifecycle days must not be negative")
+	}
+	if req.LocalDays > 0 && req.S3Days > 0 && req.S3Days < req.LocalDays {
+		return fmt.Errorf("s3_days must be greater than or equal to local_days")
+	}
+	if req.ArchiveDays > 0 && req.ArchiveDays < max(req.LocalDays, req.S3Days) {
+		return fmt.Errorf("archive_days must be greater than or equal to local_days and s3_days")
+	}
+	archives := (req.ArchiveStorageClass != nil && *req.ArchiveStorageClass != "") ||
+		(req.ArchiveBucket != nil && *req.ArchiveBucket != "")
+	if req.S3Days > 0 && !archives {
+		return fmt.Errorf("archive_storage_class or archive_bucket is required when s3_days is set")
+	}
+	return nil
+}
+
+func (h *BackupHandler) GetLifecycleRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	rule, err := h.backupService.GetLifecycleRule(connectionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "No lifecycle rule found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Lifecycle rule retrieved successfully", rule)
+}
+
+func (h *BackupHandler) UpdateLifecycleRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	var req UpdateLifecycleRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateLifecycleRule(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule, err := h.backupService.UpdateLifecycleRule(connectionID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Lifecycle rule updated successfully", rule)
+}
@@ -0,0 +1,899 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxMaskingRules limits the rules of one profile
+	maxMaskingRules = 200
+	// maskedEmailHashLength is how much of the hash fake emails keep, enough
+	// to keep distinct addresses distinct
+	maskedEmailHashLength = 12
+	fakeEmailDomain       = "example.com"
+	// mongoMaskBatchSize is how many documents a bulk write updates
+	mongoMaskBatchSize = 500
+	// maskedFromLabel links a masked backup to the backup it was made from
+	maskedFromLabel = "masked_from"
+)
+
+var errMaskingProfileInvalid = errors.New("invalid masking profile")
+
+var maskingStrategies = map[string]bool{
+	MaskHash:       true,
+	MaskNull:       true,
+	MaskFakeEmail:  true,
+	MaskKeepDomain: true,
+	MaskTruncate:   true,
+}
+
+func (s *BackupService) ListMaskingProfiles(userID uuid.UUID) ([]*MaskingProfile, error) {
+	return s.backupRepo.GetMaskingProfilesByUserID(userID)
+}
+
+func (s *BackupService) GetMaskingProfile(userID uuid.UUID, id string) (*MaskingProfile, error) {
+	profile, err := s.backupRepo.GetMaskingProfile(id)
+	if err != nil {
+		return nil, err
+	}
+	if profile.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return profile, nil
+}
+
+func (s *BackupService) CreateMaskingProfile(userID uuid.UUID, req *MaskingProfileRequest) (*MaskingProfile, error) {
+	profile := &MaskingProfile{
+		ID:        uuid.New(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.applyMaskingProfileRequest(profile, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.CreateMaskingProfile(profile); err != nil {
+		return nil, fmt.Errorf("failed to save masking profile: %v", err)
+	}
+	return profile, nil
+}
+
+func (s *BackupService) UpdateMaskingProfile(userID uuid.UUID, id string, req *MaskingProfileRequest) (*MaskingProfile, error) {
+	profile, err := s.GetMaskingProfile(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyMaskingProfileRequest(profile, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.UpdateMaskingProfile(profile); err != nil {
+		return nil, fmt.Errorf("failed to update masking profile: %v", err)
+	}
+	return profile, nil
+}
+
+// DeleteMaskingProfile deletes a profile. Masked backups keep naming it, and
+// refresh pipelines using it fail until they are pointed at another one.
+func (s *BackupService) DeleteMaskingProfile(userID uuid.UUID, id string) error {
+	if _, err := s.GetMaskingProfile(userID, id); err != nil {
+		return err
+	}
+	return s.backupRepo.DeleteMaskingProfile(id)
+}
+
+// applyMaskingProfileRequest copies a request onto a profile, checking that
+// the connection belongs to the user and the rules fit its database type
+func (s *BackupService) applyMaskingProfileRequest(profile *MaskingProfile, req *MaskingProfileRequest) error {
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return err
+	}
+	if conn.UserID != profile.UserID {
+		return sql.ErrNoRows
+	}
+
+	for _, rule := range req.Rules {
+		switch conn.Type {
+		case "mongodb":
+			for _, part := range strings.Split(rule.Column, ".") {
+				if part == "" || strings.HasPrefix(part, "$") {
+					return fmt.Errorf("%w: %q is not a valid document field path", errMaskingProfileInvalid, rule.Column)
+				}
+			}
+		case "mysql", "mariadb":
+			if strings.Contains(rule.Table, ".") {
+				return fmt.Errorf("%w: MySQL tables are named without their database: %s", errMaskingProfileInvalid, rule.Table)
+			}
+		}
+	}
+
+	profile.ConnectionID = conn.ID
+	profile.Name = strings.TrimSpace(req.Name)
+	profile.Rules = req.Rules
+	profile.UpdatedAt = time.Now()
+	return nil
+}
+
+func validateMaskingProfileRequest(req *MaskingProfileRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.ConnectionID == "" {
+		return fmt.Errorf("connection_id is required")
+	}
+	if len(req.Rules) == 0 {
+		return fmt.Errorf("a masking profile needs at least one rule")
+	}
+	if len(req.Rules) > maxMaskingRules {
+		return fmt.Errorf("a masking profile can have at most %d rules", maxMaskingRules)
+	}
+
+	seen := make(map[string]bool)
+	for i := range req.Rules {
+		rule := &req.Rules[i]
+		rule.Table = strings.TrimSpace(rule.Table)
+		rule.Column = strings.TrimSpace(rule.Column)
+		rule.Strategy = strings.TrimSpace(rule.Strategy)
+		if rule.Table == "" || rule.Column == "" {
+			return fmt.Errorf("masking rule %d needs a table and a column", i+1)
+		}
+		if !maskingStrategies[rule.Strategy] {
+			return fmt.Errorf("masking rule %s.%s has unknown strategy %q", rule.Table, rule.Column, rule.Strategy)
+		}
+		if rule.Strategy == MaskTruncate && rule.Length < 1 {
+			return fmt.Errorf("masking rule %s.%s needs a length of at least 1 to truncate", rule.Table, rule.Column)
+		}
+		if rule.Strategy != MaskTruncate {
+			rule.Length = 0
+		}
+
+		key := strings.ToLower(rule.Table + "." + rule.Column)
+		if seen[key] {
+			return fmt.Errorf("%s.%s has more than one masking rule", rule.Table, rule.Column)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// ruleTable is the table a rule names
+func (rule MaskingRule) ruleTable() tableRef {
+	if schema, name, ok := strings.Cut(rule.Table, "."); ok {
+		return tableRef{schema: schema, name: name}
+	}
+	return tableRef{name: rule.Table}
+}
+
+// matches reports whether a rule applies to a table. Names compare without
+// case, and a rule without a schema applies in every schema.
+func (rule MaskingRule) matches(table tableRef) bool {
+	target := rule.ruleTable()
+	if !strings.EqualFold(target.name, table.name) {
+		return false
+	}
+	return target.schema == "" || strings.EqualFold(target.schema, table.schema)
+}
+
+// maskValue masks one non-NULL value. It returns nil when the value becomes
+// NULL. maskExpression computes the same values in SQL.
+func maskValue(rule MaskingRule, value string) *string {
+	var masked string
+	switch rule.Strategy {
+	case MaskNull:
+		return nil
+	case MaskHash:
+		masked = hashValue(value)
+	case MaskFakeEmail:
+		masked = fakeEmail(value)
+	case MaskKeepDomain:
+		if at := strings.Index(value, "@"); at >= 0 {
+			masked = "user_" + hashValue(value)[:maskedEmailHashLength] + value[at:]
+		} else {
+			masked = fakeEmail(value)
+		}
+	case MaskTruncate:
+		masked = value
+		if runes := []rune(value); len(runes) > rule.Length {
+			masked = string(runes[:rule.Length])
+		}
+	default:
+		masked = value
+	}
+	return &masked
+}
+
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func fakeEmail(value string) string {
+	return "user_" + hashValue(value)[:maskedEmailHashLength] + "@" + fakeEmailDomain
+}
+
+// maskExpression returns the SQL that masks a quoted column in place
+func maskExpression(dbType, column string, rule MaskingRule) string {
+	postgres := dbType == "postgresql"
+	text := "CAST(" + column + " AS CHAR)"
+	hash := "SHA2(" + text + ", 256)"
+	position := "LOCATE('@', " + text + ")"
+	concat := func(parts ...string) string { return "CONCAT(" + strings.Join(parts, ", ") + ")" }
+	if postgres {
+		text = column + "::text"
+		hash = "encode(sha256(convert_to(" + text + ", 'UTF8')), 'hex')"
+		position = "strpos(" + text + ", '@')"
+		concat = func(parts ...string) string { return "(" + strings.Join(parts, " || ") + ")" }
+	}
+	shortHash := fmt.Sprintf("LEFT(%s, %d)", hash, maskedEmailHashLength)
+	email := concat("'user_'", shortHash, "'@"+fakeEmailDomain+"'")
+
+	var expr string
+	switch rule.Strategy {
+	case MaskNull:
+		return "NULL"
+	case MaskHash:
+		expr = hash
+	case MaskFakeEmail:
+		expr = email
+	case MaskKeepDomain:
+		expr = fmt.Sprintf("CASE WHEN %s > 0 THEN %s ELSE %s END",
+			position, concat("'user_'", shortHash, "SUBSTR("+text+", "+position+")"), email)
+	case MaskTruncate:
+		expr = fmt.Sprintf("LEFT(%s, %d)", text, rule.Length)
+	default:
+		return column
+	}
+	return fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE %s END", column, expr)
+}
+
+// maskingProfileForRestore returns the profile a restore masks its target
+// with. It must belong to the user and to the backup's connection.
+func (s *BackupService) maskingProfileForRestore(userID uuid.UUID, backup *Backup, req *RestoreRequest) (*MaskingProfile, error) {
+	profile, err := s.GetMaskingProfile(userID, req.MaskingProfileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: masking profile not found", errMaskingProfileInvalid)
+		}
+		return nil, err
+	}
+	if profile.ConnectionID != backup.ConnectionID {
+		return nil, fmt.Errorf("%w: the masking profile belongs to another connection than the backup", errMaskingProfileInvalid)
+	}
+	if req.Objects != nil && len(req.Objects.Rename) > 0 {
+		return nil, fmt.Errorf("%w: renamed tables can't be masked, restore them under their own names", errMaskingProfileInvalid)
+	}
+	return profile, nil
+}
+
+// maskRestoredDatabase applies a masking profile to a database that was just
+// restored and returns a summary for the restore output. A rule naming a
+// column the table doesn't have fails, and so does a rule whose table a full
+// restore didn't bring back, so data is never left unmasked by a typo. Only
+// selective restores skip the rules of tables they didn't restore.
+func (s *BackupService) maskRestoredDatabase(profileID string, conn *connection.StoredConnection, database string, fullRestore bool) (string, error) {
+	profile, err := s.backupRepo.GetMaskingProfile(profileID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get masking profile: %v", err)
+	}
+
+	if conn.Type == "mongodb" {
+		return maskRestoredMongo(profile, conn, database, fullRestore)
+	}
+
+	db, err := openRestoreDB(conn, database)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to target database: %v", err)
+	}
+	defer db.Close()
+
+	targets, err := resolveMaskingTargets(db, conn.Type, profile.Rules, fullRestore)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var report strings.Builder
+	for _, target := range targets {
+		result, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s", target.name, strings.Join(target.assignments, ", ")))
+		if err != nil {
+			return "", fmt.Errorf("failed to mask %s: %v", target.name, err)
+		}
+		rows, _ := result.RowsAffected()
+		fmt.Fprintf(&report, "masked %d column(s) in %d row(s) of %s\n", len(target.assignments), rows, target.name)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return report.String(), nil
+}
+
+// maskingTarget is a restored table and the assignments that mask it
+type maskingTarget struct {
+	name        string
+	assignments []string
+}
+
+func resolveMaskingTargets(db *sql.DB, dbType string, rules []MaskingRule, fullRestore bool) ([]*maskingTarget, error) {
+	query := `SELECT '', table_name, column_name FROM information_schema.columns WHERE table_schema = DATABASE()`
+	quote := quoteMySQLIdentifier
+	if dbType == "postgresql" {
+		query = `SELECT table_schema, table_name, column_name FROM information_schema.columns
+			WHERE table_schema NOT IN ('pg_catalog', 'information_schema') AND table_schema NOT LIKE 'pg_toast%'`
+		quote = pq.QuoteIdentifier
+	}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list restored columns: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []tableRef
+	columns := make(map[tableRef][]string)
+	for rows.Next() {
+		var table tableRef
+		var column string
+		if err := rows.Scan(&table.schema, &table.name, &column); err != nil {
+			return nil, err
+		}
+		if _, ok := columns[table]; !ok {
+			tables = append(tables, table)
+		}
+		columns[table] = append(columns[table], column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var targets []*maskingTarget
+	matched := make([]bool, len(rules))
+	for _, table := range tables {
+		var target *maskingTarget
+		for i, rule := range rules {
+			if !rule.matches(table) {
+				continue
+			}
+			matched[i] = true
+			column := findColumn(columns[table], rule.Column)
+			if column == "" {
+				return nil, fmt.Errorf("masking rule %s.%s: table %s has no column %s", rule.Table, rule.Column, table.key(), rule.Column)
+			}
+			if target == nil {
+				name := quote(table.name)
+				if table.schema != "" {
+					name = quote(table.schema) + "." + name
+				}
+				target = &maskingTarget{name: name}
+				targets = append(targets, target)
+			}
+			quoted := quote(column)
+			target.assignments = append(target.assignments, quoted+" = "+maskExpression(dbType, quoted, rule))
+		}
+	}
+	if fullRestore {
+		if err := unmatchedMaskingRule(rules, matched, "table"); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// unmatchedMaskingRule fails for the first rule that matched no restored
+// table or collection
+func unmatchedMaskingRule(rules []MaskingRule, matched []bool, kind string) error {
+	for i, rule := range rules {
+		if !matched[i] {
+			return fmt.Errorf("masking rule %s.%s: the restore has no %s %s", rule.Table, rule.Column, kind, rule.Table)
+		}
+	}
+	return nil
+}
+
+// dropUnmaskedTarget drops a restored database whose masking failed, so a
+// failed restore doesn't leave unmasked production data on the target
+func dropUnmaskedTarget(conn *connection.StoredConnection, database string) error {
+	if conn.Type == "mongodb" {
+		client, err := connectRestoreMongo(conn)
+		if err != nil {
+			return err
+		}
+		defer client.Disconnect(context.Background())
+		return client.Database(database).Drop(context.Background())
+	}
+
+	db, err := openRestoreAdminDB(conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return dropRestoreDatabase(db, conn.Type, database)
+}
+
+// findColumn returns the column named like name, or ""
+func findColumn(columns []string, name string) string {
+	for _, column := range columns {
+		if strings.EqualFold(column, name) {
+			return column
+		}
+	}
+	return ""
+}
+
+// maskRestoredMongo masks the fields of restored documents. Fields inside
+// arrays are masked in every element.
+func maskRestoredMongo(profile *MaskingProfile, conn *connection.StoredConnection, database string, fullRestore bool) (string, error) {
+	client, err := connectRestoreMongo(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to target database: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	ctx := context.Background()
+	db := client.Database(database)
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list restored collections: %v", err)
+	}
+
+	matched := make([]bool, len(profile.Rules))
+	for _, name := range names {
+		for i, rule := range profile.Rules {
+			if rule.matches(tableRef{name: name}) {
+				matched[i] = true
+			}
+		}
+	}
+	// Check before writing anything, like the SQL databases do
+	if fullRestore {
+		if err := unmatchedMaskingRule(profile.Rules, matched, "collection"); err != nil {
+			return "", err
+		}
+	}
+
+	var report strings.Builder
+	for _, name := range names {
+		var rules []MaskingRule
+		for _, rule := range profile.Rules {
+			if rule.matches(tableRef{name: name}) {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == 0 {
+			continue
+		}
+
+		masked, err := maskMongoCollection(ctx, db.Collection(name), rules)
+		if err != nil {
+			return "", fmt.Errorf("failed to mask collection %s: %v", name, err)
+		}
+		fmt.Fprintf(&report, "masked %d document(s) of %s\n", masked, name)
+	}
+	return report.String(), nil
+}
+
+func maskMongoCollection(ctx context.Context, collection *mongo.Collection, rules []MaskingRule) (int, error) {
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	masked := 0
+	var models []mongo.WriteModel
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		_, err := collection.BulkWrite(ctx, models)
+		models = models[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return masked, err
+		}
+
+		set := bson.M{}
+		for _, rule := range rules {
+			path := strings.Split(rule.Column, ".")
+			if value, changed := maskDocumentPath(doc[path[0]], path[1:], rule); changed {
+				doc[path[0]] = value
+				set[path[0]] = value
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc["_id"]}).
+			SetUpdate(bson.M{"$set": set}))
+		masked++
+		if len(models) >= mongoMaskBatchSize {
+			if err := flush(); err != nil {
+				return masked, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return masked, err
+	}
+	return masked, flush()
+}
+
+// maskDocumentPath masks the field at path below value and returns the new
+// value and whether anything changed
+func maskDocumentPath(value interface{}, path []string, rule MaskingRule) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case primitive.A:
+		changed := false
+		for i, element := range v {
+			if masked, ok := maskDocumentPath(element, path, rule); ok {
+				v[i] = masked
+				changed = true
+			}
+		}
+		return v, changed
+	case bson.M:
+		if len(path) == 0 {
+			return v, false
+		}
+		child, ok := v[path[0]]
+		if !ok {
+			return v, false
+		}
+		masked, changed := maskDocumentPath(child, path[1:], rule)
+		v[path[0]] = masked
+		return v, changed
+	case bson.D:
+		if len(path) == 0 {
+			return v, false
+		}
+		changed := false
+		for i, elem := range v {
+			if elem.Key == path[0] {
+				v[i].Value, changed = maskDocumentPath(elem.Value, path[1:], rule)
+			}
+		}
+		return v, changed
+	}
+
+	if len(path) > 0 {
+		return value, false
+	}
+	text, ok := value.(string)
+	if !ok {
+		text = fmt.Sprint(value)
+	}
+	if masked := maskValue(rule, text); masked != nil {
+		return *masked, true
+	}
+	return nil, true
+}
+
+// MaskBackup writes a masked copy of a SQL backup through a masking profile
+// and stores it as a backup of its own
+func (s *BackupService) MaskBackup(userID uuid.UUID, id string, req *MaskBackupRequest) (*Backup, error) {
+	source, err := s.backupRepo.GetBackup(id)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.backupOwner(source, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.GetMaskingProfile(userID, req.ProfileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: masking profile not found", errMaskingProfileInvalid)
+		}
+		return nil, err
+	}
+	if profile.ConnectionID != source.ConnectionID {
+		return nil, fmt.Errorf("%w: the masking profile belongs to another connection than the backup", errMaskingProfileInvalid)
+	}
+	if source.Status != "completed" {
+		return nil, fmt.Errorf("%w: only completed backups can be masked", errMaskingProfileInvalid)
+	}
+	if conn.Type == "mongodb" {
+		return nil, fmt.Errorf("%w: masked copies are only made of SQL dumps, mask MongoDB data on restore instead", errMaskingProfileInvalid)
+	}
+
+	filePath, release, err := s.ensureBackupFileAvailable(source, conn.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	filePath, releasePlain, err := decompressedBackupFile(filePath, source.Compression)
+	if err != nil {
+		return nil, err
+	}
+	defer releasePlain()
+
+	if conn.Type == "postgresql" && isPgCustomDump(filePath) {
+		plainPath, releaseCustom, err := s.convertPgCustomDump(filePath, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer releaseCustom()
+		filePath = plainPath
+	}
+
+	profileID := profile.ID.String()
+	backup := &Backup{
+		ID:               uuid.New(),
+		ConnectionID:     conn.ID,
+		DatabaseName:     source.DatabaseName,
+		StartedTime:      time.Now(),
+		Status:           "in_progress",
+		StorageTier:      StorageTierLocal,
+		Compression:      source.Compression,
+		Masked:           true,
+		MaskingProfileID: &profileID,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+
+	backupPath, err := s.prepareBackupPath(conn, backup)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeMaskedDump(filePath, dumpPath(backupPath, backup.Compression), conn.Type, profile.Rules); err != nil {
+		return nil, err
+	}
+	if err := compressBackupFile(dumpPath(backupPath, backup.Compression), backupPath, backup.Compression); err != nil {
+		os.Remove(dumpPath(backupPath, backup.Compression))
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup file info: %v", err)
+	}
+
+	backup.Size = fileInfo.Size()
+	backup.Status = "completed"
+	now := time.Now()
+	backup.CompletedTime = &now
+	backup.Checksum = backupChecksum(backupPath)
+
+	if err := s.uploadToS3IfEnabled(backup, conn, backupRunOptions{}); err != nil {
+		fmt.Printf("Warning: Failed to upload backup to S3: %v\n", err)
+	}
+
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		return nil, fmt.Errorf("failed to save backup: %v", err)
+	}
+
+	backup.Labels = map[string]string{maskedFromLabel: source.ID.String()}
+	if err := s.backupRepo.UpdateBackupMetadata(backup.ID.String(), backup.Labels, nil); err != nil {
+		fmt.Printf("Warning: Failed to label masked backup %s: %v\n", backup.ID, err)
+	}
+	return backup, nil
+}
+
+// writeMaskedDump masks the plain dump at src into a new file at dst
+func writeMaskedDump(src, dst, dbType string, rules []MaskingRule) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %v", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create masked backup: %v", err)
+	}
+
+	if err := maskSQLDump(in, out, dbType, rules); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("failed to write masked backup: %v", err)
+	}
+	return nil
+}
+
+func (h *BackupHandler) ListMaskingProfiles(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profiles, err := h.backupService.ListMaskingProfiles(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Masking profiles retrieved successfully", profiles)
+}
+
+func (h *BackupHandler) GetMaskingProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	profile, err := h.backupService.GetMaskingProfile(userID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Masking profile not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Masking profile retrieved successfully", profile)
+}
+
+func (h *BackupHandler) CreateMaskingProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req MaskingProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateMaskingProfileRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile, err := h.backupService.CreateMaskingProfile(userID, &req)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+		case errors.Is(err, errMaskingProfileInvalid):
+			response.SendError(w, http.StatusBadRequest, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Masking profile created successfully", profile)
+}
+
+func (h *BackupHandler) UpdateMaskingProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req MaskingProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateMaskingProfileRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile, err := h.backupService.UpdateMaskingProfile(userID, id, &req)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Masking profile or connection not found")
+		case errors.Is(err, errMaskingProfileInvalid):
+			response.SendError(w, http.StatusBadRequest, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Masking profile updated successfully", profile)
+}
+
+func (h *BackupHandler) DeleteMaskingProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := h.backupService.DeleteMaskingProfile(userID, id); err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Masking profile not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Masking profile deleted successfully", nil)
+}
+
+func (h *BackupHandler) MaskBackup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req MaskBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ProfileID == "" {
+		response.SendError(w, http.StatusBadRequest, "profile_id is required")
+		return
+	}
+
+	backup, err := h.backupService.MaskBackup(userID, id, &req)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+		case errors.Is(err, errMaskingProfileInvalid):
+			response.SendError(w, http.StatusBadRequest, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Masked backup created successfully", backup)
+}
@@ -0,0 +1,425 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var valuesPattern = regexp.MustCompile(`(?is)^\s*VALUES\s*`)
+
+// tableConstraintWords start the entries of a CREATE TABLE column list that
+// aren't columns
+var tableConstraintWords = map[string]bool{
+	"CONSTRAINT": true,
+	"PRIMARY":    true,
+	"UNIQUE":     true,
+	"KEY":        true,
+	"INDEX":      true,
+	"FOREIGN":    true,
+	"CHECK":      true,
+	"FULLTEXT":   true,
+	"SPATIAL":    true,
+	"EXCLUDE":    true,
+	"LIKE":       true,
+	"PERIOD":     true,
+}
+
+// dumpMasker rewrites the rows of a plain SQL dump, masking the columns of a
+// masking profile
+type dumpMasker struct {
+	postgres bool
+	rules    []MaskingRule
+	columns  map[string][]string // table key -> columns in CREATE TABLE order
+}
+
+// maskSQLDump streams a plain SQL dump from src to dst, masking COPY blocks
+// and INSERT statements. Column positions come from the statement's own
+// column list, or else from the table's CREATE TABLE earlier in the dump.
+func maskSQLDump(src io.Reader, dst io.Writer, dbType string, rules []MaskingRule) error {
+	masker := &dumpMasker{
+		postgres: dbType == "postgresql",
+		rules:    rules,
+		columns:  make(map[string][]string),
+	}
+	reader := &sqlStatementReader{
+		reader:    bufio.NewReaderSize(src, 1024*1024),
+		postgres:  masker.postgres,
+		delimiter: ";",
+	}
+	writer := bufio.NewWriterSize(dst, 1024*1024)
+
+	for {
+		stmt, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup file: %v", err)
+		}
+
+		// COPY rows follow their statement up to a \. line
+		isCopy := masker.postgres && copyPattern.MatchString(strings.TrimSpace(stmt)) && copyFromStdinPattern.MatchString(stmt)
+
+		out, positions, err := masker.maskStatement(stmt, isCopy)
+		if err != nil {
+			return err
+		}
+		separator := "\n\n"
+		if isCopy {
+			separator = "\n"
+		}
+		if _, err := writer.WriteString(out + separator); err != nil {
+			return fmt.Errorf("failed to write masked dump: %v", err)
+		}
+
+		if isCopy {
+			if err := maskCopyData(reader, writer, positions); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write masked dump: %v", err)
+	}
+	return nil
+}
+
+// maskStatement returns the statement to write for stmt. For COPY statements
+// it also returns the rules for each masked column of the rows that follow.
+func (m *dumpMasker) maskStatement(stmt string, isCopy bool) (string, map[int]MaskingRule, error) {
+	body := strings.TrimSpace(stmt)
+	kind, nameStart, ok := classify(body)
+	if !ok || (kind != kindCreate && kind != kindData) {
+		return body, nil, nil
+	}
+
+	parts, nameLen := readQualifiedName(body[nameStart:])
+	if len(parts) == 0 {
+		return body, nil, nil
+	}
+	table := tableRef{name: parts[len(parts)-1]}
+	if len(parts) > 1 {
+		table.schema = parts[len(parts)-2]
+	}
+	rest := body[nameStart+nameLen:]
+
+	if kind == kindCreate {
+		columns := createTableColumns(rest, m.postgres)
+		if columns == nil {
+			return body, nil, nil
+		}
+		m.columns[table.key()] = columns
+		// Check rules against the definition, so a typo fails before any rows
+		_, err := m.positions(table, columns)
+		return body, nil, err
+	}
+
+	if !m.hasRules(table) {
+		return body, nil, nil
+	}
+
+	columns := m.columns[table.key()]
+	listEnd := 0
+	if trimmed := strings.TrimLeft(rest, " \t\r\n"); strings.HasPrefix(trimmed, "(") {
+		listed, n := splitParenthesized(trimmed, m.postgres)
+		if n < 0 {
+			return "", nil, fmt.Errorf("failed to read the column list of %s", table.key())
+		}
+		columns = nil
+		for _, entry := range listed {
+			name, _ := readIdentifier(strings.TrimSpace(entry))
+			columns = append(columns, name)
+		}
+		listEnd = len(rest) - len(trimmed) + n
+	}
+
+	positions, err := m.positions(table, columns)
+	if err != nil {
+		return "", nil, err
+	}
+	if isCopy {
+		return body, positions, nil
+	}
+
+	masked, err := m.maskInsert(rest[listEnd:], positions, len(columns))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to mask rows of %s: %v", table.key(), err)
+	}
+	return body[:nameStart+nameLen+listEnd] + masked, nil, nil
+}
+
+func (m *dumpMasker) hasRules(table tableRef) bool {
+	for _, rule := range m.rules {
+		if rule.matches(table) {
+			return true
+		}
+	}
+	return false
+}
+
+// positions maps the masked columns of a table to their rules
+func (m *dumpMasker) positions(table tableRef, columns []string) (map[int]MaskingRule, error) {
+	positions := make(map[int]MaskingRule)
+	for _, rule := range m.rules {
+		if !rule.matches(table) {
+			continue
+		}
+		if columns == nil {
+			return nil, fmt.Errorf("%w: rule %s.%s: the dump loads %s without naming its columns or creating it first",
+				errMaskingProfileInvalid, rule.Table, rule.Column, table.key())
+		}
+		found := false
+		for i, column := range columns {
+			if strings.EqualFold(column, rule.Column) {
+				positions[i] = rule
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: rule %s.%s: table %s has no column %s", errMaskingProfileInvalid, rule.Table, rule.Column, table.key(), rule.Column)
+		}
+	}
+	return positions, nil
+}
+
+// maskInsert masks the VALUES tuples of an INSERT statement. s starts after
+// the table name and column list.
+func (m *dumpMasker) maskInsert(s string, positions map[int]MaskingRule, width int) (string, error) {
+	loc := valuesPattern.FindStringIndex(s)
+	if loc == nil {
+		return "", fmt.Errorf("only INSERT ... VALUES statements can be masked")
+	}
+
+	var out strings.Builder
+	out.WriteString(s[:loc[1]])
+	pos := loc[1]
+	for {
+		values, n := splitParenthesized(s[pos:], m.postgres)
+		if n < 0 {
+			return "", fmt.Errorf("malformed VALUES list")
+		}
+		if len(values) != width {
+			return "", fmt.Errorf("a row has %d values for %d columns", len(values), width)
+		}
+		for i, rule := range positions {
+			values[i] = m.maskLiteral(values[i], rule)
+		}
+		out.WriteString("(" + strings.Join(values, ",") + ")")
+		pos += n
+
+		next := strings.TrimLeft(s[pos:], " \t\r\n")
+		if !strings.HasPrefix(next, ",") {
+			break
+		}
+		// Keep the separator as the dump wrote it
+		separatorEnd := len(s) - len(next) + 1
+		separatorEnd += len(s[separatorEnd:]) - len(strings.TrimLeft(s[separatorEnd:], " \t\r\n"))
+		out.WriteString(s[pos:separatorEnd])
+		pos = separatorEnd
+	}
+	out.WriteString(s[pos:])
+	return out.String(), nil
+}
+
+// maskLiteral masks one value of a VALUES tuple, keeping its leading space
+func (m *dumpMasker) maskLiteral(raw string, rule MaskingRule) string {
+	value := strings.TrimSpace(raw)
+	if strings.EqualFold(value, "NULL") {
+		return raw
+	}
+	lead := raw[:len(raw)-len(strings.TrimLeft(raw, " \t\r\n"))]
+
+	masked := maskValue(rule, m.decodeLiteral(value))
+	if masked == nil {
+		return lead + "NULL"
+	}
+	return lead + m.quoteLiteral(*masked)
+}
+
+// decodeLiteral returns the text of a SQL literal. Anything that isn't a
+// quoted string, such as a number, is its own text.
+func (m *dumpMasker) decodeLiteral(value string) string {
+	start := strings.IndexByte(value, '\'')
+	if start < 0 || !strings.HasSuffix(value, "'") || start == len(value)-1 {
+		return value
+	}
+	prefix := strings.TrimSpace(value[:start])
+	// E'' strings in PostgreSQL, _charset'' and N'' introducers in MySQL
+	if prefix != "" && !strings.EqualFold(prefix, "E") && !strings.EqualFold(prefix, "N") && !strings.HasPrefix(prefix, "_") {
+		return value
+	}
+	backslashes := !m.postgres || strings.EqualFold(prefix, "E")
+
+	content := value[start+1 : len(value)-1]
+	var text strings.Builder
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\'' && i+1 < len(content) && content[i+1] == '\'':
+			text.WriteByte('\'')
+			i++
+		case c == '\\' && backslashes && i+1 < len(content):
+			i++
+			switch content[i] {
+			case '0':
+				text.WriteByte(0)
+			case 'b':
+				text.WriteByte('\b')
+			case 'n':
+				text.WriteByte('\n')
+			case 'r':
+				text.WriteByte('\r')
+			case 't':
+				text.WriteByte('\t')
+			case 'Z':
+				text.WriteByte(0x1a)
+			default:
+				text.WriteByte(content[i])
+			}
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return text.String()
+}
+
+// quoteLiteral quotes text as a string literal of the dump's dialect.
+// pg_dump turns standard_conforming_strings on, so only quotes are doubled.
+func (m *dumpMasker) quoteLiteral(text string) string {
+	if m.postgres {
+		return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\x00", `\0`, "\x1a", `\Z`)
+	return "'" + replacer.Replace(text) + "'"
+}
+
+// maskCopyData copies the rows of a COPY block, masking the given columns
+func maskCopyData(reader *sqlStatementReader, writer *bufio.Writer, positions map[int]MaskingRule) error {
+	for {
+		line, err := reader.readLine()
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("backup file ends inside COPY data")
+			}
+			return fmt.Errorf("failed to read backup file: %v", err)
+		}
+
+		row := strings.TrimSuffix(line, "\n")
+		if row == "\\." {
+			if _, err := writer.WriteString(row + "\n\n"); err != nil {
+				return fmt.Errorf("failed to write masked dump: %v", err)
+			}
+			return nil
+		}
+
+		if len(positions) > 0 {
+			fields := strings.Split(row, "\t")
+			for i, rule := range positions {
+				if i >= len(fields) {
+					return fmt.Errorf("COPY row has %d fields, expected a column at position %d", len(fields), i+1)
+				}
+				if fields[i] == `\N` {
+					continue
+				}
+				if masked := maskValue(rule, decodeCopyField(fields[i])); masked != nil {
+					fields[i] = encodeCopyField(*masked)
+				} else {
+					fields[i] = `\N`
+				}
+			}
+			line = strings.Join(fields, "\t") + "\n"
+		}
+		if _, err := writer.WriteString(line); err != nil {
+			return fmt.Errorf("failed to write masked dump: %v", err)
+		}
+	}
+}
+
+var (
+	copyFieldDecoder = strings.NewReplacer(`\\`, `\`, `\b`, "\b", `\f`, "\f", `\n`, "\n", `\r`, "\r", `\t`, "\t", `\v`, "\v")
+	copyFieldEncoder = strings.NewReplacer(`\`, `\\`, "\b", `\b`, "\f", `\f`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "\v", `\v`)
+)
+
+// decodeCopyField reads a field of COPY's text format
+func decodeCopyField(field string) string {
+	return copyFieldDecoder.Replace(field)
+}
+
+func encodeCopyField(text string) string {
+	return copyFieldEncoder.Replace(text)
+}
+
+// createTableColumns returns the column names of a CREATE TABLE statement,
+// given the text after the table name
+func createTableColumns(s string, postgres bool) []string {
+	open := strings.IndexByte(s, '(')
+	if open < 0 {
+		return nil
+	}
+	entries, n := splitParenthesized(s[open:], postgres)
+	if n < 0 {
+		return nil
+	}
+
+	columns := []string{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		name, size := readIdentifier(entry)
+		if size == 0 {
+			continue
+		}
+		if entry[0] != '"' && entry[0] != '`' && tableConstraintWords[strings.ToUpper(name)] {
+			continue
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+// splitParenthesized splits the parenthesized list at the start of s at its
+// top-level commas. It returns the entries and the length of the list, or -1
+// when the list isn't closed.
+func splitParenthesized(s string, postgres bool) ([]string, int) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, -1
+	}
+
+	var entries []string
+	var quote byte
+	depth := 0
+	start := 1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			// MySQL escapes quotes with a backslash, both double them
+			if c == '\\' && !postgres && quote == '\'' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return append(entries, s[start:i]), i + 1
+			}
+		case ',':
+			if depth == 1 {
+				entries = append(entries, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return nil, -1
+}
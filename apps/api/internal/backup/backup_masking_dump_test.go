@@ -0,0 +1,250 @@
+package backup
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// abcHash is the SHA-256 of "abc"
+const abcHash = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+func TestMaskValue(t *testing.T) {
+	tests := []struct {
+		rule  MaskingRule
+		value string
+		want  *string
+	}{
+		{rule: MaskingRule{Strategy: MaskHash}, value: "abc", want: strPtr(abcHash)},
+		{rule: MaskingRule{Strategy: MaskNull}, value: "abc"},
+		{rule: MaskingRule{Strategy: MaskFakeEmail}, value: "abc", want: strPtr("user_ba7816bf8f01@example.com")},
+		{rule: MaskingRule{Strategy: MaskKeepDomain}, value: "abc@corp.io", want: strPtr("user_" + hashValue("abc@corp.io")[:12] + "@corp.io")},
+		{rule: MaskingRule{Strategy: MaskKeepDomain}, value: "abc", want: strPtr("user_ba7816bf8f01@example.com")},
+		{rule: MaskingRule{Strategy: MaskTruncate, Length: 3}, value: "Zoë Smith", want: strPtr("Zoë")},
+		{rule: MaskingRule{Strategy: MaskTruncate, Length: 10}, value: "short", want: strPtr("short")},
+	}
+
+	for _, tt := range tests {
+		got := maskValue(tt.rule, tt.value)
+		switch {
+		case got == nil && tt.want == nil:
+		case got == nil || tt.want == nil || *got != *tt.want:
+			t.Errorf("maskValue(%s, %q) = %v, want %v", tt.rule.Strategy, tt.value, derefOrNil(got), derefOrNil(tt.want))
+		}
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func derefOrNil(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+func TestDecodeLiteral(t *testing.T) {
+	tests := []struct {
+		value    string
+		postgres bool
+		want     string
+	}{
+		{value: `'plain'`, want: "plain"},
+		{value: `'it\'s'`, want: "it's"},
+		{value: `'it''s'`, want: "it's"},
+		{value: `'a\nb\tc\\d\0'`, want: "a\nb\tc\\d\x00"},
+		{value: `_utf8mb4'abc'`, want: "abc"},
+		{value: `N'abc'`, want: "abc"},
+		{value: `X'616263'`, want: `X'616263'`},
+		{value: `42`, want: "42"},
+		{value: `'`, want: "'"},
+		{value: `'c:\path'`, postgres: true, want: `c:\path`},
+		{value: `'it''s'`, postgres: true, want: "it's"},
+		{value: `E'a\nb\''`, postgres: true, want: "a\nb'"},
+	}
+
+	for _, tt := range tests {
+		masker := &dumpMasker{postgres: tt.postgres}
+		if got := masker.decodeLiteral(tt.value); got != tt.want {
+			t.Errorf("decodeLiteral(%s) with postgres %t = %q, want %q", tt.value, tt.postgres, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	tests := []struct {
+		text     string
+		postgres bool
+		want     string
+	}{
+		{text: "it's", postgres: true, want: `'it''s'`},
+		{text: `c:\path`, postgres: true, want: `'c:\path'`},
+		{text: "it's", want: `'it\'s'`},
+		{text: "a\\b\nc\x00", want: `'a\\b\nc\0'`},
+	}
+
+	for _, tt := range tests {
+		masker := &dumpMasker{postgres: tt.postgres}
+		if got := masker.quoteLiteral(tt.text); got != tt.want {
+			t.Errorf("quoteLiteral(%q) with postgres %t = %s, want %s", tt.text, tt.postgres, got, tt.want)
+		}
+		if got := masker.decodeLiteral(masker.quoteLiteral(tt.text)); got != tt.text {
+			t.Errorf("quoted %q decodes to %q", tt.text, got)
+		}
+	}
+}
+
+func TestMaskCopyData(t *testing.T) {
+	positions := map[int]MaskingRule{
+		1: {Strategy: MaskHash},
+		2: {Strategy: MaskTruncate, Length: 3},
+	}
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "masks the given fields",
+			data: "1\tabc\tAlice\n\\.\nSELECT 1;\n",
+			want: "1\t" + abcHash + "\tAli\n\\.\n\n",
+		},
+		{
+			name: "NULL stays NULL",
+			data: "2\t\\N\t\\N\n\\.\n",
+			want: "2\t\\N\t\\N\n\\.\n\n",
+		},
+		{
+			name: "escapes are decoded before masking and encoded after",
+			data: "3\tabc\ta\\tbcd\n\\.\n",
+			want: "3\t" + abcHash + "\ta\\tb\n\\.\n\n",
+		},
+		{
+			name:    "row with too few fields",
+			data:    "4\tabc\n\\.\n",
+			wantErr: "expected a column at position 3",
+		},
+		{
+			name:    "data ends without \\.",
+			data:    "5\tabc\tAlice\n",
+			wantErr: "ends inside COPY data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &sqlStatementReader{reader: bufio.NewReader(strings.NewReader(tt.data)), postgres: true, delimiter: ";"}
+			var out strings.Builder
+			writer := bufio.NewWriter(&out)
+			err := maskCopyData(reader, writer, positions)
+			writer.Flush()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("masked rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskSQLDump(t *testing.T) {
+	tests := []struct {
+		name    string
+		dump    string
+		dbType  string
+		rules   []MaskingRule
+		want    string
+		wantErr string
+	}{
+		{
+			name: "postgres COPY block",
+			dump: "CREATE TABLE public.users (\n    id integer,\n    email text,\n    name text\n);\n\n" +
+				"COPY public.users (id, email, name) FROM stdin;\n1\tabc\tAlice\n2\t\\N\tBob\n\\.\n\n" +
+				"COPY public.teams (id, name) FROM stdin;\n1\tCore\n\\.\n",
+			dbType: "postgresql",
+			rules: []MaskingRule{
+				{Table: "users", Column: "email", Strategy: MaskHash},
+				{Table: "public.users", Column: "name", Strategy: MaskTruncate, Length: 3},
+			},
+			want: "CREATE TABLE public.users (\n    id integer,\n    email text,\n    name text\n);\n\n" +
+				"COPY public.users (id, email, name) FROM stdin;\n1\t" + abcHash + "\tAli\n2\t\\N\tBob\n\\.\n\n" +
+				"COPY public.teams (id, name) FROM stdin;\n1\tCore\n\\.\n\n",
+		},
+		{
+			name:   "postgres INSERT with a column list",
+			dump:   "INSERT INTO public.users (id, email) VALUES (1, 'abc'),\n\t(2, 'it''s');\n",
+			dbType: "postgresql",
+			rules:  []MaskingRule{{Table: "users", Column: "EMAIL", Strategy: MaskNull}},
+			want:   "INSERT INTO public.users (id, email) VALUES (1, NULL),\n\t(2, NULL);\n\n",
+		},
+		{
+			name: "mysql INSERT uses the CREATE TABLE columns",
+			dump: "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `email` varchar(255),\n  `note` text,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB;\n" +
+				"INSERT INTO `users` VALUES (1,'abc','it\\'s, fine'),(2,NULL,'x');\n",
+			dbType: "mysql",
+			rules: []MaskingRule{
+				{Table: "users", Column: "email", Strategy: MaskHash},
+				{Table: "users", Column: "note", Strategy: MaskTruncate, Length: 4},
+			},
+			want: "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `email` varchar(255),\n  `note` text,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB;\n\n" +
+				"INSERT INTO `users` VALUES (1,'" + abcHash + "','it\\'s'),(2,NULL,'x');\n\n",
+		},
+		{
+			name:    "rule for a missing column",
+			dump:    "CREATE TABLE `users` (\n  `id` int\n);\n",
+			dbType:  "mysql",
+			rules:   []MaskingRule{{Table: "users", Column: "phone", Strategy: MaskNull}},
+			wantErr: "table users has no column phone",
+		},
+		{
+			name:    "rows without known columns",
+			dump:    "INSERT INTO `users` VALUES (1,'abc');\n",
+			dbType:  "mysql",
+			rules:   []MaskingRule{{Table: "users", Column: "email", Strategy: MaskNull}},
+			wantErr: "without naming its columns or creating it first",
+		},
+		{
+			name:    "row of the wrong width",
+			dump:    "INSERT INTO users (id, email) VALUES (1);\n",
+			dbType:  "postgresql",
+			rules:   []MaskingRule{{Table: "users", Column: "email", Strategy: MaskNull}},
+			wantErr: "a row has 1 values for 2 columns",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := maskSQLDump(strings.NewReader(tt.dump), &out, tt.dbType, tt.rules)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("masked dump =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskSQLDumpInvalidRuleError(t *testing.T) {
+	err := maskSQLDump(strings.NewReader("CREATE TABLE users (id int);\n"), &strings.Builder{}, "postgresql",
+		[]MaskingRule{{Table: "users", Column: "email", Strategy: MaskNull}})
+	if !errors.Is(err, errMaskingProfileInvalid) {
+		t.Errorf("error = %v, want it to wrap errMaskingProfileInvalid", err)
+	}
+}
@@ -0,0 +1,257 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// legacyFileName matches the <db>_<timestamp>.sql names written before naming
+// templates existed, for backups recorded without a database name
+var legacyFileName = regexp.MustCompile(`^(.+)_\d{8}_\d{6}\.sql$`)
+
+// namingContext collects the template values for a backup
+func namingContext(conn *connection.StoredConnection, backup *Backup) common.NamingContext {
+	ctx := common.NamingContext{
+		Connection: conn.Name,
+		Database:   backup.DatabaseName,
+		Type:       conn.Type,
+		Time:       backup.StartedTime,
+		ID:         backup.ID.String(),
+	}
+	if backup.ScheduleID != nil {
+		ctx.Schedule = *backup.ScheduleID
+	}
+	if ctx.Database == "" {
+		if m := legacyFileName.FindStringSubmatch(filepath.Base(backup.Path)); m != nil {
+			ctx.Database = m[1]
+		} else {
+			ctx.Database = conn.DatabaseName
+		}
+	}
+	return ctx
+}
+
+// localBackupRoot returns the directory local backups of a connection live in
+func (s *BackupService) localBackupRoot(conn *connection.StoredConnection) string {
+	if conn.BackupDir != "" {
+		return conn.BackupDir
+	}
+	return s.backupDir
+}
+
+// localBackupPath renders the connection's path template for a backup
+func (s *BackupService) localBackupPath(conn *connection.StoredConnection, backup *Backup) (string, error) {
+	relativePath, err := common.RenderNamingTemplate(conn.PathTemplate, namingContext(conn, backup))
+	if err != nil {
+		return "", err
+	}
+	relativePath += compressionExtension(backup.Compression)
+	return filepath.Join(s.localBackupRoot(conn), filepath.FromSlash(relativePath)), nil
+}
+
+// suffixedBackupPath adds suffix to the name of a backup file, ahead of its
+// dump and compression extensions
+func suffixedBackupPath(backupPath, compression, suffix string) string {
+	compressed := compressionExtension(compression)
+	base := strings.TrimSuffix(backupPath, compressed)
+	extension := filepath.Ext(base)
+	return strings.TrimSuffix(base, extension) + suffix + extension + compressed
+}
+
+// uniqueBackupPath returns backupPath, or backupPath with the backup's short
+// ID added when another file already has that name. Backups started in the
+// same second, such as those of two schedules, would otherwise share a file.
+func uniqueBackupPath(backupPath string, backup *Backup) string {
+	if _, err := os.Stat(backupPath); err != nil {
+		return backupPath
+	}
+	return suffixedBackupPath(backupPath, backup.Compression, backupIDSuffix(backup))
+}
+
+func backupIDSuffix(backup *Backup) string {
+	return "_" + backup.ID.String()[:8]
+}
+
+// s3RelativeKey renders the connection's S3 key template for a backup,
+// falling back to the local path template so both layouts match by default
+func s3RelativeKey(conn *connection.StoredConnection, backup *Backup) (string, error) {
+	template := conn.S3KeyTemplate
+	if template == "" {
+		template = conn.PathTemplate
+	}
+	key, err := common.RenderNamingTemplate(template, namingContext(conn, backup))
+	if err != nil {
+		return "", err
+	}
+	key += compressionExtension(backup.Compression)
+
+	// A file name made unique locally stays unique in the bucket
+	if suffix := backupIDSuffix(backup); strings.Contains(filepath.Base(backup.Path), suffix) && !strings.Contains(key, suffix) {
+		key = suffixedBackupPath(key, backup.Compression, suffix)
+	}
+	return key, nil
+}
+
+// RelocateBackupsForConnection moves a connection's local files and S3 objects
+// to the locations its current name and naming templates point to
+func (s *BackupService) RelocateBackupsForConnection(connectionID string) error {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	backups, err := s.backupRepo.GetBackupsByConnectionID(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get backups: %w", err)
+	}
+
+	if len(backups) == 0 {
+		return nil
+	}
+
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user settings: %w", err)
+	}
+
+	var s3Storage *S3Storage
+	if s3Configured(userSettings) {
+		s3Storage, err = s.newS3StorageFromSettings(userSettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Render every location first, so a template error leaves nothing half moved
+	type relocation struct {
+		backup *Backup
+		pinned bool // the legacy database name was filled in
+		path   string
+		key    string
+	}
+	relocations := make([]*relocation, 0, len(backups))
+	planned := make(map[string]bool)
+	for _, backup := range backups {
+		// Pin legacy database names before the file name they come from changes
+		pinned := backup.DatabaseName == ""
+		if pinned {
+			backup.DatabaseName = namingContext(conn, backup).Database
+		}
+
+		newPath, err := s.localBackupPath(conn, backup)
+		if err != nil {
+			return err
+		}
+		if newPath != backup.Path {
+			if planned[newPath] {
+				newPath = suffixedBackupPath(newPath, backup.Compression, backupIDSuffix(backup))
+			} else {
+				newPath = uniqueBackupPath(newPath, backup)
+			}
+		}
+		planned[newPath] = true
+		r := &relocation{backup: backup, pinned: pinned, path: newPath}
+
+		if s3Storage != nil && backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" {
+			// The key follows the backup's new file name
+			located := *backup
+			located.Path = newPath
+			relativeKey, err := s3RelativeKey(conn, &located)
+			if err != nil {
+				return err
+			}
+			r.key = s3Storage.ObjectKey(relativeKey)
+		}
+		relocations = append(relocations, r)
+	}
+
+	ctx := context.Background()
+	movedCount := 0
+	for _, r := range relocations {
+		backup := r.backup
+		moved := r.pinned
+
+		if r.path != backup.Path {
+			if err := moveLocalFile(backup.Path, r.path); err != nil {
+				if !os.IsNotExist(err) {
+					fmt.Printf("Warning: Failed to move backup file %s to %s: %v\n", backup.Path, r.path, err)
+					continue
+				}
+			}
+			// Files purged after an S3 upload keep pointing at their would-be location
+			backup.Path = r.path
+			moved = true
+		}
+
+		if r.key != "" && r.key != *backup.S3ObjectKey {
+			oldKey := *backup.S3ObjectKey
+			if err := s3Storage.WithBucket(backup.s3BucketName()).MoveFile(ctx, oldKey, r.key); err != nil {
+				fmt.Printf("Warning: Failed to move S3 object %s to %s: %v\n", oldKey, r.key, err)
+			} else {
+				newKey := r.key
+				backup.S3ObjectKey = &newKey
+				moved = true
+			}
+		}
+
+		if !moved {
+			continue
+		}
+
+		if err := s.backupRepo.UpdateBackupLocation(backup); err != nil {
+			fmt.Printf("Warning: Failed to update location of backup %s: %v\n", backup.ID, err)
+			continue
+		}
+		movedCount++
+	}
+
+	fmt.Printf("Relocated %d backups for connection %s\n", movedCount, connectionID)
+	return nil
+}
+
+// moveLocalFile renames a file, copying it when source and destination are on
+// different volumes
+func moveLocalFile(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create backup folder: %w", err)
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
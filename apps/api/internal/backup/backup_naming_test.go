@@ -0,0 +1,46 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSuffixedBackupPath(t *testing.T) {
+	tests := []struct {
+		path        string
+		compression string
+		want        string
+	}{
+		{path: "/b/db_20240101_000000.sql", want: "/b/db_20240101_000000_x.sql"},
+		{path: "/b/db.sql.gz", compression: CompressionGzip, want: "/b/db_x.sql.gz"},
+		{path: "/b/db.archive.zst", compression: CompressionZstd, want: "/b/db_x.archive.zst"},
+		{path: "/b/db", want: "/b/db_x"},
+	}
+
+	for _, tt := range tests {
+		if got := suffixedBackupPath(tt.path, tt.compression, "_x"); got != tt.want {
+			t.Errorf("suffixedBackupPath(%q, %q) = %q, want %q", tt.path, tt.compression, got, tt.want)
+		}
+	}
+}
+
+func TestUniqueBackupPath(t *testing.T) {
+	dir := t.TempDir()
+	backup := &Backup{ID: uuid.MustParse("0123abcd-0000-0000-0000-000000000000")}
+
+	free := filepath.Join(dir, "free.sql")
+	if got := uniqueBackupPath(free, backup); got != free {
+		t.Errorf("uniqueBackupPath of a free path = %q, want it unchanged", got)
+	}
+
+	taken := filepath.Join(dir, "taken.sql")
+	if err := os.WriteFile(taken, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uniqueBackupPath(taken, backup), filepath.Join(dir, "taken_0123abcd.sql"); got != want {
+		t.Errorf("uniqueBackupPath of a taken path = %q, want %q", got, want)
+	}
+}
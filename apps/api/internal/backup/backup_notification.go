@@ -32,35 +32,184 @@ func (s *BackupService) createFailureNotification(connID string, backupErr error
 		return fmt.Errorf("invalid user ID for connection: %s", connID)
 	}
 
-	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	metadata := map[string]interface{}{
+		"connection_id": connID,
+		"database_name": conn.DatabaseName,
+		"database_type": conn.Type,
+		"error":         backupErr.Error(),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}
+
+	return s.notifyUser(conn.UserID, userAlert{
+		Type:         notification.BackupFailed,
+		Title:        "Backup Failed",
+		Message:      fmt.Sprintf("Backup failed for database '%s': %v", conn.DatabaseName, backupErr),
+		EmailSubject: "Velld - Backup Failed",
+		EmailBody:    fmt.Sprintf("Backup failed for database '%s'. Error: %v", conn.DatabaseName, backupErr),
+		Metadata:     metadata,
+	})
+}
+
+// createSuccessNotification reports a scheduled run that finished, for
+// schedules whose notification rules ask for it
+func (s *BackupService) createSuccessNotification(connID string, backups []*Backup) error {
+	conn, err := s.connStorage.GetConnection(connID)
 	if err != nil {
-		log.Printf("Failed to get user settings: %v", err)
-		return fmt.Errorf("failed to get user settings: %v", err)
+		return fmt.Errorf("failed to get connection details: %v", err)
 	}
 
-	if userSettings == nil {
-		log.Printf("No settings found for user: %s", conn.UserID)
-		return fmt.Errorf("no settings found for user: %s", conn.UserID)
+	backupIDs := make([]string, 0, len(backups))
+	var size int64
+	for _, backup := range backups {
+		backupIDs = append(backupIDs, backup.ID.String())
+		size += backup.Size
 	}
 
 	metadata := map[string]interface{}{
 		"connection_id": connID,
 		"database_name": conn.DatabaseName,
 		"database_type": conn.Type,
-		"error":         backupErr.Error(),
+		"backup_ids":    backupIDs,
+		"size":          size,
 		"timestamp":     time.Now().Format(time.RFC3339),
 	}
 
-	metadataJSON, _ := json.Marshal(metadata)
+	message := fmt.Sprintf("Backup completed for database '%s' (%d file(s), %d bytes)", conn.DatabaseName, len(backups), size)
+	return s.notifyUser(conn.UserID, userAlert{
+		Type:         notification.BackupCompleted,
+		Title:        "Backup Completed",
+		Message:      message,
+		EmailSubject: "Velld - Backup Completed",
+		EmailBody:    message,
+		Metadata:     metadata,
+	})
+}
+
+// createRestoreNotification reports a restore job that completed or failed
+func (s *BackupService) createRestoreNotification(job *RestoreJob) error {
+	metadata := map[string]interface{}{
+		"restore_job_id":  job.ID.String(),
+		"backup_id":       job.BackupID,
+		"connection_id":   job.ConnectionID,
+		"target_database": job.TargetDatabase,
+		"status":          job.Status,
+		"timestamp":       time.Now().Format(time.RFC3339),
+	}
+	if job.StartedAt != nil && job.FinishedAt != nil {
+		metadata["duration_seconds"] = job.FinishedAt.Sub(*job.StartedAt).Seconds()
+	}
+	if job.SnapshotBackupID != nil {
+		metadata["snapshot_backup_id"] = *job.SnapshotBackupID
+	}
+
+	if job.Status == RestoreJobFailed {
+		reason := "unknown error"
+		if job.Error != nil {
+			reason = *job.Error
+		}
+		metadata["error"] = reason
+
+		message := fmt.Sprintf("Restore into database '%s' failed: %s", job.TargetDatabase, reason)
+		if job.SnapshotBackupID != nil {
+			message += ". It can be reverted to the pre-restore snapshot."
+		}
+		return s.notifyUser(job.UserID, userAlert{
+			Type:         notification.RestoreFailed,
+			Title:        "Restore Failed",
+			Message:      message,
+			EmailSubject: "Velld - Restore Failed",
+			EmailBody:    fmt.Sprintf("Restore of backup %s into database '%s' failed. Error: %s", job.BackupID, job.TargetDatabase, reason),
+			Metadata:     metadata,
+		})
+	}
+
+	message := fmt.Sprintf("Restore into database '%s' completed", job.TargetDatabase)
+	return s.notifyUser(job.UserID, userAlert{
+		Type:         notification.RestoreCompleted,
+		Title:        "Restore Completed",
+		Message:      message,
+		EmailSubject: "Velld - Restore Completed",
+		EmailBody:    fmt.Sprintf("Restore of backup %s into database '%s' completed.", job.BackupID, job.TargetDatabase),
+		Metadata:     metadata,
+	})
+}
+
+// createRefreshNotification reports a refresh run that completed or failed
+func (s *BackupService) createRefreshNotification(pipeline *RefreshPipeline, run *RefreshRun) error {
+	metadata := map[string]interface{}{
+		"refresh_pipeline_id": pipeline.ID.String(),
+		"refresh_run_id":      run.ID.String(),
+		"target_database":     pipeline.TargetDatabase,
+		"status":              run.Status,
+		"timestamp":           time.Now().Format(time.RFC3339),
+	}
+	if run.FinishedAt != nil {
+		metadata["duration_seconds"] = run.FinishedAt.Sub(run.StartedAt).Seconds()
+	}
+	if run.RestoreJobID != nil {
+		metadata["restore_job_id"] = *run.RestoreJobID
+	}
+
+	if run.Status == RefreshFailed {
+		reason := "unknown error"
+		if run.Error != nil {
+			reason = *run.Error
+		}
+		metadata["error"] = reason
+
+		return s.notifyUser(pipeline.UserID, userAlert{
+			Type:         notification.RefreshFailed,
+			Title:        "Refresh Failed",
+			Message:      fmt.Sprintf("Refresh pipeline '%s' failed: %s", pipeline.Name, reason),
+			EmailSubject: "Velld - Refresh Failed",
+			EmailBody:    fmt.Sprintf("Refresh pipeline '%s' into database '%s' failed. Error: %s", pipeline.Name, pipeline.TargetDatabase, reason),
+			Metadata:     metadata,
+		})
+	}
+
+	return s.notifyUser(pipeline.UserID, userAlert{
+		Type:         notification.RefreshCompleted,
+		Title:        "Refresh Completed",
+		Message:      fmt.Sprintf("Refresh pipeline '%s' completed", pipeline.Name),
+		EmailSubject: "Velld - Refresh Completed",
+		EmailBody:    fmt.Sprintf("Refresh pipeline '%s' refreshed database '%s'.", pipeline.Name, pipeline.TargetDatabase),
+		Metadata:     metadata,
+	})
+}
+
+// userAlert is a notification delivered through every channel a user enabled
+type userAlert struct {
+	Type         notification.NotificationType
+	Title        string
+	Message      string
+	EmailSubject string
+	EmailBody    string
+	// Metadata is stored with the dashboard notification and posted to the webhook
+	Metadata map[string]interface{}
+}
+
+func (s *BackupService) notifyUser(userID uuid.UUID, alert userAlert) error {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil {
+		log.Printf("Failed to get user settings: %v", err)
+		return fmt.Errorf("failed to get user settings: %v", err)
+	}
+
+	if userSettings == nil {
+		log.Printf("No settings found for user: %s", userID)
+		return fmt.Errorf("no settings found for user: %s", userID)
+	}
+
+	metadataJSON, _ := json.Marshal(alert.Metadata)
 
 	// Create dashboard notification if enabled
 	if userSettings.NotifyDashboard {
 		notification := &notification.Notification{
 			ID:        uuid.New(),
-			UserID:    conn.UserID,
-			Title:     "Backup Failed",
-			Message:   fmt.Sprintf("Backup failed for database '%s': %v", conn.DatabaseName, backupErr),
-			Type:      notification.BackupFailed,
+			UserID:    userID,
+			Title:     alert.Title,
+			Message:   alert.Message,
+			Type:      alert.Type,
 			Status:    notification.StatusUnread,
 			Metadata:  metadataJSON,
 			CreatedAt: time.Now(),
@@ -74,18 +223,18 @@ func (s *BackupService) createFailureNotification(connID string, backupErr error
 
 	// Send webhook notification if enabled
 	if userSettings.NotifyWebhook && userSettings.WebhookURL != nil {
-		go s.sendWebhookNotification(*userSettings.WebhookURL, metadata)
+		go s.sendWebhookNotification(*userSettings.WebhookURL, alert.Metadata)
 	}
 
 	// Send email notification if enabled
 	if userSettings.NotifyEmail && userSettings.Email != nil {
 		log.Printf("Attempting to send email notification to: %s", *userSettings.Email)
 		// Use separate goroutine for email to prevent blocking
-		go func(emailAddr string, userSettings *settings.UserSettings, meta map[string]interface{}) {
-			if err := s.sendEmailNotification(emailAddr, userSettings, meta); err != nil {
+		go func(emailAddr string, userSettings *settings.UserSettings) {
+			if err := s.sendEmailNotification(emailAddr, userSettings, alert.EmailSubject, alert.EmailBody); err != nil {
 				log.Printf("Failed to send email notification: %v", err)
 			}
-		}(*userSettings.Email, userSettings, metadata)
+		}(*userSettings.Email, userSettings)
 	} else {
 		log.Printf("Email notification skipped - enabled: %v, email configured: %v",
 			userSettings.NotifyEmail, userSettings.Email != nil)
@@ -102,7 +251,7 @@ func (s *BackupService) sendWebhookNotification(webhookURL string, data map[stri
 	}
 }
 
-func (s *BackupService) sendEmailNotification(email string, userSettings *settings.UserSettings, data map[string]interface{}) error {
+func (s *BackupService) sendEmailNotification(email string, userSettings *settings.UserSettings, subject, body string) error {
 	if userSettings == nil {
 		return fmt.Errorf("settings cannot be nil")
 	}
@@ -135,8 +284,8 @@ func (s *BackupService) sendEmailNotification(email string, userSettings *settin
 	msg := &mail.Message{
 		From:    *userSettings.SMTPUsername,
 		To:      email,
-		Subject: "Velld - Backup Failed",
-		Body:    fmt.Sprintf("Backup failed for database '%s'. Error: %v", data["database_name"], data["error"]),
+		Subject: subject,
+		Body:    body,
 	}
 
 	if err := mail.SendEmail(smtpConfig, msg); err != nil {
@@ -0,0 +1,423 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var errScheduleManagedByPolicy = errors.New("schedule is managed by a backup policy, change the policy instead")
+
+func (s *BackupService) ListPolicies(userID uuid.UUID) ([]*BackupPolicy, error) {
+	return s.backupRepo.GetBackupPoliciesByUserID(userID)
+}
+
+func (s *BackupService) GetPolicy(id string) (*BackupPolicy, error) {
+	return s.backupRepo.GetBackupPolicy(id)
+}
+
+func (s *BackupService) CreatePolicy(userID uuid.UUID, req *BackupPolicyRequest) (*BackupPolicy, error) {
+	policy := &BackupPolicy{
+		ID:        uuid.New(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.applyPolicyRequest(policy, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.savePolicy(policy); err != nil {
+		return nil, err
+	}
+	return s.backupRepo.GetBackupPolicy(policy.ID.String())
+}
+
+// UpdatePolicy saves a policy and propagates it to every schedule it manages
+func (s *BackupService) UpdatePolicy(id string, req *BackupPolicyRequest) (*BackupPolicy, error) {
+	policy, err := s.backupRepo.GetBackupPolicy(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyPolicyRequest(policy, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.savePolicy(policy); err != nil {
+		return nil, err
+	}
+	return s.backupRepo.GetBackupPolicy(id)
+}
+
+// DeletePolicy removes a policy and the schedules it manages. Backups those
+// schedules produced are kept.
+func (s *BackupService) DeletePolicy(id string) error {
+	if _, err := s.backupRepo.GetBackupPolicy(id); err != nil {
+		return err
+	}
+
+	if err := s.backupRepo.DeleteBackupPolicy(id); err != nil {
+		return err
+	}
+
+	s.scheduler.Refresh()
+	return nil
+}
+
+// ApplyPoliciesForConnection reapplies the owner's policies after a
+// connection's tags changed, so tag-targeted policies pick it up or drop it
+func (s *BackupService) ApplyPoliciesForConnection(connectionID string) error {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	policies, err := s.backupRepo.GetBackupPoliciesByUserID(conn.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get backup policies: %w", err)
+	}
+
+	for _, policy := range policies {
+		if len(policy.Tags) == 0 {
+			continue
+		}
+		targets, changes, err := s.planPolicy(policy)
+		if err != nil {
+			return fmt.Errorf("failed to apply policy %s: %w", policy.Name, err)
+		}
+		if err := s.backupRepo.ApplyPolicyScheduleChanges(changes); err != nil {
+			return fmt.Errorf("failed to apply policy %s: %w", policy.Name, err)
+		}
+		s.policyApplied(policy, targets)
+	}
+	return nil
+}
+
+// RemoveConnectionFromPolicies drops a deleted connection from the policies it
+// was assigned to
+func (s *BackupService) RemoveConnectionFromPolicies(connectionID string) error {
+	return s.backupRepo.DeletePolicyTargetsForConnection(connectionID)
+}
+
+func (s *BackupService) applyPolicyRequest(policy *BackupPolicy, req *BackupPolicyRequest) error {
+	tags, err := connection.NormalizeTags(req.Tags)
+	if err != nil {
+		return err
+	}
+
+	connectionIDs := make([]string, 0, len(req.ConnectionIDs))
+	seen := make(map[string]bool, len(req.ConnectionIDs))
+	for _, connectionID := range req.ConnectionIDs {
+		if seen[connectionID] {
+			continue
+		}
+		seen[connectionID] = true
+
+		conn, err := s.connStorage.GetConnection(connectionID)
+		if err != nil {
+			return err
+		}
+		if conn.UserID != policy.UserID {
+			return sql.ErrNoRows
+		}
+		connectionIDs = append(connectionIDs, connectionID)
+	}
+
+	policy.Name = strings.TrimSpace(req.Name)
+	policy.CronSchedule = req.CronSchedule
+	policy.Timezone = strings.TrimSpace(req.Timezone)
+	policy.RetentionDays = req.RetentionDays
+	policy.Options = req.Options
+	policy.Destinations = req.Destinations
+	policy.RetryPolicy = req.RetryPolicy
+	policy.MisfirePolicy = misfirePolicyOrDefault(req.MisfirePolicy)
+	policy.MisfireGraceMinutes = req.MisfireGraceMinutes
+	policy.Notifications = defaultNotificationRules
+	if req.Notifications != nil {
+		policy.Notifications = *req.Notifications
+	}
+	policy.RPOMaxAgeHours = req.RPOMaxAgeHours
+	policy.ConnectionIDs = connectionIDs
+	policy.Tags = tags
+	policy.UpdatedAt = time.Now()
+	return nil
+}
+
+// savePolicy stores a policy and applies it to its targets in one transaction
+func (s *BackupService) savePolicy(policy *BackupPolicy) error {
+	targets, changes, err := s.planPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	if err := s.backupRepo.SaveBackupPolicy(policy, changes); err != nil {
+		return fmt.Errorf("failed to save backup policy: %v", err)
+	}
+
+	s.policyApplied(policy, targets)
+	return nil
+}
+
+// planPolicy works out how to make the policy's schedules match its settings
+// and targets: targeted connections without a schedule get one, schedules of
+// connections no longer targeted are removed and the rest are updated in
+// place, keeping whether they are enabled
+func (s *BackupService) planPolicy(policy *BackupPolicy) ([]string, *PolicyScheduleChanges, error) {
+	targets, err := s.policyTargets(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pending := make(map[string]bool, len(targets))
+	for _, connectionID := range targets {
+		pending[connectionID] = true
+	}
+
+	schedules, err := s.backupRepo.GetSchedulesByPolicyID(policy.ID.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get policy schedules: %v", err)
+	}
+
+	changes := &PolicyScheduleChanges{}
+	for _, schedule := range schedules {
+		if !pending[schedule.ConnectionID] {
+			changes.Remove = append(changes.Remove, schedule.ID.String())
+			continue
+		}
+		delete(pending, schedule.ConnectionID)
+
+		applyPolicySettings(schedule, policy)
+		if err := s.refreshNextRunTime(schedule); err != nil {
+			return nil, nil, err
+		}
+		changes.Update = append(changes.Update, schedule)
+	}
+
+	policyID := policy.ID.String()
+	for _, connectionID := range targets {
+		if !pending[connectionID] {
+			continue
+		}
+
+		schedule := &BackupSchedule{
+			ID:           uuid.New(),
+			ConnectionID: connectionID,
+			PolicyID:     &policyID,
+			Enabled:      true,
+			CreatedAt:    time.Now(),
+		}
+		applyPolicySettings(schedule, policy)
+		if err := s.refreshNextRunTime(schedule); err != nil {
+			return nil, nil, err
+		}
+		changes.Create = append(changes.Create, schedule)
+	}
+
+	return targets, changes, nil
+}
+
+// policyApplied follows up on schedule changes once they are saved
+func (s *BackupService) policyApplied(policy *BackupPolicy, targets []string) {
+	if policy.RPOMaxAgeHours > 0 {
+		for _, connectionID := range targets {
+			if err := s.applyPolicyRPO(connectionID, policy.RPOMaxAgeHours); err != nil {
+				fmt.Printf("Warning: Failed to apply RPO of policy %s to connection %s: %v\n", policy.Name, connectionID, err)
+			}
+		}
+	}
+
+	s.scheduler.Refresh()
+}
+
+// policyTargets returns the connections a policy applies to, directly
+// assigned ones first
+func (s *BackupService) policyTargets(policy *BackupPolicy) ([]string, error) {
+	tagged, err := s.backupRepo.GetConnectionIDsByTags(policy.UserID, policy.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tagged connections: %v", err)
+	}
+
+	targets := make([]string, 0, len(policy.ConnectionIDs)+len(tagged))
+	seen := make(map[string]bool)
+	for _, connectionID := range append(policy.ConnectionIDs, tagged...) {
+		if !seen[connectionID] {
+			seen[connectionID] = true
+			targets = append(targets, connectionID)
+		}
+	}
+	return targets, nil
+}
+
+// applyPolicyRPO enables RPO monitoring with the policy's maximum age, leaving
+// a matching policy untouched so its breach state is kept
+func (s *BackupService) applyPolicyRPO(connectionID string, maxAgeHours int) error {
+	existing, err := s.backupRepo.GetRPOPolicy(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if existing != nil && existing.Enabled && existing.MaxAgeHours == maxAgeHours {
+		return nil
+	}
+
+	_, err = s.UpdateRPOPolicy(connectionID, &UpdateRPOPolicyRequest{
+		Enabled:     true,
+		MaxAgeHours: maxAgeHours,
+	})
+	return err
+}
+
+func applyPolicySettings(schedule *BackupSchedule, policy *BackupPolicy) {
+	schedule.Name = policy.Name
+	schedule.CronSchedule = policy.CronSchedule
+	schedule.Timezone = policy.Timezone
+	schedule.RetentionDays = policy.RetentionDays
+	schedule.Options = policy.Options
+	schedule.Destinations = policy.Destinations
+	schedule.RetryPolicy = policy.RetryPolicy
+	schedule.MisfirePolicy = policy.MisfirePolicy
+	schedule.MisfireGraceMinutes = policy.MisfireGraceMinutes
+	schedule.Notifications = policy.Notifications
+	schedule.UpdatedAt = time.Now()
+}
+
+func validateBackupPolicyRequest(req *BackupPolicyRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.RPOMaxAgeHours < 0 {
+		return fmt.Errorf("rpo_max_age_hours must not be negative")
+	}
+	if _, err := connection.NormalizeTags(req.Tags); err != nil {
+		return err
+	}
+
+	// A policy carries the same settings as a schedule
+	return validateScheduleRequest(&ScheduleRequest{
+		CronSchedule:        req.CronSchedule,
+		Timezone:            req.Timezone,
+		RetentionDays:       req.RetentionDays,
+		Options:             req.Options,
+		Destinations:        req.Destinations,
+		RetryPolicy:         req.RetryPolicy,
+		MisfirePolicy:       req.MisfirePolicy,
+		MisfireGraceMinutes: req.MisfireGraceMinutes,
+	})
+}
+
+func (h *BackupHandler) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	policies, err := h.backupService.ListPolicies(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup policies retrieved successfully", policies)
+}
+
+func (h *BackupHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	policy, err := h.backupService.GetPolicy(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup policy not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup policy retrieved successfully", policy)
+}
+
+func (h *BackupHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req BackupPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateBackupPolicyRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	policy, err := h.backupService.CreatePolicy(userID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup policy created successfully", policy)
+}
+
+func (h *BackupHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req BackupPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateBackupPolicyRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	policy, err := h.backupService.UpdatePolicy(id, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup policy or connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup policy updated successfully", policy)
+}
+
+func (h *BackupHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := h.backupService.DeletePolicy(id); err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup policy not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup policy deleted successfully", nil)
+}
@@ -0,0 +1,790 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/audit"
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// refreshSchedulerInterval is how often due refresh pipelines are started
+	refreshSchedulerInterval = 30 * time.Second
+	// maxPostRestoreScripts and maxPostRestoreScriptBytes limit the SQL a
+	// pipeline runs after its restore
+	maxPostRestoreScripts     = 20
+	maxPostRestoreScriptBytes = 64 * 1024
+	// refreshPipelineLabel marks the source backups taken by a pipeline. Only
+	// the one of the latest successful run is kept.
+	refreshPipelineLabel = "refresh_pipeline"
+)
+
+var (
+	errRefreshRunning         = errors.New("refresh pipeline is already running")
+	errRefreshPipelineInvalid = errors.New("invalid refresh pipeline")
+)
+
+func (s *BackupService) ListRefreshPipelines(userID uuid.UUID) ([]*RefreshPipeline, error) {
+	return s.backupRepo.GetRefreshPipelinesByUserID(userID)
+}
+
+func (s *BackupService) GetRefreshPipeline(userID uuid.UUID, id string) (*RefreshPipeline, error) {
+	pipeline, err := s.backupRepo.GetRefreshPipeline(id)
+	if err != nil {
+		return nil, err
+	}
+	if pipeline.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return pipeline, nil
+}
+
+func (s *BackupService) CreateRefreshPipeline(userID uuid.UUID, req *RefreshPipelineRequest) (*RefreshPipeline, error) {
+	pipeline := &RefreshPipeline{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Enabled:   true,
+		CreatedAt: time.Now(),
+	}
+	if err := s.applyRefreshPipelineRequest(pipeline, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.CreateRefreshPipeline(pipeline); err != nil {
+		return nil, fmt.Errorf("failed to save refresh pipeline: %v", err)
+	}
+	return pipeline, nil
+}
+
+func (s *BackupService) UpdateRefreshPipeline(userID uuid.UUID, id string, req *RefreshPipelineRequest) (*RefreshPipeline, error) {
+	pipeline, err := s.GetRefreshPipeline(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyRefreshPipelineRequest(pipeline, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.UpdateRefreshPipeline(pipeline); err != nil {
+		return nil, fmt.Errorf("failed to update refresh pipeline: %v", err)
+	}
+	return pipeline, nil
+}
+
+// DeleteRefreshPipeline deletes a pipeline that isn't running, with its
+// run history. The backups it took are kept.
+func (s *BackupService) DeleteRefreshPipeline(userID uuid.UUID, id string) error {
+	if _, err := s.GetRefreshPipeline(userID, id); err != nil {
+		return err
+	}
+
+	running, err := s.backupRepo.HasRunningRefreshRun(id)
+	if err != nil {
+		return err
+	}
+	if running {
+		return errRefreshRunning
+	}
+	return s.backupRepo.DeleteRefreshPipeline(id)
+}
+
+// applyRefreshPipelineRequest copies a request onto a pipeline, checking
+// that both connections belong to the user and can be refreshed into one
+// another
+func (s *BackupService) applyRefreshPipelineRequest(pipeline *RefreshPipeline, req *RefreshPipelineRequest) error {
+	source, err := s.connStorage.GetConnection(req.SourceConnectionID)
+	if err != nil {
+		return err
+	}
+	target, err := s.connStorage.GetConnection(req.TargetConnectionID)
+	if err != nil {
+		return err
+	}
+	if source.UserID != pipeline.UserID || target.UserID != pipeline.UserID {
+		return sql.ErrNoRows
+	}
+
+	if restoreFamily(source.Type) != restoreFamily(target.Type) {
+		return fmt.Errorf("%w: a %s source can't be restored into a %s target", errRefreshPipelineInvalid, source.Type, target.Type)
+	}
+	sourceDatabase := strings.TrimSpace(req.SourceDatabase)
+	if sourceDatabase == "" {
+		sourceDatabase = source.DatabaseName
+	}
+	targetDatabase := strings.TrimSpace(req.TargetDatabase)
+	if source.ID == target.ID && sourceDatabase == targetDatabase {
+		return fmt.Errorf("%w: target_database must differ from the source database when both use the same connection", errRefreshPipelineInvalid)
+	}
+	if target.Type == "mongodb" && len(req.PostRestoreScripts) > 0 {
+		return fmt.Errorf("%w: post_restore_scripts are only supported for SQL databases", errRefreshPipelineInvalid)
+	}
+	if req.Options.MaskingProfileID != "" {
+		profile, err := s.backupRepo.GetMaskingProfile(req.Options.MaskingProfileID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err != nil || profile.UserID != pipeline.UserID {
+			return fmt.Errorf("%w: masking profile not found", errRefreshPipelineInvalid)
+		}
+		if profile.ConnectionID != source.ID {
+			return fmt.Errorf("%w: the masking profile belongs to another connection than the source", errRefreshPipelineInvalid)
+		}
+	}
+
+	pipeline.Name = strings.TrimSpace(req.Name)
+	pipeline.SourceConnectionID = source.ID
+	pipeline.SourceDatabase = strings.TrimSpace(req.SourceDatabase)
+	pipeline.TargetConnectionID = target.ID
+	pipeline.TargetDatabase = targetDatabase
+	pipeline.Options = req.Options
+	pipeline.PostRestoreScripts = req.PostRestoreScripts
+	if pipeline.PostRestoreScripts == nil {
+		pipeline.PostRestoreScripts = []RefreshScript{}
+	}
+	pipeline.Timezone = strings.TrimSpace(req.Timezone)
+	if req.Enabled != nil {
+		pipeline.Enabled = *req.Enabled
+	}
+	pipeline.UpdatedAt = time.Now()
+
+	pipeline.CronSchedule = nil
+	pipeline.NextRunTime = nil
+	if req.CronSchedule != nil && strings.TrimSpace(*req.CronSchedule) != "" {
+		expr := strings.TrimSpace(*req.CronSchedule)
+		schedule, err := parseCronSchedule(expr, pipeline.Timezone)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errRefreshPipelineInvalid, err)
+		}
+		nextRun := schedule.Next(time.Now())
+		pipeline.CronSchedule = &expr
+		pipeline.NextRunTime = &nextRun
+	}
+	return nil
+}
+
+// restoreFamily groups database types whose dumps restore into each other
+func restoreFamily(dbType string) string {
+	if dbType == "mariadb" {
+		return "mysql"
+	}
+	return dbType
+}
+
+// RunRefreshPipeline starts a run of a pipeline in the background
+func (s *BackupService) RunRefreshPipeline(userID uuid.UUID, id string) (*RefreshRun, error) {
+	pipeline, err := s.GetRefreshPipeline(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.startRefreshRun(pipeline, RunTriggerManual)
+}
+
+// startRefreshRun records a run with all its steps pending and executes it
+// in the background
+func (s *BackupService) startRefreshRun(pipeline *RefreshPipeline, trigger string) (*RefreshRun, error) {
+	steps := []*RefreshStep{
+		{Name: RefreshStepBackup, Status: RefreshPending},
+		{Name: RefreshStepRestore, Status: RefreshPending},
+	}
+	for _, script := range pipeline.PostRestoreScripts {
+		steps = append(steps, &RefreshStep{Name: RefreshStepPostRestore, Script: script.Name, Status: RefreshPending})
+	}
+
+	run := &RefreshRun{
+		ID:          uuid.New(),
+		PipelineID:  pipeline.ID.String(),
+		UserID:      pipeline.UserID,
+		TriggeredBy: trigger,
+		Status:      RefreshRunning,
+		Steps:       steps,
+		StartedAt:   time.Now(),
+	}
+
+	created, err := s.backupRepo.CreateRefreshRun(run)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record refresh run: %v", err)
+	}
+	if !created {
+		return nil, errRefreshRunning
+	}
+
+	started := *run
+	started.Steps = make([]*RefreshStep, len(steps))
+	for i, step := range steps {
+		copied := *step
+		started.Steps[i] = &copied
+	}
+	go s.executeRefreshRun(pipeline, run)
+	return &started, nil
+}
+
+// executeRefreshRun runs the steps of a run in order. A failed step skips
+// the ones after it.
+func (s *BackupService) executeRefreshRun(pipeline *RefreshPipeline, run *RefreshRun) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.heartbeatRefreshRun(run.ID.String(), stop)
+
+	fmt.Printf("Refresh pipeline %s run %s started\n", pipeline.ID, run.ID)
+
+	var backup *Backup
+	var err error
+	scripts := pipeline.PostRestoreScripts
+	for _, step := range run.Steps {
+		if err != nil {
+			step.Status = RefreshSkipped
+			continue
+		}
+
+		startedAt := time.Now()
+		step.Status = RefreshRunning
+		step.StartedAt = &startedAt
+		s.saveRefreshRun(run)
+
+		switch step.Name {
+		case RefreshStepBackup:
+			backup, err = s.refreshBackup(pipeline)
+			if backup != nil {
+				backupID := backup.ID.String()
+				run.BackupID = &backupID
+			}
+		case RefreshStepRestore:
+			var job *RestoreJob
+			job, err = s.refreshRestore(pipeline, backup)
+			if job != nil {
+				jobID := job.ID.String()
+				run.RestoreJobID = &jobID
+			}
+		case RefreshStepPostRestore:
+			err = s.runPostRestoreScript(pipeline, scripts[0])
+			scripts = scripts[1:]
+		}
+
+		finishedAt := time.Now()
+		step.FinishedAt = &finishedAt
+		step.Status = RefreshCompleted
+		if err != nil {
+			message := err.Error()
+			step.Status = RefreshFailed
+			step.Error = &message
+			if step.Script != "" {
+				err = fmt.Errorf("post-restore script %q failed: %v", step.Script, err)
+			} else {
+				err = fmt.Errorf("%s step failed: %v", step.Name, err)
+			}
+		}
+	}
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = RefreshCompleted
+	if err != nil {
+		message := err.Error()
+		run.Status = RefreshFailed
+		run.Error = &message
+	}
+	s.saveRefreshRun(run)
+
+	if err == nil {
+		s.pruneRefreshBackups(pipeline, backup)
+	}
+
+	fmt.Printf("Refresh pipeline %s run %s %s after %s\n", pipeline.ID, run.ID, run.Status,
+		finishedAt.Sub(run.StartedAt).Round(time.Second))
+	if err := s.createRefreshNotification(pipeline, run); err != nil {
+		fmt.Printf("Warning: Failed to send refresh notification: %v\n", err)
+	}
+}
+
+func (s *BackupService) saveRefreshRun(run *RefreshRun) {
+	if err := s.backupRepo.UpdateRefreshRun(run); err != nil {
+		fmt.Printf("Warning: Failed to record progress of refresh run %s: %v\n", run.ID, err)
+	}
+}
+
+func (s *BackupService) heartbeatRefreshRun(id string, stop <-chan struct{}) {
+	ticker := time.NewTicker(restoreHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.backupRepo.TouchRefreshRun(id); err != nil {
+				fmt.Printf("Warning: Failed to record heartbeat of refresh run %s: %v\n", id, err)
+			}
+		}
+	}
+}
+
+// refreshBackup takes a fresh backup of the pipeline's source database and
+// labels it with the pipeline
+func (s *BackupService) refreshBackup(pipeline *RefreshPipeline) (*Backup, error) {
+	conn, err := s.connStorage.GetConnection(pipeline.SourceConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source connection: %v", err)
+	}
+
+	database := pipeline.SourceDatabase
+	if database == "" {
+		database = conn.DatabaseName
+	}
+	// The dump command reads the database from the connection
+	conn.DatabaseName = database
+	backup, err := s.createSingleDatabaseBackup(conn, database, backupRunOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{refreshPipelineLabel: pipeline.ID.String()}
+	if err := s.backupRepo.UpdateBackupMetadata(backup.ID.String(), labels, nil); err != nil {
+		fmt.Printf("Warning: Failed to label refresh backup %s: %v\n", backup.ID, err)
+	}
+	return backup, nil
+}
+
+// pruneRefreshBackups moves the source backups of a pipeline's earlier runs
+// to the trash once a run succeeded with a newer one. They don't belong to a
+// schedule, so schedule retention would never prune them.
+func (s *BackupService) pruneRefreshBackups(pipeline *RefreshPipeline, keep *Backup) {
+	backups, err := s.backupRepo.GetBackupsByLabel(refreshPipelineLabel, pipeline.ID.String())
+	if err != nil {
+		fmt.Printf("Warning: Failed to get source backups of refresh pipeline %s: %v\n", pipeline.ID, err)
+		return
+	}
+
+	for _, backup := range backups {
+		if backup.ID == keep.ID {
+			continue
+		}
+
+		conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to get connection of backup %s: %v\n", backup.ID, err)
+			continue
+		}
+		if err := s.trashBackup(backup, conn, TrashReasonRetention, audit.ActorSystem); err != nil && !errors.Is(err, errBackupProtected) {
+			fmt.Printf("Warning: Failed to move refresh backup %s to trash: %v\n", backup.ID, err)
+		}
+	}
+}
+
+// refreshRestore replaces the target database with the source backup. It
+// runs as a regular restore job, so it shows in the restore history, takes
+// the target lock and snapshots production targets.
+func (s *BackupService) refreshRestore(pipeline *RefreshPipeline, backup *Backup) (*RestoreJob, error) {
+	conn, err := s.connStorage.GetConnection(pipeline.TargetConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target connection: %v", err)
+	}
+
+	// The pipeline's definition stands in for the drop confirmation
+	req := &RestoreRequest{
+		BackupID:        backup.ID.String(),
+		ConnectionID:    conn.ID,
+		TargetDatabase:  pipeline.TargetDatabase,
+		CreateIfMissing: true,
+		DropExisting:    true,
+		Owner:           pipeline.Options.Owner,
+		Encoding:        pipeline.Options.Encoding,
+		SafetySnapshot:  pipeline.Options.SafetySnapshot,
+		// Masking runs before the post-restore scripts see the data
+		MaskingProfileID: pipeline.Options.MaskingProfileID,
+	}
+	job, err := s.createRestoreJob(pipeline.UserID, backup, conn, req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.runRestoreJob(job)
+	if job.Status == RestoreJobFailed {
+		reason := "restore failed"
+		if job.Error != nil {
+			reason = *job.Error
+		}
+		return job, errors.New(reason)
+	}
+	return job, nil
+}
+
+// runPostRestoreScript runs one script against the refreshed target in its
+// own transaction
+func (s *BackupService) runPostRestoreScript(pipeline *RefreshPipeline, script RefreshScript) error {
+	conn, err := s.connStorage.GetConnection(pipeline.TargetConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get target connection: %v", err)
+	}
+
+	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
+	if err != nil {
+		return fmt.Errorf("failed to setup SSH tunnel: %v", err)
+	}
+	if tunnel != nil {
+		defer tunnel.Stop()
+		conn.Host = effectiveHost
+		conn.Port = effectivePort
+	}
+
+	db, err := openRestoreDB(conn, pipeline.TargetDatabase)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database: %v", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script.SQL); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// runRefreshScheduler starts scheduled pipelines when they are due. A
+// pipeline that was due several times while no replica ran it runs once.
+func (s *BackupService) runRefreshScheduler() {
+	ticker := time.NewTicker(refreshSchedulerInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if s.scheduler.IsLeader() {
+			s.startDueRefreshPipelines(time.Now())
+		}
+	}
+}
+
+func (s *BackupService) startDueRefreshPipelines(now time.Time) {
+	pipelines, err := s.backupRepo.GetDueRefreshPipelines(now)
+	if err != nil {
+		fmt.Printf("Error fetching due refresh pipelines: %v\n", err)
+		return
+	}
+
+	for _, pipeline := range pipelines {
+		pipelineID := pipeline.ID.String()
+		// Claims keep a fire time from running twice while leadership changes
+		if !s.scheduler.Claim(pipelineID, *pipeline.NextRunTime) {
+			continue
+		}
+
+		schedule, err := parseCronSchedule(*pipeline.CronSchedule, pipeline.Timezone)
+		if err != nil {
+			fmt.Printf("Error scheduling refresh pipeline %s: %v\n", pipelineID, err)
+			continue
+		}
+		nextRun := schedule.Next(now)
+		if err := s.backupRepo.SetRefreshPipelineNextRun(pipelineID, &nextRun); err != nil {
+			fmt.Printf("Warning: Failed to advance refresh pipeline %s: %v\n", pipelineID, err)
+		}
+
+		if _, err := s.startRefreshRun(pipeline, RunTriggerSchedule); err != nil {
+			fmt.Printf("Skipping scheduled run of refresh pipeline %s: %v\n", pipelineID, err)
+		}
+	}
+}
+
+// failStaleRefreshRuns fails runs left running by a replica that stopped,
+// which would otherwise keep their pipeline from running again
+func (s *BackupService) failStaleRefreshRuns() {
+	cutoff := time.Now().Add(-restoreJobStaleAfter)
+	runs, err := s.backupRepo.GetStaleRefreshRuns(cutoff)
+	if err != nil {
+		fmt.Printf("Error fetching stale refresh runs: %v\n", err)
+		return
+	}
+
+	for _, run := range runs {
+		message := "refresh was interrupted because the server running it stopped"
+		failed, err := s.backupRepo.FailStaleRefreshRun(run.ID.String(), cutoff, message)
+		if err != nil {
+			fmt.Printf("Warning: Failed to fail stale refresh run %s: %v\n", run.ID, err)
+			continue
+		}
+		if !failed {
+			// The run sent a heartbeat or finished meanwhile
+			continue
+		}
+
+		pipeline, err := s.backupRepo.GetRefreshPipeline(run.PipelineID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to get refresh pipeline %s: %v\n", run.PipelineID, err)
+			continue
+		}
+
+		finishedAt := time.Now()
+		run.Status = RefreshFailed
+		run.Error = &message
+		run.FinishedAt = &finishedAt
+		if err := s.createRefreshNotification(pipeline, run); err != nil {
+			fmt.Printf("Warning: Failed to send refresh notification: %v\n", err)
+		}
+	}
+}
+
+func (s *BackupService) ListRefreshRuns(userID uuid.UUID, id string, limit, offset int) ([]*RefreshRun, int, error) {
+	if _, err := s.GetRefreshPipeline(userID, id); err != nil {
+		return nil, 0, err
+	}
+	return s.backupRepo.GetRefreshRuns(id, limit, offset)
+}
+
+func validateRefreshPipelineRequest(req *RefreshPipelineRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.SourceConnectionID == "" {
+		return fmt.Errorf("source_connection_id is required")
+	}
+	if req.TargetConnectionID == "" {
+		return fmt.Errorf("target_connection_id is required")
+	}
+	if strings.TrimSpace(req.TargetDatabase) == "" {
+		return fmt.Errorf("target_database is required")
+	}
+
+	// The restore step takes the same options as a restore request
+	if err := validateRestoreRequest(&RestoreRequest{
+		BackupID:       "pipeline",
+		ConnectionID:   req.TargetConnectionID,
+		TargetDatabase: req.TargetDatabase,
+		Owner:          req.Options.Owner,
+		Encoding:       req.Options.Encoding,
+	}); err != nil {
+		return err
+	}
+
+	if len(req.PostRestoreScripts) > maxPostRestoreScripts {
+		return fmt.Errorf("a pipeline can have at most %d post-restore scripts", maxPostRestoreScripts)
+	}
+	for i, script := range req.PostRestoreScripts {
+		name := strings.TrimSpace(script.Name)
+		if name == "" {
+			return fmt.Errorf("post-restore script %d needs a name", i+1)
+		}
+		if strings.TrimSpace(script.SQL) == "" {
+			return fmt.Errorf("post-restore script %q has no SQL", name)
+		}
+		if len(script.SQL) > maxPostRestoreScriptBytes {
+			return fmt.Errorf("post-restore script %q is longer than %d bytes", name, maxPostRestoreScriptBytes)
+		}
+		req.PostRestoreScripts[i].Name = name
+	}
+
+	if req.CronSchedule != nil && strings.TrimSpace(*req.CronSchedule) != "" {
+		if _, err := parseCronSchedule(*req.CronSchedule, strings.TrimSpace(req.Timezone)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *BackupHandler) ListRefreshPipelines(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pipelines, err := h.backupService.ListRefreshPipelines(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Refresh pipelines retrieved successfully", pipelines)
+}
+
+func (h *BackupHandler) GetRefreshPipeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	pipeline, err := h.backupService.GetRefreshPipeline(userID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Refresh pipeline not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Refresh pipeline retrieved successfully", pipeline)
+}
+
+func (h *BackupHandler) CreateRefreshPipeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req RefreshPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateRefreshPipelineRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pipeline, err := h.backupService.CreateRefreshPipeline(userID, &req)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+		case errors.Is(err, errRefreshPipelineInvalid):
+			response.SendError(w, http.StatusBadRequest, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Refresh pipeline created successfully", pipeline)
+}
+
+func (h *BackupHandler) UpdateRefreshPipeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req RefreshPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateRefreshPipelineRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pipeline, err := h.backupService.UpdateRefreshPipeline(userID, id, &req)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Refresh pipeline or connection not found")
+		case errors.Is(err, errRefreshPipelineInvalid):
+			response.SendError(w, http.StatusBadRequest, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Refresh pipeline updated successfully", pipeline)
+}
+
+func (h *BackupHandler) DeleteRefreshPipeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := h.backupService.DeleteRefreshPipeline(userID, id); err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Refresh pipeline not found")
+		case err == errRefreshRunning:
+			response.SendError(w, http.StatusConflict, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Refresh pipeline deleted successfully", nil)
+}
+
+func (h *BackupHandler) RunRefreshPipeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	run, err := h.backupService.RunRefreshPipeline(userID, id)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Refresh pipeline not found")
+		case err == errRefreshRunning:
+			response.SendError(w, http.StatusConflict, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Refresh started successfully", run)
+}
+
+func (h *BackupHandler) ListRefreshRuns(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	page := 1
+	limit := 10
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	runs, total, err := h.backupService.ListRefreshRuns(userID, id, limit, (page-1)*limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Refresh pipeline not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendPaginatedSuccess(w, "Refresh runs retrieved successfully", runs, page, limit, total)
+}
@@ -2,6 +2,7 @@ package backup
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -20,7 +21,23 @@ func NewBackupRepository(db *sql.DB) *BackupRepository {
 	}
 }
 
+const scheduleColumns = `
+	id, connection_id, COALESCE(name, ''), enabled, cron_schedule, COALESCE(timezone, ''), retention_days,
+	COALESCE(options, ''), COALESCE(destinations, ''), COALESCE(retry_policy, ''),
+	COALESCE(misfire_policy, 'run_once'), COALESCE(misfire_grace_minutes, 0), COALESCE(notifications, ''), policy_id,
+	next_run_time, last_backup_time, created_at, updated_at`
+
+// execer is satisfied by both *sql.DB and *sql.Tx, so writes can join a
+// transaction when they are part of a larger change
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 func (r *BackupRepository) CreateBackupSchedule(schedule *BackupSchedule) error {
+	return createBackupSchedule(r.db, schedule)
+}
+
+func createBackupSchedule(ex execer, schedule *BackupSchedule) error {
 	var nextRunStr *string
 	if schedule.NextRunTime != nil {
 		str := schedule.NextRunTime.Format(time.RFC3339)
@@ -33,19 +50,32 @@ func (r *BackupRepository) CreateBackupSchedule(schedule *BackupSchedule) error
 		lastBackupStr = &str
 	}
 
+	settings, err := encodeScheduleSettings(schedule.Options, schedule.Destinations, schedule.RetryPolicy, schedule.Notifications)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now().Format(time.RFC3339)
-	_, err := r.db.Exec(`
+	_, err = ex.Exec(`
 		INSERT INTO backup_schedules (
-			id, connection_id, enabled, cron_schedule, retention_days,
+			id, connection_id, name, enabled, cron_schedule, timezone, retention_days, options, destinations,
+			retry_policy, misfire_policy, misfire_grace_minutes, notifications, policy_id,
 			next_run_time, last_backup_time, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
-		schedule.ID, schedule.ConnectionID, schedule.Enabled,
-		schedule.CronSchedule, schedule.RetentionDays,
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+		schedule.ID, schedule.ConnectionID, schedule.Name, schedule.Enabled,
+		schedule.CronSchedule, schedule.Timezone, schedule.RetentionDays, settings.options, settings.destinations,
+		settings.retryPolicy,
+		misfirePolicyOrDefault(schedule.MisfirePolicy), schedule.MisfireGraceMinutes,
+		settings.notifications, schedule.PolicyID,
 		nextRunStr, lastBackupStr, now, now)
 	return err
 }
 
 func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error {
+	return updateBackupSchedule(r.db, schedule)
+}
+
+func updateBackupSchedule(ex execer, schedule *BackupSchedule) error {
 	var nextRunStr *string
 	if schedule.NextRunTime != nil {
 		str := schedule.NextRunTime.Format(time.RFC3339)
@@ -58,24 +88,45 @@ func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error
 		lastBackupStr = &str
 	}
 
+	settings, err := encodeScheduleSettings(schedule.Options, schedule.Destinations, schedule.RetryPolicy, schedule.Notifications)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE backup_schedules 
-		SET enabled = $1, 
-		    cron_schedule = $2, 
-		    retention_days = $3, 
-		    next_run_time = $4,
-		    last_backup_time = $5,
-		    updated_at = $6
-		WHERE id = $7
+		SET name = $1,
+		    enabled = $2, 
+		    cron_schedule = $3, 
+		    timezone = $4,
+		    retention_days = $5, 
+		    options = $6,
+		    destinations = $7,
+		    retry_policy = $8,
+		    misfire_policy = $9,
+		    misfire_grace_minutes = $10,
+		    notifications = $11,
+		    next_run_time = $12,
+		    last_backup_time = $13,
+		    updated_at = $14
+		WHERE id = $15
 	`
 
-	_, err := r.db.Exec(query,
+	_, err = ex.Exec(query,
+		schedule.Name,
 		schedule.Enabled,
 		schedule.CronSchedule,
+		schedule.Timezone,
 		schedule.RetentionDays,
+		settings.options,
+		settings.destinations,
+		settings.retryPolicy,
+		misfirePolicyOrDefault(schedule.MisfirePolicy),
+		schedule.MisfireGraceMinutes,
+		settings.notifications,
 		nextRunStr,
 		lastBackupStr,
-		time.Now(),
+		time.Now().Format(time.RFC3339),
 		schedule.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update backup schedule: %v", err)
@@ -84,28 +135,153 @@ func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error
 	return nil
 }
 
+// GetBackupSchedule returns the most recently created schedule of a
+// connection that isn't managed by a backup policy
 func (r *BackupRepository) GetBackupSchedule(connectionID string) (*BackupSchedule, error) {
+	row := r.db.QueryRow(`
+		SELECT `+scheduleColumns+`
+		FROM backup_schedules 
+		WHERE connection_id = $1 AND policy_id IS NULL
+		ORDER BY created_at DESC LIMIT 1`,
+		connectionID)
+	return scanSchedule(row)
+}
+
+func (r *BackupRepository) GetBackupScheduleByID(id string) (*BackupSchedule, error) {
+	row := r.db.QueryRow(`
+		SELECT `+scheduleColumns+`
+		FROM backup_schedules 
+		WHERE id = $1`,
+		id)
+	return scanSchedule(row)
+}
+
+func (r *BackupRepository) GetSchedulesByConnectionID(connectionID string) ([]*BackupSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT `+scheduleColumns+`
+		FROM backup_schedules 
+		WHERE connection_id = $1
+		ORDER BY created_at ASC`,
+		connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSchedules(rows)
+}
+
+// GetSchedulesByUserID returns the schedules of every connection owned by a user
+func (r *BackupRepository) GetSchedulesByUserID(userID uuid.UUID) ([]*BackupSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT `+scheduleColumns+`
+		FROM backup_schedules
+		WHERE connection_id IN (SELECT id FROM connections WHERE user_id = $1)
+		ORDER BY created_at ASC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSchedules(rows)
+}
+
+func (r *BackupRepository) GetSchedulesByPolicyID(policyID string) ([]*BackupSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT `+scheduleColumns+`
+		FROM backup_schedules
+		WHERE policy_id = $1
+		ORDER BY created_at ASC`,
+		policyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSchedules(rows)
+}
+
+func (r *BackupRepository) GetAllActiveSchedules() ([]*BackupSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + scheduleColumns + `
+		FROM backup_schedules 
+		WHERE enabled = true
+		ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSchedules(rows)
+}
+
+// DeleteBackupSchedule removes a schedule. Backups it produced are kept and
+// no longer point at a schedule.
+func (r *BackupRepository) DeleteBackupSchedule(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteBackupSchedule(tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func deleteBackupSchedule(tx *sql.Tx, id string) error {
+	if _, err := tx.Exec("UPDATE backups SET schedule_id = NULL WHERE schedule_id = $1", id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM backup_schedules WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+type scheduleScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSchedule(row scheduleScanner) (*BackupSchedule, error) {
 	var (
-		nextRunStr    sql.NullString
-		lastBackupStr sql.NullString
-		createdAtStr  string
-		updatedAtStr  string
+		optionsStr      string
+		destinationsStr string
+		retryPolicyStr  string
+		notificationStr string
+		policyID        sql.NullString
+		nextRunStr      sql.NullString
+		lastBackupStr   sql.NullString
+		createdAtStr    string
+		updatedAtStr    string
 	)
 	schedule := &BackupSchedule{}
-	err := r.db.QueryRow(`
-		SELECT id, connection_id, enabled, cron_schedule, retention_days,
-		       next_run_time, last_backup_time, created_at, updated_at 
-		FROM backup_schedules 
-		WHERE connection_id = $1
-		ORDER BY created_at DESC LIMIT 1`,
-		connectionID).Scan(
-		&schedule.ID, &schedule.ConnectionID, &schedule.Enabled,
-		&schedule.CronSchedule, &schedule.RetentionDays,
+	err := row.Scan(
+		&schedule.ID, &schedule.ConnectionID, &schedule.Name, &schedule.Enabled,
+		&schedule.CronSchedule, &schedule.Timezone, &schedule.RetentionDays,
+		&optionsStr, &destinationsStr, &retryPolicyStr,
+		&schedule.MisfirePolicy, &schedule.MisfireGraceMinutes, &notificationStr, &policyID,
 		&nextRunStr, &lastBackupStr, &createdAtStr, &updatedAtStr)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := decodeScheduleSettings(optionsStr, destinationsStr, retryPolicyStr, notificationStr,
+		&schedule.Options, &schedule.Destinations, &schedule.RetryPolicy, &schedule.Notifications); err != nil {
+		return nil, err
+	}
+	if policyID.Valid {
+		schedule.PolicyID = &policyID.String
+	}
+
 	// Parse next_run_time if not null
 	if nextRunStr.Valid {
 		nextRun, err := common.ParseTime(nextRunStr.String)
@@ -140,70 +316,89 @@ func (r *BackupRepository) GetBackupSchedule(connectionID string) (*BackupSchedu
 	return schedule, nil
 }
 
-func (r *BackupRepository) GetAllActiveSchedules() ([]*BackupSchedule, error) {
-	rows, err := r.db.Query(`
-		SELECT id, connection_id, enabled, cron_schedule, retention_days,
-		       next_run_time, last_backup_time, created_at, updated_at 
-		FROM backup_schedules 
-		WHERE enabled = true
-		ORDER BY created_at DESC`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var schedules []*BackupSchedule
+func scanSchedules(rows *sql.Rows) ([]*BackupSchedule, error) {
+	schedules := make([]*BackupSchedule, 0)
 	for rows.Next() {
-		var (
-			nextRunStr    sql.NullString
-			lastBackupStr sql.NullString
-			createdAtStr  string
-			updatedAtStr  string
-		)
-		schedule := &BackupSchedule{}
-		err := rows.Scan(
-			&schedule.ID, &schedule.ConnectionID, &schedule.Enabled,
-			&schedule.CronSchedule, &schedule.RetentionDays,
-			&nextRunStr, &lastBackupStr, &createdAtStr, &updatedAtStr)
+		schedule, err := scanSchedule(rows)
 		if err != nil {
 			return nil, err
 		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
 
-		// Parse next_run_time if not null
-		if nextRunStr.Valid {
-			nextRun, err := common.ParseTime(nextRunStr.String)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing next_run_time: %v", err)
-			}
-			schedule.NextRunTime = &nextRun
-		}
+func misfirePolicyOrDefault(policy string) string {
+	if policy == "" {
+		return MisfireRunOnce
+	}
+	return policy
+}
 
-		// Parse last_backup_time if not null
-		if lastBackupStr.Valid {
-			lastBackup, err := common.ParseTime(lastBackupStr.String)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing last_backup_time: %v", err)
-			}
-			schedule.LastBackupTime = &lastBackup
-		}
+// scheduleSettings holds the JSON columns shared by schedules and policies
+type scheduleSettings struct {
+	options       string
+	destinations  string
+	retryPolicy   string
+	notifications string
+}
 
-		// Parse created_at and updated_at
-		createdAt, err := common.ParseTime(createdAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing created_at: %v", err)
-		}
-		schedule.CreatedAt = createdAt
+func encodeScheduleSettings(options BackupOptions, destinations []string, retryPolicy RetryPolicy, notifications NotificationRules) (*scheduleSettings, error) {
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schedule options: %v", err)
+	}
 
-		updatedAt, err := common.ParseTime(updatedAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing updated_at: %v", err)
-		}
-		schedule.UpdatedAt = updatedAt
+	destinationsJSON, err := json.Marshal(nonNilStrings(destinations))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schedule destinations: %v", err)
+	}
 
-		schedules = append(schedules, schedule)
+	retryPolicyJSON, err := json.Marshal(retryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schedule retry policy: %v", err)
 	}
 
-	return schedules, rows.Err()
+	notificationsJSON, err := json.Marshal(notifications)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schedule notifications: %v", err)
+	}
+
+	return &scheduleSettings{
+		options:       string(optionsJSON),
+		destinations:  string(destinationsJSON),
+		retryPolicy:   string(retryPolicyJSON),
+		notifications: string(notificationsJSON),
+	}, nil
+}
+
+// decodeScheduleSettings parses the JSON columns written by
+// encodeScheduleSettings. Rows from before notification rules existed only
+// notify on failure.
+func decodeScheduleSettings(optionsStr, destinationsStr, retryPolicyStr, notificationsStr string,
+	options *BackupOptions, destinations *[]string, retryPolicy *RetryPolicy, notifications *NotificationRules) error {
+	if optionsStr != "" {
+		if err := json.Unmarshal([]byte(optionsStr), options); err != nil {
+			return fmt.Errorf("error parsing schedule options: %v", err)
+		}
+	}
+	if destinationsStr != "" {
+		if err := json.Unmarshal([]byte(destinationsStr), destinations); err != nil {
+			return fmt.Errorf("error parsing schedule destinations: %v", err)
+		}
+	}
+	if retryPolicyStr != "" {
+		if err := json.Unmarshal([]byte(retryPolicyStr), retryPolicy); err != nil {
+			return fmt.Errorf("error parsing schedule retry policy: %v", err)
+		}
+	}
+	*notifications = defaultNotificationRules
+	if notificationsStr != "" {
+		if err := json.Unmarshal([]byte(notificationsStr), notifications); err != nil {
+			return fmt.Errorf("error parsing schedule notifications: %v", err)
+		}
+	}
+	return nil
 }
 
 // Backup Methods
@@ -211,13 +406,16 @@ func (r *BackupRepository) GetAllActiveSchedules() ([]*BackupSchedule, error) {
 func (r *BackupRepository) CreateBackup(backup *Backup) error {
 	_, err := r.db.Exec(`
 		INSERT INTO backups (
-			id, connection_id, schedule_id, status, path, s3_object_key, size,
-			started_time, completed_time, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-		backup.ID, backup.ConnectionID, backup.ScheduleID,
-		backup.Status, backup.Path, backup.S3ObjectKey, backup.Size,
+			id, connection_id, schedule_id, database_name, status, path, s3_object_key, s3_bucket, storage_tier,
+			compression, size, started_time, completed_time, created_at, updated_at, checksum,
+			masked, masking_profile_id, imported, format, original_filename
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)`,
+		backup.ID, backup.ConnectionID, backup.ScheduleID, backup.DatabaseName,
+		backup.Status, backup.Path, backup.S3ObjectKey, backup.S3Bucket, backup.StorageTier,
+		backup.Compression, backup.Size,
 		backup.StartedTime, backup.CompletedTime,
-		backup.CreatedAt, backup.UpdatedAt)
+		backup.CreatedAt, backup.UpdatedAt, backup.Checksum,
+		backup.Masked, backup.MaskingProfileID, backup.Imported, backup.Format, backup.OriginalFilename)
 	return err
 }
 
@@ -227,35 +425,44 @@ func (r *BackupRepository) UpdateBackupStatus(id string, status string) error {
 	return err
 }
 
-func (r *BackupRepository) GetBackupsOlderThan(connectionID string, cutoffTime time.Time) ([]*Backup, error) {
+// GetBackupsOlderThan returns the completed backups a schedule produced before
+// cutoffTime. A nil scheduleID returns the connection's backups no schedule
+// produced, such as manual and imported backups.
+func (r *BackupRepository) GetBackupsOlderThan(connectionID string, scheduleID *string, cutoffTime time.Time) ([]*Backup, error) {
 	rows, err := r.db.Query(`
-		SELECT id, path, s3_object_key, created_at 
-		FROM backups 
-		WHERE connection_id = $1 
-		AND created_at < $2 
-		AND status = 'completed'`,
-		connectionID, cutoffTime)
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE connection_id = $1
+		AND (schedule_id = $2 OR ($2 IS NULL AND schedule_id IS NULL))
+		AND created_at < $3
+		AND status = 'completed'
+		AND deleted_at IS NULL
+		AND NOT COALESCE(pinned, false) AND NOT COALESCE(legal_hold, false)`,
+		connectionID, scheduleID, cutoffTime)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var backups []*Backup
-	for rows.Next() {
-		backup := &Backup{}
-		var createdAtStr string
-		err := rows.Scan(&backup.ID, &backup.Path, &backup.S3ObjectKey, &createdAtStr)
-		if err != nil {
-			return nil, err
-		}
-		createdAt, err := common.ParseTime(createdAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing created_at: %v", err)
-		}
-		backup.CreatedAt = createdAt
-		backups = append(backups, backup)
+	return scanBackups(rows)
+}
+
+// GetBackupsByLabel returns the backups outside the trash carrying a label,
+// newest first
+func (r *BackupRepository) GetBackupsByLabel(key, value string) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM json_each(labels) WHERE key = $1 AND value = $2)
+		ORDER BY created_at DESC`,
+		key, value)
+	if err != nil {
+		return nil, err
 	}
-	return backups, rows.Err()
+	defer rows.Close()
+
+	return scanBackups(rows)
 }
 
 func (r *BackupRepository) DeleteBackup(id string) error {
@@ -263,26 +470,52 @@ func (r *BackupRepository) DeleteBackup(id string) error {
 	return err
 }
 
+// backupColumns is the column list scanBackup reads
+const backupColumns = `
+	id, connection_id, schedule_id, COALESCE(database_name, ''), status, path, s3_object_key, s3_bucket,
+	COALESCE(storage_tier, 'local'), COALESCE(compression, ''), size,
+	started_time, completed_time, created_at, updated_at,
+	COALESCE(pinned, false), COALESCE(legal_hold, false), legal_hold_reason,
+	deleted_at, purge_after, delete_reason, COALESCE(labels, ''), notes, checksum,
+	COALESCE(masked, false), masking_profile_id,
+	COALESCE(imported, false), format, original_filename`
+
+// GetBackup returns a backup that isn't in the trash
 func (r *BackupRepository) GetBackup(id string) (*Backup, error) {
+	row := r.db.QueryRow(`
+		SELECT `+backupColumns+`
+		FROM backups WHERE id = $1 AND deleted_at IS NULL`, id)
+	return scanBackup(row)
+}
+
+func scanBackup(row scheduleScanner) (*Backup, error) {
 	var (
 		startedTimeStr   string
 		completedTimeStr sql.NullString
 		createdAtStr     string
 		updatedAtStr     string
+		deletedAtStr     sql.NullString
+		purgeAfterStr    sql.NullString
+		labelsStr        string
 	)
 	backup := &Backup{}
-	err := r.db.QueryRow(`
-		SELECT id, connection_id, schedule_id, status, path, s3_object_key, size,
-			   started_time, completed_time, created_at, updated_at 
-		FROM backups WHERE id = $1`, id).
-		Scan(&backup.ID, &backup.ConnectionID, &backup.ScheduleID,
-			&backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.Size,
-			&startedTimeStr, &completedTimeStr,
-			&createdAtStr, &updatedAtStr)
+	err := row.Scan(&backup.ID, &backup.ConnectionID, &backup.ScheduleID, &backup.DatabaseName,
+		&backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.S3Bucket,
+		&backup.StorageTier, &backup.Compression, &backup.Size,
+		&startedTimeStr, &completedTimeStr,
+		&createdAtStr, &updatedAtStr,
+		&backup.Pinned, &backup.LegalHold, &backup.LegalHoldReason,
+		&deletedAtStr, &purgeAfterStr, &backup.DeleteReason, &labelsStr, &backup.Notes, &backup.Checksum,
+		&backup.Masked, &backup.MaskingProfileID,
+		&backup.Imported, &backup.Format, &backup.OriginalFilename)
 	if err != nil {
 		return nil, err
 	}
 
+	if backup.Labels, err = decodeLabels(labelsStr); err != nil {
+		return nil, err
+	}
+
 	// Parse started_time
 	startedTime, err := common.ParseTime(startedTimeStr)
 	if err != nil {
@@ -312,19 +545,105 @@ func (r *BackupRepository) GetBackup(id string) (*Backup, error) {
 	}
 	backup.UpdatedAt = updatedAt
 
+	if backup.DeletedAt, err = parseNullableTime(deletedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing deleted_at: %v", err)
+	}
+	if backup.PurgeAfter, err = parseNullableTime(purgeAfterStr); err != nil {
+		return nil, fmt.Errorf("error parsing purge_after: %v", err)
+	}
+
 	return backup, nil
 }
 
-func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) ([]*BackupList, int, error) {
-	whereClause := "WHERE c.user_id = $1"
+func scanBackups(rows *sql.Rows) ([]*Backup, error) {
+	var backups []*Backup
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+	return backups, rows.Err()
+}
+
+// backupListSortColumns maps the sort options of the backup catalog to columns
+var backupListSortColumns = map[string]string{
+	BackupSortCreatedAt:     "b.created_at",
+	BackupSortCompletedTime: "b.completed_time",
+	BackupSortSize:          "b.size",
+	BackupSortDatabaseName:  "COALESCE(NULLIF(b.database_name, ''), c.database_name)",
+	BackupSortStatus:        "b.status",
+}
+
+// backupListFilter builds the WHERE clause of the backup catalog from the
+// list options
+func backupListFilter(opts BackupListOptions) (string, []interface{}) {
+	whereClause := "WHERE c.user_id = $1 AND b.deleted_at IS NULL"
 	args := []interface{}{opts.UserID}
-	argCount := 2
+	add := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		whereClause += " AND " + fmt.Sprintf(condition, placeholders...)
+	}
 
 	if opts.Search != "" {
-		whereClause += fmt.Sprintf(" AND (LOWER(b.path) LIKE $%d OR LOWER(b.status) LIKE $%d)", argCount, argCount)
-		args = append(args, "%"+strings.ToLower(opts.Search)+"%")
-		argCount++
+		add("(LOWER(b.path) LIKE $%[1]d OR LOWER(b.status) LIKE $%[1]d OR LOWER(COALESCE(b.notes, '')) LIKE $%[1]d)",
+			"%"+strings.ToLower(opts.Search)+"%")
+	}
+	if opts.ConnectionID != "" {
+		add("b.connection_id = $%d", opts.ConnectionID)
+	}
+	if opts.DatabaseName != "" {
+		add("COALESCE(NULLIF(b.database_name, ''), c.database_name) = $%d", opts.DatabaseName)
+	}
+	if opts.Status != "" {
+		add("b.status = $%d", opts.Status)
+	}
+	if opts.ScheduleID != "" {
+		add("b.schedule_id = $%d", opts.ScheduleID)
+	}
+	for _, label := range opts.Labels {
+		if label.Value != nil {
+			add("EXISTS (SELECT 1 FROM json_each(b.labels) WHERE key = $%d AND value = $%d)", label.Key, *label.Value)
+		} else {
+			add("EXISTS (SELECT 1 FROM json_each(b.labels) WHERE key = $%d)", label.Key)
+		}
+	}
+	// created_at is stored in more than one layout, datetime() normalizes it
+	if opts.CreatedAfter != nil {
+		add("datetime(b.created_at) >= datetime($%d)", opts.CreatedAfter.UTC().Format("2006-01-02 15:04:05"))
 	}
+	if opts.CreatedBefore != nil {
+		add("datetime(b.created_at) < datetime($%d)", opts.CreatedBefore.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if opts.MinSize != nil {
+		add("b.size >= $%d", *opts.MinSize)
+	}
+	if opts.MaxSize != nil {
+		add("b.size <= $%d", *opts.MaxSize)
+	}
+
+	return whereClause, args
+}
+
+func backupListOrder(opts BackupListOptions) string {
+	column, ok := backupListSortColumns[opts.Sort]
+	if !ok {
+		column = backupListSortColumns[BackupSortCreatedAt]
+	}
+	direction := "DESC"
+	if opts.Order == SortOrderAsc {
+		direction = "ASC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, b.id %s", column, direction, direction)
+}
+
+func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) ([]*BackupList, int, error) {
+	whereClause, args := backupListFilter(opts)
 
 	countQuery := fmt.Sprintf(`
 		SELECT COUNT(*) 
@@ -337,22 +656,43 @@ func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) (
 		return nil, 0, err
 	}
 
+	limitClause := fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, opts.Limit, opts.Offset)
+
+	backups, err := r.queryBackupList(whereClause, backupListOrder(opts), limitClause, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	return backups, total, nil
+}
+
+// GetAllBackups returns every backup matching the list options, ignoring
+// Limit and Offset
+func (r *BackupRepository) GetAllBackups(opts BackupListOptions) ([]*BackupList, error) {
+	whereClause, args := backupListFilter(opts)
+	return r.queryBackupList(whereClause, backupListOrder(opts), "", args)
+}
+
+func (r *BackupRepository) queryBackupList(whereClause, orderClause, limitClause string, args []interface{}) ([]*BackupList, error) {
 	query := fmt.Sprintf(`
 		SELECT 
-			b.id, b.connection_id, c.type, b.schedule_id, b.status, b.path, b.s3_object_key, b.size,
+			b.id, b.connection_id, c.type, b.schedule_id, b.status, b.path, b.s3_object_key, b.s3_bucket,
+			COALESCE(b.storage_tier, 'local'), COALESCE(b.compression, ''), b.size,
 			b.started_time, b.completed_time, b.created_at, b.updated_at,
-			c.database_name
+			COALESCE(NULLIF(b.database_name, ''), c.database_name),
+			COALESCE(b.pinned, false), COALESCE(b.legal_hold, false),
+			COALESCE(b.labels, ''), b.notes, COALESCE(b.masked, false),
+			COALESCE(b.imported, false), b.checksum, b.format
 		FROM backups b
 		INNER JOIN connections c ON b.connection_id = c.id
 		%s
-		ORDER BY b.created_at DESC
-		LIMIT $%d OFFSET $%d
-	`, whereClause, argCount, argCount+1)
+		%s
+		%s
+	`, whereClause, orderClause, limitClause)
 
-	args = append(args, opts.Limit, opts.Offset)
 	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -363,37 +703,79 @@ func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) (
 			completedTimeStr sql.NullString
 			createdAtStr     string
 			updatedAtStr     string
+			labelsStr        string
 		)
 		backup := &BackupList{}
 		err := rows.Scan(
 			&backup.ID, &backup.ConnectionID, &backup.DatabaseType,
-			&backup.ScheduleID, &backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.Size,
+			&backup.ScheduleID, &backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.S3Bucket,
+			&backup.StorageTier, &backup.Compression, &backup.Size,
 			&startedTimeStr, &completedTimeStr,
 			&createdAtStr, &updatedAtStr,
 			&backup.DatabaseName,
+			&backup.Pinned, &backup.LegalHold,
+			&labelsStr, &backup.Notes, &backup.Masked,
+			&backup.Imported, &backup.Checksum, &backup.Format,
 		)
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 
 		backup.StartedTime = startedTimeStr.String
 		backup.CompletedTime = completedTimeStr.String
 		backup.CreatedAt = createdAtStr
 		backup.UpdatedAt = updatedAtStr
+		if backup.Labels, err = decodeLabels(labelsStr); err != nil {
+			return nil, err
+		}
 
 		backups = append(backups, backup)
 	}
 
-	return backups, total, rows.Err()
+	return backups, rows.Err()
 }
 
-func (r *BackupRepository) UpdateBackupStatusAndSchedule(id string, status string, scheduleID string) error {
-	_, err := r.db.Exec(`
-		UPDATE backups 
-		SET status = $1, schedule_id = $2, updated_at = $3 
-		WHERE id = $4`,
-		status, scheduleID, time.Now().Format(time.RFC3339), id)
-	return err
+// UpdateBackupMetadata replaces the labels and notes of a backup
+func (r *BackupRepository) UpdateBackupMetadata(id string, labels map[string]string, notes *string) error {
+	labelsJSON, err := encodeLabels(labels)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE backups SET labels = $1, notes = $2, updated_at = $3
+		WHERE id = $4 AND deleted_at IS NULL`,
+		labelsJSON, notes, time.Now().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func encodeLabels(labels map[string]string) (string, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode labels: %v", err)
+	}
+	return string(data), nil
+}
+
+// decodeLabels parses the JSON labels column, which is empty for unlabeled backups
+func decodeLabels(labelsStr string) (map[string]string, error) {
+	labels := map[string]string{}
+	if labelsStr == "" {
+		return labels, nil
+	}
+	if err := json.Unmarshal([]byte(labelsStr), &labels); err != nil {
+		return nil, fmt.Errorf("failed to decode labels: %v", err)
+	}
+	return labels, nil
 }
 
 func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error) {
@@ -412,7 +794,7 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 				COALESCE(SUM(b.size), 0) as total_size
 		FROM backups b
 		INNER JOIN connections c ON b.connection_id = c.id
-		WHERE c.user_id = $1
+		WHERE c.user_id = $1 AND b.deleted_at IS NULL
 	`, userID).Scan(&stats.TotalBackups, &stats.FailedBackups, &stats.TotalSize)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -436,7 +818,7 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 			b.completed_time
 		FROM backups b
 		INNER JOIN connections c ON b.connection_id = c.id
-		WHERE c.user_id = $1 
+		WHERE c.user_id = $1 AND b.deleted_at IS NULL 
 		AND b.status = 'completed'
 		AND b.completed_time IS NOT NULL
 	`, userID)
@@ -473,12 +855,13 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 	return stats, nil
 }
 
+// GetBackupsByConnectionID returns the backups of a connection that aren't in
+// the trash, newest first
 func (r *BackupRepository) GetBackupsByConnectionID(connectionID string) ([]*Backup, error) {
 	rows, err := r.db.Query(`
-		SELECT id, connection_id, schedule_id, status, path, s3_object_key, size,
-		       started_time, completed_time, created_at, updated_at
+		SELECT `+backupColumns+`
 		FROM backups
-		WHERE connection_id = $1
+		WHERE connection_id = $1 AND deleted_at IS NULL
 		ORDER BY created_at DESC`,
 		connectionID)
 	if err != nil {
@@ -486,56 +869,1835 @@ func (r *BackupRepository) GetBackupsByConnectionID(connectionID string) ([]*Bac
 	}
 	defer rows.Close()
 
-	var backups []*Backup
-	for rows.Next() {
-		backup := &Backup{}
-		var startedTimeStr, createdAtStr, updatedAtStr string
-		var completedTimeStr sql.NullString
-
-		err := rows.Scan(
-			&backup.ID, &backup.ConnectionID, &backup.ScheduleID, &backup.Status,
-			&backup.Path, &backup.S3ObjectKey, &backup.Size,
-			&startedTimeStr, &completedTimeStr, &createdAtStr, &updatedAtStr,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		backup.StartedTime, err = common.ParseTime(startedTimeStr)
-		if err != nil {
-			return nil, err
-		}
+	return scanBackups(rows)
+}
 
-		if completedTimeStr.Valid {
-			completedTime, err := common.ParseTime(completedTimeStr.String)
-			if err != nil {
-				return nil, err
-			}
-			backup.CompletedTime = &completedTime
+func (r *BackupRepository) UpdateBackupS3ObjectKey(backupID string, s3ObjectKey string) error {
+	_, err := r.db.Exec(`
+		UPDATE backups 
+		SET s3_object_key = $1, updated_at = datetime('now') 
+		WHERE id = $2`,
+		s3ObjectKey, backupID)
+	return err
+}
+
+// UpdateBackupStorage records where a backup's artifacts currently live
+func (r *BackupRepository) UpdateBackupStorage(backup *Backup) error {
+	_, err := r.db.Exec(`
+		UPDATE backups 
+		SET s3_object_key = $1, s3_bucket = $2, storage_tier = $3, updated_at = $4 
+		WHERE id = $5`,
+		backup.S3ObjectKey, backup.S3Bucket, backup.StorageTier, time.Now().Format(time.RFC3339), backup.ID)
+	return err
+}
+
+// UpdateBackupLocation records a backup's new local path and S3 object key
+func (r *BackupRepository) UpdateBackupLocation(backup *Backup) error {
+	_, err := r.db.Exec(`
+		UPDATE backups 
+		SET path = $1, s3_object_key = $2, database_name = $3, updated_at = $4 
+		WHERE id = $5`,
+		backup.Path, backup.S3ObjectKey, backup.DatabaseName, time.Now().Format(time.RFC3339), backup.ID)
+	return err
+}
+
+// Trash Methods
+
+// SetBackupPinned pins or unpins a backup
+func (r *BackupRepository) SetBackupPinned(id string, pinned bool) error {
+	result, err := r.db.Exec(`
+		UPDATE backups SET pinned = $1, updated_at = $2
+		WHERE id = $3 AND deleted_at IS NULL`,
+		pinned, time.Now().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetBackupLegalHold places or releases a legal hold. The reason is cleared
+// when the hold is released.
+func (r *BackupRepository) SetBackupLegalHold(id string, enabled bool, reason *string) error {
+	result, err := r.db.Exec(`
+		UPDATE backups SET legal_hold = $1, legal_hold_reason = $2, updated_at = $3
+		WHERE id = $4 AND deleted_at IS NULL`,
+		enabled, reason, time.Now().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TrashBackup moves a backup to the trash until purgeAfter. Pinned and held
+// backups are never trashed; sql.ErrNoRows is returned for them.
+func (r *BackupRepository) TrashBackup(id string, deletedAt, purgeAfter time.Time, reason string) error {
+	result, err := r.db.Exec(`
+		UPDATE backups SET deleted_at = $1, purge_after = $2, delete_reason = $3, updated_at = $4
+		WHERE id = $5 AND deleted_at IS NULL
+		AND NOT COALESCE(pinned, false) AND NOT COALESCE(legal_hold, false)`,
+		deletedAt.UTC().Format(time.RFC3339), purgeAfter.UTC().Format(time.RFC3339), reason,
+		time.Now().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecoverBackup takes a backup out of the trash
+func (r *BackupRepository) RecoverBackup(id string) error {
+	result, err := r.db.Exec(`
+		UPDATE backups SET deleted_at = NULL, purge_after = NULL, delete_reason = NULL, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NOT NULL`,
+		time.Now().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *BackupRepository) GetTrashedBackup(id string) (*Backup, error) {
+	row := r.db.QueryRow(`
+		SELECT `+backupColumns+`
+		FROM backups WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	return scanBackup(row)
+}
+
+// GetTrashedBackups returns the user's trashed backups, most recently deleted first
+func (r *BackupRepository) GetTrashedBackups(userID uuid.UUID) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE deleted_at IS NOT NULL
+		AND connection_id IN (SELECT id FROM connections WHERE user_id = $1)
+		ORDER BY deleted_at DESC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backups, err := scanBackups(rows)
+	if backups == nil {
+		backups = []*Backup{}
+	}
+	return backups, err
+}
+
+func (r *BackupRepository) GetTrashedBackupsByConnectionID(connectionID string) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE connection_id = $1 AND deleted_at IS NOT NULL`,
+		connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanBackups(rows)
+}
+
+// GetExpiredTrash returns trashed backups whose recovery window ended before now
+func (r *BackupRepository) GetExpiredTrash(now time.Time) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE deleted_at IS NOT NULL AND purge_after <= $1
+		ORDER BY purge_after ASC`,
+		now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanBackups(rows)
+}
+
+// Lifecycle Methods
+
+func (r *BackupRepository) GetLifecycleRule(connectionID string) (*LifecycleRule, error) {
+	rows, err := r.db.Query(`
+		SELECT connection_id, enabled, local_days, s3_days, archive_days,
+		       archive_storage_class, archive_bucket, created_at, updated_at
+		FROM lifecycle_rules
+		WHERE connection_id = $1`, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules, err := scanLifecycleRules(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return rules[0], nil
+}
+
+func (r *BackupRepository) GetEnabledLifecycleRules() ([]*LifecycleRule, error) {
+	rows, err := r.db.Query(`
+		SELECT connection_id, enabled, local_days, s3_days, archive_days,
+		       archive_storage_class, archive_bucket, created_at, updated_at
+		FROM lifecycle_rules
+		WHERE enabled = true`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanLifecycleRules(rows)
+}
+
+func (r *BackupRepository) SaveLifecycleRule(rule *LifecycleRule) error {
+	now := time.Now().Format(time.RFC3339)
+	_, err := r.db.Exec(`
+		INSERT INTO lifecycle_rules (
+			connection_id, enabled, local_days, s3_days, archive_days,
+			archive_storage_class, archive_bucket, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT(connection_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			local_days = excluded.local_days,
+			s3_days = excluded.s3_days,
+			archive_days = excluded.archive_days,
+			archive_storage_class = excluded.archive_storage_class,
+			archive_bucket = excluded.archive_bucket,
+			updated_at = excluded.updated_at`,
+		rule.ConnectionID, rule.Enabled, rule.LocalDays, rule.S3Days, rule.ArchiveDays,
+		rule.ArchiveStorageClass, rule.ArchiveBucket, now, now)
+	return err
+}
+
+func scanLifecycleRules(rows *sql.Rows) ([]*LifecycleRule, error) {
+	var rules []*LifecycleRule
+	for rows.Next() {
+		var createdAtStr, updatedAtStr string
+		rule := &LifecycleRule{}
+		err := rows.Scan(
+			&rule.ConnectionID, &rule.Enabled, &rule.LocalDays, &rule.S3Days, &rule.ArchiveDays,
+			&rule.ArchiveStorageClass, &rule.ArchiveBucket, &createdAtStr, &updatedAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		rule.CreatedAt, err = common.ParseTime(createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		rule.UpdatedAt, err = common.ParseTime(updatedAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing updated_at: %v", err)
 		}
 
-		backup.CreatedAt, err = common.ParseTime(createdAtStr)
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// Retention Rule Methods
+
+const retentionRuleColumns = `
+	connection_id, enabled, keep_last, keep_daily, keep_weekly, keep_monthly,
+	keep_yearly, min_keep, COALESCE(timezone, ''), created_at, updated_at`
+
+func (r *BackupRepository) GetRetentionRule(connectionID string) (*RetentionRule, error) {
+	return scanRetentionRule(r.db.QueryRow(`
+		SELECT `+retentionRuleColumns+`
+		FROM retention_rules
+		WHERE connection_id = $1`, connectionID))
+}
+
+// GetEnabledRetentionRules returns the enabled retention rules of all connections
+func (r *BackupRepository) GetEnabledRetentionRules() ([]*RetentionRule, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + retentionRuleColumns + `
+		FROM retention_rules
+		WHERE enabled`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*RetentionRule
+	for rows.Next() {
+		rule, err := scanRetentionRule(rows)
 		if err != nil {
 			return nil, err
 		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func scanRetentionRule(row scheduleScanner) (*RetentionRule, error) {
+	var createdAtStr, updatedAtStr string
+	rule := &RetentionRule{}
+	err := row.Scan(
+		&rule.ConnectionID, &rule.Enabled, &rule.KeepLast, &rule.KeepDaily, &rule.KeepWeekly,
+		&rule.KeepMonthly, &rule.KeepYearly, &rule.MinKeep, &rule.Timezone, &createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	rule.CreatedAt, err = common.ParseTime(createdAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	rule.UpdatedAt, err = common.ParseTime(updatedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	return rule, nil
+}
+
+func (r *BackupRepository) SaveRetentionRule(rule *RetentionRule) error {
+	now := time.Now().Format(time.RFC3339)
+	_, err := r.db.Exec(`
+		INSERT INTO retention_rules (
+			connection_id, enabled, keep_last, keep_daily, keep_weekly, keep_monthly,
+			keep_yearly, min_keep, timezone, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT(connection_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			keep_last = excluded.keep_last,
+			keep_daily = excluded.keep_daily,
+			keep_weekly = excluded.keep_weekly,
+			keep_monthly = excluded.keep_monthly,
+			keep_yearly = excluded.keep_yearly,
+			min_keep = excluded.min_keep,
+			timezone = excluded.timezone,
+			updated_at = excluded.updated_at`,
+		rule.ConnectionID, rule.Enabled, rule.KeepLast, rule.KeepDaily, rule.KeepWeekly,
+		rule.KeepMonthly, rule.KeepYearly, rule.MinKeep, rule.Timezone, now, now)
+	return err
+}
+
+// RPO Methods
+
+const rpoPolicyColumns = `
+	connection_id, enabled, max_age_hours, COALESCE(breached, false), breached_since,
+	last_checked_at, created_at, updated_at`
+
+func (r *BackupRepository) GetRPOPolicy(connectionID string) (*RPOPolicy, error) {
+	rows, err := r.db.Query(`
+		SELECT `+rpoPolicyColumns+`
+		FROM rpo_policies
+		WHERE connection_id = $1`, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies, err := scanRPOPolicies(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return policies[0], nil
+}
 
-		backup.UpdatedAt, err = common.ParseTime(updatedAtStr)
+func (r *BackupRepository) GetEnabledRPOPolicies() ([]*RPOPolicy, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + rpoPolicyColumns + `
+		FROM rpo_policies
+		WHERE enabled = true`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRPOPolicies(rows)
+}
+
+// SaveRPOPolicy creates or updates a policy's settings, keeping its breach state
+func (r *BackupRepository) SaveRPOPolicy(policy *RPOPolicy) error {
+	now := time.Now().Format(time.RFC3339)
+	_, err := r.db.Exec(`
+		INSERT INTO rpo_policies (connection_id, enabled, max_age_hours, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT(connection_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			max_age_hours = excluded.max_age_hours,
+			updated_at = excluded.updated_at`,
+		policy.ConnectionID, policy.Enabled, policy.MaxAgeHours, now, now)
+	return err
+}
+
+// UpdateRPOState records what the monitor saw when it last checked a policy
+func (r *BackupRepository) UpdateRPOState(policy *RPOPolicy) error {
+	_, err := r.db.Exec(`
+		UPDATE rpo_policies
+		SET breached = $1, breached_since = $2, last_checked_at = $3
+		WHERE connection_id = $4`,
+		policy.Breached, formatNullableTime(policy.BreachedSince),
+		formatNullableTime(policy.LastCheckedAt), policy.ConnectionID)
+	return err
+}
+
+func scanRPOPolicies(rows *sql.Rows) ([]*RPOPolicy, error) {
+	var policies []*RPOPolicy
+	for rows.Next() {
+		var (
+			breachedSinceStr sql.NullString
+			lastCheckedStr   sql.NullString
+			createdAtStr     string
+			updatedAtStr     string
+		)
+		policy := &RPOPolicy{}
+		err := rows.Scan(
+			&policy.ConnectionID, &policy.Enabled, &policy.MaxAgeHours, &policy.Breached,
+			&breachedSinceStr, &lastCheckedStr, &createdAtStr, &updatedAtStr)
 		if err != nil {
 			return nil, err
 		}
 
-		backups = append(backups, backup)
+		if policy.BreachedSince, err = parseNullableTime(breachedSinceStr); err != nil {
+			return nil, fmt.Errorf("error parsing breached_since: %v", err)
+		}
+		if policy.LastCheckedAt, err = parseNullableTime(lastCheckedStr); err != nil {
+			return nil, fmt.Errorf("error parsing last_checked_at: %v", err)
+		}
+		if policy.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		if policy.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing updated_at: %v", err)
+		}
+
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
+
+// GetLastSuccessfulBackupTime returns when the newest completed backup of a
+// connection finished, or nil if it has none
+func (r *BackupRepository) GetLastSuccessfulBackupTime(connectionID string) (*time.Time, error) {
+	var completedStr sql.NullString
+	err := r.db.QueryRow(`
+		SELECT MAX(completed_time)
+		FROM backups
+		WHERE connection_id = $1 AND status = 'completed' AND deleted_at IS NULL`,
+		connectionID).Scan(&completedStr)
+	if err != nil {
+		return nil, err
 	}
+	return parseNullableTime(completedStr)
+}
 
-	return backups, rows.Err()
+func (r *BackupRepository) CreateRPOBreach(breach *RPOBreach) error {
+	_, err := r.db.Exec(`
+		INSERT INTO rpo_breaches (id, connection_id, max_age_hours, started_at, ended_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		breach.ID, breach.ConnectionID, breach.MaxAgeHours,
+		breach.StartedAt.Format(time.RFC3339), formatNullableTime(breach.EndedAt))
+	return err
 }
 
+// EndRPOBreaches closes the open breaches of a connection
+func (r *BackupRepository) EndRPOBreaches(connectionID string, endedAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE rpo_breaches SET ended_at = $1
+		WHERE connection_id = $2 AND ended_at IS NULL`,
+		endedAt.Format(time.RFC3339), connectionID)
+	return err
+}
 
-func (r *BackupRepository) UpdateBackupS3ObjectKey(backupID string, s3ObjectKey string) error {
+// GetRPOBreaches returns the breaches of a connection that were still open at
+// or after since, oldest first
+func (r *BackupRepository) GetRPOBreaches(connectionID string, since time.Time) ([]*RPOBreach, error) {
+	rows, err := r.db.Query(`
+		SELECT id, connection_id, max_age_hours, started_at, ended_at
+		FROM rpo_breaches
+		WHERE connection_id = $1 AND (ended_at IS NULL OR ended_at >= $2)
+		ORDER BY started_at ASC`,
+		connectionID, since.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breaches := make([]*RPOBreach, 0)
+	for rows.Next() {
+		var startedAtStr string
+		var endedAtStr sql.NullString
+		breach := &RPOBreach{}
+		if err := rows.Scan(&breach.ID, &breach.ConnectionID, &breach.MaxAgeHours, &startedAtStr, &endedAtStr); err != nil {
+			return nil, err
+		}
+		if breach.StartedAt, err = common.ParseTime(startedAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing started_at: %v", err)
+		}
+		if breach.EndedAt, err = parseNullableTime(endedAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing ended_at: %v", err)
+		}
+		breaches = append(breaches, breach)
+	}
+	return breaches, rows.Err()
+}
+
+// Blackout Window Methods
+
+const blackoutColumns = `
+	id, user_id, connection_id, schedule_id, name, cron_schedule, COALESCE(duration_minutes, 0),
+	COALESCE(timezone, ''), starts_at, ends_at, COALESCE(action, 'skip'), enabled, created_at, updated_at`
+
+func (r *BackupRepository) CreateBlackoutWindow(window *BlackoutWindow) error {
+	now := time.Now().Format(time.RFC3339)
 	_, err := r.db.Exec(`
-		UPDATE backups 
-		SET s3_object_key = $1, updated_at = datetime('now') 
-		WHERE id = $2`,
-		s3ObjectKey, backupID)
+		INSERT INTO blackout_windows (
+			id, user_id, connection_id, schedule_id, name, cron_schedule, duration_minutes,
+			timezone, starts_at, ends_at, action, enabled, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		window.ID, window.UserID, window.ConnectionID, window.ScheduleID, window.Name,
+		window.CronSchedule, window.DurationMinutes, window.Timezone,
+		formatNullableTime(window.StartsAt), formatNullableTime(window.EndsAt),
+		window.Action, window.Enabled, now, now)
 	return err
 }
+
+func (r *BackupRepository) UpdateBlackoutWindow(window *BlackoutWindow) error {
+	result, err := r.db.Exec(`
+		UPDATE blackout_windows
+		SET connection_id = $1, schedule_id = $2, name = $3, cron_schedule = $4,
+		    duration_minutes = $5, timezone = $6, starts_at = $7, ends_at = $8,
+		    action = $9, enabled = $10, updated_at = $11
+		WHERE id = $12`,
+		window.ConnectionID, window.ScheduleID, window.Name, window.CronSchedule,
+		window.DurationMinutes, window.Timezone,
+		formatNullableTime(window.StartsAt), formatNullableTime(window.EndsAt),
+		window.Action, window.Enabled, time.Now().Format(time.RFC3339), window.ID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *BackupRepository) DeleteBlackoutWindow(id string) error {
+	result, err := r.db.Exec("DELETE FROM blackout_windows WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *BackupRepository) GetBlackoutWindow(id string) (*BlackoutWindow, error) {
+	rows, err := r.db.Query(`
+		SELECT `+blackoutColumns+`
+		FROM blackout_windows
+		WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows, err := scanBlackoutWindows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return windows[0], nil
+}
+
+func (r *BackupRepository) GetBlackoutWindowsByUserID(userID uuid.UUID) ([]*BlackoutWindow, error) {
+	rows, err := r.db.Query(`
+		SELECT `+blackoutColumns+`
+		FROM blackout_windows
+		WHERE user_id = $1
+		ORDER BY created_at ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanBlackoutWindows(rows)
+}
+
+// GetBlackoutWindowsForSchedule returns the enabled windows that apply to a
+// schedule: the user's global windows plus those of its connection and itself
+func (r *BackupRepository) GetBlackoutWindowsForSchedule(userID uuid.UUID, connectionID string, scheduleID string) ([]*BlackoutWindow, error) {
+	rows, err := r.db.Query(`
+		SELECT `+blackoutColumns+`
+		FROM blackout_windows
+		WHERE enabled = true
+		AND user_id = $1
+		AND (connection_id IS NULL OR connection_id = $2)
+		AND (schedule_id IS NULL OR schedule_id = $3)`,
+		userID, connectionID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanBlackoutWindows(rows)
+}
+
+func scanBlackoutWindows(rows *sql.Rows) ([]*BlackoutWindow, error) {
+	windows := make([]*BlackoutWindow, 0)
+	for rows.Next() {
+		var (
+			startsAtStr  sql.NullString
+			endsAtStr    sql.NullString
+			createdAtStr string
+			updatedAtStr string
+		)
+		window := &BlackoutWindow{}
+		err := rows.Scan(
+			&window.ID, &window.UserID, &window.ConnectionID, &window.ScheduleID, &window.Name,
+			&window.CronSchedule, &window.DurationMinutes, &window.Timezone,
+			&startsAtStr, &endsAtStr, &window.Action, &window.Enabled,
+			&createdAtStr, &updatedAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		if window.StartsAt, err = parseNullableTime(startsAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing starts_at: %v", err)
+		}
+		if window.EndsAt, err = parseNullableTime(endsAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing ends_at: %v", err)
+		}
+		if window.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		if window.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing updated_at: %v", err)
+		}
+
+		windows = append(windows, window)
+	}
+	return windows, rows.Err()
+}
+
+// Schedule Run Methods
+
+func (r *BackupRepository) CreateScheduleRun(run *ScheduleRun) error {
+	backupIDs, err := json.Marshal(nonNilStrings(run.BackupIDs))
+	if err != nil {
+		return err
+	}
+
+	attemptErrors, err := json.Marshal(nonNilStrings(run.AttemptErrors))
+	if err != nil {
+		return err
+	}
+
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = time.Now()
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO schedule_runs (
+			id, schedule_id, connection_id, triggered_by, backup_ids, status, reason, attempts, attempt_errors, error,
+			scheduled_time, started_at, finished_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		run.ID, run.ScheduleID, run.ConnectionID, run.TriggeredBy, string(backupIDs),
+		run.Status, run.Reason, run.Attempts, string(attemptErrors), run.Error,
+		run.ScheduledTime.Format(time.RFC3339), formatNullableTime(run.StartedAt),
+		formatNullableTime(run.FinishedAt), run.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+// FinishScheduleRun records the outcome of a run started earlier
+func (r *BackupRepository) FinishScheduleRun(run *ScheduleRun) error {
+	backupIDs, err := json.Marshal(nonNilStrings(run.BackupIDs))
+	if err != nil {
+		return err
+	}
+
+	attemptErrors, err := json.Marshal(nonNilStrings(run.AttemptErrors))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`
+		UPDATE schedule_runs
+		SET status = $1, backup_ids = $2, reason = $3, attempts = $4, attempt_errors = $5, error = $6, finished_at = $7
+		WHERE id = $8`,
+		run.Status, string(backupIDs), run.Reason, run.Attempts, string(attemptErrors), run.Error,
+		formatNullableTime(run.FinishedAt), run.ID)
+	return err
+}
+
+func (r *BackupRepository) GetScheduleRuns(scheduleID string, limit, offset int) ([]*ScheduleRun, int, error) {
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM schedule_runs WHERE schedule_id = $1", scheduleID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, schedule_id, connection_id, COALESCE(triggered_by, 'schedule'), COALESCE(backup_ids, ''),
+		       status, reason, COALESCE(attempts, 0), COALESCE(attempt_errors, ''), error,
+		       scheduled_time, started_at, finished_at, created_at
+		FROM schedule_runs
+		WHERE schedule_id = $1
+		ORDER BY scheduled_time DESC, created_at DESC
+		LIMIT $2 OFFSET $3`,
+		scheduleID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	runs := make([]*ScheduleRun, 0)
+	for rows.Next() {
+		var (
+			backupIDsStr     string
+			attemptErrorsStr string
+			scheduledTimeStr string
+			startedAtStr     sql.NullString
+			finishedAtStr    sql.NullString
+			createdAtStr     string
+		)
+		run := &ScheduleRun{}
+		err := rows.Scan(
+			&run.ID, &run.ScheduleID, &run.ConnectionID, &run.TriggeredBy, &backupIDsStr,
+			&run.Status, &run.Reason, &run.Attempts, &attemptErrorsStr, &run.Error,
+			&scheduledTimeStr, &startedAtStr, &finishedAtStr, &createdAtStr)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		run.BackupIDs = []string{}
+		if backupIDsStr != "" {
+			if err := json.Unmarshal([]byte(backupIDsStr), &run.BackupIDs); err != nil {
+				return nil, 0, fmt.Errorf("error parsing backup_ids: %v", err)
+			}
+		}
+		run.AttemptErrors = []string{}
+		if attemptErrorsStr != "" {
+			if err := json.Unmarshal([]byte(attemptErrorsStr), &run.AttemptErrors); err != nil {
+				return nil, 0, fmt.Errorf("error parsing attempt_errors: %v", err)
+			}
+		}
+		if run.ScheduledTime, err = common.ParseTime(scheduledTimeStr); err != nil {
+			return nil, 0, fmt.Errorf("error parsing scheduled_time: %v", err)
+		}
+		if run.StartedAt, err = parseNullableTime(startedAtStr); err != nil {
+			return nil, 0, fmt.Errorf("error parsing started_at: %v", err)
+		}
+		if run.FinishedAt, err = parseNullableTime(finishedAtStr); err != nil {
+			return nil, 0, fmt.Errorf("error parsing finished_at: %v", err)
+		}
+		if run.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+			return nil, 0, fmt.Errorf("error parsing created_at: %v", err)
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, total, rows.Err()
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func formatNullableTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	str := t.Format(time.RFC3339)
+	return &str
+}
+
+func parseNullableTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
+	}
+	t, err := common.ParseTime(value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Scheduler Lease Methods
+
+// leaseTimeFormat is fixed width so stored times compare as strings
+const leaseTimeFormat = "2006-01-02T15:04:05Z"
+
+// AcquireLease takes a named lease for holder if it is free or expired, or
+// renews it if holder already owns it. It reports whether holder owns the
+// lease afterwards.
+func (r *BackupRepository) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	result, err := r.db.Exec(`
+		INSERT INTO scheduler_leases (name, holder, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT(name) DO UPDATE
+		SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE scheduler_leases.holder = excluded.holder OR scheduler_leases.expires_at < $4`,
+		name, holder, now.Add(ttl).Format(leaseTimeFormat), now.Format(leaseTimeFormat))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ClaimScheduleFire records that holder runs a schedule's fire time. It
+// returns false if the fire time was already claimed.
+func (r *BackupRepository) ClaimScheduleFire(scheduleID string, fireTime time.Time, holder string) (bool, error) {
+	result, err := r.db.Exec(`
+		INSERT OR IGNORE INTO schedule_claims (schedule_id, fire_time, holder, claimed_at)
+		VALUES ($1, $2, $3, $4)`,
+		scheduleID, fireTime.UTC().Format(leaseTimeFormat), holder, time.Now().UTC().Format(leaseTimeFormat))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *BackupRepository) DeleteScheduleClaimsBefore(cutoff time.Time) error {
+	_, err := r.db.Exec("DELETE FROM schedule_claims WHERE claimed_at < $1", cutoff.UTC().Format(leaseTimeFormat))
+	return err
+}
+
+// DeferScheduleRun stores a run of a schedule at at, returning false when a
+// deferred run is already pending for it
+func (r *BackupRepository) DeferScheduleRun(scheduleID string, at time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE backup_schedules SET deferred_run_time = $1
+		WHERE id = $2 AND deferred_run_time IS NULL`,
+		at.UTC().Format(leaseTimeFormat), scheduleID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *BackupRepository) ClearDeferredRun(scheduleID string) error {
+	_, err := r.db.Exec("UPDATE backup_schedules SET deferred_run_time = NULL WHERE id = $1", scheduleID)
+	return err
+}
+
+// GetDueDeferredRuns returns the deferred run times of enabled schedules that
+// are due at now
+func (r *BackupRepository) GetDueDeferredRuns(now time.Time) (map[string]time.Time, error) {
+	rows, err := r.db.Query(`
+		SELECT id, deferred_run_time
+		FROM backup_schedules
+		WHERE enabled = true AND deferred_run_time IS NOT NULL AND deferred_run_time <= $1`,
+		now.UTC().Format(leaseTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := make(map[string]time.Time)
+	for rows.Next() {
+		var id, atStr string
+		if err := rows.Scan(&id, &atStr); err != nil {
+			return nil, err
+		}
+		at, err := time.Parse(leaseTimeFormat, atStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deferred run time of schedule %s: %w", id, err)
+		}
+		due[id] = at
+	}
+	return due, rows.Err()
+}
+
+// Backup Policy Methods
+
+const policyColumns = `
+	id, user_id, name, cron_schedule, COALESCE(timezone, ''), retention_days,
+	COALESCE(options, ''), COALESCE(destinations, ''), COALESCE(retry_policy, ''), COALESCE(notifications, ''),
+	COALESCE(misfire_policy, 'run_once'), COALESCE(misfire_grace_minutes, 0), COALESCE(rpo_max_age_hours, 0),
+	(SELECT COUNT(*) FROM backup_schedules WHERE policy_id = backup_policies.id),
+	created_at, updated_at`
+
+// SaveBackupPolicy inserts or updates a policy together with its targets and
+// the schedule changes applying it, so a failure leaves all of them as they were
+func (r *BackupRepository) SaveBackupPolicy(policy *BackupPolicy, changes *PolicyScheduleChanges) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := savePolicy(tx, policy); err != nil {
+		return err
+	}
+	if err := applyPolicyScheduleChanges(tx, changes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ApplyPolicyScheduleChanges writes the schedule changes of a policy whose
+// own settings are unchanged, all or none of them
+func (r *BackupRepository) ApplyPolicyScheduleChanges(changes *PolicyScheduleChanges) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := applyPolicyScheduleChanges(tx, changes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func applyPolicyScheduleChanges(tx *sql.Tx, changes *PolicyScheduleChanges) error {
+	for _, id := range changes.Remove {
+		if err := deleteBackupSchedule(tx, id); err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to delete schedule %s: %v", id, err)
+		}
+	}
+	for _, schedule := range changes.Update {
+		if err := updateBackupSchedule(tx, schedule); err != nil {
+			return err
+		}
+	}
+	for _, schedule := range changes.Create {
+		if err := createBackupSchedule(tx, schedule); err != nil {
+			return fmt.Errorf("failed to save backup schedule: %v", err)
+		}
+	}
+	return nil
+}
+
+func savePolicy(tx *sql.Tx, policy *BackupPolicy) error {
+	settings, err := encodeScheduleSettings(policy.Options, policy.Destinations, policy.RetryPolicy, policy.Notifications)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	_, err = tx.Exec(`
+		INSERT INTO backup_policies (
+			id, user_id, name, cron_schedule, timezone, retention_days, options, destinations,
+			retry_policy, notifications, misfire_policy, misfire_grace_minutes, rpo_max_age_hours,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			cron_schedule = excluded.cron_schedule,
+			timezone = excluded.timezone,
+			retention_days = excluded.retention_days,
+			options = excluded.options,
+			destinations = excluded.destinations,
+			retry_policy = excluded.retry_policy,
+			notifications = excluded.notifications,
+			misfire_policy = excluded.misfire_policy,
+			misfire_grace_minutes = excluded.misfire_grace_minutes,
+			rpo_max_age_hours = excluded.rpo_max_age_hours,
+			updated_at = excluded.updated_at`,
+		policy.ID, policy.UserID, policy.Name, policy.CronSchedule, policy.Timezone, policy.RetentionDays,
+		settings.options, settings.destinations, settings.retryPolicy, settings.notifications,
+		misfirePolicyOrDefault(policy.MisfirePolicy), policy.MisfireGraceMinutes, policy.RPOMaxAgeHours,
+		now, now)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM backup_policy_targets WHERE policy_id = $1", policy.ID); err != nil {
+		return err
+	}
+	insertTarget := func(targetType, target string) error {
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO backup_policy_targets (policy_id, target_type, target)
+			VALUES ($1, $2, $3)`,
+			policy.ID, targetType, target)
+		return err
+	}
+	for _, connectionID := range policy.ConnectionIDs {
+		if err := insertTarget(PolicyTargetConnection, connectionID); err != nil {
+			return err
+		}
+	}
+	for _, tag := range policy.Tags {
+		if err := insertTarget(PolicyTargetTag, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *BackupRepository) GetBackupPolicy(id string) (*BackupPolicy, error) {
+	row := r.db.QueryRow(`
+		SELECT `+policyColumns+`
+		FROM backup_policies
+		WHERE id = $1`,
+		id)
+	policy, err := scanPolicy(row)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadPolicyTargets(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (r *BackupRepository) GetBackupPoliciesByUserID(userID uuid.UUID) ([]*BackupPolicy, error) {
+	rows, err := r.db.Query(`
+		SELECT `+policyColumns+`
+		FROM backup_policies
+		WHERE user_id = $1
+		ORDER BY name ASC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make([]*BackupPolicy, 0)
+	for rows.Next() {
+		policy, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, policy := range policies {
+		if err := r.loadPolicyTargets(policy); err != nil {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+// DeleteBackupPolicy removes a policy and the schedules it manages. Backups
+// those schedules produced are kept and no longer point at a schedule.
+func (r *BackupRepository) DeleteBackupPolicy(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE backups SET schedule_id = NULL
+		WHERE schedule_id IN (SELECT id FROM backup_schedules WHERE policy_id = $1)`,
+		id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM backup_schedules WHERE policy_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM backup_policy_targets WHERE policy_id = $1", id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM backup_policies WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// DeletePolicyTargetsForConnection drops a deleted connection from the
+// policies it was assigned to directly
+func (r *BackupRepository) DeletePolicyTargetsForConnection(connectionID string) error {
+	_, err := r.db.Exec(`
+		DELETE FROM backup_policy_targets
+		WHERE target_type = $1 AND target = $2`,
+		PolicyTargetConnection, connectionID)
+	return err
+}
+
+// GetConnectionIDsByTags returns the user's connections carrying any of tags
+func (r *BackupRepository) GetConnectionIDsByTags(userID uuid.UUID, tags []string) ([]string, error) {
+	connectionIDs := make([]string, 0)
+	if len(tags) == 0 {
+		return connectionIDs, nil
+	}
+
+	args := []interface{}{userID}
+	placeholders := make([]string, len(tags))
+	for i, tag := range tags {
+		args = append(args, tag)
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT DISTINCT c.id
+		FROM connections c, json_each(c.tags) t
+		WHERE c.user_id = $1 AND json_valid(c.tags)
+		  AND t.value IN (`+strings.Join(placeholders, ", ")+`)`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		connectionIDs = append(connectionIDs, id)
+	}
+	return connectionIDs, rows.Err()
+}
+
+func (r *BackupRepository) loadPolicyTargets(policy *BackupPolicy) error {
+	rows, err := r.db.Query(`
+		SELECT target_type, target
+		FROM backup_policy_targets
+		WHERE policy_id = $1
+		ORDER BY target ASC`,
+		policy.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	policy.ConnectionIDs = []string{}
+	policy.Tags = []string{}
+	for rows.Next() {
+		var targetType, target string
+		if err := rows.Scan(&targetType, &target); err != nil {
+			return err
+		}
+		switch targetType {
+		case PolicyTargetConnection:
+			policy.ConnectionIDs = append(policy.ConnectionIDs, target)
+		case PolicyTargetTag:
+			policy.Tags = append(policy.Tags, target)
+		}
+	}
+	return rows.Err()
+}
+
+func scanPolicy(row scheduleScanner) (*BackupPolicy, error) {
+	var (
+		optionsStr       string
+		destinationsStr  string
+		retryPolicyStr   string
+		notificationsStr string
+		createdAtStr     string
+		updatedAtStr     string
+	)
+	policy := &BackupPolicy{}
+	err := row.Scan(
+		&policy.ID, &policy.UserID, &policy.Name, &policy.CronSchedule, &policy.Timezone, &policy.RetentionDays,
+		&optionsStr, &destinationsStr, &retryPolicyStr, &notificationsStr,
+		&policy.MisfirePolicy, &policy.MisfireGraceMinutes, &policy.RPOMaxAgeHours,
+		&policy.ScheduleCount, &createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decodeScheduleSettings(optionsStr, destinationsStr, retryPolicyStr, notificationsStr,
+		&policy.Options, &policy.Destinations, &policy.RetryPolicy, &policy.Notifications); err != nil {
+		return nil, err
+	}
+
+	if policy.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if policy.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	return policy, nil
+}
+
+// Restore Job Methods
+
+const restoreJobColumns = `
+	id, user_id, started_by, backup_id, connection_id, target_database, COALESCE(options, ''),
+	status, snapshot_backup_id, reverts_job_id, error, queued_at, started_at, finished_at`
+
+// CreateRestoreJob queues a restore job. It returns false when another
+// queued or running job already targets the same database.
+func (r *BackupRepository) CreateRestoreJob(job *RestoreJob) (bool, error) {
+	options, err := json.Marshal(job.Options)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode restore options: %v", err)
+	}
+
+	result, err := r.db.Exec(`
+		INSERT OR IGNORE INTO restore_jobs (
+			id, user_id, started_by, backup_id, connection_id, target_database, options,
+			status, reverts_job_id, queued_at, heartbeat_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		job.ID, job.UserID, job.StartedBy, job.BackupID, job.ConnectionID, job.TargetDatabase,
+		string(options), job.Status, job.RevertsJobID, job.QueuedAt.Format(time.RFC3339),
+		time.Now().UTC().Format(leaseTimeFormat))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *BackupRepository) StartRestoreJob(id string, startedAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE restore_jobs SET status = $1, started_at = $2, heartbeat_at = $3
+		WHERE id = $4`,
+		RestoreJobRunning, startedAt.Format(time.RFC3339), time.Now().UTC().Format(leaseTimeFormat), id)
+	return err
+}
+
+// SetRestoreJobSnapshot links a job to its pre-restore snapshot
+func (r *BackupRepository) SetRestoreJobSnapshot(id, backupID string) error {
+	_, err := r.db.Exec("UPDATE restore_jobs SET snapshot_backup_id = $1 WHERE id = $2", backupID, id)
+	return err
+}
+
+// TouchRestoreJob records that the replica running a job is still alive
+func (r *BackupRepository) TouchRestoreJob(id string) error {
+	_, err := r.db.Exec("UPDATE restore_jobs SET heartbeat_at = $1 WHERE id = $2",
+		time.Now().UTC().Format(leaseTimeFormat), id)
+	return err
+}
+
+// FinishRestoreJob records the outcome of a job, releasing its target
+func (r *BackupRepository) FinishRestoreJob(job *RestoreJob) error {
+	_, err := r.db.Exec(`
+		UPDATE restore_jobs SET status = $1, output = $2, error = $3, finished_at = $4
+		WHERE id = $5`,
+		job.Status, job.Output, job.Error, formatNullableTime(job.FinishedAt), job.ID)
+	return err
+}
+
+// GetStaleRestoreJobs returns the queued and running jobs whose replica
+// stopped sending heartbeats before cutoff
+func (r *BackupRepository) GetStaleRestoreJobs(cutoff time.Time) ([]*RestoreJob, error) {
+	rows, err := r.db.Query(`SELECT `+restoreJobColumns+` FROM restore_jobs
+		WHERE status IN ($1, $2) AND heartbeat_at < $3`,
+		RestoreJobQueued, RestoreJobRunning, cutoff.UTC().Format(leaseTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*RestoreJob, 0)
+	for rows.Next() {
+		job, err := scanRestoreJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// FailStaleRestoreJob fails a job unlocking its target, unless it sent a
+// heartbeat or finished since it was found stale
+func (r *BackupRepository) FailStaleRestoreJob(id string, cutoff time.Time, reason string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE restore_jobs SET status = $1, error = $2, finished_at = $3
+		WHERE id = $4 AND status IN ($5, $6) AND heartbeat_at < $7`,
+		RestoreJobFailed, reason, time.Now().Format(time.RFC3339),
+		id, RestoreJobQueued, RestoreJobRunning, cutoff.UTC().Format(leaseTimeFormat))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *BackupRepository) GetRestoreJob(id string) (*RestoreJob, error) {
+	var output string
+	row := r.db.QueryRow(`SELECT `+restoreJobColumns+`, COALESCE(output, '') FROM restore_jobs WHERE id = $1`, id)
+	job, err := scanRestoreJob(row, &output)
+	if err != nil {
+		return nil, err
+	}
+	job.Output = output
+	return job, nil
+}
+
+// GetLatestRestoreJobID returns the ID of the last job queued into a
+// database of a connection
+func (r *BackupRepository) GetLatestRestoreJobID(connectionID, database string) (string, error) {
+	var id string
+	err := r.db.QueryRow(`
+		SELECT id FROM restore_jobs
+		WHERE connection_id = $1 AND target_database = $2
+		ORDER BY queued_at DESC, rowid DESC
+		LIMIT 1`,
+		connectionID, database).Scan(&id)
+	return id, err
+}
+
+// GetRestoreJobs lists a user's restore jobs, newest first, without their output
+func (r *BackupRepository) GetRestoreJobs(opts RestoreJobListOptions) ([]*RestoreJob, int, error) {
+	whereClause := "WHERE user_id = $1"
+	args := []interface{}{opts.UserID}
+	if opts.ConnectionID != "" {
+		args = append(args, opts.ConnectionID)
+		whereClause += fmt.Sprintf(" AND connection_id = $%d", len(args))
+	}
+	if opts.Status != "" {
+		args = append(args, opts.Status)
+		whereClause += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM restore_jobs "+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM restore_jobs
+		%s
+		ORDER BY queued_at DESC
+		LIMIT $%d OFFSET $%d`, restoreJobColumns, whereClause, len(args)+1, len(args)+2)
+	args = append(args, opts.Limit, opts.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*RestoreJob, 0)
+	for rows.Next() {
+		job, err := scanRestoreJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, total, rows.Err()
+}
+
+// scanRestoreJob reads restoreJobColumns followed by any extra columns
+func scanRestoreJob(row scheduleScanner, extra ...interface{}) (*RestoreJob, error) {
+	var (
+		optionsStr    string
+		queuedAtStr   string
+		startedAtStr  sql.NullString
+		finishedAtStr sql.NullString
+	)
+	job := &RestoreJob{}
+	dest := []interface{}{
+		&job.ID, &job.UserID, &job.StartedBy, &job.BackupID, &job.ConnectionID, &job.TargetDatabase,
+		&optionsStr, &job.Status, &job.SnapshotBackupID, &job.RevertsJobID, &job.Error,
+		&queuedAtStr, &startedAtStr, &finishedAtStr,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if optionsStr != "" {
+		if err := json.Unmarshal([]byte(optionsStr), &job.Options); err != nil {
+			return nil, fmt.Errorf("error parsing restore options: %v", err)
+		}
+	}
+
+	var err error
+	if job.QueuedAt, err = common.ParseTime(queuedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing queued_at: %v", err)
+	}
+	if job.StartedAt, err = parseNullableTime(startedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing started_at: %v", err)
+	}
+	if job.FinishedAt, err = parseNullableTime(finishedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing finished_at: %v", err)
+	}
+	if job.StartedAt != nil && job.FinishedAt != nil {
+		duration := job.FinishedAt.Sub(*job.StartedAt).Seconds()
+		job.DurationSeconds = &duration
+	}
+	return job, nil
+}
+
+// Refresh Pipeline Methods
+
+const refreshPipelineColumns = `
+	id, user_id, name, source_connection_id, COALESCE(source_database, ''), target_connection_id,
+	target_database, COALESCE(options, ''), COALESCE(post_restore_scripts, ''), cron_schedule,
+	COALESCE(timezone, ''), enabled, next_run_at, created_at, updated_at`
+
+func (r *BackupRepository) CreateRefreshPipeline(pipeline *RefreshPipeline) error {
+	options, scripts, err := encodeRefreshSettings(pipeline)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO refresh_pipelines (
+			id, user_id, name, source_connection_id, source_database, target_connection_id,
+			target_database, options, post_restore_scripts, cron_schedule, timezone, enabled,
+			next_run_at, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		pipeline.ID, pipeline.UserID, pipeline.Name, pipeline.SourceConnectionID, pipeline.SourceDatabase,
+		pipeline.TargetConnectionID, pipeline.TargetDatabase, options, scripts, pipeline.CronSchedule,
+		pipeline.Timezone, pipeline.Enabled, formatLeaseTime(pipeline.NextRunTime),
+		pipeline.CreatedAt.Format(time.RFC3339), pipeline.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *BackupRepository) UpdateRefreshPipeline(pipeline *RefreshPipeline) error {
+	options, scripts, err := encodeRefreshSettings(pipeline)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE refresh_pipelines
+		SET name = $1, source_connection_id = $2, source_database = $3, target_connection_id = $4,
+		    target_database = $5, options = $6, post_restore_scripts = $7, cron_schedule = $8,
+		    timezone = $9, enabled = $10, next_run_at = $11, updated_at = $12
+		WHERE id = $13`,
+		pipeline.Name, pipeline.SourceConnectionID, pipeline.SourceDatabase, pipeline.TargetConnectionID,
+		pipeline.TargetDatabase, options, scripts, pipeline.CronSchedule, pipeline.Timezone,
+		pipeline.Enabled, formatLeaseTime(pipeline.NextRunTime), pipeline.UpdatedAt.Format(time.RFC3339),
+		pipeline.ID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetRefreshPipelineNextRun moves a scheduled pipeline to its next fire time
+func (r *BackupRepository) SetRefreshPipelineNextRun(id string, nextRun *time.Time) error {
+	_, err := r.db.Exec("UPDATE refresh_pipelines SET next_run_at = $1 WHERE id = $2",
+		formatLeaseTime(nextRun), id)
+	return err
+}
+
+// DeleteRefreshPipeline deletes a pipeline and its run history
+func (r *BackupRepository) DeleteRefreshPipeline(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM refresh_runs WHERE pipeline_id = $1", id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM refresh_pipelines WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func (r *BackupRepository) GetRefreshPipeline(id string) (*RefreshPipeline, error) {
+	row := r.db.QueryRow(`SELECT `+refreshPipelineColumns+` FROM refresh_pipelines WHERE id = $1`, id)
+	return scanRefreshPipeline(row)
+}
+
+func (r *BackupRepository) GetRefreshPipelinesByUserID(userID uuid.UUID) ([]*RefreshPipeline, error) {
+	return r.queryRefreshPipelines(`SELECT `+refreshPipelineColumns+` FROM refresh_pipelines
+		WHERE user_id = $1
+		ORDER BY created_at ASC`, userID)
+}
+
+// GetDueRefreshPipelines returns the enabled scheduled pipelines whose next
+// run is at or before now
+func (r *BackupRepository) GetDueRefreshPipelines(now time.Time) ([]*RefreshPipeline, error) {
+	return r.queryRefreshPipelines(`SELECT `+refreshPipelineColumns+` FROM refresh_pipelines
+		WHERE enabled = true AND cron_schedule IS NOT NULL AND next_run_at <= $1`,
+		now.UTC().Format(leaseTimeFormat))
+}
+
+func (r *BackupRepository) queryRefreshPipelines(query string, args ...interface{}) ([]*RefreshPipeline, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pipelines := make([]*RefreshPipeline, 0)
+	for rows.Next() {
+		pipeline, err := scanRefreshPipeline(rows)
+		if err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+	return pipelines, rows.Err()
+}
+
+func scanRefreshPipeline(row scheduleScanner) (*RefreshPipeline, error) {
+	var (
+		optionsStr   string
+		scriptsStr   string
+		nextRunStr   sql.NullString
+		createdAtStr string
+		updatedAtStr string
+	)
+	pipeline := &RefreshPipeline{}
+	err := row.Scan(
+		&pipeline.ID, &pipeline.UserID, &pipeline.Name, &pipeline.SourceConnectionID, &pipeline.SourceDatabase,
+		&pipeline.TargetConnectionID, &pipeline.TargetDatabase, &optionsStr, &scriptsStr,
+		&pipeline.CronSchedule, &pipeline.Timezone, &pipeline.Enabled, &nextRunStr,
+		&createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if optionsStr != "" {
+		if err := json.Unmarshal([]byte(optionsStr), &pipeline.Options); err != nil {
+			return nil, fmt.Errorf("error parsing refresh options: %v", err)
+		}
+	}
+	pipeline.PostRestoreScripts = []RefreshScript{}
+	if scriptsStr != "" {
+		if err := json.Unmarshal([]byte(scriptsStr), &pipeline.PostRestoreScripts); err != nil {
+			return nil, fmt.Errorf("error parsing post-restore scripts: %v", err)
+		}
+	}
+
+	if pipeline.NextRunTime, err = parseNullableTime(nextRunStr); err != nil {
+		return nil, fmt.Errorf("error parsing next_run_at: %v", err)
+	}
+	if pipeline.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if pipeline.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	return pipeline, nil
+}
+
+func encodeRefreshSettings(pipeline *RefreshPipeline) (string, string, error) {
+	options, err := json.Marshal(pipeline.Options)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode refresh options: %v", err)
+	}
+	scripts, err := json.Marshal(pipeline.PostRestoreScripts)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode post-restore scripts: %v", err)
+	}
+	return string(options), string(scripts), nil
+}
+
+func formatLeaseTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.UTC().Format(leaseTimeFormat)
+	return &formatted
+}
+
+// Refresh Run Methods
+
+const refreshRunColumns = `
+	id, pipeline_id, user_id, triggered_by, status, backup_id, restore_job_id,
+	COALESCE(steps, ''), error, started_at, finished_at`
+
+// CreateRefreshRun records a started run. It returns false when the
+// pipeline already has a running run.
+func (r *BackupRepository) CreateRefreshRun(run *RefreshRun) (bool, error) {
+	steps, err := json.Marshal(run.Steps)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode refresh steps: %v", err)
+	}
+
+	result, err := r.db.Exec(`
+		INSERT OR IGNORE INTO refresh_runs (
+			id, pipeline_id, user_id, triggered_by, status, steps, started_at, heartbeat_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		run.ID, run.PipelineID, run.UserID, run.TriggeredBy, run.Status, string(steps),
+		run.StartedAt.Format(time.RFC3339), time.Now().UTC().Format(leaseTimeFormat))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// UpdateRefreshRun saves the progress of a run, which also counts as a
+// heartbeat
+func (r *BackupRepository) UpdateRefreshRun(run *RefreshRun) error {
+	steps, err := json.Marshal(run.Steps)
+	if err != nil {
+		return fmt.Errorf("failed to encode refresh steps: %v", err)
+	}
+
+	_, err = r.db.Exec(`
+		UPDATE refresh_runs
+		SET status = $1, backup_id = $2, restore_job_id = $3, steps = $4, error = $5,
+		    finished_at = $6, heartbeat_at = $7
+		WHERE id = $8`,
+		run.Status, run.BackupID, run.RestoreJobID, string(steps), run.Error,
+		formatNullableTime(run.FinishedAt), time.Now().UTC().Format(leaseTimeFormat), run.ID)
+	return err
+}
+
+// TouchRefreshRun records that the replica running a run is still alive
+func (r *BackupRepository) TouchRefreshRun(id string) error {
+	_, err := r.db.Exec("UPDATE refresh_runs SET heartbeat_at = $1 WHERE id = $2",
+		time.Now().UTC().Format(leaseTimeFormat), id)
+	return err
+}
+
+// GetStaleRefreshRuns returns the running runs whose replica stopped sending
+// heartbeats before cutoff
+func (r *BackupRepository) GetStaleRefreshRuns(cutoff time.Time) ([]*RefreshRun, error) {
+	return r.queryRefreshRuns(`SELECT `+refreshRunColumns+` FROM refresh_runs
+		WHERE status = $1 AND heartbeat_at < $2`,
+		RefreshRunning, cutoff.UTC().Format(leaseTimeFormat))
+}
+
+// FailStaleRefreshRun fails a run, unless it sent a heartbeat or finished
+// since it was found stale
+func (r *BackupRepository) FailStaleRefreshRun(id string, cutoff time.Time, reason string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE refresh_runs SET status = $1, error = $2, finished_at = $3
+		WHERE id = $4 AND status = $5 AND heartbeat_at < $6`,
+		RefreshFailed, reason, time.Now().Format(time.RFC3339),
+		id, RefreshRunning, cutoff.UTC().Format(leaseTimeFormat))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// HasRunningRefreshRun reports whether a pipeline is running
+func (r *BackupRepository) HasRunningRefreshRun(pipelineID string) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM refresh_runs WHERE pipeline_id = $1 AND status = $2",
+		pipelineID, RefreshRunning).Scan(&count)
+	return count > 0, err
+}
+
+// GetRefreshRuns lists the runs of a pipeline, newest first
+func (r *BackupRepository) GetRefreshRuns(pipelineID string, limit, offset int) ([]*RefreshRun, int, error) {
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM refresh_runs WHERE pipeline_id = $1", pipelineID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	runs, err := r.queryRefreshRuns(`SELECT `+refreshRunColumns+` FROM refresh_runs
+		WHERE pipeline_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2 OFFSET $3`, pipelineID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+func (r *BackupRepository) queryRefreshRuns(query string, args ...interface{}) ([]*RefreshRun, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*RefreshRun, 0)
+	for rows.Next() {
+		run, err := scanRefreshRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func scanRefreshRun(row scheduleScanner) (*RefreshRun, error) {
+	var (
+		stepsStr      string
+		startedAtStr  string
+		finishedAtStr sql.NullString
+	)
+	run := &RefreshRun{}
+	err := row.Scan(
+		&run.ID, &run.PipelineID, &run.UserID, &run.TriggeredBy, &run.Status, &run.BackupID,
+		&run.RestoreJobID, &stepsStr, &run.Error, &startedAtStr, &finishedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	run.Steps = []*RefreshStep{}
+	if stepsStr != "" {
+		if err := json.Unmarshal([]byte(stepsStr), &run.Steps); err != nil {
+			return nil, fmt.Errorf("error parsing refresh steps: %v", err)
+		}
+	}
+
+	if run.StartedAt, err = common.ParseTime(startedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing started_at: %v", err)
+	}
+	if run.FinishedAt, err = parseNullableTime(finishedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing finished_at: %v", err)
+	}
+	if run.FinishedAt != nil {
+		duration := run.FinishedAt.Sub(run.StartedAt).Seconds()
+		run.DurationSeconds = &duration
+	}
+	return run, nil
+}
+
+// Masking Profile Methods
+
+const maskingProfileColumns = `id, user_id, connection_id, name, rules, created_at, updated_at`
+
+func (r *BackupRepository) CreateMaskingProfile(profile *MaskingProfile) error {
+	rules, err := json.Marshal(profile.Rules)
+	if err != nil {
+		return fmt.Errorf("failed to encode masking rules: %v", err)
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO masking_profiles (id, user_id, connection_id, name, rules, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		profile.ID, profile.UserID, profile.ConnectionID, profile.Name, string(rules),
+		profile.CreatedAt.Format(time.RFC3339), profile.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *BackupRepository) UpdateMaskingProfile(profile *MaskingProfile) error {
+	rules, err := json.Marshal(profile.Rules)
+	if err != nil {
+		return fmt.Errorf("failed to encode masking rules: %v", err)
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE masking_profiles
+		SET connection_id = $1, name = $2, rules = $3, updated_at = $4
+		WHERE id = $5`,
+		profile.ConnectionID, profile.Name, string(rules), profile.UpdatedAt.Format(time.RFC3339), profile.ID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *BackupRepository) DeleteMaskingProfile(id string) error {
+	result, err := r.db.Exec("DELETE FROM masking_profiles WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *BackupRepository) GetMaskingProfile(id string) (*MaskingProfile, error) {
+	row := r.db.QueryRow(`SELECT `+maskingProfileColumns+` FROM masking_profiles WHERE id = $1`, id)
+	return scanMaskingProfile(row)
+}
+
+func (r *BackupRepository) GetMaskingProfilesByUserID(userID uuid.UUID) ([]*MaskingProfile, error) {
+	rows, err := r.db.Query(`SELECT `+maskingProfileColumns+` FROM masking_profiles
+		WHERE user_id = $1
+		ORDER BY created_at ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]*MaskingProfile, 0)
+	for rows.Next() {
+		profile, err := scanMaskingProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
+
+func scanMaskingProfile(row scheduleScanner) (*MaskingProfile, error) {
+	var (
+		rulesStr     string
+		createdAtStr string
+		updatedAtStr string
+	)
+	profile := &MaskingProfile{}
+	err := row.Scan(&profile.ID, &profile.UserID, &profile.ConnectionID, &profile.Name, &rulesStr,
+		&createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.Rules = []MaskingRule{}
+	if err := json.Unmarshal([]byte(rulesStr), &profile.Rules); err != nil {
+		return nil, fmt.Errorf("error parsing masking rules: %v", err)
+	}
+	if profile.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if profile.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	return profile, nil
+}
@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/connection"
@@ -14,6 +15,50 @@ import (
 type RestoreRequest struct {
 	BackupID     string `json:"backup_id"`
 	ConnectionID string `json:"connection_id"`
+	// TargetDatabase defaults to the connection's database
+	TargetDatabase string `json:"target_database"`
+	// CreateIfMissing creates the target database when it doesn't exist
+	CreateIfMissing bool `json:"create_if_missing"`
+	// DropExisting drops and recreates the target database. It needs a token
+	// from the restore confirmation endpoint.
+	DropExisting      bool   `json:"drop_existing"`
+	ConfirmationToken string `json:"confirmation_token"`
+	// Owner and Encoding apply when the database is created. They default to
+	// the connection's user and the encoding the dump was taken with.
+	Owner    string `json:"owner"`
+	Encoding string `json:"encoding"`
+	// Objects limits the restore to some tables, schemas or collections
+	Objects *RestoreObjects `json:"objects"`
+	// SafetySnapshot backs up the target database before restoring over it.
+	// It defaults to on for connections tagged production.
+	SafetySnapshot *bool `json:"safety_snapshot"`
+	// MaskingProfileID scrubs the restored data with a masking profile of the
+	// backup's connection once the restore finishes
+	MaskingProfileID string `json:"masking_profile_id"`
+}
+
+// RestoreObjects selects what a selective restore brings back
+type RestoreObjects struct {
+	// Tables are "table" or, for PostgreSQL, "schema.table"
+	Tables []string `json:"tables"`
+	// Schemas restores every table of the given PostgreSQL schemas
+	Schemas []string `json:"schemas"`
+	// Collections are MongoDB collection names
+	Collections []string `json:"collections"`
+	// Rename restores a selected table or collection under another name so it
+	// can be compared with the live one side by side
+	Rename map[string]string `json:"rename"`
+	// DataOnly loads rows into the existing tables without recreating them
+	DataOnly bool `json:"data_only"`
+}
+
+// RestoreConfirmation is a token that allows one restore to drop its target
+// database
+type RestoreConfirmation struct {
+	ConfirmationToken string    `json:"confirmation_token"`
+	ConnectionID      string    `json:"connection_id"`
+	TargetDatabase    string    `json:"target_database"`
+	ExpiresAt         time.Time `json:"expires_at"`
 }
 
 var restoreTools = map[string]string{
@@ -23,40 +68,94 @@ var restoreTools = map[string]string{
 	"mongodb":    "mongorestore",
 }
 
-// RestoreBackup restores a backup to a target database connection
-func (s *BackupService) RestoreBackup(backupID string, connectionID string) error {
-	backup, err := s.backupRepo.GetBackup(backupID)
+// restoreBackup restores a backup to a target database connection and returns
+// the output of the restore tool. Callers check ownership and the drop
+// confirmation first.
+func (s *BackupService) restoreBackup(req *RestoreRequest) ([]byte, error) {
+	backup, err := s.backupRepo.GetBackup(req.BackupID)
 	if err != nil {
-		return fmt.Errorf("failed to get backup: %v", err)
+		return nil, fmt.Errorf("failed to get backup: %v", err)
 	}
 
-	conn, err := s.connStorage.GetConnection(connectionID)
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
 	if err != nil {
-		return fmt.Errorf("failed to get connection: %v", err)
+		return nil, fmt.Errorf("failed to get connection: %v", err)
 	}
 
+	targetDatabase := restoreTargetDatabase(conn, req)
+
 	// Ensure backup file is available (local or download from S3)
-	filePath, isTemp, err := s.ensureBackupFileAvailable(backup, conn.UserID)
+	filePath, release, err := s.ensureBackupFileAvailable(backup, conn.UserID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer release()
 
-	// Clean up temp file after restore if needed
-	if isTemp {
-		defer func() {
-			if err := os.Remove(filePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp file %s: %v\n", filePath, err)
-			}
-		}()
+	filePath, releasePlain, err := decompressedBackupFile(filePath, backup.Compression)
+	if err != nil {
+		return nil, err
 	}
+	defer releasePlain()
 
 	if err := s.verifyRestoreTools(conn.Type); err != nil {
-		return err
+		return nil, err
+	}
+
+	// Velld's own dumps never name a database, uploaded ones may
+	if backup.Imported && conn.Type != "mongodb" && !isPgCustomDump(filePath) {
+		if err := checkRestoreDumpScope(filePath, conn.Type); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Objects != nil {
+		if err := validateRestoreObjects(conn.Type, req.Objects); err != nil {
+			return nil, err
+		}
+	}
+
+	// Selections of custom-format dumps are restored from the archive through
+	// a filtered list, only renames need the plain SQL filter
+	var archiveList string
+	if conn.Type == "postgresql" && isPgCustomDump(filePath) {
+		if req.Objects != nil && len(req.Objects.Rename) == 0 {
+			listPath, releaseList, err := s.listPgCustomDump(filePath, req.Objects)
+			if err != nil {
+				return nil, err
+			}
+			defer releaseList()
+			archiveList = listPath
+		} else {
+			plainPath, releaseCustom, err := s.convertPgCustomDump(filePath, req.Objects)
+			if err != nil {
+				return nil, err
+			}
+			defer releaseCustom()
+			filePath = plainPath
+		}
+	}
+
+	var mongoNamespaces []string
+	if req.Objects != nil && archiveList == "" {
+		if conn.Type == "mongodb" {
+			sourceDatabase := backup.DatabaseName
+			if sourceDatabase == "" {
+				sourceDatabase = conn.DatabaseName
+			}
+			mongoNamespaces = mongoNamespaceArgs(sourceDatabase, targetDatabase, req.Objects)
+		} else {
+			filteredPath, releaseFiltered, err := filterSQLDump(filePath, conn.Type, req.Objects)
+			if err != nil {
+				return nil, err
+			}
+			defer releaseFiltered()
+			filePath = filteredPath
+		}
 	}
 
 	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
 	if err != nil {
-		return fmt.Errorf("failed to setup SSH tunnel: %v", err)
+		return nil, fmt.Errorf("failed to setup SSH tunnel: %v", err)
 	}
 	if tunnel != nil {
 		defer tunnel.Stop()
@@ -64,24 +163,69 @@ func (s *BackupService) RestoreBackup(backupID string, connectionID string) erro
 		conn.Port = effectivePort
 	}
 
+	if err := s.prepareRestoreTarget(conn, targetDatabase, req, filePath); err != nil {
+		return nil, err
+	}
+	conn.DatabaseName = targetDatabase
+
 	var cmd *exec.Cmd
 	switch conn.Type {
 	case "postgresql":
-		cmd = s.createPsqlRestoreCmd(conn, filePath)
+		if archiveList != "" {
+			cmd = s.createPgRestoreCmd(conn, filePath, archiveList)
+		} else {
+			cmd = s.createPsqlRestoreCmd(conn, filePath)
+		}
 	case "mysql", "mariadb":
 		cmd = s.createMySQLRestoreCmd(conn, filePath)
 	case "mongodb":
-		cmd = s.createMongoRestoreCmd(conn, filePath)
+		cmd = s.createMongoRestoreCmd(conn, filePath, req.DropExisting, mongoNamespaces)
 	default:
-		return fmt.Errorf("unsupported database type for restore: %s", conn.Type)
+		return nil, fmt.Errorf("unsupported database type for restore: %s", conn.Type)
 	}
 
 	if cmd == nil {
-		return fmt.Errorf("restore tool not found for %s. Please ensure %s is installed", conn.Type, restoreTools[conn.Type])
+		return nil, fmt.Errorf("restore tool not found for %s. Please ensure %s is installed", conn.Type, restoreTools[conn.Type])
 	}
 
 	output, err := cmd.CombinedOutput()
-	return s.validateRestoreOutput(conn.Type, conn.DatabaseName, output, err)
+	if err := s.validateRestoreOutput(conn.Type, conn.DatabaseName, output, err); err != nil {
+		return output, err
+	}
+
+	if req.MaskingProfileID != "" {
+		report, err := s.maskRestoredDatabase(req.MaskingProfileID, conn, targetDatabase, req.Objects == nil)
+		output = append(output, report...)
+		if err != nil {
+			// Unmasked production data must not stay behind on the target
+			if dropErr := dropUnmaskedTarget(conn, targetDatabase); dropErr != nil {
+				return output, fmt.Errorf("restore finished but masking failed and the target couldn't be dropped, it holds unmasked data: %v (drop failed: %v)", err, dropErr)
+			}
+			fmt.Printf("Dropped database %s on connection %s after masking failed\n", targetDatabase, conn.ID)
+			return output, fmt.Errorf("restore finished but masking failed, the target database was dropped so no unmasked data is left: %v", err)
+		}
+	}
+	return output, nil
+}
+
+// checkRestoreDumpScope refuses plain SQL dumps that create or switch
+// databases by name, which would be restored outside the target database
+func checkRestoreDumpScope(path, dbType string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %v", err)
+	}
+	defer file.Close()
+
+	switches, err := dumpDatabaseSwitches(file, dbType)
+	if err != nil {
+		return err
+	}
+	if len(switches) > 0 {
+		return fmt.Errorf("the dump selects databases by name and would be restored into them instead of the target: %s",
+			strings.Join(switches, "; "))
+	}
+	return nil
 }
 
 func (s *BackupService) validateRestoreOutput(dbType, dbName string, output []byte, cmdErr error) error {
@@ -116,7 +260,7 @@ func (s *BackupService) validatePostgreSQLRestore(output []byte, cmdErr error) e
 	if len(criticalErrors) > 0 {
 		for _, errLine := range criticalErrors {
 			if strings.Contains(errLine, "already exists") {
-				return fmt.Errorf("restore failed: target database must be empty. See documentation for restore best practices")
+				return fmt.Errorf("restore failed: target database must be empty. Restore into a new database or set drop_existing to replace it")
 			}
 		}
 		return fmt.Errorf("restore failed with %d error(s)", len(criticalErrors))
@@ -202,6 +346,32 @@ func (s *BackupService) createPsqlRestoreCmd(conn *connection.StoredConnection,
 	return cmd
 }
 
+// createPgRestoreCmd restores the entries of a custom-format dump that a
+// list file names
+func (s *BackupService) createPgRestoreCmd(conn *connection.StoredConnection, dumpPath, listPath string) *exec.Cmd {
+	binaryPath := common.FindBinaryPath("postgresql", "pg_restore")
+	if binaryPath == "" {
+		fmt.Printf("ERROR: pg_restore binary not found. Please install PostgreSQL client tools.\n")
+		return nil
+	}
+
+	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName("pg_restore"))
+
+	// --exit-on-error stops at the first error like psql's ON_ERROR_STOP
+	cmd := exec.Command(binPath,
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+		"-U", conn.Username,
+		"-d", conn.DatabaseName,
+		"--use-list", listPath,
+		"--exit-on-error",
+		dumpPath,
+	)
+
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
+	return cmd
+}
+
 func (s *BackupService) createMySQLRestoreCmd(conn *connection.StoredConnection, backupPath string) *exec.Cmd {
 	binaryPath := s.findDatabaseRestorePath(conn.Type)
 	if binaryPath == "" {
@@ -238,7 +408,9 @@ func (s *BackupService) createMySQLRestoreCmd(conn *connection.StoredConnection,
 	return cmd
 }
 
-func (s *BackupService) createMongoRestoreCmd(conn *connection.StoredConnection, backupPath string) *exec.Cmd {
+// createMongoRestoreCmd builds a mongorestore command. namespaces holds the
+// --nsInclude/--nsFrom/--nsTo arguments of a selective restore.
+func (s *BackupService) createMongoRestoreCmd(conn *connection.StoredConnection, backupPath string, drop bool, namespaces []string) *exec.Cmd {
 	binaryPath := s.findDatabaseRestorePath("mongodb")
 	if binaryPath == "" {
 		fmt.Printf("ERROR: mongorestore binary not found. Please install MongoDB Database Tools.\n")
@@ -247,13 +419,23 @@ func (s *BackupService) createMongoRestoreCmd(conn *connection.StoredConnection,
 
 	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(restoreTools["mongodb"]))
 
-	backupDir := filepath.Dir(backupPath)
-
 	args := []string{
 		"--host", conn.Host,
 		"--port", fmt.Sprintf("%d", conn.Port),
-		"--db", conn.DatabaseName,
-		backupDir,
+	}
+
+	// --db can't be combined with namespace options, which already name the
+	// target database
+	if len(namespaces) > 0 {
+		args = append(args, namespaces...)
+	} else {
+		args = append(args, "--db", conn.DatabaseName)
+	}
+
+	if isMongoArchive(backupPath) {
+		args = append(args, "--archive="+backupPath)
+	} else {
+		args = append(args, filepath.Dir(backupPath))
 	}
 
 	if conn.Username != "" {
@@ -264,5 +446,11 @@ func (s *BackupService) createMongoRestoreCmd(conn *connection.StoredConnection,
 		args = append(args, "--password", conn.Password)
 	}
 
+	// MongoDB creates databases on first write, so replacing one means
+	// dropping each collection before it is restored
+	if drop {
+		args = append(args, "--drop")
+	}
+
 	return exec.Command(binPath, args...)
 }
@@ -0,0 +1,1078 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/lib/pq"
+)
+
+// errRestoreSelection wraps selective restore requests that don't fit the
+// backup or the database type
+var errRestoreSelection = errors.New("invalid restore selection")
+
+// Magic bytes at the start of dumps that can't be streamed through psql
+var (
+	pgCustomDumpMagic = []byte("PGDMP")
+	mongoArchiveMagic = []byte{0x6d, 0xe2, 0x99, 0x81}
+)
+
+var (
+	createTablePattern    = regexp.MustCompile(`(?is)^CREATE\s+(?:(?:GLOBAL|LOCAL)\s+)?(?:(?:TEMPORARY|TEMP|UNLOGGED)\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?`)
+	alterTablePattern     = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?`)
+	dropTablePattern      = regexp.MustCompile(`(?is)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?`)
+	copyPattern           = regexp.MustCompile(`(?is)^COPY\s+`)
+	copyFromStdinPattern  = regexp.MustCompile(`(?is)\sFROM\s+stdin\s*;\s*$`)
+	insertPattern         = regexp.MustCompile(`(?is)^(?:INSERT|REPLACE)\s+(?:(?:IGNORE|LOW_PRIORITY|DELAYED|HIGH_PRIORITY)\s+)*INTO\s+`)
+	lockTablesPattern     = regexp.MustCompile(`(?is)^LOCK\s+TABLES\s+`)
+	createIndexPattern    = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(?:\S+\s+)?ON\s+(?:ONLY\s+)?`)
+	createTriggerPattern  = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:DEFINER\s*=\s*\S+\s+)?(?:CONSTRAINT\s+)?TRIGGER\s+.+?\s+ON\s+`)
+	commentOnPattern      = regexp.MustCompile(`(?is)^COMMENT\s+ON\s+(TABLE|COLUMN)\s+`)
+	grantPattern          = regexp.MustCompile(`(?is)^(?:GRANT|REVOKE)\s+.+?\s+ON\s+(?:TABLE\s+)?`)
+	grantOtherPattern     = regexp.MustCompile(`(?is)\sON\s+(?:SCHEMA|SEQUENCE|FUNCTION|PROCEDURE|ROUTINE|DATABASE|TYPE|DOMAIN|LANGUAGE|ALL\s)`)
+	createSequencePattern = regexp.MustCompile(`(?is)^CREATE\s+SEQUENCE\s+(?:IF\s+NOT\s+EXISTS\s+)?`)
+	alterSequencePattern  = regexp.MustCompile(`(?is)^ALTER\s+SEQUENCE\s+(?:IF\s+EXISTS\s+)?`)
+	ownedByPattern        = regexp.MustCompile(`(?is)\sOWNED\s+BY\s+`)
+	identitySequence      = regexp.MustCompile(`(?is)\sSEQUENCE\s+NAME\s+`)
+	setvalPattern         = regexp.MustCompile(`(?is)^SELECT\s+pg_catalog\.setval\('((?:[^']|'')+)'`)
+	schemaPattern         = regexp.MustCompile(`(?is)^(?:CREATE|ALTER|COMMENT\s+ON)\s+SCHEMA\s+(?:IF\s+NOT\s+EXISTS\s+)?`)
+	schemaObjectPattern   = regexp.MustCompile(`(?is)^(?:CREATE(?:\s+OR\s+REPLACE)?|ALTER|COMMENT\s+ON)\s+(?:MATERIALIZED\s+VIEW|VIEW|FUNCTION|PROCEDURE|TYPE|DOMAIN|AGGREGATE)\s+`)
+	sessionPattern        = regexp.MustCompile(`(?is)^(?:SET\s|SELECT\s+pg_catalog\.set_config\(|UNLOCK\s+TABLES)`)
+	renamedAlterPattern   = regexp.MustCompile(`(?is)\s(?:OWNER\s+TO|DISABLE\s+KEYS|ENABLE\s+KEYS)\s`)
+	foreignKeyLine        = regexp.MustCompile(`(?i)^\s*CONSTRAINT\s+\S+\s+FOREIGN\s+KEY`)
+	mysqlVersionComment   = regexp.MustCompile(`(?s)^(/\*!\d+\s*)(.*?)(\s*\*/\s*;?\s*)$`)
+	dollarQuoteTag        = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
+	delimiterPattern      = regexp.MustCompile(`(?i)^DELIMITER\s+(\S+)`)
+	mysqlCommentMarker    = regexp.MustCompile(`/\*!\d+\s?|\*/`)
+	pgDatabaseSwitch      = regexp.MustCompile(`(?is)^(?:\\(?:connect|c)(?:\s|$)|CREATE\s+DATABASE\s)`)
+	mysqlDatabaseSwitch   = regexp.MustCompile(`(?is)^(?:USE\s|CREATE\s+(?:DATABASE|SCHEMA)\s)`)
+)
+
+// maxDatabaseSwitches is how many database switching statements are reported
+const maxDatabaseSwitches = 5
+
+// statementKind is what a dump statement does to the table it names
+type statementKind int
+
+const (
+	kindCreate statementKind = iota
+	kindAlter
+	kindDrop
+	kindData
+	kindLock
+	kindIndex
+	kindTrigger
+	kindComment
+	kindGrant
+)
+
+// sqlScanState tracks quoting across the lines of a statement
+type sqlScanState struct {
+	quote        byte   // ', " or ` while inside a quoted string or identifier
+	dollarTag    string // PostgreSQL dollar quote delimiter
+	blockComment bool
+}
+
+// scan advances the state over a line and returns the index of the last byte
+// of the delimiter that ends the statement, or -1 when the statement continues
+func (s *sqlScanState) scan(line string, postgres bool, delimiter string) int {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case s.blockComment:
+			if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+				s.blockComment = false
+				i++
+			}
+		case s.dollarTag != "":
+			if strings.HasPrefix(line[i:], s.dollarTag) {
+				i += len(s.dollarTag) - 1
+				s.dollarTag = ""
+			}
+		case s.quote != 0:
+			// MySQL escapes quotes with a backslash, PostgreSQL doubles them
+			if c == '\\' && !postgres {
+				i++
+			} else if c == s.quote {
+				s.quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			s.quote = c
+		case c == '-' && i+1 < len(line) && line[i+1] == '-':
+			return -1
+		case c == '/' && i+1 < len(line) && line[i+1] == '*':
+			s.blockComment = true
+			i++
+		case c == '$' && postgres:
+			if tag := dollarQuoteTag.FindString(line[i:]); tag != "" {
+				s.dollarTag = tag
+				i += len(tag) - 1
+			}
+		case c == delimiter[0] && strings.HasPrefix(line[i:], delimiter):
+			return i + len(delimiter) - 1
+		}
+	}
+	return -1
+}
+
+// sqlStatementReader splits a plain SQL dump into statements without loading
+// it into memory. COPY data that follows a statement is read with readLine.
+type sqlStatementReader struct {
+	reader    *bufio.Reader
+	postgres  bool
+	delimiter string // changed by the MySQL client's DELIMITER command
+	pending   string
+}
+
+func (r *sqlStatementReader) readLine() (string, error) {
+	if r.pending != "" {
+		line := r.pending
+		r.pending = ""
+		return line, nil
+	}
+	line, err := r.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return line, nil
+	}
+	return line, err
+}
+
+// next returns the next statement, or io.EOF at the end of the dump
+func (r *sqlStatementReader) next() (string, error) {
+	var stmt strings.Builder
+	var state sqlScanState
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(stmt.String()) != "" {
+				return stmt.String(), nil
+			}
+			return "", err
+		}
+
+		if stmt.Len() == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+			// psql meta-commands such as \connect end at the line break
+			if r.postgres && strings.HasPrefix(trimmed, "\\") {
+				return trimmed, nil
+			}
+			// mysqldump wraps triggers and routines in DELIMITER ;; blocks
+			if m := delimiterPattern.FindStringSubmatch(trimmed); m != nil && !r.postgres {
+				r.delimiter = m[1]
+				return trimmed, nil
+			}
+		}
+
+		end := state.scan(line, r.postgres, r.delimiter)
+		if end < 0 {
+			stmt.WriteString(line)
+			continue
+		}
+		stmt.WriteString(line[:end+1])
+		if rest := line[end+1:]; strings.TrimSpace(rest) != "" {
+			r.pending = rest
+		}
+		return stmt.String(), nil
+	}
+}
+
+// readIdentifier reads one identifier, quoted or bare, from the start of s
+func readIdentifier(s string) (string, int) {
+	if s == "" {
+		return "", 0
+	}
+	if quote := s[0]; quote == '"' || quote == '`' {
+		var ident strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != quote {
+				ident.WriteByte(s[i])
+				continue
+			}
+			// A doubled quote is an escaped quote
+			if i+1 < len(s) && s[i+1] == quote {
+				ident.WriteByte(quote)
+				i++
+				continue
+			}
+			return ident.String(), i + 1
+		}
+		return "", 0
+	}
+
+	end := 0
+	for end < len(s) {
+		c := s[end]
+		if c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 {
+			end++
+			continue
+		}
+		break
+	}
+	return s[:end], end
+}
+
+// readQualifiedName reads a dotted name such as public.users from the start
+// of s and returns its parts and how many bytes it spans
+func readQualifiedName(s string) ([]string, int) {
+	var parts []string
+	pos := 0
+	for {
+		ident, n := readIdentifier(s[pos:])
+		if n == 0 {
+			break
+		}
+		parts = append(parts, ident)
+		pos += n
+		if pos >= len(s) || s[pos] != '.' {
+			break
+		}
+		pos++
+	}
+	return parts, pos
+}
+
+// tableRef is a table named by a dump statement
+type tableRef struct {
+	schema string
+	name   string
+}
+
+func (t tableRef) key() string {
+	if t.schema == "" {
+		return t.name
+	}
+	return t.schema + "." + t.name
+}
+
+// dumpFilter decides which statements of a SQL dump a selective restore keeps
+type dumpFilter struct {
+	postgres bool
+	objects  *RestoreObjects
+	tables   map[string]string // selected "table" or "schema.table" -> request entry
+	schemas  map[string]bool
+	rename   map[string]string // request entry -> new table name
+	matched  map[string]bool   // request entries found in the dump
+
+	sequences        map[string]bool     // sequences of selected tables
+	pendingSequences map[string][]string // sequence statements seen before their owner
+
+	selectAll bool            // no selection was given, every table is kept
+	created   map[string]bool // tables the filtered dump creates, by restored name
+	loaded    map[string]bool // tables the filtered dump loads rows into
+}
+
+// newDumpFilter builds the filter of a selection. A nil selection keeps every
+// table, which is used to list what a full restore creates.
+func newDumpFilter(dbType string, objects *RestoreObjects) *dumpFilter {
+	selectAll := objects == nil
+	if selectAll {
+		objects = &RestoreObjects{}
+	}
+	f := &dumpFilter{
+		postgres:         dbType == "postgresql",
+		objects:          objects,
+		tables:           make(map[string]string),
+		schemas:          make(map[string]bool),
+		rename:           objects.Rename,
+		matched:          make(map[string]bool),
+		sequences:        make(map[string]bool),
+		pendingSequences: make(map[string][]string),
+		selectAll:        selectAll,
+		created:          make(map[string]bool),
+		loaded:           make(map[string]bool),
+	}
+	for _, table := range objects.Tables {
+		f.tables[table] = table
+	}
+	for _, schema := range objects.Schemas {
+		f.schemas[schema] = true
+	}
+	return f
+}
+
+// selection returns the request entry that selects a table, if any
+func (f *dumpFilter) selection(table tableRef) (string, bool) {
+	if f.selectAll {
+		return table.key(), true
+	}
+	if entry, ok := f.tables[table.key()]; ok {
+		return entry, true
+	}
+	if entry, ok := f.tables[table.name]; ok {
+		return entry, true
+	}
+	if table.schema != "" && f.schemas[table.schema] {
+		return table.schema, true
+	}
+	return "", false
+}
+
+// renamedName returns the quoted name a renamed table is restored as
+func (f *dumpFilter) renamedName(table tableRef, entry string) (string, bool) {
+	newName, ok := f.rename[entry]
+	if !ok {
+		return "", false
+	}
+	quoted := quoteMySQLIdentifier(newName)
+	if f.postgres {
+		quoted = pq.QuoteIdentifier(newName)
+		if table.schema != "" {
+			quoted = pq.QuoteIdentifier(table.schema) + "." + quoted
+		}
+	}
+	return quoted, true
+}
+
+// classify finds the table a statement acts on and where its name starts
+func classify(body string) (statementKind, int, bool) {
+	patterns := []struct {
+		kind    statementKind
+		pattern *regexp.Regexp
+	}{
+		{kindCreate, createTablePattern},
+		{kindAlter, alterTablePattern},
+		{kindDrop, dropTablePattern},
+		{kindData, copyPattern},
+		{kindData, insertPattern},
+		{kindLock, lockTablesPattern},
+		{kindIndex, createIndexPattern},
+		{kindTrigger, createTriggerPattern},
+		{kindComment, commentOnPattern},
+	}
+	for _, p := range patterns {
+		if loc := p.pattern.FindStringIndex(body); loc != nil {
+			return p.kind, loc[1], true
+		}
+	}
+	if loc := grantPattern.FindStringIndex(body); loc != nil && !grantOtherPattern.MatchString(body) {
+		return kindGrant, loc[1], true
+	}
+	return 0, 0, false
+}
+
+// filter returns the statement to write for stmt, or false to skip it
+func (f *dumpFilter) filter(stmt string) (string, bool) {
+	prefix, body, suffix := "", strings.TrimSpace(stmt), ""
+	if m := mysqlVersionComment.FindStringSubmatch(body); m != nil {
+		prefix, body, suffix = m[1], m[2], m[3]
+	}
+
+	if strings.HasPrefix(body, "\\") || delimiterPattern.MatchString(body) || sessionPattern.MatchString(body) {
+		return stmt, true
+	}
+
+	if f.postgres {
+		if out, handled, keep := f.filterPostgresObject(body); handled {
+			return out, keep
+		}
+	} else if strings.HasPrefix(body, "/*!") {
+		return stmt, f.keepMySQLTrigger(body)
+	}
+
+	kind, nameStart, ok := classify(body)
+	if !ok {
+		return "", false
+	}
+
+	parts, nameLen := readQualifiedName(body[nameStart:])
+	if kind == kindComment && strings.EqualFold(commentOnPattern.FindStringSubmatch(body)[1], "COLUMN") && len(parts) > 1 {
+		// COMMENT ON COLUMN names table.column
+		parts = parts[:len(parts)-1]
+		nameLen = strings.LastIndex(body[nameStart:nameStart+nameLen], ".")
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+	table := tableRef{name: parts[len(parts)-1]}
+	if len(parts) > 1 {
+		table.schema = parts[len(parts)-2]
+	}
+
+	entry, selected := f.selection(table)
+	if !selected {
+		return "", false
+	}
+	f.matched[entry] = true
+
+	if f.postgres && kind == kindAlter {
+		// Identity columns own a sequence that setval later refers to
+		if loc := identitySequence.FindStringIndex(body); loc != nil {
+			seqParts, _ := readQualifiedName(body[loc[1]:])
+			f.sequences[strings.Join(seqParts, ".")] = true
+		}
+	}
+
+	newName, renamed := f.renamedName(table, entry)
+	if !keepStatement(kind, body, renamed, f.objects.DataOnly) {
+		return "", false
+	}
+	f.record(kind, table, entry)
+
+	if renamed {
+		body = body[:nameStart] + newName + body[nameStart+nameLen:]
+		if kind == kindCreate && !f.postgres {
+			body = stripForeignKeys(body)
+		}
+	}
+	return prefix + body + suffix, true
+}
+
+// record notes a table that a kept statement creates or loads, under the
+// name it is restored as
+func (f *dumpFilter) record(kind statementKind, table tableRef, entry string) {
+	if newName, ok := f.rename[entry]; ok {
+		table.name = newName
+	}
+	switch kind {
+	case kindCreate:
+		f.created[table.key()] = true
+	case kindData:
+		f.loaded[table.key()] = true
+	}
+}
+
+// keepMySQLTrigger handles the triggers mysqldump spreads over several
+// version comments. They are kept as they are, so they are dropped for
+// renamed tables like any other trigger.
+func (f *dumpFilter) keepMySQLTrigger(body string) bool {
+	plain := mysqlCommentMarker.ReplaceAllString(body, "")
+	loc := createTriggerPattern.FindStringIndex(plain)
+	if loc == nil {
+		return false
+	}
+	parts, _ := readQualifiedName(plain[loc[1]:])
+	if len(parts) == 0 {
+		return false
+	}
+	entry, selected := f.selection(tableRef{name: parts[len(parts)-1]})
+	if !selected {
+		return false
+	}
+	_, renamed := f.rename[entry]
+	return keepStatement(kindTrigger, plain, renamed, f.objects.DataOnly)
+}
+
+// keepStatement decides whether a statement of a selected table is restored.
+// Renamed tables get their columns and data only, since their indexes,
+// constraints, triggers and sequences would clash with the originals.
+func keepStatement(kind statementKind, body string, renamed, dataOnly bool) bool {
+	if dataOnly {
+		return kind == kindData || kind == kindLock
+	}
+	if !renamed {
+		return true
+	}
+	switch kind {
+	case kindIndex, kindTrigger:
+		return false
+	case kindAlter:
+		return renamedAlterPattern.MatchString(body + " ")
+	default:
+		return true
+	}
+}
+
+// filterPostgresObject handles the PostgreSQL statements that aren't tied to
+// a table by name: sequences, schemas and schema objects
+func (f *dumpFilter) filterPostgresObject(body string) (out string, handled, keep bool) {
+	ddl := !f.objects.DataOnly
+
+	if loc := createSequencePattern.FindStringIndex(body); loc != nil {
+		parts, _ := readQualifiedName(body[loc[1]:])
+		name := strings.Join(parts, ".")
+		if f.sequences[name] {
+			return body, true, ddl
+		}
+		f.pendingSequences[name] = append(f.pendingSequences[name], body)
+		return "", true, false
+	}
+
+	if loc := alterSequencePattern.FindStringIndex(body); loc != nil {
+		parts, _ := readQualifiedName(body[loc[1]:])
+		name := strings.Join(parts, ".")
+
+		if owned := ownedByPattern.FindStringIndex(body); owned != nil {
+			ownerParts, _ := readQualifiedName(body[owned[1]:])
+			if len(ownerParts) >= 2 {
+				// OWNED BY names schema.table.column or table.column
+				table := tableRef{name: ownerParts[len(ownerParts)-2]}
+				if len(ownerParts) > 2 {
+					table.schema = ownerParts[len(ownerParts)-3]
+				}
+				if entry, ok := f.selection(table); ok {
+					if _, renamed := f.rename[entry]; !renamed {
+						f.sequences[name] = true
+						statements := append(f.pendingSequences[name], body)
+						delete(f.pendingSequences, name)
+						return strings.Join(statements, "\n\n"), true, ddl
+					}
+				}
+			}
+			delete(f.pendingSequences, name)
+			return "", true, false
+		}
+
+		if f.sequences[name] {
+			return body, true, ddl
+		}
+		f.pendingSequences[name] = append(f.pendingSequences[name], body)
+		return "", true, false
+	}
+
+	if m := setvalPattern.FindStringSubmatch(body); m != nil {
+		parts, _ := readQualifiedName(strings.ReplaceAll(m[1], "''", "'"))
+		return body, true, f.sequences[strings.Join(parts, ".")]
+	}
+
+	if loc := schemaPattern.FindStringIndex(body); loc != nil {
+		name, _ := readIdentifier(body[loc[1]:])
+		if f.schemas[name] {
+			f.matched[name] = true
+			return body, true, ddl
+		}
+		return "", true, false
+	}
+
+	if loc := schemaObjectPattern.FindStringIndex(body); loc != nil {
+		parts, _ := readQualifiedName(body[loc[1]:])
+		if len(parts) > 1 && f.schemas[parts[0]] {
+			f.matched[parts[0]] = true
+			return body, true, ddl
+		}
+		return "", true, false
+	}
+
+	return "", false, false
+}
+
+// stripForeignKeys drops the foreign keys of a MySQL CREATE TABLE, whose names
+// are unique per database and would clash with the original table's
+func stripForeignKeys(body string) string {
+	lines := strings.Split(body, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if foreignKeyLine.MatchString(line) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	// The column list may now end with a dangling comma
+	for i := 1; i < len(kept); i++ {
+		if strings.HasPrefix(strings.TrimSpace(kept[i]), ")") {
+			kept[i-1] = strings.TrimSuffix(strings.TrimRight(kept[i-1], " \t"), ",")
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// missing returns the requested tables and schemas the dump didn't contain
+func (f *dumpFilter) missing() []string {
+	var missing []string
+	for _, table := range f.objects.Tables {
+		if !f.matched[table] {
+			missing = append(missing, table)
+		}
+	}
+	for _, schema := range f.objects.Schemas {
+		if !f.matched[schema] {
+			missing = append(missing, schema)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// filterSQLDump streams a plain SQL dump into a temporary file holding only
+// the statements of the requested tables and schemas
+func filterSQLDump(dumpPath, dbType string, objects *RestoreObjects) (string, func(), error) {
+	src, err := os.Open(dumpPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open backup file: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp("", "velld-restore-*.sql")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create filtered dump: %v", err)
+	}
+	release := func() { os.Remove(dst.Name()) }
+
+	filter := newDumpFilter(dbType, objects)
+	if err := writeFilteredDump(src, dst, filter); err != nil {
+		dst.Close()
+		release()
+		return "", nil, err
+	}
+	if err := dst.Close(); err != nil {
+		release()
+		return "", nil, fmt.Errorf("failed to write filtered dump: %v", err)
+	}
+
+	if missing := filter.missing(); len(missing) > 0 {
+		release()
+		return "", nil, fmt.Errorf("%w: not found in backup: %s", errRestoreSelection, strings.Join(missing, ", "))
+	}
+	return dst.Name(), release, nil
+}
+
+// scanDump runs a selection over a plain dump without writing anything,
+// returning the filter with the tables the restore would create and load
+func scanDump(src io.Reader, dbType string, objects *RestoreObjects) (*dumpFilter, error) {
+	filter := newDumpFilter(dbType, objects)
+	if err := writeFilteredDump(src, io.Discard, filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// dumpDatabaseSwitches returns the first statements of a plain SQL dump that
+// create or switch to a database by name, as pg_dumpall, pg_dump --create and
+// mysqldump --databases write them. Restoring such a dump writes into the
+// databases it names instead of the restore's target.
+func dumpDatabaseSwitches(src io.Reader, dbType string) ([]string, error) {
+	postgres := dbType == "postgresql"
+	reader := &sqlStatementReader{
+		reader:    bufio.NewReaderSize(src, 1024*1024),
+		postgres:  postgres,
+		delimiter: ";",
+	}
+
+	var switches []string
+	for len(switches) < maxDatabaseSwitches {
+		stmt, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup file: %v", err)
+		}
+
+		body := strings.TrimSpace(stmt)
+		if postgres {
+			if copyPattern.MatchString(body) && copyFromStdinPattern.MatchString(body) {
+				if err := copyDataBlock(reader, nil, false); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if pgDatabaseSwitch.MatchString(body) {
+				switches = append(switches, firstLine(body))
+			}
+			continue
+		}
+
+		if m := mysqlVersionComment.FindStringSubmatch(body); m != nil {
+			body = m[2]
+		}
+		if mysqlDatabaseSwitch.MatchString(body) {
+			switches = append(switches, firstLine(body))
+		}
+	}
+	return switches, nil
+}
+
+// firstLine returns the first line of a statement for messages
+func firstLine(stmt string) string {
+	if i := strings.IndexByte(stmt, '\n'); i >= 0 {
+		return strings.TrimSpace(stmt[:i])
+	}
+	return stmt
+}
+
+func writeFilteredDump(src io.Reader, dst io.Writer, filter *dumpFilter) error {
+	reader := &sqlStatementReader{
+		reader:    bufio.NewReaderSize(src, 1024*1024),
+		postgres:  filter.postgres,
+		delimiter: ";",
+	}
+	writer := bufio.NewWriterSize(dst, 1024*1024)
+
+	for {
+		stmt, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup file: %v", err)
+		}
+
+		// COPY rows follow their statement up to a \. line
+		isCopy := filter.postgres && copyPattern.MatchString(strings.TrimSpace(stmt)) && copyFromStdinPattern.MatchString(stmt)
+
+		out, keep := filter.filter(stmt)
+		if keep {
+			separator := "\n\n"
+			if isCopy {
+				separator = "\n"
+			}
+			if _, err := writer.WriteString(strings.TrimSpace(out) + separator); err != nil {
+				return fmt.Errorf("failed to write filtered dump: %v", err)
+			}
+		}
+
+		if isCopy {
+			if err := copyDataBlock(reader, writer, keep); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write filtered dump: %v", err)
+	}
+	return nil
+}
+
+func copyDataBlock(reader *sqlStatementReader, writer *bufio.Writer, keep bool) error {
+	for {
+		line, err := reader.readLine()
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("backup file ends inside COPY data")
+			}
+			return fmt.Errorf("failed to read backup file: %v", err)
+		}
+		if keep {
+			if _, err := writer.WriteString(line); err != nil {
+				return fmt.Errorf("failed to write filtered dump: %v", err)
+			}
+		}
+		if strings.TrimRight(line, "\r\n") == "\\." {
+			if keep {
+				if _, err := writer.WriteString("\n"); err != nil {
+					return fmt.Errorf("failed to write filtered dump: %v", err)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// validateRestoreObjects checks that a selection fits the database type
+func validateRestoreObjects(dbType string, objects *RestoreObjects) error {
+	switch dbType {
+	case "postgresql":
+		if len(objects.Collections) > 0 {
+			return fmt.Errorf("%w: collections only apply to MongoDB", errRestoreSelection)
+		}
+	case "mysql", "mariadb":
+		if len(objects.Collections) > 0 {
+			return fmt.Errorf("%w: collections only apply to MongoDB", errRestoreSelection)
+		}
+		if len(objects.Schemas) > 0 {
+			return fmt.Errorf("%w: schemas only apply to PostgreSQL", errRestoreSelection)
+		}
+		for _, table := range objects.Tables {
+			if strings.Contains(table, ".") {
+				return fmt.Errorf("%w: MySQL tables are selected without a schema: %s", errRestoreSelection, table)
+			}
+		}
+	case "mongodb":
+		if len(objects.Tables) > 0 || len(objects.Schemas) > 0 {
+			return fmt.Errorf("%w: select collections for MongoDB", errRestoreSelection)
+		}
+		if objects.DataOnly {
+			return fmt.Errorf("%w: data_only doesn't apply to MongoDB", errRestoreSelection)
+		}
+	default:
+		return fmt.Errorf("%w: selective restore isn't supported for %s", errRestoreSelection, dbType)
+	}
+	return nil
+}
+
+// mongoNamespaceArgs limits mongorestore to the selected collections and maps
+// them into the target database, under their new name if renamed
+func mongoNamespaceArgs(sourceDatabase, targetDatabase string, objects *RestoreObjects) []string {
+	var args []string
+	for _, collection := range objects.Collections {
+		target := collection
+		if newName, ok := objects.Rename[collection]; ok {
+			target = newName
+		}
+		source := sourceDatabase + "." + collection
+		args = append(args,
+			"--nsInclude", source,
+			"--nsFrom", source,
+			"--nsTo", targetDatabase+"."+target,
+		)
+	}
+	return args
+}
+
+func hasFilePrefix(path string, magic []byte) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, magic)
+}
+
+// isPgCustomDump reports whether a dump is in pg_dump's custom format, which
+// psql can't read
+func isPgCustomDump(path string) bool {
+	return hasFilePrefix(path, pgCustomDumpMagic)
+}
+
+func isMongoArchive(path string) bool {
+	return hasFilePrefix(path, mongoArchiveMagic)
+}
+
+// convertPgCustomDump turns a custom-format dump into a plain SQL file with
+// pg_restore. It is used for full restores, for masking and for selections
+// that rename tables, which only filterSQLDump can do; other selections are
+// restored from the archive with a list from listPgCustomDump.
+func (s *BackupService) convertPgCustomDump(dumpPath string, objects *RestoreObjects) (string, func(), error) {
+	binaryPath := common.FindBinaryPath("postgresql", "pg_restore")
+	if binaryPath == "" {
+		return "", nil, fmt.Errorf("pg_restore binary not found, it is needed to restore custom-format dumps")
+	}
+
+	out, err := os.CreateTemp("", "velld-restore-*.sql")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create plain dump: %v", err)
+	}
+	out.Close()
+	release := func() { os.Remove(out.Name()) }
+
+	args := []string{"--file", out.Name()}
+	if objects != nil && objects.DataOnly {
+		args = append(args, "--data-only")
+	}
+	args = append(args, dumpPath)
+
+	cmd := exec.Command(filepath.Join(binaryPath, common.GetPlatformExecutableName("pg_restore")), args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		release()
+		return "", nil, fmt.Errorf("pg_restore failed to read custom-format dump: %v\nOutput: %s", err, string(output))
+	}
+	return out.Name(), release, nil
+}
+
+// pgArchiveEntry is an item of the table of contents pg_restore --list
+// prints for a custom-format archive
+type pgArchiveEntry struct {
+	line   string
+	id     string
+	desc   string
+	schema string
+	tag    string
+	deps   []string // dump IDs, listed with --verbose
+}
+
+var pgArchiveEntryLine = regexp.MustCompile(`^(\d+); \d+ \d+ (.+)$`)
+
+// pgArchiveDescs are the entry types a selective restore looks at. Types
+// that start like another one come first.
+var pgArchiveDescs = []string{
+	"TABLE DATA", "TABLE ATTACH", "TABLE",
+	"SEQUENCE OWNED BY", "SEQUENCE SET", "SEQUENCE",
+	"FK CONSTRAINT", "CHECK CONSTRAINT", "CONSTRAINT",
+	"INDEX ATTACH", "INDEX",
+	"DEFAULT", "TRIGGER", "COMMENT", "ACL", "SCHEMA",
+	"MATERIALIZED VIEW DATA", "MATERIALIZED VIEW", "VIEW",
+	"FUNCTION", "PROCEDURE", "TYPE", "DOMAIN", "AGGREGATE",
+}
+
+// parsePgArchiveTOC reads the entries of a table of contents with the types
+// in pgArchiveDescs
+func parsePgArchiveTOC(toc string) []pgArchiveEntry {
+	var entries []pgArchiveEntry
+	last := -1
+	for _, line := range strings.Split(toc, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if deps, ok := strings.CutPrefix(line, ";\tdepends on:"); ok {
+			if last >= 0 {
+				entries[last].deps = strings.Fields(deps)
+			}
+			continue
+		}
+
+		match := pgArchiveEntryLine.FindStringSubmatch(line)
+		if match == nil {
+			if !strings.HasPrefix(line, ";") {
+				last = -1
+			}
+			continue
+		}
+		last = -1
+		for _, desc := range pgArchiveDescs {
+			rest, ok := strings.CutPrefix(match[2], desc+" ")
+			if !ok {
+				continue
+			}
+			// The schema comes first and the owner last, the tag may hold spaces
+			schema, rest, _ := strings.Cut(rest, " ")
+			tag := rest
+			if i := strings.LastIndex(rest, " "); i >= 0 {
+				tag = rest[:i]
+			}
+			entries = append(entries, pgArchiveEntry{line: line, id: match[1], desc: desc, schema: schema, tag: tag})
+			last = len(entries) - 1
+			break
+		}
+	}
+	return entries
+}
+
+// filterPgArchiveTOC keeps the table of contents entries of a selection: the
+// selected tables and their data, the indexes, constraints, defaults,
+// triggers, sequences, comments and grants that belong to them, and for
+// selected schemas the schema with its views, functions and types, like
+// filterSQLDump. It returns the list for pg_restore --use-list and the
+// requested tables and schemas the archive didn't contain.
+func filterPgArchiveTOC(toc string, objects *RestoreObjects) (string, []string) {
+	filter := newDumpFilter("postgresql", objects)
+	entries := parsePgArchiveTOC(toc)
+	keep := make(map[string]bool)
+	tables := make(map[string]bool) // dump IDs of the selected tables
+	var selected []tableRef
+
+	for _, e := range entries {
+		if e.desc != "TABLE" && e.desc != "TABLE DATA" {
+			continue
+		}
+		table := tableRef{schema: e.schema, name: e.tag}
+		entry, ok := filter.selection(table)
+		if !ok {
+			continue
+		}
+		filter.matched[entry] = true
+		keep[e.id] = true
+		if e.desc == "TABLE" {
+			tables[e.id] = true
+			selected = append(selected, table)
+		}
+	}
+
+	dependsOn := func(e pgArchiveEntry, ids map[string]bool) bool {
+		for _, dep := range e.deps {
+			if ids[dep] {
+				return true
+			}
+		}
+		return false
+	}
+	// Constraints, defaults and triggers are tagged "<table> <name>". Foreign
+	// keys also depend on the table they reference, so the tag decides.
+	taggedWith := func(e pgArchiveEntry) bool {
+		for _, table := range selected {
+			if table.schema == e.schema && strings.HasPrefix(e.tag, table.name+" ") {
+				return true
+			}
+		}
+		return false
+	}
+
+	sequences := make(map[string]bool) // dump IDs of sequences kept objects use
+	for _, e := range entries {
+		switch e.desc {
+		case "SCHEMA":
+			if filter.schemas[e.tag] {
+				filter.matched[e.tag] = true
+				keep[e.id] = true
+			}
+		case "MATERIALIZED VIEW", "VIEW", "FUNCTION", "PROCEDURE", "TYPE", "DOMAIN", "AGGREGATE":
+			if filter.schemas[e.schema] {
+				filter.matched[e.schema] = true
+				keep[e.id] = true
+			}
+		case "INDEX", "SEQUENCE OWNED BY":
+			keep[e.id] = dependsOn(e, tables)
+		case "CONSTRAINT", "FK CONSTRAINT", "CHECK CONSTRAINT", "DEFAULT", "TRIGGER":
+			keep[e.id] = taggedWith(e)
+		default:
+			continue
+		}
+		if keep[e.id] && (e.desc == "DEFAULT" || e.desc == "SEQUENCE OWNED BY") {
+			for _, dep := range e.deps {
+				sequences[dep] = true
+			}
+		}
+	}
+	// Identity sequences depend on their table, serial ones are found
+	// through the defaults and OWNED BY entries that use them
+	for _, e := range entries {
+		if e.desc == "SEQUENCE" && (sequences[e.id] || dependsOn(e, tables)) {
+			keep[e.id] = true
+		}
+	}
+	for _, e := range entries {
+		switch e.desc {
+		case "SEQUENCE SET", "COMMENT", "ACL":
+			if dependsOn(e, keep) {
+				keep[e.id] = true
+			}
+		}
+	}
+
+	var list strings.Builder
+	for _, e := range entries {
+		if !keep[e.id] {
+			continue
+		}
+		if objects.DataOnly && e.desc != "TABLE DATA" && e.desc != "SEQUENCE SET" {
+			continue
+		}
+		list.WriteString(e.line)
+		list.WriteString("\n")
+	}
+	return list.String(), filter.missing()
+}
+
+// listPgCustomDump writes the table of contents entries of a selection to a
+// temporary list file, so pg_restore restores the selected tables with the
+// objects that belong to them, which its -t and -n options leave out
+func (s *BackupService) listPgCustomDump(dumpPath string, objects *RestoreObjects) (string, func(), error) {
+	binaryPath := common.FindBinaryPath("postgresql", "pg_restore")
+	if binaryPath == "" {
+		return "", nil, fmt.Errorf("pg_restore binary not found, it is needed to restore custom-format dumps")
+	}
+
+	cmd := exec.Command(filepath.Join(binaryPath, common.GetPlatformExecutableName("pg_restore")), "--list", "--verbose", dumpPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("pg_restore failed to read custom-format dump: %v\nOutput: %s", err, stderr.String())
+	}
+
+	list, missing := filterPgArchiveTOC(string(output), objects)
+	if len(missing) > 0 {
+		return "", nil, fmt.Errorf("%w: not found in backup: %s", errRestoreSelection, strings.Join(missing, ", "))
+	}
+
+	out, err := os.CreateTemp("", "velld-restore-*.list")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create restore list: %v", err)
+	}
+	release := func() { os.Remove(out.Name()) }
+	if _, err := out.WriteString(list); err != nil {
+		out.Close()
+		release()
+		return "", nil, fmt.Errorf("failed to write restore list: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		release()
+		return "", nil, fmt.Errorf("failed to write restore list: %v", err)
+	}
+	return out.Name(), release, nil
+}
@@ -0,0 +1,419 @@
+package backup
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSQLStatementReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		dump     string
+		postgres bool
+		want     []string
+	}{
+		{
+			name: "statement over several lines",
+			dump: "CREATE TABLE t (\n  a int\n);\n",
+			want: []string{"CREATE TABLE t (\n  a int\n);"},
+		},
+		{
+			name: "several statements on one line",
+			dump: "SELECT 1; SELECT 2;\n",
+			want: []string{"SELECT 1;", "SELECT 2;"},
+		},
+		{
+			name: "delimiter inside a string",
+			dump: "INSERT INTO t VALUES ('a;b');\nSELECT 1;\n",
+			want: []string{"INSERT INTO t VALUES ('a;b');", "SELECT 1;"},
+		},
+		{
+			name: "mysql backslash escape",
+			dump: "INSERT INTO t VALUES ('it\\'s;');\nSELECT 1;\n",
+			want: []string{"INSERT INTO t VALUES ('it\\'s;');", "SELECT 1;"},
+		},
+		{
+			name:     "postgres doubled quote",
+			dump:     "INSERT INTO t VALUES ('it''s;', 'c:\\');\nSELECT 1;\n",
+			postgres: true,
+			want:     []string{"INSERT INTO t VALUES ('it''s;', 'c:\\');", "SELECT 1;"},
+		},
+		{
+			name:     "postgres dollar quote",
+			dump:     "CREATE FUNCTION f() RETURNS int AS $body$\nSELECT 1;\n$body$ LANGUAGE sql;\nSELECT 2;\n",
+			postgres: true,
+			want:     []string{"CREATE FUNCTION f() RETURNS int AS $body$\nSELECT 1;\n$body$ LANGUAGE sql;", "SELECT 2;"},
+		},
+		{
+			name: "comments",
+			dump: "-- a; comment\nSELECT 1; -- trailing;\n/* block; */ SELECT 2;\n",
+			want: []string{"SELECT 1;", "/* block; */ SELECT 2;"},
+		},
+		{
+			name:     "psql meta-command ends at the line break",
+			dump:     "\\connect app\nSELECT 1;\n",
+			postgres: true,
+			want:     []string{"\\connect app", "SELECT 1;"},
+		},
+		{
+			name: "mysql client delimiter",
+			dump: "DELIMITER ;;\nCREATE TRIGGER trg BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.a = 1; END ;;\nDELIMITER ;\nSELECT 1;\n",
+			want: []string{
+				"DELIMITER ;;",
+				"CREATE TRIGGER trg BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.a = 1; END ;;",
+				"DELIMITER ;",
+				"SELECT 1;",
+			},
+		},
+		{
+			name: "last statement without a delimiter",
+			dump: "SELECT 1;\nSELECT 2",
+			want: []string{"SELECT 1;", "SELECT 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &sqlStatementReader{
+				reader:    bufio.NewReader(strings.NewReader(tt.dump)),
+				postgres:  tt.postgres,
+				delimiter: ";",
+			}
+			var got []string
+			for {
+				stmt, err := reader.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, strings.TrimSpace(stmt))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadQualifiedName(t *testing.T) {
+	tests := []struct {
+		s     string
+		parts []string
+		n     int
+	}{
+		{s: "public.users (", parts: []string{"public", "users"}, n: 12},
+		{s: "users;", parts: []string{"users"}, n: 5},
+		{s: "`my``table` VALUES", parts: []string{"my`table"}, n: 11},
+		{s: `"Sales"."Big ""Orders""" (`, parts: []string{"Sales", `Big "Orders"`}, n: 24},
+		{s: "(id)", n: 0},
+	}
+
+	for _, tt := range tests {
+		parts, n := readQualifiedName(tt.s)
+		if !reflect.DeepEqual(parts, tt.parts) || n != tt.n {
+			t.Errorf("readQualifiedName(%q) = %q, %d, want %q, %d", tt.s, parts, n, tt.parts, tt.n)
+		}
+	}
+}
+
+const postgresFilterDump = `SET statement_timeout = 0;
+
+CREATE SCHEMA sales;
+
+CREATE TABLE public.users (
+    id integer
+);
+
+CREATE TABLE public.orders (
+    id integer
+);
+
+CREATE TABLE sales.invoices (
+    id integer
+);
+
+CREATE VIEW sales.totals AS SELECT 1;
+
+CREATE SEQUENCE public.users_id_seq
+    START WITH 1;
+
+ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
+
+CREATE SEQUENCE public.orders_id_seq;
+
+ALTER SEQUENCE public.orders_id_seq OWNED BY public.orders.id;
+
+COPY public.users (id) FROM stdin;
+1
+2
+\.
+
+COPY public.orders (id) FROM stdin;
+3
+\.
+
+SELECT pg_catalog.setval('public.users_id_seq', 2, true);
+
+SELECT pg_catalog.setval('public.orders_id_seq', 3, true);
+
+CREATE INDEX users_id ON public.users USING btree (id);
+`
+
+const mysqlFilterDump = "CREATE TABLE `users` (\n" +
+	"  `id` int NOT NULL,\n" +
+	"  `team_id` int,\n" +
+	"  CONSTRAINT `fk_team` FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`)\n" +
+	") ENGINE=InnoDB;\n" +
+	"CREATE TABLE `teams` (\n" +
+	"  `id` int NOT NULL\n" +
+	") ENGINE=InnoDB;\n" +
+	"/*!40000 ALTER TABLE `users` DISABLE KEYS */;\n" +
+	"LOCK TABLES `users` WRITE;\n" +
+	"INSERT INTO `users` VALUES (1,'a;b');\n" +
+	"UNLOCK TABLES;\n" +
+	"INSERT INTO `teams` VALUES (1);\n"
+
+func TestWriteFilteredDump(t *testing.T) {
+	tests := []struct {
+		name    string
+		dump    string
+		dbType  string
+		objects *RestoreObjects
+		want    string
+	}{
+		{
+			name:    "postgres table with its sequence and rows",
+			dump:    postgresFilterDump,
+			dbType:  "postgresql",
+			objects: &RestoreObjects{Tables: []string{"public.users"}},
+			want: "SET statement_timeout = 0;\n\n" +
+				"CREATE TABLE public.users (\n    id integer\n);\n\n" +
+				"CREATE SEQUENCE public.users_id_seq\n    START WITH 1;\n\n" +
+				"ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;\n\n" +
+				"COPY public.users (id) FROM stdin;\n1\n2\n\\.\n\n" +
+				"SELECT pg_catalog.setval('public.users_id_seq', 2, true);\n\n" +
+				"CREATE INDEX users_id ON public.users USING btree (id);\n\n",
+		},
+		{
+			name:    "postgres schema",
+			dump:    postgresFilterDump,
+			dbType:  "postgresql",
+			objects: &RestoreObjects{Schemas: []string{"sales"}},
+			want: "SET statement_timeout = 0;\n\n" +
+				"CREATE SCHEMA sales;\n\n" +
+				"CREATE TABLE sales.invoices (\n    id integer\n);\n\n" +
+				"CREATE VIEW sales.totals AS SELECT 1;\n\n",
+		},
+		{
+			name:    "postgres renamed table drops its index and sequence",
+			dump:    postgresFilterDump,
+			dbType:  "postgresql",
+			objects: &RestoreObjects{Tables: []string{"public.users"}, Rename: map[string]string{"public.users": "users_old"}},
+			want: "SET statement_timeout = 0;\n\n" +
+				"CREATE TABLE \"public\".\"users_old\" (\n    id integer\n);\n\n" +
+				"COPY \"public\".\"users_old\" (id) FROM stdin;\n1\n2\n\\.\n\n",
+		},
+		{
+			name:    "postgres data only",
+			dump:    postgresFilterDump,
+			dbType:  "postgresql",
+			objects: &RestoreObjects{Tables: []string{"users"}, DataOnly: true},
+			want: "SET statement_timeout = 0;\n\n" +
+				"COPY public.users (id) FROM stdin;\n1\n2\n\\.\n\n" +
+				"SELECT pg_catalog.setval('public.users_id_seq', 2, true);\n\n",
+		},
+		{
+			name:    "mysql table",
+			dump:    mysqlFilterDump,
+			dbType:  "mysql",
+			objects: &RestoreObjects{Tables: []string{"users"}},
+			want: "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `team_id` int,\n" +
+				"  CONSTRAINT `fk_team` FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`)\n) ENGINE=InnoDB;\n\n" +
+				"/*!40000 ALTER TABLE `users` DISABLE KEYS */;\n\n" +
+				"LOCK TABLES `users` WRITE;\n\n" +
+				"INSERT INTO `users` VALUES (1,'a;b');\n\n" +
+				"UNLOCK TABLES;\n\n",
+		},
+		{
+			name:    "mysql renamed table drops its foreign keys",
+			dump:    mysqlFilterDump,
+			dbType:  "mysql",
+			objects: &RestoreObjects{Tables: []string{"users"}, Rename: map[string]string{"users": "users_old"}},
+			want: "CREATE TABLE `users_old` (\n  `id` int NOT NULL,\n  `team_id` int\n) ENGINE=InnoDB;\n\n" +
+				"/*!40000 ALTER TABLE `users_old` DISABLE KEYS */;\n\n" +
+				"LOCK TABLES `users_old` WRITE;\n\n" +
+				"INSERT INTO `users_old` VALUES (1,'a;b');\n\n" +
+				"UNLOCK TABLES;\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			filter := newDumpFilter(tt.dbType, tt.objects)
+			if err := writeFilteredDump(strings.NewReader(tt.dump), &out, filter); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("filtered dump =\n%s\nwant\n%s", got, tt.want)
+			}
+			if missing := filter.missing(); len(missing) > 0 {
+				t.Errorf("missing = %q, want none", missing)
+			}
+		})
+	}
+}
+
+func TestWriteFilteredDumpUnterminatedCopy(t *testing.T) {
+	dump := "COPY public.users (id) FROM stdin;\n1\n2\n"
+	filter := newDumpFilter("postgresql", &RestoreObjects{Tables: []string{"users"}})
+	err := writeFilteredDump(strings.NewReader(dump), io.Discard, filter)
+	if err == nil || !strings.Contains(err.Error(), "ends inside COPY data") {
+		t.Errorf("error = %v, want the COPY data to be reported as cut off", err)
+	}
+}
+
+func TestScanDump(t *testing.T) {
+	filter, err := scanDump(strings.NewReader(postgresFilterDump), "postgresql", &RestoreObjects{
+		Tables:  []string{"public.users", "ghosts"},
+		Schemas: []string{"sales", "archive"},
+		Rename:  map[string]string{"public.users": "users_old"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"archive", "ghosts"}; !reflect.DeepEqual(filter.missing(), want) {
+		t.Errorf("missing = %q, want %q", filter.missing(), want)
+	}
+	if want := map[string]bool{"public.users_old": true, "sales.invoices": true}; !reflect.DeepEqual(filter.created, want) {
+		t.Errorf("created = %v, want %v", filter.created, want)
+	}
+	if want := map[string]bool{"public.users_old": true}; !reflect.DeepEqual(filter.loaded, want) {
+		t.Errorf("loaded = %v, want %v", filter.loaded, want)
+	}
+}
+
+// pgArchiveTOC is what pg_restore --list --verbose prints for an archive
+const pgArchiveTOC = `;
+; Archive created at 2026-01-05 10:00:00 UTC
+;     dbname: app
+;
+; Selected TOC Entries:
+;
+6; 2615 16385 SCHEMA - billing app
+;	depends on: 1
+5; 2615 2200 SCHEMA - public pg_database_owner
+216; 1259 16390 TABLE public teams app
+;	depends on: 5
+218; 1259 16400 TABLE public users app
+;	depends on: 5
+217; 1259 16399 SEQUENCE public users_id_seq app
+;	depends on: 5
+219; 0 0 SEQUENCE OWNED BY public users_id_seq app
+;	depends on: 217 218
+220; 1259 16410 TABLE public audit log app
+;	depends on: 5
+221; 1259 16411 SEQUENCE public audit log_id_seq app
+;	depends on: 220
+222; 1259 16420 TABLE billing invoices app
+;	depends on: 6
+223; 1259 16425 VIEW billing open_invoices app
+;	depends on: 6 222
+3200; 2604 16401 DEFAULT public users id app
+;	depends on: 217 218
+3500; 0 16390 TABLE DATA public teams app
+;	depends on: 216
+3501; 0 16400 TABLE DATA public users app
+;	depends on: 218
+3502; 0 16410 TABLE DATA public audit log app
+;	depends on: 220
+3503; 0 16420 TABLE DATA billing invoices app
+;	depends on: 222
+3600; 0 0 SEQUENCE SET public users_id_seq app
+;	depends on: 217
+3601; 0 0 SEQUENCE SET public audit log_id_seq app
+;	depends on: 221
+3300; 2606 16430 CONSTRAINT public teams teams_pkey app
+;	depends on: 216
+3301; 2606 16431 CONSTRAINT public users users_pkey app
+;	depends on: 218
+3400; 1259 16440 INDEX public users_email_idx app
+;	depends on: 218
+3450; 2620 16450 TRIGGER public users users_touch app
+;	depends on: 218
+3460; 2606 16460 FK CONSTRAINT public users users_team_id_fkey app
+;	depends on: 218 216 3300
+3461; 2606 16461 FK CONSTRAINT public teams teams_owner_id_fkey app
+;	depends on: 216 218 3301
+3700; 0 0 COMMENT public TABLE users app
+;	depends on: 218
+3701; 0 0 ACL public TABLE teams app
+;	depends on: 216
+`
+
+func TestFilterPgArchiveTOC(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects *RestoreObjects
+		want    []string // dump IDs of the kept entries, in archive order
+		missing []string
+	}{
+		{
+			name:    "table with its serial sequence, indexes, constraints and triggers",
+			objects: &RestoreObjects{Tables: []string{"users"}},
+			want:    []string{"218", "217", "219", "3200", "3501", "3600", "3301", "3400", "3450", "3460", "3700"},
+		},
+		{
+			name:    "data only keeps rows and sequence values",
+			objects: &RestoreObjects{Tables: []string{"public.users"}, DataOnly: true},
+			want:    []string{"3501", "3600"},
+		},
+		{
+			name:    "table name with a space and an identity sequence",
+			objects: &RestoreObjects{Tables: []string{"public.audit log"}},
+			want:    []string{"220", "221", "3502", "3601"},
+		},
+		{
+			name:    "foreign keys of other tables are left out",
+			objects: &RestoreObjects{Tables: []string{"teams"}},
+			want:    []string{"216", "3500", "3300", "3461", "3701"},
+		},
+		{
+			name:    "schema with its views",
+			objects: &RestoreObjects{Schemas: []string{"billing"}},
+			want:    []string{"6", "222", "223", "3503"},
+		},
+		{
+			name:    "missing table",
+			objects: &RestoreObjects{Tables: []string{"users", "ghosts"}, Schemas: []string{"sales"}},
+			want:    []string{"218", "217", "219", "3200", "3501", "3600", "3301", "3400", "3450", "3460", "3700"},
+			missing: []string{"ghosts", "sales"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, missing := filterPgArchiveTOC(pgArchiveTOC, tt.objects)
+			var got []string
+			for _, line := range strings.Split(strings.TrimSuffix(list, "\n"), "\n") {
+				if line == "" {
+					continue
+				}
+				id, _, _ := strings.Cut(line, ";")
+				got = append(got, id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kept entries = %v, want %v\nlist:\n%s", got, tt.want, list)
+			}
+			if !reflect.DeepEqual(missing, tt.missing) {
+				t.Errorf("missing = %q, want %q", missing, tt.missing)
+			}
+		})
+	}
+}
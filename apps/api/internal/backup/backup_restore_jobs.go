@@ -0,0 +1,347 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/audit"
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxConcurrentRestores is how many restores a replica runs at once;
+	// later jobs stay queued until one finishes
+	maxConcurrentRestores = 2
+	// restoreHeartbeatInterval is how often a replica confirms it is still
+	// working on its jobs
+	restoreHeartbeatInterval = 30 * time.Second
+	// restoreJobStaleAfter is how long a job may miss heartbeats before it is
+	// failed and its target unlocked
+	restoreJobStaleAfter = 3 * time.Minute
+	// maxRestoreOutputBytes is how much of the restore tool's output is kept
+	maxRestoreOutputBytes = 64 * 1024
+)
+
+var errRestoreTargetBusy = errors.New("another restore into this database is queued or running")
+
+// StartRestore queues a restore and runs it in the background. Everything
+// that can be checked without the database server is checked first, so those
+// errors reach the caller directly.
+func (s *BackupService) StartRestore(userID uuid.UUID, req *RestoreRequest) (*RestoreJob, error) {
+	backup, conn, err := s.restoreSubjects(userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	targetDatabase := restoreTargetDatabase(conn, req)
+	if req.DropExisting {
+		if err := s.verifyRestoreConfirmation(req.ConfirmationToken, userID, backup.ID.String(), conn.ID, targetDatabase); err != nil {
+			return nil, err
+		}
+	}
+	if req.Objects != nil {
+		if err := validateRestoreObjects(conn.Type, req.Objects); err != nil {
+			return nil, err
+		}
+	}
+	if req.MaskingProfileID != "" {
+		if _, err := s.maskingProfileForRestore(userID, backup, req); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.queueRestore(userID, backup, conn, req, nil)
+}
+
+// restoreSubjects returns the backup and target connection of a restore
+// request, making sure both belong to the user
+func (s *BackupService) restoreSubjects(userID uuid.UUID, req *RestoreRequest) (*Backup, *connection.StoredConnection, error) {
+	backup, err := s.backupRepo.GetBackup(req.BackupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.backupOwner(backup, userID); err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conn.UserID != userID {
+		return nil, nil, sql.ErrNoRows
+	}
+	return backup, conn, nil
+}
+
+// queueRestore records a restore job, taking the lock on its target, and
+// starts it in the background. revertsJobID is set when the job reverts
+// another to its snapshot.
+func (s *BackupService) queueRestore(userID uuid.UUID, backup *Backup, conn *connection.StoredConnection, req *RestoreRequest, revertsJobID *string) (*RestoreJob, error) {
+	job, err := s.createRestoreJob(userID, backup, conn, req, revertsJobID)
+	if err != nil {
+		return nil, err
+	}
+
+	queued := *job
+	go s.runRestoreJob(job)
+	return &queued, nil
+}
+
+// createRestoreJob records a queued restore job and takes the lock on its
+// target. The caller runs it with runRestoreJob.
+func (s *BackupService) createRestoreJob(userID uuid.UUID, backup *Backup, conn *connection.StoredConnection, req *RestoreRequest, revertsJobID *string) (*RestoreJob, error) {
+	targetDatabase := restoreTargetDatabase(conn, req)
+
+	options := *req
+	options.ConfirmationToken = ""
+	if options.SafetySnapshot == nil {
+		snapshot := hasTag(conn.Tags, productionTag)
+		options.SafetySnapshot = &snapshot
+	}
+
+	job := &RestoreJob{
+		ID:             uuid.New(),
+		UserID:         userID,
+		StartedBy:      userID.String(),
+		BackupID:       backup.ID.String(),
+		ConnectionID:   conn.ID,
+		TargetDatabase: targetDatabase,
+		Options:        options,
+		Status:         RestoreJobQueued,
+		RevertsJobID:   revertsJobID,
+		QueuedAt:       time.Now(),
+	}
+
+	created, err := s.backupRepo.CreateRestoreJob(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue restore: %v", err)
+	}
+	if !created {
+		return nil, errRestoreTargetBusy
+	}
+
+	details := map[string]interface{}{
+		"restore_job_id":  job.ID.String(),
+		"connection_id":   conn.ID,
+		"target_database": targetDatabase,
+		"drop_existing":   req.DropExisting,
+		"safety_snapshot": *options.SafetySnapshot,
+	}
+	if revertsJobID != nil {
+		details["reverts_job_id"] = *revertsJobID
+	}
+	s.recordAudit(userID, userID.String(), audit.BackupRestored, backup, details)
+	return job, nil
+}
+
+// runRestoreJob waits for a free restore slot, runs the job and records how
+// it went
+func (s *BackupService) runRestoreJob(job *RestoreJob) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.heartbeatRestoreJob(job.ID.String(), stop)
+
+	s.restoreSlots <- struct{}{}
+	defer func() { <-s.restoreSlots }()
+
+	startedAt := time.Now()
+	job.Status = RestoreJobRunning
+	job.StartedAt = &startedAt
+	if err := s.backupRepo.StartRestoreJob(job.ID.String(), startedAt); err != nil {
+		fmt.Printf("Warning: Failed to mark restore job %s as running: %v\n", job.ID, err)
+	}
+
+	var output []byte
+	var err error
+	if *job.Options.SafetySnapshot {
+		var snapshot *Backup
+		if snapshot, err = s.takeSafetySnapshot(job); err != nil {
+			err = fmt.Errorf("pre-restore snapshot failed, the target was left untouched: %v", err)
+		} else if snapshot != nil {
+			snapshotID := snapshot.ID.String()
+			job.SnapshotBackupID = &snapshotID
+		}
+	}
+	if err == nil {
+		output, err = s.restoreBackup(&job.Options)
+	}
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	job.Output = restoreOutputTail(output)
+	job.Status = RestoreJobCompleted
+	if err != nil {
+		message := err.Error()
+		job.Status = RestoreJobFailed
+		job.Error = &message
+	}
+	if err := s.backupRepo.FinishRestoreJob(job); err != nil {
+		fmt.Printf("Error recording restore job %s: %v\n", job.ID, err)
+	}
+
+	fmt.Printf("Restore job %s %s after %s\n", job.ID, job.Status, finishedAt.Sub(startedAt).Round(time.Second))
+	if err := s.createRestoreNotification(job); err != nil {
+		fmt.Printf("Warning: Failed to send restore notification: %v\n", err)
+	}
+}
+
+func (s *BackupService) heartbeatRestoreJob(id string, stop <-chan struct{}) {
+	ticker := time.NewTicker(restoreHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.backupRepo.TouchRestoreJob(id); err != nil {
+				fmt.Printf("Warning: Failed to record heartbeat of restore job %s: %v\n", id, err)
+			}
+		}
+	}
+}
+
+// runRestoreJobReaper fails jobs left queued or running by a replica that
+// stopped, which would otherwise lock their target forever, and the refresh
+// runs that were left running the same way
+func (s *BackupService) runRestoreJobReaper() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if s.scheduler.IsLeader() {
+			s.failStaleRestoreJobs()
+			s.failStaleRefreshRuns()
+		}
+	}
+}
+
+func (s *BackupService) failStaleRestoreJobs() {
+	cutoff := time.Now().Add(-restoreJobStaleAfter)
+	jobs, err := s.backupRepo.GetStaleRestoreJobs(cutoff)
+	if err != nil {
+		fmt.Printf("Error fetching stale restore jobs: %v\n", err)
+		return
+	}
+
+	for _, job := range jobs {
+		message := "restore was interrupted because the server running it stopped"
+		failed, err := s.backupRepo.FailStaleRestoreJob(job.ID.String(), cutoff, message)
+		if err != nil {
+			fmt.Printf("Warning: Failed to fail stale restore job %s: %v\n", job.ID, err)
+			continue
+		}
+		if !failed {
+			// The job sent a heartbeat or finished meanwhile
+			continue
+		}
+
+		finishedAt := time.Now()
+		job.Status = RestoreJobFailed
+		job.Error = &message
+		job.FinishedAt = &finishedAt
+		if err := s.createRestoreNotification(job); err != nil {
+			fmt.Printf("Warning: Failed to send restore notification: %v\n", err)
+		}
+	}
+}
+
+// restoreOutputTail keeps the end of the output, where tools report errors
+func restoreOutputTail(output []byte) string {
+	if len(output) <= maxRestoreOutputBytes {
+		return strings.ToValidUTF8(string(output), "")
+	}
+	tail := output[len(output)-maxRestoreOutputBytes:]
+	return "[output truncated]\n" + strings.ToValidUTF8(string(tail), "")
+}
+
+func (s *BackupService) ListRestoreJobs(opts RestoreJobListOptions) ([]*RestoreJob, int, error) {
+	return s.backupRepo.GetRestoreJobs(opts)
+}
+
+func (s *BackupService) GetRestoreJob(userID uuid.UUID, id string) (*RestoreJob, error) {
+	job, err := s.backupRepo.GetRestoreJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return job, nil
+}
+
+func (h *BackupHandler) ListRestoreJobs(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page := 1
+	limit := 10
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", RestoreJobQueued, RestoreJobRunning, RestoreJobCompleted, RestoreJobFailed:
+	default:
+		response.SendError(w, http.StatusBadRequest, fmt.Sprintf("invalid status %q", status))
+		return
+	}
+
+	jobs, total, err := h.backupService.ListRestoreJobs(RestoreJobListOptions{
+		UserID:       userID,
+		ConnectionID: r.URL.Query().Get("connection_id"),
+		Status:       status,
+		Limit:        limit,
+		Offset:       (page - 1) * limit,
+	})
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendPaginatedSuccess(w, "Restore jobs retrieved successfully", jobs, page, limit, total)
+}
+
+func (h *BackupHandler) GetRestoreJob(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	job, err := h.backupService.GetRestoreJob(userID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Restore job not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Restore job retrieved successfully", job)
+}
@@ -0,0 +1,977 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// compressionRatioEstimate is how much larger a plain dump is assumed to
+	// be than its compressed file when estimating staging space
+	compressionRatioEstimate = 5
+	// preflightTimeout bounds each query against the target server
+	preflightTimeout = 15 * time.Second
+	// maxPreflightConflicts is how many conflicting tables a report lists
+	maxPreflightConflicts = 50
+)
+
+var (
+	versionPattern         = regexp.MustCompile(`\d+(?:\.\d+)+|\d+`)
+	mysqlClientVersion     = regexp.MustCompile(`(?:Distrib|Ver) (\d+\.\d+\.\d+)`)
+	pgDumpVersionLine      = regexp.MustCompile(`(?m)^-- Dumped by pg_dump version (\S+)`)
+	pgSourceVersionLine    = regexp.MustCompile(`(?m)^-- Dumped from database version (\S+)`)
+	pgArchiveDumpVersion   = regexp.MustCompile(`(?m)Dumped by pg_dump version: (\S+)`)
+	pgArchiveSourceVersion = regexp.MustCompile(`(?m)Dumped from database version: (\S+)`)
+	pgArchiveFormatVersion = regexp.MustCompile(`(?m)Archive version: (\S+)`)
+	pgArchiveTableEntry    = regexp.MustCompile(`(?m)^\d+; \d+ \d+ (TABLE|TABLE DATA) (\S+) (\S+) `)
+	mysqlDumpVersionLine   = regexp.MustCompile(`(?m)^-- MySQL dump \S+\s+Distrib (\S+?),`)
+	mysqlSourceVersionLine = regexp.MustCompile(`(?m)^-- Server version\s+(\S+)`)
+	mysqlGrantLine         = regexp.MustCompile("(?i)^GRANT (.+?) ON (\\S+?)\\.\\S+ TO ")
+)
+
+// restorePreflight holds what the checks of one preflight learn about the
+// restore, and the resources to release once the report is done
+type restorePreflight struct {
+	s      *BackupService
+	backup *Backup
+	conn   *connection.StoredConnection
+	req    *RestoreRequest
+	target string
+	report *RestorePreflightReport
+
+	stagingShort  bool   // there is not enough disk space to stage the file
+	filePath      string // staged backup file, empty when it isn't available
+	custom        bool   // the dump is a PostgreSQL custom-format archive
+	archiveTOC    string // pg_restore --list output of a custom-format archive
+	sourceVersion string // server version the dump was taken from
+
+	db      *sql.DB // server connection of SQL targets
+	mongo   *mongo.Client
+	cleanup []func()
+}
+
+// PreflightRestore checks whether a restore would succeed without changing
+// anything: the restore tool and its version, the target server and the
+// user's privileges on it, what already exists in the target database, free
+// disk space for staging and the backup's checksum.
+func (s *BackupService) PreflightRestore(userID uuid.UUID, req *RestoreRequest) (*RestorePreflightReport, error) {
+	backup, conn, err := s.restoreSubjects(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Objects != nil {
+		if err := validateRestoreObjects(conn.Type, req.Objects); err != nil {
+			return nil, err
+		}
+	}
+
+	target := *conn
+	p := &restorePreflight{
+		s:      s,
+		backup: backup,
+		conn:   &target,
+		req:    req,
+		target: restoreTargetDatabase(conn, req),
+		report: &RestorePreflightReport{
+			BackupID:     backup.ID.String(),
+			ConnectionID: conn.ID,
+			Checks:       []*PreflightCheck{},
+		},
+	}
+	p.report.TargetDatabase = p.target
+	defer p.close()
+
+	p.checkDiskSpace()
+	p.checkChecksum()
+	p.checkRestoreTool()
+	p.checkDumpScope()
+	if p.checkConnectivity() {
+		p.checkPrivileges()
+		p.checkTargetDatabase()
+	} else {
+		p.add(PreflightCheckPrivileges, PreflightSkip, "target server isn't reachable", nil)
+		p.add(PreflightCheckTargetDatabase, PreflightSkip, "target server isn't reachable", nil)
+	}
+
+	p.report.Ready = true
+	for _, check := range p.report.Checks {
+		if check.Status == PreflightFail {
+			p.report.Ready = false
+		}
+	}
+	p.report.CheckedAt = time.Now()
+	return p.report, nil
+}
+
+func (p *restorePreflight) add(name, status, message string, details map[string]interface{}) {
+	p.report.Checks = append(p.report.Checks, &PreflightCheck{
+		Name:    name,
+		Status:  status,
+		Message: message,
+		Details: details,
+	})
+}
+
+func (p *restorePreflight) close() {
+	for i := len(p.cleanup) - 1; i >= 0; i-- {
+		p.cleanup[i]()
+	}
+}
+
+// checkDiskSpace estimates the space staging needs: S3 backups are
+// downloaded into the cache, and compressed, filtered or custom-format
+// dumps are written to temporary plain copies.
+func (p *restorePreflight) checkDiskSpace() {
+	plainSize := p.backup.Size
+	if p.backup.Compression != CompressionNone {
+		plainSize = p.backup.Size * compressionRatioEstimate
+	}
+
+	needs := make(map[string]int64)
+	_, err := os.Stat(p.backup.Path)
+	local := err == nil
+	if !local {
+		needs[p.s.downloadCache.dir] += p.backup.Size
+	}
+	if p.backup.Compression != CompressionNone {
+		needs[os.TempDir()] += plainSize
+	}
+	// Filtering and converting custom-format archives write another copy,
+	// except selections without renames, which pg_restore reads from the
+	// archive. Whether a remote dump is an archive isn't known before it is
+	// staged.
+	archive := local && p.backup.Compression == CompressionNone && isPgCustomDump(p.backup.Path)
+	listed := archive && p.req.Objects != nil && len(p.req.Objects.Rename) == 0
+	converted := p.conn.Type == "postgresql" && (!local || p.backup.Compression != CompressionNone || archive)
+	if !listed && (p.req.Objects != nil || converted) {
+		needs[os.TempDir()] += plainSize
+	}
+	if len(needs) == 0 {
+		p.add(PreflightCheckDiskSpace, PreflightPass, "backup is restored from its local file without staging", nil)
+		return
+	}
+
+	dirs := make([]string, 0, len(needs))
+	for dir := range needs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	details := make(map[string]interface{})
+	var short []string
+	for _, dir := range dirs {
+		free, err := freeDiskSpace(dir)
+		if err != nil {
+			p.add(PreflightCheckDiskSpace, PreflightSkip, fmt.Sprintf("can't read free space of %s: %v", dir, err), nil)
+			return
+		}
+		details[dir] = map[string]int64{"required_bytes": needs[dir], "free_bytes": free}
+		if free < needs[dir] {
+			short = append(short, fmt.Sprintf("%s needs about %d bytes but has %d free", dir, needs[dir], free))
+		}
+	}
+
+	if len(short) > 0 {
+		p.stagingShort = true
+		p.add(PreflightCheckDiskSpace, PreflightFail, "not enough disk space to stage the backup: "+strings.Join(short, "; "), details)
+		return
+	}
+	p.add(PreflightCheckDiskSpace, PreflightPass, "enough disk space to stage the backup", details)
+}
+
+// checkChecksum stages the backup file and compares it with the checksum
+// recorded when the backup was taken
+func (p *restorePreflight) checkChecksum() {
+	if _, err := os.Stat(p.backup.Path); err != nil && p.stagingShort {
+		p.add(PreflightCheckChecksum, PreflightSkip, "not enough disk space to download the backup", nil)
+		return
+	}
+
+	path, release, err := p.s.ensureBackupFileAvailable(p.backup, p.conn.UserID)
+	if err != nil {
+		p.add(PreflightCheckChecksum, PreflightFail, fmt.Sprintf("backup file isn't available: %v", err), nil)
+		return
+	}
+	p.cleanup = append(p.cleanup, release)
+	p.filePath = path
+
+	if p.backup.Checksum == nil {
+		p.add(PreflightCheckChecksum, PreflightSkip, "backup has no recorded checksum", nil)
+		return
+	}
+
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		p.add(PreflightCheckChecksum, PreflightFail, fmt.Sprintf("failed to read backup file: %v", err), nil)
+		return
+	}
+	details := map[string]interface{}{"expected": *p.backup.Checksum, "actual": checksum}
+	if checksum != *p.backup.Checksum {
+		p.add(PreflightCheckChecksum, PreflightFail, "backup file doesn't match its recorded checksum, it is corrupt or was changed", details)
+		return
+	}
+	p.add(PreflightCheckChecksum, PreflightPass, "backup file matches its recorded checksum", details)
+}
+
+// checkRestoreTool finds the restore tool and compares its version with the
+// one that wrote the dump
+func (p *restorePreflight) checkRestoreTool() {
+	tool, ok := restoreTools[p.conn.Type]
+	if !ok {
+		p.add(PreflightCheckRestoreTool, PreflightFail, fmt.Sprintf("unsupported database type: %s", p.conn.Type), nil)
+		return
+	}
+	toolPath := p.s.findDatabaseRestorePath(p.conn.Type)
+	if toolPath == "" {
+		p.add(PreflightCheckRestoreTool, PreflightFail, fmt.Sprintf("%s not found, install the %s client tools", tool, p.conn.Type), nil)
+		return
+	}
+	version := toolVersion(filepath.Join(toolPath, common.GetPlatformExecutableName(tool)))
+	details := map[string]interface{}{"tool": tool, "tool_version": version}
+
+	if p.filePath == "" {
+		p.add(PreflightCheckRestoreTool, PreflightWarn, fmt.Sprintf("%s %s found, but the dump couldn't be read to compare versions", tool, version), details)
+		return
+	}
+	header, err := readDumpHeader(p.filePath, p.backup.Compression)
+	if err != nil {
+		p.add(PreflightCheckRestoreTool, PreflightFail, fmt.Sprintf("failed to read dump: %v", err), details)
+		return
+	}
+
+	switch p.conn.Type {
+	case "postgresql":
+		if bytes.HasPrefix(header, pgCustomDumpMagic) {
+			p.custom = true
+			p.checkPgArchive(details)
+			return
+		}
+		dumpVersion := firstSubmatch(pgDumpVersionLine, header)
+		p.sourceVersion = firstSubmatch(pgSourceVersionLine, header)
+		details["dump_version"] = dumpVersion
+		if dumpVersion != "" && version != "" && compareVersions(pgMajorVersion(version), pgMajorVersion(dumpVersion)) < 0 {
+			p.add(PreflightCheckRestoreTool, PreflightWarn, fmt.Sprintf(
+				"psql %s is older than pg_dump %s that wrote the dump, which may use commands it doesn't know", version, dumpVersion), details)
+			return
+		}
+	case "mysql", "mariadb":
+		dumpVersion := firstSubmatch(mysqlDumpVersionLine, header)
+		p.sourceVersion = firstSubmatch(mysqlSourceVersionLine, header)
+		details["dump_version"] = dumpVersion
+		if dumpVersion != "" && version != "" && compareVersions(versionParts(version, 1), versionParts(dumpVersion, 1)) < 0 {
+			p.add(PreflightCheckRestoreTool, PreflightWarn, fmt.Sprintf(
+				"mysql client %s is older than mysqldump %s that wrote the dump", version, dumpVersion), details)
+			return
+		}
+	}
+
+	p.add(PreflightCheckRestoreTool, PreflightPass, strings.TrimSpace(fmt.Sprintf("%s %s can read the dump", tool, version)), details)
+}
+
+// checkDumpScope fails plain SQL dumps that create or switch databases by
+// name, since their restore would leave the target database
+func (p *restorePreflight) checkDumpScope() {
+	switch {
+	case p.conn.Type == "mongodb" || p.custom:
+		return
+	case p.filePath == "":
+		p.add(PreflightCheckDumpScope, PreflightSkip, "backup file isn't available", nil)
+		return
+	}
+
+	reader, closeReader, err := openDecompressed(p.filePath, p.backup.Compression)
+	if err != nil {
+		p.add(PreflightCheckDumpScope, PreflightWarn, fmt.Sprintf("failed to read backup file: %v", err), nil)
+		return
+	}
+	defer closeReader()
+
+	switches, err := dumpDatabaseSwitches(reader, p.conn.Type)
+	if err != nil {
+		p.add(PreflightCheckDumpScope, PreflightWarn, err.Error(), nil)
+		return
+	}
+	if len(switches) > 0 {
+		p.add(PreflightCheckDumpScope, PreflightFail, fmt.Sprintf(
+			"the dump selects databases by name and would be restored into them instead of %s: %s",
+			p.target, strings.Join(switches, "; ")), map[string]interface{}{"statements": switches})
+		return
+	}
+	p.add(PreflightCheckDumpScope, PreflightPass, fmt.Sprintf("the dump stays in %s", p.target), nil)
+}
+
+// checkPgArchive lists a custom-format archive with pg_restore, which fails
+// when the archive version is newer than it supports
+func (p *restorePreflight) checkPgArchive(details map[string]interface{}) {
+	binDir := common.FindBinaryPath("postgresql", "pg_restore")
+	if binDir == "" {
+		p.add(PreflightCheckRestoreTool, PreflightFail, "custom-format dumps need pg_restore, which wasn't found", details)
+		return
+	}
+	binPath := filepath.Join(binDir, common.GetPlatformExecutableName("pg_restore"))
+	restoreVersion := toolVersion(binPath)
+	details["pg_restore_version"] = restoreVersion
+
+	reader, closeReader, err := openDecompressed(p.filePath, p.backup.Compression)
+	if err != nil {
+		p.add(PreflightCheckRestoreTool, PreflightFail, fmt.Sprintf("failed to read dump: %v", err), details)
+		return
+	}
+	defer closeReader()
+
+	cmd := exec.Command(binPath, "--list")
+	cmd.Stdin = reader
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		message := strings.TrimSpace(string(output))
+		if line, _, ok := strings.Cut(message, "\n"); ok {
+			message = line
+		}
+		p.add(PreflightCheckRestoreTool, PreflightFail, fmt.Sprintf("pg_restore %s can't read the archive: %s", restoreVersion, message), details)
+		return
+	}
+
+	p.archiveTOC = string(output)
+	p.sourceVersion = firstSubmatch(pgArchiveSourceVersion, output)
+	details["dump_version"] = firstSubmatch(pgArchiveDumpVersion, output)
+	details["archive_version"] = firstSubmatch(pgArchiveFormatVersion, output)
+	p.add(PreflightCheckRestoreTool, PreflightPass, fmt.Sprintf("pg_restore %s can read the archive", restoreVersion), details)
+}
+
+// checkConnectivity connects to the target server, through the SSH tunnel
+// when one is configured. Later checks use the connection.
+func (p *restorePreflight) checkConnectivity() bool {
+	details := map[string]interface{}{"host": p.conn.Host, "port": p.conn.Port, "ssh_tunnel": p.conn.SSHEnabled}
+
+	tunnel, effectiveHost, effectivePort, err := p.s.setupSSHTunnelIfNeeded(p.conn)
+	if err != nil {
+		p.add(PreflightCheckConnectivity, PreflightFail, fmt.Sprintf("SSH tunnel failed: %v", err), details)
+		return false
+	}
+	if tunnel != nil {
+		p.cleanup = append(p.cleanup, func() { tunnel.Stop() })
+		p.conn.Host = effectiveHost
+		p.conn.Port = effectivePort
+	}
+
+	var serverVersion string
+	switch p.conn.Type {
+	case "postgresql", "mysql", "mariadb":
+		db, err := openRestoreAdminDB(p.conn)
+		if err != nil {
+			p.add(PreflightCheckConnectivity, PreflightFail, fmt.Sprintf("can't connect to the database server: %v", err), details)
+			return false
+		}
+		p.db = db
+		p.cleanup = append(p.cleanup, func() { db.Close() })
+
+		query := "SELECT VERSION()"
+		if p.conn.Type == "postgresql" {
+			query = "SHOW server_version"
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		defer cancel()
+		if err := db.QueryRowContext(ctx, query).Scan(&serverVersion); err != nil {
+			p.add(PreflightCheckConnectivity, PreflightFail, fmt.Sprintf("connected but failed to read the server version: %v", err), details)
+			return false
+		}
+		serverVersion = strings.Fields(serverVersion + " ")[0]
+	case "mongodb":
+		client, err := connectRestoreMongo(p.conn)
+		if err != nil {
+			p.add(PreflightCheckConnectivity, PreflightFail, fmt.Sprintf("can't connect to the database server: %v", err), details)
+			return false
+		}
+		p.mongo = client
+		p.cleanup = append(p.cleanup, func() { client.Disconnect(context.Background()) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		defer cancel()
+		var info struct {
+			Version string `bson:"version"`
+		}
+		if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info); err == nil {
+			serverVersion = info.Version
+		}
+	default:
+		p.add(PreflightCheckConnectivity, PreflightFail, fmt.Sprintf("unsupported database type: %s", p.conn.Type), details)
+		return false
+	}
+	details["server_version"] = serverVersion
+
+	if p.sourceVersion != "" && serverVersion != "" && sameVersionLine(p.sourceVersion, serverVersion) {
+		parts := 2
+		source, server := versionParts(p.sourceVersion, parts), versionParts(serverVersion, parts)
+		if p.conn.Type == "postgresql" {
+			source, server = pgMajorVersion(p.sourceVersion), pgMajorVersion(serverVersion)
+		}
+		details["source_version"] = p.sourceVersion
+		if compareVersions(server, source) < 0 {
+			p.add(PreflightCheckConnectivity, PreflightWarn, fmt.Sprintf(
+				"dump was taken from server %s, restoring into older server %s may fail", p.sourceVersion, serverVersion), details)
+			return true
+		}
+	}
+
+	p.add(PreflightCheckConnectivity, PreflightPass, strings.TrimSpace("connected to server "+serverVersion), details)
+	return true
+}
+
+// checkPrivileges makes sure the user can create, and when asked drop, the
+// target database and its objects
+func (p *restorePreflight) checkPrivileges() {
+	var details map[string]interface{}
+	var problems []string
+	var err error
+	switch p.conn.Type {
+	case "postgresql":
+		details, problems, err = p.pgPrivileges()
+	case "mysql", "mariadb":
+		details, problems, err = p.mysqlPrivileges()
+	default:
+		p.add(PreflightCheckPrivileges, PreflightSkip, "privileges aren't checked for MongoDB", nil)
+		return
+	}
+	if err != nil {
+		p.add(PreflightCheckPrivileges, PreflightWarn, fmt.Sprintf("failed to read privileges: %v", err), details)
+		return
+	}
+	if len(problems) > 0 {
+		p.add(PreflightCheckPrivileges, PreflightFail, strings.Join(problems, "; "), details)
+		return
+	}
+	p.add(PreflightCheckPrivileges, PreflightPass, fmt.Sprintf("%s has the privileges the restore needs", p.conn.Username), details)
+}
+
+func (p *restorePreflight) pgPrivileges() (map[string]interface{}, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	var user string
+	var superuser, createDB bool
+	if err := p.db.QueryRowContext(ctx,
+		`SELECT rolname, rolsuper, rolcreatedb FROM pg_roles WHERE rolname = current_user`,
+	).Scan(&user, &superuser, &createDB); err != nil {
+		return nil, nil, err
+	}
+	details := map[string]interface{}{"user": user, "superuser": superuser, "createdb": createDB}
+	if superuser {
+		return details, nil, nil
+	}
+
+	var problems []string
+	var owner string
+	var canCreate bool
+	err := p.db.QueryRowContext(ctx,
+		`SELECT pg_catalog.pg_get_userbyid(datdba), has_database_privilege(datname, 'CREATE') FROM pg_database WHERE datname = $1`,
+		p.target,
+	).Scan(&owner, &canCreate)
+	switch {
+	case err == sql.ErrNoRows:
+		if (p.req.CreateIfMissing || p.req.DropExisting) && !createDB {
+			problems = append(problems, fmt.Sprintf("%s can't create databases, it needs the CREATEDB attribute", user))
+		}
+	case err != nil:
+		return details, nil, err
+	default:
+		details["database_owner"] = owner
+		if p.req.DropExisting {
+			if owner != user {
+				problems = append(problems, fmt.Sprintf("only %s, the owner of %s, or a superuser can drop it", owner, p.target))
+			}
+			if !createDB {
+				problems = append(problems, fmt.Sprintf("%s can't recreate the database, it needs the CREATEDB attribute", user))
+			}
+		} else if owner != user && !canCreate {
+			problems = append(problems, fmt.Sprintf("%s has no CREATE privilege on %s", user, p.target))
+		}
+	}
+
+	if owner := strings.TrimSpace(p.req.Owner); owner != "" && owner != user && (p.req.CreateIfMissing || p.req.DropExisting) {
+		var member bool
+		if err := p.db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1) AND pg_has_role(current_user, $1, 'MEMBER')`, owner,
+		).Scan(&member); err != nil {
+			return details, problems, err
+		}
+		if !member {
+			problems = append(problems, fmt.Sprintf("%s isn't a member of %s, so it can't create a database owned by it", user, owner))
+		}
+	}
+	return details, problems, nil
+}
+
+func (p *restorePreflight) mysqlPrivileges() (map[string]interface{}, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, "SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var grants []string
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return nil, nil, err
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	required := []string{"CREATE", "INSERT"}
+	if p.req.DropExisting {
+		required = append(required, "DROP")
+	}
+	var missing []string
+	for _, privilege := range required {
+		if !mysqlHasPrivilege(grants, privilege, p.target) {
+			missing = append(missing, privilege)
+		}
+	}
+
+	details := map[string]interface{}{"grants": grants}
+	if len(missing) > 0 {
+		return details, []string{fmt.Sprintf("%s lacks %s on %s", p.conn.Username, strings.Join(missing, ", "), p.target)}, nil
+	}
+	return details, nil, nil
+}
+
+// checkTargetDatabase reports whether the target exists and which of its
+// tables the dump would collide with
+func (p *restorePreflight) checkTargetDatabase() {
+	exists, err := p.targetExists()
+	if err != nil {
+		p.add(PreflightCheckTargetDatabase, PreflightWarn, fmt.Sprintf("failed to check target database: %v", err), nil)
+		return
+	}
+	if !exists {
+		if p.req.CreateIfMissing || p.req.DropExisting {
+			p.add(PreflightCheckTargetDatabase, PreflightPass, fmt.Sprintf("%s doesn't exist and will be created", p.target), nil)
+			return
+		}
+		p.add(PreflightCheckTargetDatabase, PreflightFail, errRestoreTargetMissing.Error(), nil)
+		return
+	}
+
+	existing, err := p.existingTables()
+	if err != nil {
+		p.add(PreflightCheckTargetDatabase, PreflightWarn, fmt.Sprintf("failed to list objects of %s: %v", p.target, err), nil)
+		return
+	}
+	details := map[string]interface{}{"existing_objects": len(existing)}
+
+	if p.req.DropExisting {
+		if len(existing) > 0 {
+			p.add(PreflightCheckTargetDatabase, PreflightWarn, fmt.Sprintf("%s has %d objects that will be dropped with the database", p.target, len(existing)), details)
+			return
+		}
+		p.add(PreflightCheckTargetDatabase, PreflightPass, fmt.Sprintf("%s is empty and will be recreated", p.target), details)
+		return
+	}
+
+	if p.conn.Type == "mongodb" {
+		p.checkMongoTarget(existing, details)
+		return
+	}
+
+	dump, err := p.dumpTables()
+	if err != nil || dump == nil {
+		if len(existing) == 0 {
+			p.add(PreflightCheckTargetDatabase, PreflightPass, fmt.Sprintf("%s is empty", p.target), details)
+			return
+		}
+		p.add(PreflightCheckTargetDatabase, PreflightWarn, fmt.Sprintf(
+			"%s has %d objects, and the dump couldn't be read to find conflicts", p.target, len(existing)), details)
+		return
+	}
+
+	if p.req.Objects != nil && p.req.Objects.DataOnly {
+		missing := sortedKeys(dump.loaded, func(table string) bool { return !existing[table] })
+		if len(missing) > 0 {
+			details["missing_tables"] = limitNames(missing)
+			p.add(PreflightCheckTargetDatabase, PreflightFail, fmt.Sprintf(
+				"a data-only restore needs its tables to exist, %d are missing: %s", len(missing), strings.Join(limitNames(missing), ", ")), details)
+			return
+		}
+		p.add(PreflightCheckTargetDatabase, PreflightPass, fmt.Sprintf("every table the dump loads exists in %s", p.target), details)
+		return
+	}
+
+	conflicts := sortedKeys(dump.created, func(table string) bool { return existing[table] })
+	if len(conflicts) > 0 {
+		details["conflicts"] = limitNames(conflicts)
+		p.add(PreflightCheckTargetDatabase, PreflightFail, fmt.Sprintf(
+			"%d tables of the dump already exist in %s: %s. Restore into an empty database, rename them or set drop_existing",
+			len(conflicts), p.target, strings.Join(limitNames(conflicts), ", ")), details)
+		return
+	}
+	if len(existing) == 0 {
+		p.add(PreflightCheckTargetDatabase, PreflightPass, fmt.Sprintf("%s is empty", p.target), details)
+		return
+	}
+	p.add(PreflightCheckTargetDatabase, PreflightPass, fmt.Sprintf(
+		"%s has %d objects, none conflict with the dump", p.target, len(existing)), details)
+}
+
+// checkMongoTarget compares the target's collections with the selected
+// ones. Full archives don't list their collections without reading them.
+func (p *restorePreflight) checkMongoTarget(existing map[string]bool, details map[string]interface{}) {
+	if len(existing) == 0 {
+		p.add(PreflightCheckTargetDatabase, PreflightPass, fmt.Sprintf("%s is empty", p.target), details)
+		return
+	}
+
+	if p.req.Objects != nil && len(p.req.Objects.Collections) > 0 {
+		restored := make(map[string]bool)
+		for _, collection := range p.req.Objects.Collections {
+			if newName, ok := p.req.Objects.Rename[collection]; ok {
+				collection = newName
+			}
+			restored[collection] = true
+		}
+		conflicts := sortedKeys(restored, func(collection string) bool { return existing[collection] })
+		if len(conflicts) > 0 {
+			details["conflicts"] = limitNames(conflicts)
+			p.add(PreflightCheckTargetDatabase, PreflightWarn, fmt.Sprintf(
+				"%d collections already exist in %s, documents whose _id exists are skipped: %s",
+				len(conflicts), p.target, strings.Join(limitNames(conflicts), ", ")), details)
+			return
+		}
+		p.add(PreflightCheckTargetDatabase, PreflightPass, fmt.Sprintf(
+			"%s has %d collections, none conflict with the selection", p.target, len(existing)), details)
+		return
+	}
+
+	p.add(PreflightCheckTargetDatabase, PreflightWarn, fmt.Sprintf(
+		"%s has %d collections; documents whose _id already exists are skipped unless drop_existing is set", p.target, len(existing)), details)
+}
+
+func (p *restorePreflight) targetExists() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	if p.mongo != nil {
+		names, err := p.mongo.ListDatabaseNames(ctx, bson.D{{Key: "name", Value: p.target}})
+		return len(names) > 0, err
+	}
+	return restoreDatabaseExists(p.db, p.conn.Type, p.target)
+}
+
+// existingTables lists the tables, views and collections of the target, by
+// "schema.table" on PostgreSQL and by name elsewhere
+func (p *restorePreflight) existingTables() (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	tables := make(map[string]bool)
+	switch p.conn.Type {
+	case "mongodb":
+		names, err := p.mongo.Database(p.target).ListCollectionNames(ctx, bson.D{})
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			tables[name] = true
+		}
+		return tables, nil
+	case "postgresql":
+		db, err := openRestoreDB(p.conn, p.target)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		return collectNames(db.QueryContext(ctx, `
+			SELECT n.nspname || '.' || c.relname FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f')
+			AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+			AND n.nspname NOT LIKE 'pg_toast%'`))
+	default:
+		return collectNames(p.db.QueryContext(ctx,
+			`SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?`, p.target))
+	}
+}
+
+// dumpTables lists the tables the restore creates and loads. It returns nil
+// when the dump isn't available.
+func (p *restorePreflight) dumpTables() (*dumpFilter, error) {
+	if p.filePath == "" {
+		return nil, nil
+	}
+
+	if p.custom {
+		if p.archiveTOC == "" {
+			return nil, nil
+		}
+		filter := newDumpFilter(p.conn.Type, p.req.Objects)
+		for _, match := range pgArchiveTableEntry.FindAllStringSubmatch(p.archiveTOC, -1) {
+			kind := kindCreate
+			if match[1] == "TABLE DATA" {
+				kind = kindData
+			}
+			table := tableRef{schema: match[2], name: match[3]}
+			entry, ok := filter.selection(table)
+			if !ok || (kind == kindCreate && filter.objects.DataOnly) {
+				continue
+			}
+			filter.record(kind, table, entry)
+		}
+		return filter, nil
+	}
+
+	reader, closeReader, err := openDecompressed(p.filePath, p.backup.Compression)
+	if err != nil {
+		return nil, err
+	}
+	defer closeReader()
+	return scanDump(reader, p.conn.Type, p.req.Objects)
+}
+
+// connectRestoreMongo connects to a MongoDB server for the preflight
+func connectRestoreMongo(conn *connection.StoredConnection) (*mongo.Client, error) {
+	uri := url.URL{
+		Scheme: "mongodb",
+		Host:   fmt.Sprintf("%s:%d", conn.Host, conn.Port),
+		Path:   "/admin",
+	}
+	if conn.Username != "" {
+		uri.User = url.UserPassword(conn.Username, conn.Password)
+	}
+	if conn.SSL {
+		uri.RawQuery = "tls=true"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri.String()))
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return client, nil
+}
+
+func collectNames(rows *sql.Rows, err error) (map[string]bool, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
+
+// readDumpHeader reads the start of a backup's plain dump
+func readDumpHeader(path, compression string) ([]byte, error) {
+	reader, closeReader, err := openDecompressed(path, compression)
+	if err != nil {
+		return nil, err
+	}
+	defer closeReader()
+
+	header, err := io.ReadAll(io.LimitReader(reader, encodingSniffBytes))
+	if err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// toolVersion runs a tool with --version and returns the version it
+// reports, or an empty string
+func toolVersion(binPath string) string {
+	output, err := exec.Command(binPath, "--version").CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	if match := mysqlClientVersion.FindSubmatch(output); match != nil {
+		return string(match[1])
+	}
+	return string(versionPattern.Find(output))
+}
+
+// mysqlHasPrivilege reports whether one of the grants gives the privilege
+// on every database or on the given one. Grant scopes may use LIKE
+// wildcards.
+func mysqlHasPrivilege(grants []string, privilege, database string) bool {
+	for _, grant := range grants {
+		match := mysqlGrantLine.FindStringSubmatch(grant)
+		if match == nil {
+			continue
+		}
+		if !mysqlScopeMatches(match[2], database) {
+			continue
+		}
+		for _, granted := range strings.Split(match[1], ",") {
+			granted = strings.ToUpper(strings.TrimSpace(granted))
+			if granted == privilege || granted == "ALL" || granted == "ALL PRIVILEGES" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func mysqlScopeMatches(scope, database string) bool {
+	scope = strings.Trim(scope, "`")
+	if scope == "*" {
+		return true
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for i := 0; i < len(scope); i++ {
+		switch c := scope[i]; {
+		case c == '\\' && i+1 < len(scope):
+			i++
+			pattern.WriteString(regexp.QuoteMeta(string(scope[i])))
+		case c == '%':
+			pattern.WriteString(".*")
+		case c == '_':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	pattern.WriteString("$")
+
+	matched, err := regexp.MatchString(pattern.String(), database)
+	return err == nil && matched
+}
+
+func firstSubmatch(pattern *regexp.Regexp, data []byte) string {
+	if match := pattern.FindSubmatch(data); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
+
+// versionParts returns up to n leading numbers of a version string
+func versionParts(version string, n int) []int {
+	var parts []int
+	for _, part := range strings.Split(string(versionPattern.Find([]byte(version))), ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil || len(parts) == n {
+			break
+		}
+		parts = append(parts, number)
+	}
+	return parts
+}
+
+// pgMajorVersion returns the major version, which has two numbers before
+// PostgreSQL 10
+func pgMajorVersion(version string) []int {
+	parts := versionParts(version, 2)
+	if len(parts) > 0 && parts[0] >= 10 {
+		return parts[:1]
+	}
+	return parts
+}
+
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// sameVersionLine reports whether two server versions can be compared;
+// MariaDB numbers its releases apart from MySQL
+func sameVersionLine(a, b string) bool {
+	return strings.Contains(strings.ToLower(a), "mariadb") == strings.Contains(strings.ToLower(b), "mariadb")
+}
+
+func sortedKeys(set map[string]bool, keep func(string) bool) []string {
+	var keys []string
+	for key := range set {
+		if keep(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func limitNames(names []string) []string {
+	if len(names) > maxPreflightConflicts {
+		return names[:maxPreflightConflicts]
+	}
+	return names
+}
+
+func (h *BackupHandler) PreflightRestore(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateRestoreRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.backupService.PreflightRestore(userID, &req)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Backup or connection not found")
+		case errors.Is(err, errRestoreSelection):
+			response.SendError(w, http.StatusBadRequest, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Restore preflight completed", report)
+}
@@ -0,0 +1,125 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMySQLScopeMatches(t *testing.T) {
+	tests := []struct {
+		scope    string
+		database string
+		want     bool
+	}{
+		{scope: "*", database: "app", want: true},
+		{scope: "`app`", database: "app", want: true},
+		{scope: "`app`", database: "app2"},
+		{scope: "`app%`", database: "app_staging", want: true},
+		{scope: "`app_`", database: "app2", want: true},
+		{scope: "`app_`", database: "app"},
+		{scope: "`app\\_db`", database: "app_db", want: true},
+		{scope: "`app\\_db`", database: "appxdb"},
+		{scope: "`a.b`", database: "axb"},
+	}
+
+	for _, tt := range tests {
+		if got := mysqlScopeMatches(tt.scope, tt.database); got != tt.want {
+			t.Errorf("mysqlScopeMatches(%q, %q) = %t, want %t", tt.scope, tt.database, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLHasPrivilege(t *testing.T) {
+	tests := []struct {
+		name   string
+		grants []string
+		want   bool
+	}{
+		{
+			name:   "global grant",
+			grants: []string{"GRANT SELECT, INSERT, CREATE ON *.* TO `velld`@`%`"},
+			want:   true,
+		},
+		{
+			name:   "all privileges on the database",
+			grants: []string{"GRANT USAGE ON *.* TO `velld`@`%`", "GRANT ALL PRIVILEGES ON `app`.* TO `velld`@`%`"},
+			want:   true,
+		},
+		{
+			name:   "wildcard scope",
+			grants: []string{"GRANT create, drop ON `ap%`.* TO `velld`@`%`"},
+			want:   true,
+		},
+		{
+			name:   "privilege on another database",
+			grants: []string{"GRANT CREATE ON `billing`.* TO `velld`@`%`"},
+		},
+		{
+			name:   "other privileges only",
+			grants: []string{"GRANT SELECT, INSERT ON `app`.* TO `velld`@`%`"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := mysqlHasPrivilege(tt.grants, "CREATE", "app"); got != tt.want {
+			t.Errorf("%s: mysqlHasPrivilege = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want int
+	}{
+		{a: []int{16}, b: []int{16}, want: 0},
+		{a: []int{15}, b: []int{16}, want: -1},
+		{a: []int{9, 6}, b: []int{9, 5}, want: 1},
+		{a: []int{8, 0, 36}, b: []int{8, 4}, want: -1},
+		// Missing parts are not compared
+		{a: []int{8}, b: []int{8, 4}, want: 0},
+		{a: nil, b: []int{16}, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPgMajorVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []int
+	}{
+		{version: "16.2", want: []int{16}},
+		{version: "PostgreSQL 14.11 (Debian 14.11-1.pgdg120+2)", want: []int{14}},
+		{version: "9.6.24", want: []int{9, 6}},
+		{version: "10", want: []int{10}},
+		{version: "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := pgMajorVersion(tt.version); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pgMajorVersion(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestSameVersionLine(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "8.0.36", b: "8.4.0", want: true},
+		{a: "10.11.6-MariaDB", b: "11.2.2-MariaDB-1:11.2.2+maria~ubu2204", want: true},
+		{a: "8.0.36", b: "10.11.6-MariaDB"},
+	}
+
+	for _, tt := range tests {
+		if got := sameVersionLine(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameVersionLine(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// productionTag marks connections whose restores take a safety snapshot
+// unless the request turns it off
+const productionTag = "production"
+
+// Labels of pre-restore snapshots
+const (
+	snapshotLabel           = "snapshot"
+	snapshotLabelPreRestore = "pre-restore"
+	restoreJobLabel         = "restore_job"
+)
+
+var (
+	errNoSafetySnapshot = errors.New("restore job has no pre-restore snapshot to revert to")
+	errRestoreJobActive = errors.New("restore job is still queued or running")
+	errRevertNotLatest  = errors.New("only the latest restore into a database can be reverted")
+	// errRevertConfirmation stands in for errRestoreConfirmation, whose
+	// endpoint doesn't apply to reverts
+	errRevertConfirmation = errors.New("reverting drops the target database and needs a valid confirmation token, request one from /api/restores/{id}/revert/confirmation")
+)
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// takeSafetySnapshot backs up a job's target database with the normal backup
+// pipeline before the restore touches it. The snapshot is labelled, pinned so
+// retention keeps it, and linked to the job. It returns nil when the target
+// doesn't exist yet, as there is nothing to lose.
+func (s *BackupService) takeSafetySnapshot(job *RestoreJob) (*Backup, error) {
+	conn, err := s.connStorage.GetConnection(job.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	exists, err := s.restoreTargetExists(conn, job.TargetDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check target database: %v", err)
+	}
+	if !exists {
+		fmt.Printf("Skipping pre-restore snapshot of %s for restore job %s: the database doesn't exist\n",
+			job.TargetDatabase, job.ID)
+		return nil, nil
+	}
+
+	// The dump command reads the database from the connection
+	conn.DatabaseName = job.TargetDatabase
+	snapshot, err := s.createSingleDatabaseBackup(conn, job.TargetDatabase, backupRunOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		snapshotLabel:   snapshotLabelPreRestore,
+		restoreJobLabel: job.ID.String(),
+	}
+	notes := fmt.Sprintf("Snapshot of %s taken before restore job %s restored backup %s over it",
+		job.TargetDatabase, job.ID, job.BackupID)
+	if err := s.backupRepo.UpdateBackupMetadata(snapshot.ID.String(), labels, &notes); err != nil {
+		fmt.Printf("Warning: Failed to label pre-restore snapshot %s: %v\n", snapshot.ID, err)
+	}
+	if err := s.backupRepo.SetBackupPinned(snapshot.ID.String(), true); err != nil {
+		fmt.Printf("Warning: Failed to pin pre-restore snapshot %s: %v\n", snapshot.ID, err)
+	}
+	if err := s.backupRepo.SetRestoreJobSnapshot(job.ID.String(), snapshot.ID.String()); err != nil {
+		fmt.Printf("Warning: Failed to link pre-restore snapshot %s to restore job %s: %v\n", snapshot.ID, job.ID, err)
+	}
+
+	fmt.Printf("Took pre-restore snapshot %s of %s for restore job %s\n", snapshot.ID, job.TargetDatabase, job.ID)
+	return snapshot, nil
+}
+
+// restoreTargetExists reports whether the target database of a restore
+// exists. MongoDB databases are assumed to exist; dumping a missing one just
+// produces an empty snapshot.
+func (s *BackupService) restoreTargetExists(conn *connection.StoredConnection, database string) (bool, error) {
+	switch conn.Type {
+	case "postgresql", "mysql", "mariadb":
+	default:
+		return true, nil
+	}
+
+	target := *conn
+	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(&target)
+	if err != nil {
+		return false, fmt.Errorf("failed to setup SSH tunnel: %v", err)
+	}
+	if tunnel != nil {
+		defer tunnel.Stop()
+		target.Host = effectiveHost
+		target.Port = effectivePort
+	}
+
+	db, err := openRestoreAdminDB(&target)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database server: %v", err)
+	}
+	defer db.Close()
+
+	return restoreDatabaseExists(db, conn.Type, database)
+}
+
+// revertRequest returns the restore that reverts a job to its snapshot. Only
+// the latest restore into a database can be reverted, since the snapshot
+// predates everything later restores and writes put there.
+func (s *BackupService) revertRequest(userID uuid.UUID, jobID string) (*RestoreRequest, *Backup, *connection.StoredConnection, error) {
+	job, err := s.GetRestoreJob(userID, jobID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if job.Status == RestoreJobQueued || job.Status == RestoreJobRunning {
+		return nil, nil, nil, errRestoreJobActive
+	}
+	if job.SnapshotBackupID == nil {
+		return nil, nil, nil, errNoSafetySnapshot
+	}
+
+	latestID, err := s.backupRepo.GetLatestRestoreJobID(job.ConnectionID, job.TargetDatabase)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if latestID != job.ID.String() {
+		return nil, nil, nil, errRevertNotLatest
+	}
+
+	snapshot, err := s.backupRepo.GetBackup(*job.SnapshotBackupID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, nil, fmt.Errorf("%w: snapshot %s was deleted", errNoSafetySnapshot, *job.SnapshotBackupID)
+		}
+		return nil, nil, nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(job.ConnectionID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if conn.UserID != userID {
+		return nil, nil, nil, sql.ErrNoRows
+	}
+
+	// The snapshot holds the whole database, so it replaces the target
+	// instead of being loaded on top of what the restore left. The revert
+	// takes a snapshot of its own so it can be undone in turn.
+	safetySnapshot := true
+	req := &RestoreRequest{
+		BackupID:       snapshot.ID.String(),
+		ConnectionID:   conn.ID,
+		TargetDatabase: job.TargetDatabase,
+		DropExisting:   true,
+		Owner:          job.Options.Owner,
+		Encoding:       job.Options.Encoding,
+		SafetySnapshot: &safetySnapshot,
+	}
+	return req, snapshot, conn, nil
+}
+
+// IssueRevertConfirmation returns the token that allows reverting a job
+func (s *BackupService) IssueRevertConfirmation(userID uuid.UUID, jobID string) (*RestoreConfirmation, error) {
+	req, _, _, err := s.revertRequest(userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return s.IssueRestoreConfirmation(userID, req)
+}
+
+// RevertRestore restores the snapshot a job took of its target, replacing
+// whatever the restore left behind. The revert runs as a new restore job.
+func (s *BackupService) RevertRestore(userID uuid.UUID, jobID string, confirmationToken string) (*RestoreJob, error) {
+	req, snapshot, conn, err := s.revertRequest(userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyRestoreConfirmation(confirmationToken, userID, snapshot.ID.String(), conn.ID, req.TargetDatabase); err != nil {
+		return nil, errRevertConfirmation
+	}
+	return s.queueRestore(userID, snapshot, conn, req, &jobID)
+}
+
+// writeRevertError answers a failed revert or revert confirmation
+func writeRevertError(w http.ResponseWriter, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Restore job not found")
+	case err == errRevertConfirmation:
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errNoSafetySnapshot), err == errRestoreJobActive, err == errRevertNotLatest, err == errRestoreTargetBusy:
+		response.SendError(w, http.StatusConflict, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *BackupHandler) ConfirmRevertRestoreJob(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	confirmation, err := h.backupService.IssueRevertConfirmation(userID, id)
+	if err != nil {
+		writeRevertError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Revert confirmation issued successfully", confirmation)
+}
+
+func (h *BackupHandler) RevertRestoreJob(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req RevertRestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := h.backupService.RevertRestore(userID, id, req.ConfirmationToken)
+	if err != nil {
+		writeRevertError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Revert to pre-restore snapshot queued successfully", job)
+}
@@ -0,0 +1,361 @@
+package backup
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// restoreConfirmationTTL is how long a drop confirmation token stays valid
+const restoreConfirmationTTL = 10 * time.Minute
+
+// maxDatabaseNameLength is PostgreSQL's identifier limit, MySQL allows 64
+const maxDatabaseNameLength = 63
+
+// encodingSniffBytes is how much of a dump is read to find its encoding
+const encodingSniffBytes = 64 * 1024
+
+var (
+	errRestoreTargetMissing = errors.New("target database does not exist, set create_if_missing to create it")
+	errRestoreConfirmation  = errors.New("dropping the target database needs a valid confirmation token, request one from /api/backups/restore/confirmation")
+)
+
+var (
+	encodingPattern   = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+	pgEncodingLine    = regexp.MustCompile(`^SET client_encoding = '([^']+)';`)
+	mysqlEncodingLine = regexp.MustCompile(`SET NAMES ([A-Za-z0-9_]+)`)
+)
+
+// restoreConfirmationClaims bind a drop confirmation to one user, backup and
+// target database. They are encrypted into the token, so any replica can
+// verify it.
+type restoreConfirmationClaims struct {
+	UserID       string `json:"user_id"`
+	BackupID     string `json:"backup_id"`
+	ConnectionID string `json:"connection_id"`
+	Database     string `json:"database"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+func restoreTargetDatabase(conn *connection.StoredConnection, req *RestoreRequest) string {
+	if target := strings.TrimSpace(req.TargetDatabase); target != "" {
+		return target
+	}
+	return conn.DatabaseName
+}
+
+// IssueRestoreConfirmation returns a short-lived token that allows a restore
+// to drop and recreate its target database
+func (s *BackupService) IssueRestoreConfirmation(userID uuid.UUID, req *RestoreRequest) (*RestoreConfirmation, error) {
+	backup, err := s.backupRepo.GetBackup(req.BackupID)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	targetDatabase := restoreTargetDatabase(conn, req)
+	expiresAt := time.Now().Add(restoreConfirmationTTL)
+	claims, err := json.Marshal(restoreConfirmationClaims{
+		UserID:       userID.String(),
+		BackupID:     backup.ID.String(),
+		ConnectionID: conn.ID,
+		Database:     targetDatabase,
+		ExpiresAt:    expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.cryptoService.Encrypt(string(claims))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create confirmation token: %v", err)
+	}
+
+	return &RestoreConfirmation{
+		ConfirmationToken: token,
+		ConnectionID:      conn.ID,
+		TargetDatabase:    targetDatabase,
+		ExpiresAt:         expiresAt,
+	}, nil
+}
+
+func (s *BackupService) verifyRestoreConfirmation(token string, userID uuid.UUID, backupID, connectionID, database string) error {
+	if token == "" {
+		return errRestoreConfirmation
+	}
+
+	plaintext, err := s.cryptoService.Decrypt(token)
+	if err != nil {
+		return errRestoreConfirmation
+	}
+
+	var claims restoreConfirmationClaims
+	if err := json.Unmarshal([]byte(plaintext), &claims); err != nil {
+		return errRestoreConfirmation
+	}
+
+	if claims.UserID != userID.String() || claims.BackupID != backupID ||
+		claims.ConnectionID != connectionID || claims.Database != database ||
+		time.Now().Unix() > claims.ExpiresAt {
+		return errRestoreConfirmation
+	}
+	return nil
+}
+
+// prepareRestoreTarget makes sure the target database exists before the dump
+// is loaded, dropping it first when the restore replaces it. conn must already
+// point at the SSH tunnel if one is used.
+func (s *BackupService) prepareRestoreTarget(conn *connection.StoredConnection, database string, req *RestoreRequest, dumpPath string) error {
+	switch conn.Type {
+	case "postgresql", "mysql", "mariadb":
+	default:
+		// MongoDB creates databases on first write
+		return nil
+	}
+
+	db, err := openRestoreAdminDB(conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database server: %v", err)
+	}
+	defer db.Close()
+
+	exists, err := restoreDatabaseExists(db, conn.Type, database)
+	if err != nil {
+		return fmt.Errorf("failed to check target database: %v", err)
+	}
+
+	if exists && req.DropExisting {
+		if err := dropRestoreDatabase(db, conn.Type, database); err != nil {
+			return fmt.Errorf("failed to drop database %q: %v", database, err)
+		}
+		fmt.Printf("Dropped database %s on connection %s before restore\n", database, conn.ID)
+		exists = false
+	}
+	if exists {
+		return nil
+	}
+	if !req.CreateIfMissing && !req.DropExisting {
+		return errRestoreTargetMissing
+	}
+
+	encoding := strings.TrimSpace(req.Encoding)
+	if encoding == "" {
+		encoding = detectDumpEncoding(dumpPath, conn.Type)
+	}
+	owner := strings.TrimSpace(req.Owner)
+	if owner == "" {
+		owner = conn.Username
+	}
+
+	if err := createRestoreDatabase(db, conn.Type, database, owner, encoding); err != nil {
+		return fmt.Errorf("failed to create database %q: %v", database, err)
+	}
+	fmt.Printf("Created database %s on connection %s for restore\n", database, conn.ID)
+	return nil
+}
+
+// openRestoreAdminDB connects to the server without selecting the target
+// database, which may not exist yet or may be dropped
+func openRestoreAdminDB(conn *connection.StoredConnection) (*sql.DB, error) {
+	return openRestoreDB(conn, "")
+}
+
+// openRestoreDB connects to a database of the server, or to none when
+// database is empty
+func openRestoreDB(conn *connection.StoredConnection, database string) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	switch conn.Type {
+	case "postgresql":
+		sslMode := "disable"
+		if conn.SSL {
+			sslMode = "require"
+		}
+		if database == "" {
+			database = "postgres"
+		}
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+			conn.Host, conn.Port, quotePgConnValue(conn.Username), quotePgConnValue(conn.Password), quotePgConnValue(database), sslMode)
+		db, err = sql.Open("postgres", dsn)
+	case "mysql", "mariadb":
+		// Post-restore scripts of refresh pipelines hold several statements
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?tls=%t&multiStatements=true",
+			conn.Username, conn.Password, conn.Host, conn.Port, database, conn.SSL)
+		db, err = sql.Open("mysql", dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", conn.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// quotePgConnValue quotes a value of a PostgreSQL key=value connection string
+func quotePgConnValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+func restoreDatabaseExists(db *sql.DB, dbType, database string) (bool, error) {
+	var count int
+	var err error
+	if dbType == "postgresql" {
+		err = db.QueryRow(`SELECT COUNT(*) FROM pg_database WHERE datname = $1`, database).Scan(&count)
+	} else {
+		err = db.QueryRow(`SELECT COUNT(*) FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?`, database).Scan(&count)
+	}
+	return count > 0, err
+}
+
+func dropRestoreDatabase(db *sql.DB, dbType, database string) error {
+	if dbType != "postgresql" {
+		_, err := db.Exec(fmt.Sprintf("DROP DATABASE %s", quoteMySQLIdentifier(database)))
+		return err
+	}
+
+	// PostgreSQL refuses to drop a database that has open sessions
+	if _, err := db.Exec(`
+		SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+		WHERE datname = $1 AND pid <> pg_backend_pid()`, database); err != nil {
+		return fmt.Errorf("failed to close sessions: %v", err)
+	}
+	_, err := db.Exec(fmt.Sprintf("DROP DATABASE %s", pq.QuoteIdentifier(database)))
+	return err
+}
+
+func createRestoreDatabase(db *sql.DB, dbType, database, owner, encoding string) error {
+	if dbType != "postgresql" {
+		// MySQL has no database owner; access is granted per user
+		_, err := db.Exec(fmt.Sprintf("CREATE DATABASE %s CHARACTER SET %s",
+			quoteMySQLIdentifier(database), encoding))
+		return err
+	}
+
+	// template0 allows an encoding other than the server default
+	_, err := db.Exec(fmt.Sprintf("CREATE DATABASE %s OWNER %s ENCODING %s TEMPLATE template0",
+		pq.QuoteIdentifier(database), pq.QuoteIdentifier(owner), pq.QuoteLiteral(encoding)))
+	return err
+}
+
+func quoteMySQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// detectDumpEncoding reads the encoding a dump was taken with from its
+// header, falling back to UTF-8
+func detectDumpEncoding(dumpPath, dbType string) string {
+	fallback := "UTF8"
+	pattern := pgEncodingLine
+	if dbType != "postgresql" {
+		fallback = "utf8mb4"
+		pattern = mysqlEncodingLine
+	}
+
+	file, err := os.Open(dumpPath)
+	if err != nil {
+		return fallback
+	}
+	defer file.Close()
+
+	read := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), encodingSniffBytes)
+	for scanner.Scan() && read < encodingSniffBytes {
+		line := scanner.Text()
+		read += len(line) + 1
+		if match := pattern.FindStringSubmatch(line); match != nil {
+			return match[1]
+		}
+	}
+	return fallback
+}
+
+func validateRestoreRequest(req *RestoreRequest) error {
+	if req.BackupID == "" {
+		return fmt.Errorf("backup_id is required")
+	}
+	if req.ConnectionID == "" {
+		return fmt.Errorf("connection_id is required")
+	}
+
+	if target := strings.TrimSpace(req.TargetDatabase); target != "" {
+		if len(target) > maxDatabaseNameLength {
+			return fmt.Errorf("target_database is longer than %d characters", maxDatabaseNameLength)
+		}
+		if strings.ContainsAny(target, "\x00/\\.") {
+			return fmt.Errorf("target_database must not contain '/', '\\', '.' or NUL characters")
+		}
+	}
+	if owner := strings.TrimSpace(req.Owner); len(owner) > maxDatabaseNameLength {
+		return fmt.Errorf("owner is longer than %d characters", maxDatabaseNameLength)
+	}
+	if encoding := strings.TrimSpace(req.Encoding); encoding != "" && !encodingPattern.MatchString(encoding) {
+		return fmt.Errorf("invalid encoding %q", encoding)
+	}
+	if req.Objects != nil {
+		return validateRestoreSelection(req)
+	}
+	return nil
+}
+
+func validateRestoreSelection(req *RestoreRequest) error {
+	objects := req.Objects
+	if len(objects.Tables)+len(objects.Schemas)+len(objects.Collections) == 0 {
+		return fmt.Errorf("objects must select at least one table, schema or collection")
+	}
+	if req.DropExisting {
+		return fmt.Errorf("drop_existing can't be combined with a selective restore")
+	}
+
+	selected := make(map[string]bool)
+	for _, names := range [][]string{objects.Tables, objects.Schemas, objects.Collections} {
+		for i, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return fmt.Errorf("objects must not contain empty names")
+			}
+			names[i] = name
+			selected[name] = true
+		}
+	}
+	for _, schema := range objects.Schemas {
+		if _, ok := objects.Rename[schema]; ok {
+			return fmt.Errorf("schema %q can't be renamed, rename its tables instead", schema)
+		}
+	}
+
+	renamed := make(map[string]bool)
+	for entry, newName := range objects.Rename {
+		if !selected[entry] {
+			return fmt.Errorf("rename %q is not a selected table or collection", entry)
+		}
+		if newName == "" || len(newName) > maxDatabaseNameLength || strings.ContainsAny(newName, "\x00.") {
+			return fmt.Errorf("invalid new name %q for %q: use up to %d characters without '.'", newName, entry, maxDatabaseNameLength)
+		}
+		if renamed[newName] {
+			return fmt.Errorf("two objects can't be renamed to %q", newName)
+		}
+		renamed[newName] = true
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/audit"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// retentionEnforceInterval is how often retention rules are applied to every
+// connection, including those without a scheduled run to trigger them
+const retentionEnforceInterval = time.Hour
+
+// retentionPeriod groups backups into calendar periods for GFS rules
+type retentionPeriod struct {
+	name  string
+	count func(rule *RetentionRule) int
+	key   func(t time.Time) string
+}
+
+var retentionPeriods = []retentionPeriod{
+	{"daily", func(r *RetentionRule) int { return r.KeepDaily }, func(t time.Time) string { return t.Format("2006-01-02") }},
+	{"weekly", func(r *RetentionRule) int { return r.KeepWeekly }, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}},
+	{"monthly", func(r *RetentionRule) int { return r.KeepMonthly }, func(t time.Time) string { return t.Format("2006-01") }},
+	{"yearly", func(r *RetentionRule) int { return r.KeepYearly }, func(t time.Time) string { return t.Format("2006") }},
+}
+
+// retentionGroup returns the history a backup is evaluated in. Each database
+// and each schedule keeps its own history, so a frequent schema-only schedule
+// doesn't crowd the nightly full backups out of the daily keepers. Masked
+// copies can't be recovered from, so they never stand in for a real backup,
+// and imported dumps keep apart from the backups Velld took.
+func retentionGroup(backup *Backup) string {
+	scheduleID := ""
+	if backup.ScheduleID != nil {
+		scheduleID = *backup.ScheduleID
+	}
+	return fmt.Sprintf("%s\x00%s\x00%t\x00%t", backup.DatabaseName, scheduleID, backup.Masked, backup.Imported)
+}
+
+// planRetention decides which of a connection's successful backups a rule
+// keeps. Every retention group is evaluated on its own, see retentionGroup.
+func planRetention(rule *RetentionRule, backups []*Backup) []*RetentionDecision {
+	loc := time.Local
+	if rule.Timezone != "" {
+		if l, err := time.LoadLocation(rule.Timezone); err == nil {
+			loc = l
+		}
+	}
+
+	groups := make(map[string][]*Backup)
+	for _, backup := range backups {
+		if backup.Status != "completed" {
+			continue
+		}
+		key := retentionGroup(backup)
+		groups[key] = append(groups[key], backup)
+	}
+
+	decisions := make([]*RetentionDecision, 0)
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].CreatedAt.After(group[j].CreatedAt) })
+
+		groupDecisions := make([]*RetentionDecision, len(group))
+		for i, backup := range group {
+			groupDecisions[i] = &RetentionDecision{
+				BackupID:     backup.ID,
+				DatabaseName: backup.DatabaseName,
+				ScheduleID:   backup.ScheduleID,
+				CreatedAt:    backup.CreatedAt,
+				Size:         backup.Size,
+				Reasons:      []string{},
+			}
+		}
+		keep := func(d *RetentionDecision, reason string) {
+			d.Keep = true
+			d.Reasons = append(d.Reasons, reason)
+		}
+
+		// The last good backup is never pruned, however old it is
+		keep(groupDecisions[0], "latest successful backup")
+
+		for i, backup := range group {
+			if backup.Pinned {
+				keep(groupDecisions[i], "pinned")
+			}
+			if backup.LegalHold {
+				keep(groupDecisions[i], "legal hold")
+			}
+		}
+
+		for i := 0; i < rule.KeepLast && i < len(groupDecisions); i++ {
+			keep(groupDecisions[i], fmt.Sprintf("keep last %d", rule.KeepLast))
+		}
+
+		for _, period := range retentionPeriods {
+			count := period.count(rule)
+			if count <= 0 {
+				continue
+			}
+			seen := make(map[string]bool)
+			for i, backup := range group {
+				key := period.key(backup.CreatedAt.In(loc))
+				if seen[key] {
+					continue
+				}
+				if len(seen) == count {
+					break
+				}
+				seen[key] = true
+				keep(groupDecisions[i], fmt.Sprintf("%s %s", period.name, key))
+			}
+		}
+
+		kept := 0
+		for _, d := range groupDecisions {
+			if d.Keep {
+				kept++
+			}
+		}
+		for _, d := range groupDecisions {
+			if kept >= rule.MinKeep {
+				break
+			}
+			if !d.Keep {
+				keep(d, fmt.Sprintf("minimum count %d", rule.MinKeep))
+				kept++
+			}
+		}
+
+		for _, d := range groupDecisions {
+			if !d.Keep {
+				d.Reasons = append(d.Reasons, "not selected by any retention rule")
+			}
+		}
+		decisions = append(decisions, groupDecisions...)
+	}
+
+	sort.Slice(decisions, func(i, j int) bool { return decisions[i].CreatedAt.After(decisions[j].CreatedAt) })
+	return decisions
+}
+
+// latestBackupIDs returns the newest successful backup of each retention group
+// of a connection, which retention never deletes
+func (s *BackupService) latestBackupIDs(connectionID string) (map[uuid.UUID]bool, error) {
+	backups, err := s.backupRepo.GetBackupsByConnectionID(connectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[uuid.UUID]bool)
+	newest := make(map[string]*Backup)
+	for _, backup := range backups {
+		if backup.Status != "completed" {
+			continue
+		}
+		key := retentionGroup(backup)
+		if current, ok := newest[key]; !ok || backup.CreatedAt.After(current.CreatedAt) {
+			newest[key] = backup
+		}
+	}
+	for _, backup := range newest {
+		latest[backup.ID] = true
+	}
+	return latest, nil
+}
+
+// applyRetentionRule evaluates a rule over a connection's backups and, unless
+// dryRun is set, moves the backups it doesn't keep to the trash
+func (s *BackupService) applyRetentionRule(rule *RetentionRule, dryRun bool) (*RetentionPlan, error) {
+	backups, err := s.backupRepo.GetBackupsByConnectionID(rule.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backups: %w", err)
+	}
+
+	plan := &RetentionPlan{
+		ConnectionID: rule.ConnectionID,
+		Rule:         rule,
+		DryRun:       dryRun,
+		Decisions:    planRetention(rule, backups),
+	}
+	for _, d := range plan.Decisions {
+		if d.Keep {
+			plan.KeptCount++
+		} else {
+			plan.PrunedCount++
+			plan.PrunedSize += d.Size
+		}
+	}
+
+	if dryRun || plan.PrunedCount == 0 {
+		return plan, nil
+	}
+
+	conn, err := s.connStorage.GetConnection(rule.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	byID := make(map[uuid.UUID]*Backup, len(backups))
+	for _, backup := range backups {
+		byID[backup.ID] = backup
+	}
+
+	for _, d := range plan.Decisions {
+		if d.Keep {
+			continue
+		}
+		if err := s.trashBackup(byID[d.BackupID], conn, TrashReasonRetention, audit.ActorSystem); err != nil {
+			fmt.Printf("Warning: Failed to move backup %s to trash: %v\n", d.BackupID, err)
+		}
+	}
+
+	fmt.Printf("Retention rule applied: pruned %d of %d backups for connection %s\n",
+		plan.PrunedCount, len(plan.Decisions), rule.ConnectionID)
+	return plan, nil
+}
+
+// runRetentionEnforcer periodically applies the enabled retention rules, so
+// connections with only manual or imported backups are pruned as well
+func (s *BackupService) runRetentionEnforcer() {
+	ticker := time.NewTicker(retentionEnforceInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Only the replica running schedules prunes, so deletions don't race
+		if s.scheduler.IsLeader() {
+			s.enforceRetentionRules()
+		}
+	}
+}
+
+func (s *BackupService) enforceRetentionRules() {
+	rules, err := s.backupRepo.GetEnabledRetentionRules()
+	if err != nil {
+		fmt.Printf("Error fetching retention rules: %v\n", err)
+		return
+	}
+
+	for _, rule := range rules {
+		if _, err := s.applyRetentionRule(rule, false); err != nil {
+			fmt.Printf("Error applying retention rule for connection %s: %v\n", rule.ConnectionID, err)
+		}
+	}
+}
+
+func (s *BackupService) GetRetentionRule(connectionID string) (*RetentionRule, error) {
+	return s.backupRepo.GetRetentionRule(connectionID)
+}
+
+func (s *BackupService) UpdateRetentionRule(connectionID string, req *UpdateRetentionRuleRequest) (*RetentionRule, error) {
+	if _, err := s.connStorage.GetConnection(connectionID); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.SaveRetentionRule(retentionRuleFromRequest(connectionID, req)); err != nil {
+		return nil, fmt.Errorf("failed to save retention rule: %v", err)
+	}
+
+	return s.backupRepo.GetRetentionRule(connectionID)
+}
+
+// PreviewRetention shows what a retention rule would prune without deleting
+// anything. A nil request previews the connection's saved rule.
+func (s *BackupService) PreviewRetention(connectionID string, req *UpdateRetentionRuleRequest) (*RetentionPlan, error) {
+	if _, err := s.connStorage.GetConnection(connectionID); err != nil {
+		return nil, err
+	}
+
+	var rule *RetentionRule
+	if req != nil {
+		rule = retentionRuleFromRequest(connectionID, req)
+	} else {
+		saved, err := s.backupRepo.GetRetentionRule(connectionID)
+		if err != nil {
+			return nil, err
+		}
+		rule = saved
+	}
+
+	return s.applyRetentionRule(rule, true)
+}
+
+func retentionRuleFromRequest(connectionID string, req *UpdateRetentionRuleRequest) *RetentionRule {
+	return &RetentionRule{
+		ConnectionID: connectionID,
+		Enabled:      req.Enabled,
+		KeepLast:     req.KeepLast,
+		KeepDaily:    req.KeepDaily,
+		KeepWeekly:   req.KeepWeekly,
+		KeepMonthly:  req.KeepMonthly,
+		KeepYearly:   req.KeepYearly,
+		MinKeep:      req.MinKeep,
+		Timezone:     strings.TrimSpace(req.Timezone),
+	}
+}
+
+func validateRetentionRule(req *UpdateRetentionRuleRequest) error {
+	counts := []int{req.KeepLast, req.KeepDaily, req.KeepWeekly, req.KeepMonthly, req.KeepYearly, req.MinKeep}
+	total := 0
+	for _, count := range counts {
+		if count < 0 {
+			return fmt.Errorf("retention counts must not be negative")
+		}
+		total += count
+	}
+	if total == 0 {
+		return fmt.Errorf("at least one of keep_last, keep_daily, keep_weekly, keep_monthly, keep_yearly or min_keep must be set")
+	}
+	if timezone := strings.TrimSpace(req.Timezone); timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %v", timezone, err)
+		}
+	}
+	return nil
+}
+
+func (h *BackupHandler) GetRetentionRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	rule, err := h.backupService.GetRetentionRule(connectionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "No retention rule found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Retention rule retrieved successfully", rule)
+}
+
+func (h *BackupHandler) UpdateRetentionRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	var req UpdateRetentionRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateRetentionRule(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule, err := h.backupService.UpdateRetentionRule(connectionID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Retention rule updated successfully", rule)
+}
+
+// PreviewRetention is a dry run of a retention rule. The body may hold a rule
+// to try out; without one the saved rule is used.
+func (h *BackupHandler) PreviewRetention(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	var req *UpdateRetentionRuleRequest
+	var body UpdateRetentionRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err != io.EOF {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		if err := validateRetentionRule(&body); err != nil {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req = &body
+	}
+
+	plan, err := h.backupService.PreviewRetention(connectionID, req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection or retention rule not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Retention dry run completed successfully", plan)
+}
@@ -0,0 +1,250 @@
+package backup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// retentionFixture describes a backup by its number, which is also the last
+// part of its ID
+type retentionFixture struct {
+	n         int
+	createdAt time.Time
+	status    string
+	database  string
+	schedule  string
+	pinned    bool
+	legalHold bool
+	masked    bool
+	imported  bool
+}
+
+func (f retentionFixture) backup() *Backup {
+	backup := &Backup{
+		ID:           uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", f.n)),
+		DatabaseName: "app",
+		Status:       "completed",
+		CreatedAt:    f.createdAt,
+		Pinned:       f.pinned,
+		LegalHold:    f.legalHold,
+		Masked:       f.masked,
+		Imported:     f.imported,
+	}
+	if f.status != "" {
+		backup.Status = f.status
+	}
+	if f.database != "" {
+		backup.DatabaseName = f.database
+	}
+	if f.schedule != "" {
+		schedule := f.schedule
+		backup.ScheduleID = &schedule
+	}
+	return backup
+}
+
+func TestPlanRetention(t *testing.T) {
+	day := func(d, hour int) time.Time { return time.Date(2024, 1, d, hour, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		rule     RetentionRule
+		backups  []retentionFixture
+		kept     []int
+		pruned   []int
+		noDecide []int
+	}{
+		{
+			name: "keep last",
+			rule: RetentionRule{KeepLast: 2},
+			backups: []retentionFixture{
+				{n: 1, createdAt: day(4, 0)}, {n: 2, createdAt: day(3, 0)},
+				{n: 3, createdAt: day(2, 0)}, {n: 4, createdAt: day(1, 0)},
+			},
+			kept:   []int{1, 2},
+			pruned: []int{3, 4},
+		},
+		{
+			name: "latest backup is always kept",
+			rule: RetentionRule{},
+			backups: []retentionFixture{
+				{n: 1, createdAt: day(2, 0)}, {n: 2, createdAt: day(1, 0)},
+			},
+			kept:   []int{1},
+			pruned: []int{2},
+		},
+		{
+			name: "daily keeps the newest backup of each day",
+			rule: RetentionRule{KeepDaily: 2},
+			backups: []retentionFixture{
+				{n: 1, createdAt: day(3, 18)}, {n: 2, createdAt: day(3, 6)},
+				{n: 3, createdAt: day(2, 18)}, {n: 4, createdAt: day(2, 6)},
+				{n: 5, createdAt: day(1, 18)},
+			},
+			kept:   []int{1, 3},
+			pruned: []int{2, 4, 5},
+		},
+		{
+			name: "weekly uses ISO weeks",
+			rule: RetentionRule{KeepWeekly: 2},
+			backups: []retentionFixture{
+				// 2024-01-15 is a Monday, 2024-01-14 the Sunday before
+				{n: 1, createdAt: day(16, 0)}, {n: 2, createdAt: day(15, 0)},
+				{n: 3, createdAt: day(14, 0)}, {n: 4, createdAt: day(8, 0)},
+				{n: 5, createdAt: day(7, 0)},
+			},
+			kept:   []int{1, 3},
+			pruned: []int{2, 4, 5},
+		},
+		{
+			name: "monthly and yearly",
+			rule: RetentionRule{KeepMonthly: 2, KeepYearly: 2},
+			backups: []retentionFixture{
+				{n: 1, createdAt: time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)},
+				{n: 2, createdAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+				{n: 3, createdAt: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)},
+				{n: 4, createdAt: time.Date(2023, 12, 10, 0, 0, 0, 0, time.UTC)},
+				{n: 5, createdAt: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)},
+			},
+			kept:   []int{1, 3, 4},
+			pruned: []int{2, 5},
+		},
+		{
+			name: "pinned and legal hold",
+			rule: RetentionRule{KeepLast: 1},
+			backups: []retentionFixture{
+				{n: 1, createdAt: day(3, 0)},
+				{n: 2, createdAt: day(2, 0), pinned: true},
+				{n: 3, createdAt: day(1, 0), legalHold: true},
+			},
+			kept: []int{1, 2, 3},
+		},
+		{
+			name: "minimum count fills up with the newest",
+			rule: RetentionRule{KeepLast: 1, MinKeep: 3},
+			backups: []retentionFixture{
+				{n: 1, createdAt: day(4, 0)}, {n: 2, createdAt: day(3, 0)},
+				{n: 3, createdAt: day(2, 0)}, {n: 4, createdAt: day(1, 0)},
+			},
+			kept:   []int{1, 2, 3},
+			pruned: []int{4},
+		},
+		{
+			name: "unsuccessful backups are left alone",
+			rule: RetentionRule{KeepLast: 1},
+			backups: []retentionFixture{
+				{n: 1, createdAt: day(3, 0), status: "failed"},
+				{n: 2, createdAt: day(2, 0)},
+				{n: 3, createdAt: day(1, 0)},
+			},
+			kept:     []int{2},
+			pruned:   []int{3},
+			noDecide: []int{1},
+		},
+		{
+			name: "databases, schedules, masked copies and imports keep their own history",
+			rule: RetentionRule{KeepLast: 1},
+			backups: []retentionFixture{
+				{n: 1, createdAt: day(4, 0), schedule: "hourly"},
+				{n: 2, createdAt: day(3, 0), schedule: "hourly"},
+				{n: 3, createdAt: day(2, 0), schedule: "nightly"},
+				{n: 4, createdAt: day(1, 0), schedule: "nightly"},
+				{n: 5, createdAt: day(4, 0), schedule: "nightly", database: "billing"},
+				{n: 6, createdAt: day(5, 0), schedule: "nightly", masked: true},
+				{n: 7, createdAt: day(5, 0), imported: true},
+			},
+			kept:   []int{1, 3, 5, 6, 7},
+			pruned: []int{2, 4},
+		},
+		{
+			name: "periods follow the rule's timezone",
+			rule: RetentionRule{KeepDaily: 2, Timezone: "America/New_York"},
+			backups: []retentionFixture{
+				// All three fall on January 1st in New York
+				{n: 1, createdAt: day(2, 3)},
+				{n: 2, createdAt: day(2, 1)},
+				{n: 3, createdAt: day(1, 12)},
+			},
+			kept:   []int{1},
+			pruned: []int{2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backups := make([]*Backup, len(tt.backups))
+			for i, f := range tt.backups {
+				backups[i] = f.backup()
+			}
+			rule := tt.rule
+			if rule.Timezone == "" {
+				rule.Timezone = "UTC"
+			}
+
+			plan := planRetention(&rule, backups)
+			decisions := make(map[int]*RetentionDecision)
+			for i, d := range plan {
+				if i > 0 && d.CreatedAt.After(plan[i-1].CreatedAt) {
+					t.Errorf("decisions are not sorted newest first")
+				}
+				var n int
+				fmt.Sscanf(d.BackupID.String()[24:], "%d", &n)
+				decisions[n] = d
+			}
+
+			check := func(numbers []int, keep bool) {
+				for _, n := range numbers {
+					d, ok := decisions[n]
+					if !ok {
+						t.Errorf("backup %d has no decision", n)
+						continue
+					}
+					if d.Keep != keep {
+						t.Errorf("backup %d keep = %t, want %t (reasons %v)", n, d.Keep, keep, d.Reasons)
+					}
+					if len(d.Reasons) == 0 {
+						t.Errorf("backup %d has no reason", n)
+					}
+				}
+			}
+			check(tt.kept, true)
+			check(tt.pruned, false)
+			for _, n := range tt.noDecide {
+				if _, ok := decisions[n]; ok {
+					t.Errorf("backup %d got a decision, want none", n)
+				}
+			}
+			if want := len(tt.kept) + len(tt.pruned); len(decisions) != want {
+				t.Errorf("got %d decisions, want %d", len(decisions), want)
+			}
+		})
+	}
+}
+
+func TestRetentionGroup(t *testing.T) {
+	base := retentionFixture{n: 1, schedule: "nightly"}.backup()
+
+	tests := []struct {
+		name string
+		edit func(b *Backup)
+		same bool
+	}{
+		{name: "identical", edit: func(b *Backup) {}, same: true},
+		{name: "other database", edit: func(b *Backup) { b.DatabaseName = "billing" }},
+		{name: "other schedule", edit: func(b *Backup) { other := "hourly"; b.ScheduleID = &other }},
+		{name: "unscheduled", edit: func(b *Backup) { b.ScheduleID = nil }},
+		{name: "masked copy", edit: func(b *Backup) { b.Masked = true }},
+		{name: "imported dump", edit: func(b *Backup) { b.Imported = true }},
+	}
+
+	for _, tt := range tests {
+		other := *base
+		tt.edit(&other)
+		if same := retentionGroup(base) == retentionGroup(&other); same != tt.same {
+			t.Errorf("%s: same group = %t, want %t", tt.name, same, tt.same)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxRetryBackoff caps the delay between two attempts of a run
+const maxRetryBackoff = time.Hour
+
+// maxRetryAttempts caps how often a single run is attempted
+const maxRetryAttempts = 10
+
+// Error patterns of dump tools, database drivers and SSH, checked in order so
+// an authentication failure reported on a connection is not mistaken for a
+// connection problem
+var errorClassPatterns = []struct {
+	class    string
+	patterns []string
+}{
+	{ErrorClassAuth, []string{
+		"authentication failed", "unable to authenticate", "access denied",
+		"permission denied", "login failed", "not authorized", "auth failed",
+	}},
+	{ErrorClassTimeout, []string{
+		"timeout", "timed out", "deadline exceeded",
+	}},
+	{ErrorClassConnection, []string{
+		"connection refused", "connection reset", "no route to host", "network is unreachable",
+		"could not connect", "can't connect", "broken pipe", "unexpected eof", "no such host",
+		"temporary failure in name resolution", "could not translate host name", "server closed the connection",
+	}},
+}
+
+// classifyBackupError sorts a backup error into one of the ErrorClass values
+func classifyBackupError(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, group := range errorClassPatterns {
+		for _, pattern := range group.patterns {
+			if strings.Contains(message, pattern) {
+				return group.class
+			}
+		}
+	}
+	return ErrorClassOther
+}
+
+// attempts returns how often a run is attempted in total
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// retries reports whether errors of class are worth another attempt
+func (p RetryPolicy) retries(class string) bool {
+	retryOn := p.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = defaultRetryOn
+	}
+	for _, c := range retryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay after the given failed attempt, doubling with
+// every attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := time.Duration(p.BackoffSeconds) * time.Second
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
+
+func validateRetryPolicy(p RetryPolicy) error {
+	if p.MaxAttempts < 0 || p.MaxAttempts > maxRetryAttempts {
+		return fmt.Errorf("retry_policy.max_attempts must be between 0 and %d", maxRetryAttempts)
+	}
+	if p.BackoffSeconds < 0 {
+		return fmt.Errorf("retry_policy.backoff_seconds must not be negative")
+	}
+	for _, class := range p.RetryOn {
+		switch class {
+		case ErrorClassConnection, ErrorClassTimeout, ErrorClassAuth, ErrorClassOther:
+		default:
+			return fmt.Errorf("invalid retry_policy.retry_on class %q: must be %q, %q, %q or %q",
+				class, ErrorClassConnection, ErrorClassTimeout, ErrorClassAuth, ErrorClassOther)
+		}
+	}
+	return nil
+}
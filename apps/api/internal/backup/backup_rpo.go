@@ -0,0 +1,362 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// rpoCheckInterval is how often RPO policies are checked
+const rpoCheckInterval = time.Minute
+
+// maxRPOReportDays caps the window of an RPO report
+const maxRPOReportDays = 365
+
+// runRPOMonitor periodically checks the age of every monitored connection's
+// newest backup. It does not depend on the scheduler having fired, so a
+// stopped scheduler or a disabled schedule is noticed too.
+func (s *BackupService) runRPOMonitor() {
+	ticker := time.NewTicker(rpoCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Only the replica running schedules alerts, so alerts aren't duplicated
+		if s.scheduler.IsLeader() {
+			s.checkRPOPolicies()
+		}
+	}
+}
+
+func (s *BackupService) checkRPOPolicies() {
+	policies, err := s.backupRepo.GetEnabledRPOPolicies()
+	if err != nil {
+		fmt.Printf("Error fetching RPO policies: %v\n", err)
+		return
+	}
+
+	for _, policy := range policies {
+		if err := s.checkRPOPolicy(policy, time.Now()); err != nil {
+			fmt.Printf("Error checking RPO of connection %s: %v\n", policy.ConnectionID, err)
+		}
+	}
+}
+
+// checkRPOPolicy compares a connection's newest backup with its RPO and
+// alerts when the connection enters or leaves breach
+func (s *BackupService) checkRPOPolicy(policy *RPOPolicy, now time.Time) error {
+	lastBackup, err := s.backupRepo.GetLastSuccessfulBackupTime(policy.ConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get last backup time: %w", err)
+	}
+
+	breachedSince := rpoBreachedSince(policy, lastBackup)
+	breached := !breachedSince.After(now)
+	wasBreached := policy.Breached
+
+	policy.LastCheckedAt = &now
+	switch {
+	case breached && !wasBreached:
+		policy.Breached = true
+		policy.BreachedSince = &breachedSince
+		if err := s.backupRepo.CreateRPOBreach(&RPOBreach{
+			ID:           uuid.New(),
+			ConnectionID: policy.ConnectionID,
+			MaxAgeHours:  policy.MaxAgeHours,
+			StartedAt:    breachedSince,
+		}); err != nil {
+			return fmt.Errorf("failed to record RPO breach: %w", err)
+		}
+	case !breached && wasBreached:
+		// The breach ended when the backup that cleared it finished, or now if
+		// the policy was relaxed instead
+		endedAt := now
+		if lastBackup != nil && policy.BreachedSince != nil && lastBackup.After(*policy.BreachedSince) {
+			endedAt = *lastBackup
+		}
+		policy.Breached = false
+		policy.BreachedSince = nil
+		if err := s.backupRepo.EndRPOBreaches(policy.ConnectionID, endedAt); err != nil {
+			return fmt.Errorf("failed to close RPO breach: %w", err)
+		}
+	}
+
+	if err := s.backupRepo.UpdateRPOState(policy); err != nil {
+		return fmt.Errorf("failed to update RPO state: %w", err)
+	}
+
+	if breached != wasBreached {
+		if err := s.createRPONotification(policy, lastBackup, breached); err != nil {
+			fmt.Printf("Error creating RPO notification: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// rpoBreachedSince returns when a connection breaches (or breached) its RPO
+// given its newest backup. Connections without backups count from the
+// moment the policy was created.
+func rpoBreachedSince(policy *RPOPolicy, lastBackup *time.Time) time.Time {
+	maxAge := time.Duration(policy.MaxAgeHours) * time.Hour
+	if lastBackup == nil {
+		return policy.CreatedAt.Add(maxAge)
+	}
+	return lastBackup.Add(maxAge)
+}
+
+func (s *BackupService) createRPONotification(policy *RPOPolicy, lastBackup *time.Time, breached bool) error {
+	conn, err := s.connStorage.GetConnection(policy.ConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection details: %v", err)
+	}
+
+	lastBackupText := "never"
+	var lastBackupValue interface{}
+	if lastBackup != nil {
+		lastBackupText = lastBackup.Format(time.RFC3339)
+		lastBackupValue = lastBackupText
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id":    conn.ID,
+		"connection_name":  conn.Name,
+		"database_name":    conn.DatabaseName,
+		"database_type":    conn.Type,
+		"max_age_hours":    policy.MaxAgeHours,
+		"last_backup_time": lastBackupValue,
+		"timestamp":        time.Now().Format(time.RFC3339),
+	}
+
+	if breached {
+		metadata["event"] = string(notification.RPOBreached)
+		message := fmt.Sprintf("Connection '%s' has no successful backup newer than %d hours (last backup: %s)",
+			conn.Name, policy.MaxAgeHours, lastBackupText)
+		return s.notifyUser(conn.UserID, userAlert{
+			Type:         notification.RPOBreached,
+			Title:        "Backup RPO Breached",
+			Message:      message,
+			EmailSubject: "Velld - Backup RPO Breached",
+			EmailBody:    message,
+			Metadata:     metadata,
+		})
+	}
+
+	metadata["event"] = string(notification.RPORecovered)
+	message := fmt.Sprintf("Connection '%s' is within its %d hour RPO again (last backup: %s)",
+		conn.Name, policy.MaxAgeHours, lastBackupText)
+	return s.notifyUser(conn.UserID, userAlert{
+		Type:         notification.RPORecovered,
+		Title:        "Backup RPO Recovered",
+		Message:      message,
+		EmailSubject: "Velld - Backup RPO Recovered",
+		EmailBody:    message,
+		Metadata:     metadata,
+	})
+}
+
+func (s *BackupService) GetRPOPolicy(connectionID string) (*RPOPolicy, error) {
+	return s.backupRepo.GetRPOPolicy(connectionID)
+}
+
+func (s *BackupService) UpdateRPOPolicy(connectionID string, req *UpdateRPOPolicyRequest) (*RPOPolicy, error) {
+	if _, err := s.connStorage.GetConnection(connectionID); err != nil {
+		return nil, err
+	}
+
+	policy := &RPOPolicy{
+		ConnectionID: connectionID,
+		Enabled:      req.Enabled,
+		MaxAgeHours:  req.MaxAgeHours,
+	}
+
+	if err := s.backupRepo.SaveRPOPolicy(policy); err != nil {
+		return nil, fmt.Errorf("failed to save RPO policy: %v", err)
+	}
+
+	policy, err := s.backupRepo.GetRPOPolicy(connectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.Enabled {
+		// Apply the new maximum age right away instead of on the next check
+		if err := s.checkRPOPolicy(policy, time.Now()); err != nil {
+			return nil, err
+		}
+	} else if policy.Breached {
+		// A disabled policy is not monitored, so its open breach ends quietly
+		now := time.Now()
+		if err := s.backupRepo.EndRPOBreaches(connectionID, now); err != nil {
+			return nil, fmt.Errorf("failed to close RPO breach: %w", err)
+		}
+		policy.Breached = false
+		policy.BreachedSince = nil
+		policy.LastCheckedAt = &now
+		if err := s.backupRepo.UpdateRPOState(policy); err != nil {
+			return nil, fmt.Errorf("failed to update RPO state: %w", err)
+		}
+	}
+
+	return policy, nil
+}
+
+// GetRPOReport reports a connection's current RPO status and its compliance
+// over the last windowDays
+func (s *BackupService) GetRPOReport(connectionID string, windowDays int) (*RPOReport, error) {
+	if _, err := s.connStorage.GetConnection(connectionID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &RPOReport{
+		ConnectionID:      connectionID,
+		Status:            RPOStatusUnmonitored,
+		WindowDays:        windowDays,
+		WindowStart:       now.AddDate(0, 0, -windowDays),
+		CompliancePercent: 100,
+		Breaches:          []*RPOBreach{},
+	}
+
+	lastBackup, err := s.backupRepo.GetLastSuccessfulBackupTime(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last backup time: %w", err)
+	}
+	if lastBackup != nil {
+		report.LastBackupTime = lastBackup
+		age := now.Sub(*lastBackup).Hours()
+		report.BackupAgeHours = &age
+	}
+
+	policy, err := s.backupRepo.GetRPOPolicy(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if policy == nil {
+		return report, nil
+	}
+
+	report.MaxAgeHours = policy.MaxAgeHours
+	if policy.Enabled {
+		report.Status = RPOStatusCompliant
+		if breachedSince := rpoBreachedSince(policy, lastBackup); !breachedSince.After(now) {
+			report.Status = RPOStatusBreached
+			report.BreachedSince = &breachedSince
+		}
+	}
+
+	// Only time the connection was monitored counts towards compliance
+	monitoredFrom := report.WindowStart
+	if policy.CreatedAt.After(monitoredFrom) {
+		monitoredFrom = policy.CreatedAt
+	}
+
+	breaches, err := s.backupRepo.GetRPOBreaches(connectionID, report.WindowStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get RPO breaches: %w", err)
+	}
+	report.Breaches = breaches
+	report.BreachCount = len(breaches)
+
+	var breached time.Duration
+	for _, breach := range breaches {
+		start, end := breach.StartedAt, now
+		if breach.EndedAt != nil {
+			end = *breach.EndedAt
+		}
+		if start.Before(monitoredFrom) {
+			start = monitoredFrom
+		}
+		if end.After(start) {
+			breached += end.Sub(start)
+		}
+	}
+	report.BreachedHours = breached.Hours()
+
+	if monitored := now.Sub(monitoredFrom); monitored > 0 {
+		report.CompliancePercent = 100 * (1 - float64(breached)/float64(monitored))
+		if report.CompliancePercent < 0 {
+			report.CompliancePercent = 0
+		}
+	}
+
+	return report, nil
+}
+
+func (h *BackupHandler) GetRPOPolicy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	policy, err := h.backupService.GetRPOPolicy(connectionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "No RPO policy found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "RPO policy retrieved successfully", policy)
+}
+
+func (h *BackupHandler) UpdateRPOPolicy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	var req UpdateRPOPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.MaxAgeHours <= 0 {
+		response.SendError(w, http.StatusBadRequest, "max_age_hours must be greater than 0")
+		return
+	}
+
+	policy, err := h.backupService.UpdateRPOPolicy(connectionID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "RPO policy updated successfully", policy)
+}
+
+func (h *BackupHandler) GetRPOReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d <= 0 || d > maxRPOReportDays {
+			response.SendError(w, http.StatusBadRequest, fmt.Sprintf("days must be between 1 and %d", maxRPOReportDays))
+			return
+		}
+		days = d
+	}
+
+	report, err := h.backupService.GetRPOReport(connectionID, days)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "RPO report retrieved successfully", report)
+}
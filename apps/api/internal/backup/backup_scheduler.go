@@ -4,13 +4,56 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math/rand"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/dendianugerah/velld/internal/audit"
+	"github.com/dendianugerah/velld/internal/connection"
 	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
 )
 
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// parseCronSchedule parses a cron expression evaluated in the given IANA
+// timezone, or in the server's local zone when timezone is empty
+func parseCronSchedule(expr string, timezone string) (cron.Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "TZ=") || strings.HasPrefix(expr, "CRON_TZ=") {
+		return nil, fmt.Errorf("invalid cron schedule: use the timezone field instead of a TZ prefix")
+	}
+
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %v", timezone, err)
+		}
+		expr = fmt.Sprintf("CRON_TZ=%s %s", timezone, expr)
+	}
+
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron schedule: %v", err)
+	}
+	return schedule, nil
+}
+
+// nextRunTimes returns the next count fire times of a cron schedule after from
+func nextRunTimes(schedule cron.Schedule, from time.Time, count int) []time.Time {
+	runs := make([]time.Time, 0, count)
+	for len(runs) < count {
+		from = schedule.Next(from)
+		if from.IsZero() {
+			break
+		}
+		runs = append(runs, from)
+	}
+	return runs
+}
+
+// ScheduleBackup creates a schedule for a connection, or updates its most
+// recent schedule if one exists. Use CreateSchedule to add further schedules.
 func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
 	// Check if a schedule already exists for this connection
 	existingSchedule, err := s.backupRepo.GetBackupSchedule(req.ConnectionID)
@@ -18,10 +61,17 @@ func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
 		return fmt.Errorf("failed to check existing schedule: %v", err)
 	}
 
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(req.CronSchedule)
+	timezone := ""
+	if existingSchedule != nil {
+		timezone = existingSchedule.Timezone
+	}
+	if req.Timezone != nil {
+		timezone = strings.TrimSpace(*req.Timezone)
+	}
+
+	schedule, err := parseCronSchedule(req.CronSchedule, timezone)
 	if err != nil {
-		return fmt.Errorf("invalid cron schedule: %v", err)
+		return err
 	}
 
 	nextRun := schedule.Next(time.Now())
@@ -30,6 +80,7 @@ func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
 		// Update existing schedule
 		existingSchedule.Enabled = true
 		existingSchedule.CronSchedule = req.CronSchedule
+		existingSchedule.Timezone = timezone
 		existingSchedule.RetentionDays = req.RetentionDays
 		existingSchedule.NextRunTime = &nextRun
 		existingSchedule.UpdatedAt = time.Now()
@@ -38,20 +89,7 @@ func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
 			return fmt.Errorf("failed to update backup schedule: %v", err)
 		}
 
-		// Update cron job
-		scheduleID := existingSchedule.ID.String()
-		if oldEntryID, exists := s.cronEntries[scheduleID]; exists {
-			s.cronManager.Remove(oldEntryID)
-		}
-
-		entryID, err := s.cronManager.AddFunc(req.CronSchedule, func() {
-			s.executeCronBackup(existingSchedule)
-		})
-		if err != nil {
-			return fmt.Errorf("failed to schedule backup: %v", err)
-		}
-
-		s.cronEntries[scheduleID] = entryID
+		s.scheduler.Refresh()
 		return nil
 	}
 
@@ -61,7 +99,10 @@ func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
 		ConnectionID:  req.ConnectionID,
 		Enabled:       true,
 		CronSchedule:  req.CronSchedule,
+		Timezone:      timezone,
 		RetentionDays: req.RetentionDays,
+		MisfirePolicy: MisfireRunOnce,
+		Notifications: defaultNotificationRules,
 		NextRunTime:   &nextRun,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
@@ -71,19 +112,28 @@ func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
 		return fmt.Errorf("failed to save backup schedule: %v", err)
 	}
 
-	scheduleID := backupSchedule.ID.String()
-	entryID, err := s.cronManager.AddFunc(req.CronSchedule, func() {
-		s.executeCronBackup(backupSchedule)
-	})
+	s.scheduler.Refresh()
+	return nil
+}
+
+// fireSchedule runs a schedule for a fire time this replica has claimed. The
+// schedule is reloaded so changes saved on any replica apply.
+func (s *BackupService) fireSchedule(scheduleID string, fireTime time.Time) {
+	schedule, err := s.backupRepo.GetBackupScheduleByID(scheduleID)
 	if err != nil {
-		return fmt.Errorf("failed to schedule backup: %v", err)
+		if err != sql.ErrNoRows {
+			fmt.Printf("Error loading schedule %s: %v\n", scheduleID, err)
+		}
+		return
+	}
+	if !schedule.Enabled {
+		return
 	}
 
-	s.cronEntries[scheduleID] = entryID
-	return nil
+	s.executeCronBackup(schedule, fireTime)
 }
 
-func (s *BackupService) executeCronBackup(schedule *BackupSchedule) {
+func (s *BackupService) executeCronBackup(schedule *BackupSchedule, scheduledTime time.Time) {
 	// if schedule.CronSchedule == "0 */1 * * * *" {
 	// 	err := fmt.Errorf("test failure: this is a simulated backup failure for SMTP testing")
 	// 	if notifyErr := s.createFailureNotification(schedule.ConnectionID, err); notifyErr != nil {
@@ -92,55 +142,280 @@ func (s *BackupService) executeCronBackup(schedule *BackupSchedule) {
 	// 	return
 	// }
 
-	backup, err := s.CreateBackup(schedule.ConnectionID)
+	if s.holdForBlackout(schedule, scheduledTime) {
+		s.advanceSchedule(schedule)
+		if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+			fmt.Printf("Error updating backup schedule: %v\n", err)
+		}
+		return
+	}
+
+	s.runSchedule(schedule, RunTriggerSchedule, scheduledTime)
+	s.advanceSchedule(schedule)
+	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+		fmt.Printf("Error updating backup schedule: %v\n", err)
+	}
+}
+
+// maxCatchUpJitter bounds the random delay before a catch-up run so a restart
+// does not start every missed dump at the same instant
+const maxCatchUpJitter = 5 * time.Minute
+
+// handleMissedRun applies a schedule's misfire policy to a run missed while
+// the server was down
+func (s *BackupService) handleMissedRun(schedule *BackupSchedule, now time.Time) {
+	// Another replica may already have caught up on this run
+	if !s.scheduler.Claim(schedule.ID.String(), *schedule.NextRunTime) {
+		return
+	}
+
+	missedBy := now.Sub(*schedule.NextRunTime)
+
+	var reason string
+	switch schedule.MisfirePolicy {
+	case MisfireSkip:
+		reason = fmt.Sprintf("missed by %s, skipped by misfire policy", missedBy.Round(time.Second))
+	case MisfireRunIfWithin:
+		grace := time.Duration(schedule.MisfireGraceMinutes) * time.Minute
+		if missedBy >= grace {
+			reason = fmt.Sprintf("missed by %s, more than the %s grace period", missedBy.Round(time.Second), grace)
+		}
+	}
+
+	if reason != "" {
+		fmt.Printf("Schedule %s run skipped: %s\n", schedule.ID, reason)
+		s.recordScheduleRun(&ScheduleRun{
+			ScheduleID:    schedule.ID.String(),
+			ConnectionID:  schedule.ConnectionID,
+			TriggeredBy:   RunTriggerSchedule,
+			Status:        ScheduleRunSkipped,
+			Reason:        &reason,
+			ScheduledTime: *schedule.NextRunTime,
+		})
+		s.advanceSchedule(schedule)
+		if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+			fmt.Printf("Error updating backup schedule: %v\n", err)
+		}
+		return
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(maxCatchUpJitter)))
+	fmt.Printf("Schedule %s missed by %s, catching up in %s\n",
+		schedule.ID, missedBy.Round(time.Second), jitter.Round(time.Second))
+	s.deferScheduleRun(schedule, now.Add(jitter))
+}
+
+// startScheduleRun records a schedule run as running before it starts
+func (s *BackupService) startScheduleRun(schedule *BackupSchedule, trigger string, scheduledTime time.Time) *ScheduleRun {
+	startedAt := time.Now()
+	run := &ScheduleRun{
+		ScheduleID:    schedule.ID.String(),
+		ConnectionID:  schedule.ConnectionID,
+		TriggeredBy:   trigger,
+		BackupIDs:     []string{},
+		AttemptErrors: []string{},
+		Status:        ScheduleRunRunning,
+		ScheduledTime: scheduledTime,
+		StartedAt:     &startedAt,
+	}
+	s.recordScheduleRun(run)
+	return run
+}
+
+// runSchedule backs up a schedule's connection with the schedule's options,
+// records the outcome in the run history and applies its retention
+func (s *BackupService) runSchedule(schedule *BackupSchedule, trigger string, scheduledTime time.Time) *ScheduleRun {
+	return s.completeScheduleRun(schedule, s.startScheduleRun(schedule, trigger, scheduledTime))
+}
+
+func (s *BackupService) completeScheduleRun(schedule *BackupSchedule, run *ScheduleRun) *ScheduleRun {
+	scheduleID := schedule.ID.String()
+	backups, err := s.createBackupsWithRetry(schedule, run)
 	if err != nil {
-		if notifyErr := s.createFailureNotification(schedule.ConnectionID, err); notifyErr != nil {
-			fmt.Printf("Error creating failure notification: %v\n", notifyErr)
+		run.Status = ScheduleRunFailed
+		errMsg := err.Error()
+		run.Error = &errMsg
+		// Only notify once the retry policy gave up
+		if schedule.Notifications.OnFailure {
+			if notifyErr := s.createFailureNotification(schedule.ConnectionID, err); notifyErr != nil {
+				fmt.Printf("Error creating failure notification: %v\n", notifyErr)
+			}
 		}
 	} else {
-		scheduleIDStr := schedule.ID.String()
-		if err := s.backupRepo.UpdateBackupStatusAndSchedule(backup.ID.String(), backup.Status, scheduleIDStr); err != nil {
-			fmt.Printf("Error updating backup status and schedule: %v\n", err)
+		run.Status = ScheduleRunCompleted
+		for _, backup := range backups {
+			run.BackupIDs = append(run.BackupIDs, backup.ID.String())
+		}
+		now := time.Now()
+		schedule.LastBackupTime = &now
+		if schedule.Notifications.OnSuccess {
+			if notifyErr := s.createSuccessNotification(schedule.ConnectionID, backups); notifyErr != nil {
+				fmt.Printf("Error creating success notification: %v\n", notifyErr)
+			}
 		}
 	}
 
-	// Update schedule's next run time and last backup time
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	cronSchedule, _ := parser.Parse(schedule.CronSchedule)
-	nextRun := cronSchedule.Next(time.Now())
-	schedule.NextRunTime = &nextRun
-	now := time.Now()
-	schedule.LastBackupTime = &now
-	schedule.UpdatedAt = now
-
-	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
-		fmt.Printf("Error updating backup schedule: %v\n", err)
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	if err := s.backupRepo.FinishScheduleRun(run); err != nil {
+		fmt.Printf("Warning: Failed to record outcome of schedule %s run: %v\n", scheduleID, err)
 	}
 
 	if schedule.RetentionDays > 0 {
-		s.cleanupOldBackups(schedule.ConnectionID, schedule.RetentionDays)
+		s.cleanupOldBackups(schedule)
 	}
+
+	return run
 }
 
-func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int) {
-	cutoffTime := time.Now().AddDate(0, 0, -retentionDays)
-	oldBackups, err := s.backupRepo.GetBackupsOlderThan(connectionID, cutoffTime)
+// createBackupsWithRetry backs up a schedule's connection, retrying retryable
+// failures as its retry policy allows. Every attempt is recorded on the run and
+// the returned error lists the errors of all attempts.
+func (s *BackupService) createBackupsWithRetry(schedule *BackupSchedule, run *ScheduleRun) ([]*Backup, error) {
+	scheduleID := schedule.ID.String()
+	policy := schedule.RetryPolicy
+
+	for attempt := 1; ; attempt++ {
+		run.Attempts = attempt
+		backups, err := s.createBackups(schedule.ConnectionID, backupRunOptions{
+			RetentionDays: schedule.RetentionDays,
+			ScheduleID:    &scheduleID,
+			Options:       schedule.Options,
+			Destinations:  schedule.Destinations,
+		})
+		if err == nil {
+			return backups, nil
+		}
+
+		class := classifyBackupError(err)
+		run.AttemptErrors = append(run.AttemptErrors, fmt.Sprintf("attempt %d (%s): %v", attempt, class, err))
+
+		retry := attempt < policy.attempts() && policy.retries(class)
+		// A replica that lost the lease leaves the schedule to the new leader
+		if retry && run.TriggeredBy == RunTriggerSchedule && !s.scheduler.IsLeader() {
+			retry = false
+		}
+		if !retry {
+			if attempt == 1 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("backup failed after %d attempts: %s", attempt, strings.Join(run.AttemptErrors, "; "))
+		}
+
+		delay := policy.backoff(attempt)
+		fmt.Printf("Schedule %s attempt %d failed (%s error), retrying in %s: %v\n",
+			scheduleID, attempt, class, delay, err)
+		if err := s.backupRepo.FinishScheduleRun(run); err != nil {
+			fmt.Printf("Warning: Failed to record attempt of schedule %s run: %v\n", scheduleID, err)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// advanceSchedule moves a schedule's next run time past now
+func (s *BackupService) advanceSchedule(schedule *BackupSchedule) {
+	if cronSchedule, err := parseCronSchedule(schedule.CronSchedule, schedule.Timezone); err == nil {
+		nextRun := cronSchedule.Next(time.Now())
+		schedule.NextRunTime = &nextRun
+	}
+	schedule.UpdatedAt = time.Now()
+}
+
+// cleanupOldBackups removes backups of a schedule that are past its retention.
+// A connection with an enabled retention rule is pruned by that rule instead,
+// and the newest successful backup of each database is always kept.
+func (s *BackupService) cleanupOldBackups(schedule *BackupSchedule) {
+	connectionID := schedule.ConnectionID
+
+	rule, err := s.backupRepo.GetRetentionRule(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		fmt.Printf("Error fetching retention rule for cleanup: %v\n", err)
+		return
+	}
+	if rule != nil && rule.Enabled {
+		if _, err := s.applyRetentionRule(rule, false); err != nil {
+			fmt.Printf("Error applying retention rule for connection %s: %v\n", connectionID, err)
+		}
+		return
+	}
+
+	scheduleID := schedule.ID.String()
+	cutoffTime := time.Now().AddDate(0, 0, -schedule.RetentionDays)
+	oldBackups, err := s.backupRepo.GetBackupsOlderThan(connectionID, &scheduleID, cutoffTime)
 	if err != nil {
 		fmt.Printf("Error fetching old backups for cleanup: %v\n", err)
 		return
 	}
 
+	// Backups no schedule produced, such as manual ones, are kept as long as
+	// the connection's longest schedule retention
+	unscheduledDays, err := s.unscheduledRetentionDays(connectionID)
+	if err != nil {
+		fmt.Printf("Error fetching schedules for cleanup: %v\n", err)
+		return
+	}
+	if unscheduledDays > 0 {
+		unscheduled, err := s.backupRepo.GetBackupsOlderThan(connectionID, nil, time.Now().AddDate(0, 0, -unscheduledDays))
+		if err != nil {
+			fmt.Printf("Error fetching old backups for cleanup: %v\n", err)
+			return
+		}
+		oldBackups = append(oldBackups, unscheduled...)
+	}
+
 	if len(oldBackups) == 0 {
 		return
 	}
 
-	// Get connection to retrieve user settings for S3
+	latest, err := s.latestBackupIDs(connectionID)
+	if err != nil {
+		fmt.Printf("Error fetching latest backups for cleanup: %v\n", err)
+		return
+	}
+
 	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
 		fmt.Printf("Error getting connection for cleanup: %v\n", err)
 		return
 	}
 
+	// Move old backups to the trash; the purge job deletes them later
+	processed := 0
+	for _, backup := range oldBackups {
+		if latest[backup.ID] {
+			fmt.Printf("Keeping backup %s past retention: it is the latest successful backup\n", backup.ID)
+			continue
+		}
+		if err := s.trashBackup(backup, conn, TrashReasonRetention, audit.ActorSystem); err != nil {
+			fmt.Printf("Warning: Failed to move backup %s to trash: %v\n", backup.ID, err)
+			continue
+		}
+		processed++
+	}
+
+	fmt.Printf("Retention cleanup completed: processed %d old backups for connection %s\n",
+		processed, connectionID)
+}
+
+// unscheduledRetentionDays returns the longest retention of a connection's
+// enabled schedules, or 0 when none of them expires backups
+func (s *BackupService) unscheduledRetentionDays(connectionID string) (int, error) {
+	schedules, err := s.backupRepo.GetSchedulesByConnectionID(connectionID)
+	if err != nil {
+		return 0, err
+	}
+	days := 0
+	for _, schedule := range schedules {
+		if schedule.Enabled && schedule.RetentionDays > days {
+			days = schedule.RetentionDays
+		}
+	}
+	return days, nil
+}
+
+// cleanupS3Storage returns the S3 client used to delete remote copies of
+// pruned backups, or nil when S3 isn't configured
+func (s *BackupService) cleanupS3Storage(conn *connection.StoredConnection) *S3Storage {
 	// Get user settings to check if S3 is enabled
 	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
 	if err != nil {
@@ -148,141 +423,113 @@ func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int
 		// Continue with local cleanup even if we can't get S3 settings
 	}
 
-	// Initialize S3 client if S3 is enabled and configured
-	var s3Storage *S3Storage
-	if userSettings != nil && userSettings.S3Enabled && 
-	   userSettings.S3Endpoint != nil && *userSettings.S3Endpoint != "" &&
-	   userSettings.S3Bucket != nil && *userSettings.S3Bucket != "" &&
-	   userSettings.S3AccessKey != nil && *userSettings.S3AccessKey != "" &&
-	   userSettings.S3SecretKey != nil && *userSettings.S3SecretKey != "" {
-		
-		secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-		if err != nil {
-			fmt.Printf("Warning: Failed to decrypt S3 secret key for cleanup: %v\n", err)
-		} else {
-			region := "us-east-1"
-			if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-				region = *userSettings.S3Region
-			}
+	if !s3Configured(userSettings) {
+		return nil
+	}
 
-			pathPrefix := ""
-			if userSettings.S3PathPrefix != nil {
-				pathPrefix = *userSettings.S3PathPrefix
-			}
+	s3Storage, err := s.newS3StorageFromSettings(userSettings)
+	if err != nil {
+		fmt.Printf("Warning: Failed to create S3 storage client for cleanup: %v\n", err)
+		return nil
+	}
+	return s3Storage
+}
 
-			s3Config := S3Config{
-				Endpoint:   *userSettings.S3Endpoint,
-				Region:     region,
-				Bucket:     *userSettings.S3Bucket,
-				AccessKey:  *userSettings.S3AccessKey,
-				SecretKey:  secretKey,
-				UseSSL:     userSettings.S3UseSSL,
-				PathPrefix: pathPrefix,
-			}
+// deleteBackupArtifacts removes a backup's S3 object (when deleteRemote is set
+// and S3 is available), its local file and its database record. Objects under
+// object lock cannot be deleted before their retention expires, so such
+// backups are left untouched and false is returned to let a later run retry.
+func (s *BackupService) deleteBackupArtifacts(ctx context.Context, backup *Backup, s3Storage *S3Storage, deleteRemote bool, reason string) bool {
+	backupID := backup.ID.String()
 
-			s3Storage, err = NewS3Storage(s3Config)
-			if err != nil {
-				fmt.Printf("Warning: Failed to create S3 storage client for cleanup: %v\n", err)
-				s3Storage = nil
-			}
-		}
-	}
+	if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" && s3Storage != nil && deleteRemote {
+		storage := s3Storage.WithBucket(backup.s3BucketName())
 
-	// Clean up old backups
-	ctx := context.Background()
-	for _, backup := range oldBackups {
-		backupID := backup.ID.String()
-		
-		// Delete from S3 if object key exists, S3 is configured, and connection has S3 cleanup enabled
-		if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" && s3Storage != nil && conn.S3CleanupOnRetention {
-			if err := s3Storage.DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
-				fmt.Printf("Warning: Failed to delete S3 object %s for backup %s: %v\n", 
-					*backup.S3ObjectKey, backupID, err)
-			} else {
-				fmt.Printf("Deleted S3 object %s for backup %s (retention cleanup)\n", 
-					*backup.S3ObjectKey, backupID)
-			}
+		retainUntil, err := storage.GetRetainUntil(ctx, *backup.S3ObjectKey)
+		if err != nil {
+			fmt.Printf("Warning: Failed to check object lock for S3 object %s: %v\n", *backup.S3ObjectKey, err)
+		} else if retainUntil.After(time.Now()) {
+			fmt.Printf("Skipping backup %s: S3 object %s is locked until %s\n",
+				backupID, *backup.S3ObjectKey, retainUntil.Format(time.RFC3339))
+			return false
 		}
 
-		// Delete local file if it exists
-		if _, err := os.Stat(backup.Path); err == nil {
-			if err := os.Remove(backup.Path); err != nil {
-				fmt.Printf("Warning: Failed to delete local file %s for backup %s: %v\n", 
-					backup.Path, backupID, err)
-			} else {
-				fmt.Printf("Deleted local file %s for backup %s (retention cleanup)\n", 
-					backup.Path, backupID)
-			}
+		if err := storage.DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
+			fmt.Printf("Warning: Failed to delete S3 object %s for backup %s: %v\n",
+				*backup.S3ObjectKey, backupID, err)
+		} else {
+			fmt.Printf("Deleted S3 object %s for backup %s (%s)\n",
+				*backup.S3ObjectKey, backupID, reason)
 		}
+	}
 
-		// Delete backup record from database
-		if err := s.backupRepo.DeleteBackup(backupID); err != nil {
-			fmt.Printf("Error deleting backup record %s: %v\n", backupID, err)
+	// Delete local file if it exists
+	if _, err := os.Stat(backup.Path); err == nil {
+		if err := os.Remove(backup.Path); err != nil {
+			fmt.Printf("Warning: Failed to delete local file %s for backup %s: %v\n",
+				backup.Path, backupID, err)
 		} else {
-			fmt.Printf("Deleted backup record %s (retention cleanup)\n", backupID)
+			fmt.Printf("Deleted local file %s for backup %s (%s)\n",
+				backup.Path, backupID, reason)
 		}
 	}
 
-	fmt.Printf("Retention cleanup completed: processed %d old backups for connection %s\n", 
-		len(oldBackups), connectionID)
+	// Delete backup record from database
+	if err := s.backupRepo.DeleteBackup(backupID); err != nil {
+		fmt.Printf("Error deleting backup record %s: %v\n", backupID, err)
+		return false
+	}
+
+	fmt.Printf("Deleted backup record %s (%s)\n", backupID, reason)
+	return true
 }
 
+// DisableBackupSchedule disables the most recent schedule of a connection
 func (s *BackupService) DisableBackupSchedule(connectionID string) error {
 	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
 	if err != nil {
 		return err
 	}
 
-	scheduleID := schedule.ID.String()
-	if entryID, exists := s.cronEntries[scheduleID]; exists {
-		s.cronManager.Remove(entryID)
-		delete(s.cronEntries, scheduleID)
-	}
-
 	schedule.Enabled = false
 	schedule.UpdatedAt = time.Now()
 	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
 		return err
 	}
 
+	s.cancelDeferredRun(schedule.ID.String())
+	s.scheduler.Refresh()
 	return nil
 }
 
+// UpdateBackupSchedule updates the most recent schedule of a connection
 func (s *BackupService) UpdateBackupSchedule(connectionID string, req *UpdateScheduleRequest) error {
 	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
 	if err != nil {
 		return err
 	}
 
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	_, err = parser.Parse(req.CronSchedule)
-	if err != nil {
-		return fmt.Errorf("invalid cron schedule: %v", err)
+	// Clients that predate timezones don't send one, keep the stored zone
+	if req.Timezone != nil {
+		schedule.Timezone = strings.TrimSpace(*req.Timezone)
 	}
 
-	schedule.CronSchedule = req.CronSchedule
-	schedule.RetentionDays = req.RetentionDays
-	err = s.backupRepo.UpdateBackupSchedule(schedule)
+	cronSchedule, err := parseCronSchedule(req.CronSchedule, schedule.Timezone)
 	if err != nil {
 		return err
 	}
 
-	// Remove old cron job
-	if entryID, ok := s.cronEntries[schedule.ID.String()]; ok {
-		s.cronManager.Remove(entryID)
-		delete(s.cronEntries, schedule.ID.String())
+	schedule.CronSchedule = req.CronSchedule
+	schedule.RetentionDays = req.RetentionDays
+	if schedule.Enabled {
+		nextRun := cronSchedule.Next(time.Now())
+		schedule.NextRunTime = &nextRun
 	}
-
-	// Add new cron job
-	entryID, err := s.cronManager.AddFunc(schedule.CronSchedule, func() {
-		s.executeCronBackup(schedule)
-	})
+	err = s.backupRepo.UpdateBackupSchedule(schedule)
 	if err != nil {
-		return fmt.Errorf("failed to register cron job: %v", err)
+		return err
 	}
 
-	// Store the new entry ID
-	s.cronEntries[schedule.ID.String()] = entryID
-
+	s.scheduler.Refresh()
 	return nil
 }
@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	winter := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	summer := time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		expr     string
+		timezone string
+		from     time.Time
+		want     time.Time
+		wantErr  string
+	}{
+		{
+			name:     "utc",
+			expr:     "0 0 2 * * *",
+			timezone: "UTC",
+			from:     winter,
+			want:     time.Date(2024, 1, 16, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "standard time",
+			expr:     "0 0 2 * * *",
+			timezone: "America/New_York",
+			from:     winter,
+			want:     time.Date(2024, 1, 16, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daylight saving time",
+			expr:     "0 0 2 * * *",
+			timezone: "America/New_York",
+			from:     summer,
+			want:     time.Date(2024, 7, 16, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "zone ahead of utc",
+			expr:     "0 30 1 * * *",
+			timezone: "Asia/Kolkata",
+			from:     winter,
+			want:     time.Date(2024, 1, 15, 20, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "surrounding whitespace",
+			expr:     "  0 0 * * * *  ",
+			timezone: "UTC",
+			from:     winter,
+			want:     time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "CRON_TZ prefix",
+			expr:    "CRON_TZ=Europe/Berlin 0 0 2 * * *",
+			wantErr: "use the timezone field",
+		},
+		{
+			name:    "TZ prefix",
+			expr:    "TZ=Europe/Berlin 0 0 2 * * *",
+			wantErr: "use the timezone field",
+		},
+		{
+			name:     "unknown timezone",
+			expr:     "0 0 2 * * *",
+			timezone: "Mars/Olympus_Mons",
+			wantErr:  "invalid timezone",
+		},
+		{
+			name:    "invalid expression",
+			expr:    "every night",
+			wantErr: "invalid cron schedule",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCronSchedule(tt.expr, tt.timezone)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseCronSchedule(%q, %q) error = %v, want %q", tt.expr, tt.timezone, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCronSchedule(%q, %q): %v", tt.expr, tt.timezone, err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("next run = %s, want %s", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronScheduleServerZone(t *testing.T) {
+	schedule, err := parseCronSchedule("0 0 2 * * *", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2024, 1, 15, 12, 0, 0, 0, time.Local)
+	want := time.Date(2024, 1, 16, 2, 0, 0, 0, time.Local)
+	if got := schedule.Next(from); !got.Equal(want) {
+		t.Errorf("next run = %s, want %s in the server's zone", got, want)
+	}
+}
+
+func TestNextRunTimes(t *testing.T) {
+	schedule, err := parseCronSchedule("0 0 */6 * * *", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2024, 1, 15, 5, 0, 0, 0, time.UTC)
+	got := nextRunTimes(schedule, from, 3)
+	want := []time.Time{
+		time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 15, 18, 0, 0, 0, time.UTC),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("nextRunTimes returned %d runs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("run %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestServerTimezoneName(t *testing.T) {
+	tests := []struct {
+		tz   string
+		want string
+	}{
+		{tz: "Europe/Berlin", want: "Europe/Berlin"},
+		{tz: ":America/New_York", want: "America/New_York"},
+		{tz: "", want: "UTC"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TZ", tt.tz)
+		if got := serverTimezoneName(); got != tt.want {
+			t.Errorf("serverTimezoneName() with TZ=%q = %q, want %q", tt.tz, got, tt.want)
+		}
+	}
+}
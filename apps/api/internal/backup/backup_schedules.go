@@ -0,0 +1,472 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func (s *BackupService) ListSchedules(userID uuid.UUID, connectionID string) ([]*BackupSchedule, error) {
+	if connectionID != "" {
+		return s.backupRepo.GetSchedulesByConnectionID(connectionID)
+	}
+	return s.backupRepo.GetSchedulesByUserID(userID)
+}
+
+func (s *BackupService) GetSchedule(id string) (*BackupSchedule, error) {
+	return s.backupRepo.GetBackupScheduleByID(id)
+}
+
+func (s *BackupService) CreateSchedule(req *ScheduleRequest) (*BackupSchedule, error) {
+	if _, err := s.connStorage.GetConnection(req.ConnectionID); err != nil {
+		return nil, err
+	}
+
+	schedule := &BackupSchedule{
+		ID:           uuid.New(),
+		ConnectionID: req.ConnectionID,
+		Enabled:      true,
+		CreatedAt:    time.Now(),
+	}
+	applyScheduleRequest(schedule, req)
+
+	if err := s.refreshNextRunTime(schedule); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.CreateBackupSchedule(schedule); err != nil {
+		return nil, fmt.Errorf("failed to save backup schedule: %v", err)
+	}
+
+	s.scheduler.Refresh()
+	return schedule, nil
+}
+
+func (s *BackupService) UpdateSchedule(id string, req *ScheduleRequest) (*BackupSchedule, error) {
+	schedule, err := s.backupRepo.GetBackupScheduleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.PolicyID != nil {
+		return nil, errScheduleManagedByPolicy
+	}
+
+	applyScheduleRequest(schedule, req)
+
+	if err := s.refreshNextRunTime(schedule); err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	if !schedule.Enabled {
+		s.cancelDeferredRun(id)
+	}
+	s.scheduler.Refresh()
+	return schedule, nil
+}
+
+func (s *BackupService) DeleteSchedule(id string) error {
+	schedule, err := s.backupRepo.GetBackupScheduleByID(id)
+	if err != nil {
+		return err
+	}
+	if schedule.PolicyID != nil {
+		return errScheduleManagedByPolicy
+	}
+
+	if err := s.backupRepo.DeleteBackupSchedule(id); err != nil {
+		return err
+	}
+
+	s.scheduler.Refresh()
+	return nil
+}
+
+// RunScheduleNow starts an out-of-band run of a schedule with its own options
+// and retention. The run is recorded right away and completes in the background.
+func (s *BackupService) RunScheduleNow(id string) (*ScheduleRun, error) {
+	schedule, err := s.backupRepo.GetBackupScheduleByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	run := s.startScheduleRun(schedule, RunTriggerManual, time.Now())
+	started := *run
+
+	go func() {
+		s.completeScheduleRun(schedule, run)
+		if schedule.LastBackupTime == nil {
+			return
+		}
+
+		// Reload so a cron run finishing meanwhile isn't overwritten
+		current, err := s.backupRepo.GetBackupScheduleByID(id)
+		if err != nil {
+			fmt.Printf("Warning: Failed to reload schedule %s: %v\n", id, err)
+			return
+		}
+		current.LastBackupTime = schedule.LastBackupTime
+		if err := s.backupRepo.UpdateBackupSchedule(current); err != nil {
+			fmt.Printf("Error updating backup schedule: %v\n", err)
+		}
+	}()
+
+	return &started, nil
+}
+
+func (s *BackupService) ListScheduleRuns(id string, limit, offset int) ([]*ScheduleRun, int, error) {
+	if _, err := s.backupRepo.GetBackupScheduleByID(id); err != nil {
+		return nil, 0, err
+	}
+	return s.backupRepo.GetScheduleRuns(id, limit, offset)
+}
+
+func applyScheduleRequest(schedule *BackupSchedule, req *ScheduleRequest) {
+	schedule.Name = strings.TrimSpace(req.Name)
+	schedule.CronSchedule = req.CronSchedule
+	schedule.Timezone = strings.TrimSpace(req.Timezone)
+	schedule.RetentionDays = req.RetentionDays
+	schedule.Options = req.Options
+	schedule.Destinations = req.Destinations
+	schedule.RetryPolicy = req.RetryPolicy
+	schedule.MisfirePolicy = misfirePolicyOrDefault(req.MisfirePolicy)
+	schedule.MisfireGraceMinutes = req.MisfireGraceMinutes
+	schedule.Notifications = defaultNotificationRules
+	if req.Notifications != nil {
+		schedule.Notifications = *req.Notifications
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	schedule.UpdatedAt = time.Now()
+}
+
+// refreshNextRunTime recomputes when an enabled schedule runs next
+func (s *BackupService) refreshNextRunTime(schedule *BackupSchedule) error {
+	cronSchedule, err := parseCronSchedule(schedule.CronSchedule, schedule.Timezone)
+	if err != nil {
+		return err
+	}
+
+	if !schedule.Enabled {
+		schedule.NextRunTime = nil
+		return nil
+	}
+
+	nextRun := cronSchedule.Next(time.Now())
+	schedule.NextRunTime = &nextRun
+	return nil
+}
+
+// maxPreviewRuns caps how many fire times a preview returns
+const maxPreviewRuns = 50
+
+// PreviewSchedule validates a cron expression and returns its next count runs
+// in the given timezone and in UTC
+func (s *BackupService) PreviewSchedule(expr string, timezone string, count int) (*SchedulePreview, error) {
+	cronSchedule, err := parseCronSchedule(expr, timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	location, zoneName := time.Local, serverTimezoneName()
+	if timezone != "" {
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, err
+		}
+		zoneName = location.String()
+	}
+
+	preview := &SchedulePreview{
+		CronSchedule: expr,
+		Timezone:     zoneName,
+		NextRuns:     make([]ScheduleRunTime, 0, count),
+	}
+
+	for _, run := range nextRunTimes(cronSchedule, time.Now(), count) {
+		preview.NextRuns = append(preview.NextRuns, ScheduleRunTime{Local: run.In(location), UTC: run.UTC()})
+	}
+
+	return preview, nil
+}
+
+// serverTimezoneName returns the name of the zone schedules without a
+// timezone run in, which time.Local only calls "Local"
+func serverTimezoneName() string {
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		if tz = strings.TrimPrefix(tz, ":"); tz != "" {
+			return tz
+		}
+		return "UTC"
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return name
+		}
+	}
+	name, _ := time.Now().Zone()
+	return name
+}
+
+func validateScheduleRequest(req *ScheduleRequest) error {
+	if req.CronSchedule == "" {
+		return fmt.Errorf("cron_schedule is required")
+	}
+	if _, err := parseCronSchedule(req.CronSchedule, strings.TrimSpace(req.Timezone)); err != nil {
+		return err
+	}
+	if req.RetentionDays <= 0 {
+		return fmt.Errorf("retention_days must be greater than 0")
+	}
+	for _, destination := range req.Destinations {
+		if destination != DestinationLocal && destination != DestinationS3 {
+			return fmt.Errorf("invalid destination %q: must be %q or %q", destination, DestinationLocal, DestinationS3)
+		}
+	}
+	if err := validateCompression(req.Options.Compression); err != nil {
+		return err
+	}
+	if err := validateRetryPolicy(req.RetryPolicy); err != nil {
+		return err
+	}
+	switch misfirePolicyOrDefault(req.MisfirePolicy) {
+	case MisfireRunOnce, MisfireSkip:
+	case MisfireRunIfWithin:
+		if req.MisfireGraceMinutes <= 0 {
+			return fmt.Errorf("misfire_grace_minutes must be greater than 0 for the %q policy", MisfireRunIfWithin)
+		}
+	default:
+		return fmt.Errorf("invalid misfire_policy %q: must be %q, %q or %q",
+			req.MisfirePolicy, MisfireRunOnce, MisfireSkip, MisfireRunIfWithin)
+	}
+	if req.MisfireGraceMinutes < 0 {
+		return fmt.Errorf("misfire_grace_minutes must not be negative")
+	}
+	for _, database := range req.Options.Databases {
+		if strings.TrimSpace(database) == "" {
+			return fmt.Errorf("options.databases must not contain empty names")
+		}
+	}
+	return nil
+}
+
+func (h *BackupHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	schedules, err := h.backupService.ListSchedules(userID, r.URL.Query().Get("connection_id"))
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedules retrieved successfully", schedules)
+}
+
+func (h *BackupHandler) PreviewSchedule(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	expr := query.Get("cron_schedule")
+	timezone := strings.TrimSpace(query.Get("timezone"))
+
+	// Preview an existing schedule when no expression is given
+	if scheduleID := query.Get("schedule_id"); scheduleID != "" && expr == "" {
+		schedule, err := h.backupService.GetSchedule(scheduleID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				response.SendError(w, http.StatusNotFound, "Schedule not found")
+				return
+			}
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		expr = schedule.CronSchedule
+		if timezone == "" {
+			timezone = schedule.Timezone
+		}
+	}
+
+	if expr == "" {
+		response.SendError(w, http.StatusBadRequest, "cron_schedule is required")
+		return
+	}
+
+	count := 5
+	if countStr := query.Get("count"); countStr != "" {
+		n, err := strconv.Atoi(countStr)
+		if err != nil || n <= 0 || n > maxPreviewRuns {
+			response.SendError(w, http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", maxPreviewRuns))
+			return
+		}
+		count = n
+	}
+
+	preview, err := h.backupService.PreviewSchedule(expr, timezone, count)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Schedule preview generated successfully", preview)
+}
+
+func (h *BackupHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	schedule, err := h.backupService.GetSchedule(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule retrieved successfully", schedule)
+}
+
+func (h *BackupHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ConnectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+	if err := validateScheduleRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	schedule, err := h.backupService.CreateSchedule(&req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule created successfully", schedule)
+}
+
+func (h *BackupHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateScheduleRequest(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	schedule, err := h.backupService.UpdateSchedule(id, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		if err == errScheduleManagedByPolicy {
+			response.SendError(w, http.StatusConflict, err.Error())
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule updated successfully", schedule)
+}
+
+func (h *BackupHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := h.backupService.DeleteSchedule(id); err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		if err == errScheduleManagedByPolicy {
+			response.SendError(w, http.StatusConflict, err.Error())
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule deleted successfully", nil)
+}
+
+func (h *BackupHandler) RunSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	run, err := h.backupService.RunScheduleNow(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Schedule run started successfully", run)
+}
+
+func (h *BackupHandler) ListScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	page := 1
+	limit := 10
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	runs, total, err := h.backupService.ListScheduleRuns(id, limit, (page-1)*limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendPaginatedSuccess(w, "Schedule runs retrieved successfully", runs, page, limit, total)
+}
@@ -4,28 +4,31 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/dendianugerah/velld/internal/audit"
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/connection"
 	"github.com/dendianugerah/velld/internal/notification"
 	"github.com/dendianugerah/velld/internal/settings"
 	"github.com/google/uuid"
-	"github.com/robfig/cron/v3"
+	"github.com/minio/minio-go/v7"
 )
 
 type BackupService struct {
 	connStorage      *connection.ConnectionRepository
 	backupDir        string
 	backupRepo       *BackupRepository
-	cronManager      *cron.Cron
-	cronEntries      map[string]cron.EntryID // map[scheduleID]entryID
+	scheduler        *Scheduler
 	settingsService  *settings.SettingsService
 	notificationRepo *notification.NotificationRepository
 	cryptoService    *common.EncryptionService
+	downloadCache    *DownloadCache
+	auditService     *audit.AuditService
+
+	restoreSlots chan struct{} // bounds the restores running on this replica
 }
 
 func NewBackupService(
@@ -35,12 +38,13 @@ func NewBackupService(
 	settingsService *settings.SettingsService,
 	notificationRepo *notification.NotificationRepository,
 	cryptoService *common.EncryptionService,
+	downloadCache *DownloadCache,
+	auditService *audit.AuditService,
 ) *BackupService {
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		panic(err)
 	}
 
-	cronManager := cron.New(cron.WithSeconds())
 	service := &BackupService{
 		connStorage:      connStorage,
 		backupDir:        backupDir,
@@ -48,67 +52,126 @@ func NewBackupService(
 		settingsService:  settingsService,
 		notificationRepo: notificationRepo,
 		cryptoService:    cryptoService,
-		cronManager:      cronManager,
-		cronEntries:      make(map[string]cron.EntryID),
-	}
-
-	// Recover existing schedules before starting the cron manager
-	if err := service.recoverSchedules(); err != nil {
-		fmt.Printf("Error recovering schedules: %v\n", err)
-	}
-
-	cronManager.Start()
+		downloadCache:    downloadCache,
+		auditService:     auditService,
+		restoreSlots:     make(chan struct{}, maxConcurrentRestores),
+	}
+
+	service.scheduler = NewScheduler(backupRepo, service.fireSchedule, service.recoverMissedRuns)
+	service.scheduler.Start()
+	go service.runLifecycleWorker()
+	go service.runRPOMonitor()
+	go service.runTrashPurger()
+	go service.runRetentionEnforcer()
+	go service.runRestoreJobReaper()
+	go service.runRefreshScheduler()
 	return service
 }
 
-func (s *BackupService) recoverSchedules() error {
+// recoverMissedRuns applies the misfire policy of schedules whose next run
+// passed while no replica was running them
+func (s *BackupService) recoverMissedRuns() {
 	schedules, err := s.backupRepo.GetAllActiveSchedules()
 	if err != nil {
-		return fmt.Errorf("failed to get active schedules: %v", err)
+		fmt.Printf("Error recovering schedules: failed to get active schedules: %v\n", err)
+		return
 	}
 
 	now := time.Now()
 	for _, schedule := range schedules {
-		scheduleID := schedule.ID.String()
-
 		// Check if we missed any backups
 		if schedule.NextRunTime != nil && schedule.NextRunTime.Before(now) {
-			// Execute a backup immediately for missed schedule
-			go s.executeCronBackup(schedule)
+			s.handleMissedRun(schedule, now)
 		}
+	}
+}
 
-		// Re-register the cron job
-		entryID, err := s.cronManager.AddFunc(schedule.CronSchedule, func() {
-			s.executeCronBackup(schedule)
-		})
-		if err != nil {
-			fmt.Printf("Error re-registering schedule %s: %v\n", scheduleID, err)
-			continue
+// backupRunOptions carries per-run settings from the caller (e.g. a schedule)
+// into the backup pipeline
+type backupRunOptions struct {
+	// RetentionDays is used to compute the S3 object lock retain-until date
+	RetentionDays int
+	// ScheduleID is recorded on the backups of scheduled runs
+	ScheduleID *string
+	// Options controls what is dumped
+	Options BackupOptions
+	// Destinations overrides where the backup is stored, see DestinationLocal
+	Destinations []string
+}
+
+// hasDestination reports whether a run explicitly targets the destination
+func (o backupRunOptions) hasDestination(destination string) bool {
+	for _, d := range o.Destinations {
+		if d == destination {
+			return true
 		}
+	}
+	return false
+}
 
-		s.cronEntries[scheduleID] = entryID
+// retainUntil returns when a backup started at startedAt may be deleted, or
+// the zero time if the run has no retention
+func (o backupRunOptions) retainUntil(startedAt time.Time) time.Time {
+	if o.RetentionDays <= 0 {
+		return time.Time{}
 	}
+	return startedAt.AddDate(0, 0, o.RetentionDays)
+}
 
-	return nil
+// objectRetainUntil returns until when a backup's S3 object is locked. Backups
+// of runs without a retention of their own, such as manual backups and
+// imports, are locked as long as cleanup keeps unscheduled backups.
+func (s *BackupService) objectRetainUntil(backup *Backup, opts backupRunOptions) (time.Time, error) {
+	if opts.RetentionDays <= 0 && opts.ScheduleID == nil {
+		days, err := s.unscheduledRetentionDays(backup.ConnectionID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		opts.RetentionDays = days
+	}
+	// Imported backups may be older than their retention already
+	retainUntil := opts.retainUntil(backup.StartedTime)
+	if !retainUntil.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	return retainUntil, nil
 }
 
 func (s *BackupService) CreateBackup(connectionID string) (*Backup, error) {
+	backups, err := s.createBackups(connectionID, backupRunOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return backups[0], nil
+}
+
+// createBackups backs up a connection, returning one backup per database
+func (s *BackupService) createBackups(connectionID string, opts backupRunOptions) ([]*Backup, error) {
 	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get connection: %v", err)
 	}
 
+	// Schedules can pick their own set of databases
+	if len(opts.Options.Databases) > 0 {
+		conn.SelectedDatabases = opts.Options.Databases
+	}
+
 	// Check if multi-database backup is needed
 	if len(conn.SelectedDatabases) > 0 {
 		// Create backups for all selected databases
-		return s.createMultiDatabaseBackup(conn)
+		return s.createMultiDatabaseBackup(conn, opts)
 	}
 
 	// Single database backup
-	return s.createSingleDatabaseBackup(conn, conn.DatabaseName)
+	backup, err := s.createSingleDatabaseBackup(conn, conn.DatabaseName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []*Backup{backup}, nil
 }
 
-func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnection) (*Backup, error) {
+func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnection, opts backupRunOptions) ([]*Backup, error) {
 	if err := s.verifyBackupTools(conn.Type); err != nil {
 		return nil, err
 	}
@@ -123,42 +186,40 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 		conn.Port = effectivePort
 	}
 
-	connectionFolder := filepath.Join(s.backupDir, common.SanitizeConnectionName(conn.Name))
-	if err := os.MkdirAll(connectionFolder, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create connection backup folder: %v", err)
-	}
-
-	timestamp := time.Now().Format("20060102_150405")
 	startTime := time.Now()
 
 	var failedDatabases []string
+	var failures []string
 	var successfulBackups []*Backup
 
 	for _, dbName := range conn.SelectedDatabases {
-		backupID := uuid.New()
-		filename := fmt.Sprintf("%s_%s.sql", dbName, timestamp)
-		backupPath := filepath.Join(connectionFolder, filename)
+		backup := &Backup{
+			ID:           uuid.New(),
+			ConnectionID: conn.ID,
+			ScheduleID:   opts.ScheduleID,
+			DatabaseName: dbName,
+			StartedTime:  startTime,
+			StorageTier:  StorageTierLocal,
+			Compression:  opts.Options.Compression,
+		}
+
+		backupPath, err := s.prepareBackupPath(conn, backup)
+		if err != nil {
+			return nil, err
+		}
 
 		tempConn := *conn
 		tempConn.DatabaseName = dbName
 
-		var cmd *exec.Cmd
-		switch conn.Type {
-		case "postgresql":
-			cmd = s.createPgDumpCmd(&tempConn, backupPath)
-		case "mysql", "mariadb":
-			cmd = s.createMySQLDumpCmd(&tempConn, backupPath)
-		case "mongodb":
-			cmd = s.createMongoDumpCmd(&tempConn, backupPath)
-		case "redis":
-			cmd = s.createRedisDumpCmd(&tempConn, backupPath)
-		default:
-			return nil, fmt.Errorf("unsupported database type for backup: %s", conn.Type)
+		cmd, err := s.createDumpCmd(&tempConn, dumpPath(backupPath, backup.Compression), opts.Options)
+		if err != nil {
+			return nil, err
 		}
 
 		if cmd == nil {
 			fmt.Printf("Warning: backup tool not found for database '%s'\n", dbName)
 			failedDatabases = append(failedDatabases, dbName)
+			failures = append(failures, fmt.Sprintf("%s: backup tool not found", dbName))
 			continue
 		}
 
@@ -166,6 +227,18 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 		if err != nil {
 			fmt.Printf("Warning: Failed to backup database '%s': %s\n", dbName, string(output))
 			failedDatabases = append(failedDatabases, dbName)
+			errorMsg := strings.TrimSpace(string(output))
+			if errorMsg == "" {
+				errorMsg = err.Error()
+			}
+			failures = append(failures, fmt.Sprintf("%s: %s", dbName, errorMsg))
+			continue
+		}
+
+		if err := compressBackupFile(dumpPath(backupPath, backup.Compression), backupPath, backup.Compression); err != nil {
+			fmt.Printf("Warning: Failed to compress backup of database '%s': %v\n", dbName, err)
+			failedDatabases = append(failedDatabases, dbName)
+			failures = append(failures, fmt.Sprintf("%s: %v", dbName, err))
 			continue
 		}
 
@@ -173,30 +246,27 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 		if err != nil {
 			fmt.Printf("Warning: Failed to get file info for database '%s': %v\n", dbName, err)
 			failedDatabases = append(failedDatabases, dbName)
+			failures = append(failures, fmt.Sprintf("%s: %v", dbName, err))
 			continue
 		}
 
-		backup := &Backup{
-			ID:           backupID,
-			ConnectionID: conn.ID,
-			StartedTime:  startTime,
-			Status:       "completed",
-			Path:         backupPath,
-			Size:         fileInfo.Size(),
-			CreatedAt:    time.Now(),
-			UpdatedAt:    time.Now(),
-		}
+		backup.Status = "completed"
+		backup.Size = fileInfo.Size()
+		backup.Checksum = backupChecksum(backupPath)
+		backup.CreatedAt = time.Now()
+		backup.UpdatedAt = time.Now()
 
 		now := time.Now()
 		backup.CompletedTime = &now
 
-		if err := s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name); err != nil {
+		if err := s.uploadToS3IfEnabled(backup, conn, opts); err != nil {
 			fmt.Printf("Warning: Failed to upload backup '%s' to S3: %v\n", dbName, err)
 		}
 
 		if err := s.backupRepo.CreateBackup(backup); err != nil {
 			fmt.Printf("Warning: Failed to save backup record for '%s': %v\n", dbName, err)
 			failedDatabases = append(failedDatabases, dbName)
+			failures = append(failures, fmt.Sprintf("%s: %v", dbName, err))
 			continue
 		}
 
@@ -204,8 +274,8 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 	}
 
 	if len(successfulBackups) == 0 {
-		if len(failedDatabases) > 0 {
-			return nil, fmt.Errorf("all database backups failed: %v", failedDatabases)
+		if len(failures) > 0 {
+			return nil, fmt.Errorf("all database backups failed: %s", strings.Join(failures, "; "))
 		}
 		return nil, fmt.Errorf("all database backups failed")
 	}
@@ -218,10 +288,10 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 			len(successfulBackups), len(conn.SelectedDatabases))
 	}
 
-	return successfulBackups[0], nil
+	return successfulBackups, nil
 }
 
-func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnection, dbName string) (*Backup, error) {
+func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnection, dbName string, opts backupRunOptions) (*Backup, error) {
 	if err := s.verifyBackupTools(conn.Type); err != nil {
 		return nil, err
 	}
@@ -238,39 +308,27 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 		conn.Port = effectivePort
 	}
 
-	backupID := uuid.New()
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("%s_%s.sql", dbName, timestamp)
-
-	connectionFolder := filepath.Join(s.backupDir, common.SanitizeConnectionName(conn.Name))
-	if err := os.MkdirAll(connectionFolder, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create connection backup folder: %v", err)
-	}
-
-	backupPath := filepath.Join(connectionFolder, filename)
-
 	backup := &Backup{
-		ID:           backupID,
+		ID:           uuid.New(),
 		ConnectionID: conn.ID,
+		ScheduleID:   opts.ScheduleID,
+		DatabaseName: dbName,
 		StartedTime:  time.Now(),
 		Status:       "in_progress",
-		Path:         backupPath,
+		StorageTier:  StorageTierLocal,
+		Compression:  opts.Options.Compression,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
-	var cmd *exec.Cmd
-	switch conn.Type {
-	case "postgresql":
-		cmd = s.createPgDumpCmd(conn, backupPath)
-	case "mysql", "mariadb":
-		cmd = s.createMySQLDumpCmd(conn, backupPath)
-	case "mongodb":
-		cmd = s.createMongoDumpCmd(conn, backupPath)
-	case "redis":
-		cmd = s.createRedisDumpCmd(conn, backupPath)
-	default:
-		return nil, fmt.Errorf("unsupported database type for backup: %s", conn.Type)
+	backupPath, err := s.prepareBackupPath(conn, backup)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := s.createDumpCmd(conn, dumpPath(backupPath, backup.Compression), opts.Options)
+	if err != nil {
+		return nil, err
 	}
 
 	if cmd == nil {
@@ -287,6 +345,10 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 			conn.Type, dbName, conn.Host, conn.Port, errorMsg)
 	}
 
+	if err := compressBackupFile(dumpPath(backupPath, backup.Compression), backupPath, backup.Compression); err != nil {
+		return nil, err
+	}
+
 	// Get file size
 	fileInfo, err := os.Stat(backupPath)
 	if err != nil {
@@ -297,8 +359,9 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 	backup.Status = "completed"
 	now := time.Now()
 	backup.CompletedTime = &now
+	backup.Checksum = backupChecksum(backupPath)
 
-	if err := s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name); err != nil {
+	if err := s.uploadToS3IfEnabled(backup, conn, opts); err != nil {
 		fmt.Printf("Warning: Failed to upload backup to S3: %v\n", err)
 	}
 
@@ -309,6 +372,24 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 	return backup, nil
 }
 
+// prepareBackupPath renders the local path for a new backup, records it on
+// the backup and creates its parent folders. A path another file already
+// uses gets the backup's short ID added.
+func (s *BackupService) prepareBackupPath(conn *connection.StoredConnection, backup *Backup) (string, error) {
+	backupPath, err := s.localBackupPath(conn, backup)
+	if err != nil {
+		return "", fmt.Errorf("failed to render backup path: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create connection backup folder: %v", err)
+	}
+
+	backupPath = uniqueBackupPath(backupPath, backup)
+	backup.Path = backupPath
+	return backupPath, nil
+}
+
 func (s *BackupService) GetBackup(id string) (*Backup, error) {
 	return s.backupRepo.GetBackup(id)
 }
@@ -331,16 +412,8 @@ func (s *BackupService) GetBackupStats(userID uuid.UUID) (*BackupStats, error) {
 	return s.backupRepo.GetBackupStats(userID)
 }
 
-func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, connectionName string) error {
-	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
-	if err != nil {
-		return fmt.Errorf("failed to get user settings: %w", err)
-	}
-
-	if !userSettings.S3Enabled {
-		return nil
-	}
-
+// validateS3Settings checks that every setting needed to reach the bucket is present
+func validateS3Settings(userSettings *settings.UserSettings) error {
 	if userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" {
 		return fmt.Errorf("S3 endpoint not configured")
 	}
@@ -353,10 +426,23 @@ func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, co
 	if userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
 		return fmt.Errorf("S3 secret key not configured")
 	}
+	return nil
+}
+
+// s3Configured reports whether S3 storage is enabled and fully configured
+func s3Configured(userSettings *settings.UserSettings) bool {
+	return userSettings != nil && userSettings.S3Enabled && validateS3Settings(userSettings) == nil
+}
+
+// newS3StorageFromSettings creates an S3 client from the user's storage settings
+func (s *BackupService) newS3StorageFromSettings(userSettings *settings.UserSettings) (*S3Storage, error) {
+	if err := validateS3Settings(userSettings); err != nil {
+		return nil, err
+	}
 
 	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt S3 secret key: %w", err)
+		return nil, fmt.Errorf("failed to decrypt S3 secret key: %w", err)
 	}
 
 	// (default to us-east-1 if not set)
@@ -365,30 +451,81 @@ func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, co
 		region = *userSettings.S3Region
 	}
 
-	pathPrefix := ""
+	s3Config := S3Config{
+		Endpoint:  *userSettings.S3Endpoint,
+		Region:    region,
+		Bucket:    *userSettings.S3Bucket,
+		AccessKey: *userSettings.S3AccessKey,
+		SecretKey: secretKey,
+		UseSSL:    userSettings.S3UseSSL,
+	}
 	if userSettings.S3PathPrefix != nil {
-		pathPrefix = *userSettings.S3PathPrefix
+		s3Config.PathPrefix = *userSettings.S3PathPrefix
 	}
-
-	s3Config := S3Config{
-		Endpoint:   *userSettings.S3Endpoint,
-		Region:     region,
-		Bucket:     *userSettings.S3Bucket,
-		AccessKey:  *userSettings.S3AccessKey,
-		SecretKey:  secretKey,
-		UseSSL:     userSettings.S3UseSSL,
-		PathPrefix: pathPrefix,
+	if userSettings.S3SSEMode != nil {
+		s3Config.SSEMode = *userSettings.S3SSEMode
+	}
+	if userSettings.S3SSEKMSKeyID != nil {
+		s3Config.SSEKMSKeyID = *userSettings.S3SSEKMSKeyID
+	}
+	if userSettings.S3StorageClass != nil {
+		s3Config.StorageClass = *userSettings.S3StorageClass
+	}
+	if userSettings.S3ObjectLockMode != nil {
+		s3Config.ObjectLockMode = *userSettings.S3ObjectLockMode
 	}
 
 	s3Storage, err := NewS3Storage(s3Config)
 	if err != nil {
-		return fmt.Errorf("failed to create S3 storage client: %w", err)
+		return nil, fmt.Errorf("failed to create S3 storage client: %w", err)
+	}
+	return s3Storage, nil
+}
+
+// uploadToS3IfEnabled copies a finished backup to S3. Runs without explicit
+// destinations follow the user's storage settings; otherwise the backup is
+// uploaded only when S3 is a destination and kept locally only when local is.
+func (s *BackupService) uploadToS3IfEnabled(backup *Backup, conn *connection.StoredConnection, opts backupRunOptions) error {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user settings: %w", err)
+	}
+
+	purgeLocal := userSettings.S3PurgeLocal
+	if len(opts.Destinations) > 0 {
+		if !opts.hasDestination(DestinationS3) {
+			return nil
+		}
+		if !userSettings.S3Enabled {
+			return fmt.Errorf("schedule stores backups in S3 but S3 storage is not enabled")
+		}
+		purgeLocal = !opts.hasDestination(DestinationLocal)
+	}
+
+	if !userSettings.S3Enabled {
+		return nil
+	}
+
+	s3Storage, err := s.newS3StorageFromSettings(userSettings)
+	if err != nil {
+		return err
+	}
+
+	relativeKey, err := s3RelativeKey(conn, backup)
+	if err != nil {
+		return fmt.Errorf("failed to render S3 object key: %w", err)
+	}
+
+	retainUntil, err := s.objectRetainUntil(backup, opts)
+	if err != nil {
+		return fmt.Errorf("failed to compute object lock retention: %w", err)
+	}
+	if retainUntil.IsZero() && s3Storage.lockMode != "" {
+		fmt.Printf("Warning: Backup %s is uploaded without object lock: connection %s has no schedule with a retention period\n", backup.ID, conn.ID)
 	}
 
 	ctx := context.Background()
-	// Use sanitized connection name as subfolder
-	sanitizedConnectionName := common.SanitizeConnectionName(connectionName)
-	objectKey, err := s3Storage.UploadFileWithPath(ctx, backup.Path, sanitizedConnectionName)
+	objectKey, err := s3Storage.UploadFileAs(ctx, backup.Path, relativeKey, retainUntil)
 	if err != nil {
 		return fmt.Errorf("failed to upload backup to S3: %w", err)
 	}
@@ -398,10 +535,11 @@ func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, co
 	fmt.Printf("Successfully uploaded backup %s to S3: %s\n", backup.ID, objectKey)
 
 	// Purge local backup file if enabled
-	if userSettings.S3PurgeLocal {
+	if purgeLocal {
 		if err := os.Remove(backup.Path); err != nil {
 			fmt.Printf("Warning: Failed to purge local backup file %s: %v\n", backup.Path, err)
 		} else {
+			backup.StorageTier = StorageTierS3
 			fmt.Printf("Successfully purged local backup file: %s\n", backup.Path)
 		}
 	}
@@ -409,98 +547,88 @@ func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, co
 	return nil
 }
 
-// ensureBackupFileAvailable checks if backup file exists locally, if not downloads from S3
-// Returns the path to use and a boolean indicating if it's a temporary file that should be cleaned up
-func (s *BackupService) ensureBackupFileAvailable(backup *Backup, userID uuid.UUID) (string, bool, error) {
+// ensureBackupFileAvailable checks if backup file exists locally, if not it is
+// fetched from S3 through the download cache. The returned release function
+// must be called once the caller is done reading the file.
+func (s *BackupService) ensureBackupFileAvailable(backup *Backup, userID uuid.UUID) (string, func(), error) {
 	// Check if local file exists
 	if _, err := os.Stat(backup.Path); err == nil {
 		// Local file exists, use it
-		return backup.Path, false, nil
+		return backup.Path, func() {}, nil
 	}
 
 	// Local file doesn't exist, check if we have S3 object key
 	if backup.S3ObjectKey == nil || *backup.S3ObjectKey == "" {
-		return "", false, fmt.Errorf("backup file not found locally and no S3 object key available")
+		return "", nil, fmt.Errorf("backup file not found locally and no S3 object key available")
 	}
 
-	// Get user settings to configure S3 client
-	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	s3Storage, err := s.s3StorageForBackup(backup, userID)
 	if err != nil {
-		return "", false, fmt.Errorf("failed to get user settings: %w", err)
+		return "", nil, err
 	}
 
-	if !userSettings.S3Enabled {
-		return "", false, fmt.Errorf("backup file not found locally and S3 is not enabled")
+	objectKey := *backup.S3ObjectKey
+	cacheKey := s3Storage.bucket + "/" + objectKey
+	path, release, err := s.downloadCache.Acquire(cacheKey, func(dst string) error {
+		if err := s3Storage.DownloadFile(context.Background(), objectKey, dst); err != nil {
+			return fmt.Errorf("failed to download backup from S3: %w", err)
+		}
+		fmt.Printf("Successfully downloaded backup %s from S3 to cache: %s\n", backup.ID, dst)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
 	}
 
-	// Validate S3 configuration
-	if userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" {
-		return "", false, fmt.Errorf("S3 endpoint not configured")
-	}
-	if userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" {
-		return "", false, fmt.Errorf("S3 bucket not configured")
-	}
-	if userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" {
-		return "", false, fmt.Errorf("S3 access key not configured")
-	}
-	if userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
-		return "", false, fmt.Errorf("S3 secret key not configured")
-	}
+	return path, release, nil
+}
 
-	// Decrypt S3 secret key
-	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-	if err != nil {
-		return "", false, fmt.Errorf("failed to decrypt S3 secret key: %w", err)
-	}
+// presignedDownloadExpiry is how long a presigned S3 download link stays valid
+const presignedDownloadExpiry = 15 * time.Minute
 
-	// Configure S3 client
-	region := "us-east-1"
-	if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-		region = *userSettings.S3Region
+// s3StorageForBackup returns an S3 client for a backup that is stored in S3
+func (s *BackupService) s3StorageForBackup(backup *Backup, userID uuid.UUID) (*S3Storage, error) {
+	if backup.S3ObjectKey == nil || *backup.S3ObjectKey == "" {
+		return nil, fmt.Errorf("backup has no S3 object key")
 	}
 
-	pathPrefix := ""
-	if userSettings.S3PathPrefix != nil {
-		pathPrefix = *userSettings.S3PathPrefix
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user settings: %w", err)
 	}
 
-	s3Config := S3Config{
-		Endpoint:   *userSettings.S3Endpoint,
-		Region:     region,
-		Bucket:     *userSettings.S3Bucket,
-		AccessKey:  *userSettings.S3AccessKey,
-		SecretKey:  secretKey,
-		UseSSL:     userSettings.S3UseSSL,
-		PathPrefix: pathPrefix,
+	if !userSettings.S3Enabled {
+		return nil, fmt.Errorf("backup is stored in S3 but S3 is not enabled")
 	}
 
-	s3Storage, err := NewS3Storage(s3Config)
+	s3Storage, err := s.newS3StorageFromSettings(userSettings)
 	if err != nil {
-		return "", false, fmt.Errorf("failed to create S3 storage client: %w", err)
+		return nil, err
 	}
+	return s3Storage.WithBucket(backup.s3BucketName()), nil
+}
 
-	// Create temp file path
-	tempDir := filepath.Join(os.TempDir(), "velld-s3-downloads")
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return "", false, fmt.Errorf("failed to create temp directory: %w", err)
+// openS3Backup opens a seekable stream of a backup stored in S3, so it can be
+// served without staging it on local disk
+func (s *BackupService) openS3Backup(ctx context.Context, backup *Backup, userID uuid.UUID) (*minio.Object, minio.ObjectInfo, error) {
+	s3Storage, err := s.s3StorageForBackup(backup, userID)
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
 	}
+	return s3Storage.OpenObject(ctx, *backup.S3ObjectKey)
+}
 
-	tempFilePath := filepath.Join(tempDir, filepath.Base(backup.Path))
-
-	// Download from S3
-	ctx := context.Background()
-	if err := s3Storage.DownloadFile(ctx, *backup.S3ObjectKey, tempFilePath); err != nil {
-		return "", false, fmt.Errorf("failed to download backup from S3: %w", err)
+// presignS3Backup returns a short-lived URL to download a backup straight from S3
+func (s *BackupService) presignS3Backup(ctx context.Context, backup *Backup, userID uuid.UUID) (string, error) {
+	s3Storage, err := s.s3StorageForBackup(backup, userID)
+	if err != nil {
+		return "", err
 	}
-
-	fmt.Printf("Successfully downloaded backup %s from S3 to temp location: %s\n", backup.ID, tempFilePath)
-	
-	// Return temp file path and indicate it should be cleaned up
-	return tempFilePath, true, nil
+	return s3Storage.PresignedDownloadURL(ctx, *backup.S3ObjectKey, filepath.Base(backup.Path), presignedDownloadExpiry)
 }
 
-
-// CleanupS3BackupsForConnection deletes all S3 backups for a specific connection
+// CleanupS3BackupsForConnection deletes all S3 backups for a specific
+// connection, including trashed ones. Pinned and held backups are kept.
 func (s *BackupService) CleanupS3BackupsForConnection(connectionID string) error {
 	// Get all backups for this connection
 	backups, err := s.backupRepo.GetBackupsByConnectionID(connectionID)
@@ -508,6 +636,12 @@ func (s *BackupService) CleanupS3BackupsForConnection(connectionID string) error
 		return fmt.Errorf("failed to get backups for connection %s: %w", connectionID, err)
 	}
 
+	trashed, err := s.backupRepo.GetTrashedBackupsByConnectionID(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get trashed backups for connection %s: %w", connectionID, err)
+	}
+	backups = append(backups, trashed...)
+
 	if len(backups) == 0 {
 		return nil
 	}
@@ -524,54 +658,26 @@ func (s *BackupService) CleanupS3BackupsForConnection(connectionID string) error
 		return fmt.Errorf("failed to get user settings: %w", err)
 	}
 
-	// Check if S3 is enabled and configured
-	if !userSettings.S3Enabled || 
-	   userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" ||
-	   userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" ||
-	   userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" ||
-	   userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
+	if !s3Configured(userSettings) {
 		// S3 not configured, nothing to clean
 		return nil
 	}
 
-	// Decrypt S3 secret key
-	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
+	s3Storage, err := s.newS3StorageFromSettings(userSettings)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt S3 secret key: %w", err)
-	}
-
-	// Configure S3 client
-	region := "us-east-1"
-	if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-		region = *userSettings.S3Region
-	}
-
-	pathPrefix := ""
-	if userSettings.S3PathPrefix != nil {
-		pathPrefix = *userSettings.S3PathPrefix
-	}
-
-	s3Config := S3Config{
-		Endpoint:   *userSettings.S3Endpoint,
-		Region:     region,
-		Bucket:     *userSettings.S3Bucket,
-		AccessKey:  *userSettings.S3AccessKey,
-		SecretKey:  secretKey,
-		UseSSL:     userSettings.S3UseSSL,
-		PathPrefix: pathPrefix,
-	}
-
-	s3Storage, err := NewS3Storage(s3Config)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 storage client: %w", err)
+		return err
 	}
 
 	// Delete S3 objects for all backups
 	ctx := context.Background()
 	deletedCount := 0
 	for _, backup := range backups {
+		if backup.protected() {
+			fmt.Printf("Keeping S3 object of backup %s: it is pinned or under legal hold\n", backup.ID)
+			continue
+		}
 		if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" {
-			if err := s3Storage.DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
+			if err := s3Storage.WithBucket(backup.s3BucketName()).DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
 				fmt.Printf("Warning: Failed to delete S3 object %s: %v\n", *backup.S3ObjectKey, err)
 			} else {
 				deletedCount++
@@ -584,116 +690,3 @@ func (s *BackupService) CleanupS3BackupsForConnection(connectionID string) error
 	fmt.Printf("S3 cleanup completed for connection %s: deleted %d objects\n", connectionID, deletedCount)
 	return nil
 }
-
-
-// RenameS3FolderForConnection renames the S3 folder when connection name changes
-func (s *BackupService) RenameS3FolderForConnection(connectionID string, oldName string, newName string) error {
-	// Get all backups for this connection
-	backups, err := s.backupRepo.GetBackupsByConnectionID(connectionID)
-	if err != nil {
-		return fmt.Errorf("failed to get backups: %w", err)
-	}
-
-	if len(backups) == 0 {
-		return nil // No backups to rename
-	}
-
-	// Get connection to retrieve user settings
-	conn, err := s.connStorage.GetConnection(connectionID)
-	if err != nil {
-		return fmt.Errorf("failed to get connection: %w", err)
-	}
-
-	// Get user settings for S3 configuration
-	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
-	if err != nil {
-		return fmt.Errorf("failed to get user settings: %w", err)
-	}
-
-	// Check if S3 is enabled and configured
-	if !userSettings.S3Enabled || 
-	   userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" ||
-	   userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" ||
-	   userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" ||
-	   userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
-		return nil // S3 not configured, nothing to rename
-	}
-
-	// Decrypt S3 secret key
-	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-	if err != nil {
-		return fmt.Errorf("failed to decrypt S3 secret key: %w", err)
-	}
-
-	// Configure S3 client
-	region := "us-east-1"
-	if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-		region = *userSettings.S3Region
-	}
-
-	pathPrefix := ""
-	if userSettings.S3PathPrefix != nil {
-		pathPrefix = *userSettings.S3PathPrefix
-	}
-
-	s3Config := S3Config{
-		Endpoint:   *userSettings.S3Endpoint,
-		Region:     region,
-		Bucket:     *userSettings.S3Bucket,
-		AccessKey:  *userSettings.S3AccessKey,
-		SecretKey:  secretKey,
-		UseSSL:     userSettings.S3UseSSL,
-		PathPrefix: pathPrefix,
-	}
-
-	s3Storage, err := NewS3Storage(s3Config)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 storage client: %w", err)
-	}
-
-	// Sanitize old and new folder names
-	oldFolder := common.SanitizeConnectionName(oldName)
-	newFolder := common.SanitizeConnectionName(newName)
-
-	if oldFolder == newFolder {
-		return nil // Names are the same after sanitization, no rename needed
-	}
-
-	// Rename S3 objects
-	ctx := context.Background()
-	renamedCount := 0
-	for _, backup := range backups {
-		if backup.S3ObjectKey == nil || *backup.S3ObjectKey == "" {
-			continue // No S3 object, skip
-		}
-
-		oldKey := *backup.S3ObjectKey
-		
-		// Replace old folder with new folder in the object key
-		newKey := strings.Replace(oldKey, oldFolder, newFolder, 1)
-		
-		if oldKey == newKey {
-			continue // No change needed
-		}
-
-		// Move object in S3
-		if err := s3Storage.MoveFile(ctx, oldKey, newKey); err != nil {
-			fmt.Printf("Warning: Failed to rename S3 object %s to %s: %v\n", oldKey, newKey, err)
-			continue
-		}
-
-		// Update database record with new S3 object key
-		backup.S3ObjectKey = &newKey
-		if err := s.backupRepo.UpdateBackupS3ObjectKey(backup.ID.String(), newKey); err != nil {
-			fmt.Printf("Warning: Failed to update S3 object key in database for backup %s: %v\n", backup.ID, err)
-			continue
-		}
-
-		renamedCount++
-		fmt.Printf("Renamed S3 object from %s to %s\n", oldKey, newKey)
-	}
-
-	fmt.Printf("S3 folder rename completed for connection %s: renamed %d objects from %s to %s\n", 
-		connectionID, renamedCount, oldFolder, newFolder)
-	return nil
-}
@@ -0,0 +1,412 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/audit"
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// trashPurgeInterval is how often expired trash is purged
+const trashPurgeInterval = time.Hour
+
+// auditResourceBackup is the resource type of backup audit entries
+const auditResourceBackup = "backup"
+
+// errBackupProtected is returned when deleting a pinned or held backup
+var errBackupProtected = errors.New("backup is pinned or under legal hold")
+
+// runTrashPurger periodically deletes trashed backups whose recovery window
+// has ended
+func (s *BackupService) runTrashPurger() {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Only the replica running schedules purges, so deletions don't race
+		if s.scheduler.IsLeader() {
+			s.purgeExpiredTrash()
+		}
+	}
+}
+
+func (s *BackupService) purgeExpiredTrash() {
+	backups, err := s.backupRepo.GetExpiredTrash(time.Now())
+	if err != nil {
+		fmt.Printf("Error fetching expired trash: %v\n", err)
+		return
+	}
+
+	conns := make(map[string]*connection.StoredConnection)
+	purged := 0
+	for _, backup := range backups {
+		conn, ok := conns[backup.ConnectionID]
+		if !ok {
+			conn, err = s.connStorage.GetConnection(backup.ConnectionID)
+			if err != nil {
+				fmt.Printf("Warning: Failed to get connection %s to purge backup %s: %v\n",
+					backup.ConnectionID, backup.ID, err)
+				continue
+			}
+			conns[backup.ConnectionID] = conn
+		}
+
+		if err := s.purgeBackup(backup, conn, audit.ActorSystem); err != nil {
+			fmt.Printf("Warning: Failed to purge backup %s: %v\n", backup.ID, err)
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		fmt.Printf("Trash purge completed: purged %d backups\n", purged)
+	}
+}
+
+// trashBackup moves a backup to the trash for the owner's recovery window
+func (s *BackupService) trashBackup(backup *Backup, conn *connection.StoredConnection, reason, actor string) error {
+	retentionDays := settings.DefaultTrashRetentionDays
+	if userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID); err == nil && userSettings.TrashRetentionDays > 0 {
+		retentionDays = userSettings.TrashRetentionDays
+	}
+
+	now := time.Now()
+	purgeAfter := now.AddDate(0, 0, retentionDays)
+	if err := s.backupRepo.TrashBackup(backup.ID.String(), now, purgeAfter, reason); err != nil {
+		if err == sql.ErrNoRows {
+			return errBackupProtected
+		}
+		return err
+	}
+
+	fmt.Printf("Moved backup %s to trash (%s), purging after %s\n",
+		backup.ID, reason, purgeAfter.Format(time.RFC3339))
+	s.recordAudit(conn.UserID, actor, audit.BackupTrashed, backup, map[string]interface{}{
+		"reason":      reason,
+		"purge_after": purgeAfter.UTC().Format(time.RFC3339),
+	})
+	return nil
+}
+
+// purgeBackup deletes a trashed backup for good. Remote copies of backups
+// pruned by retention are only deleted when the connection opted in, matching
+// what retention did before backups went through the trash.
+func (s *BackupService) purgeBackup(backup *Backup, conn *connection.StoredConnection, actor string) error {
+	deleteRemote := true
+	if backup.DeleteReason != nil && *backup.DeleteReason == TrashReasonRetention {
+		deleteRemote = conn.S3CleanupOnRetention
+	}
+
+	if !s.deleteBackupArtifacts(context.Background(), backup, s.cleanupS3Storage(conn), deleteRemote, "trash purge") {
+		return fmt.Errorf("backup could not be deleted yet")
+	}
+
+	s.recordAudit(conn.UserID, actor, audit.BackupPurged, backup, nil)
+	return nil
+}
+
+// recordAudit writes an audit entry for a backup. A failed write is logged
+// rather than failing the action it records.
+func (s *BackupService) recordAudit(userID uuid.UUID, actor string, action audit.Action, backup *Backup, details map[string]interface{}) {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details["connection_id"] = backup.ConnectionID
+	details["database_name"] = backup.DatabaseName
+	details["path"] = backup.Path
+
+	if err := s.auditService.Record(userID, actor, action, auditResourceBackup, backup.ID.String(), details); err != nil {
+		fmt.Printf("Warning: Failed to record audit entry %s for backup %s: %v\n", action, backup.ID, err)
+	}
+}
+
+// backupOwner returns the connection of a backup, or sql.ErrNoRows when it
+// belongs to another user
+func (s *BackupService) backupOwner(backup *Backup, userID uuid.UUID) (*connection.StoredConnection, error) {
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return conn, nil
+}
+
+func (s *BackupService) PinBackup(userID uuid.UUID, id string, pinned bool) (*Backup, error) {
+	backup, err := s.backupRepo.GetBackup(id)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.backupOwner(backup, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.SetBackupPinned(id, pinned); err != nil {
+		return nil, err
+	}
+
+	action := audit.BackupUnpinned
+	if pinned {
+		action = audit.BackupPinned
+	}
+	s.recordAudit(conn.UserID, userID.String(), action, backup, nil)
+
+	return s.backupRepo.GetBackup(id)
+}
+
+func (s *BackupService) SetLegalHold(userID uuid.UUID, id string, req *LegalHoldRequest) (*Backup, error) {
+	backup, err := s.backupRepo.GetBackup(id)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.backupOwner(backup, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var reason *string
+	action := audit.BackupLegalHoldReleased
+	details := map[string]interface{}{}
+	if req.Enabled {
+		r := strings.TrimSpace(req.Reason)
+		reason = &r
+		action = audit.BackupLegalHoldPlaced
+		details["reason"] = r
+	} else if backup.LegalHoldReason != nil {
+		details["reason"] = *backup.LegalHoldReason
+	}
+
+	if err := s.backupRepo.SetBackupLegalHold(id, req.Enabled, reason); err != nil {
+		return nil, err
+	}
+	s.recordAudit(conn.UserID, userID.String(), action, backup, details)
+
+	return s.backupRepo.GetBackup(id)
+}
+
+// DeleteBackup moves a backup to the trash. It can be recovered until the
+// user's trash retention ends.
+func (s *BackupService) DeleteBackup(userID uuid.UUID, id string) error {
+	backup, err := s.backupRepo.GetBackup(id)
+	if err != nil {
+		return err
+	}
+	conn, err := s.backupOwner(backup, userID)
+	if err != nil {
+		return err
+	}
+	if backup.protected() {
+		return errBackupProtected
+	}
+
+	return s.trashBackup(backup, conn, TrashReasonManual, userID.String())
+}
+
+func (s *BackupService) ListTrash(userID uuid.UUID) ([]*Backup, error) {
+	return s.backupRepo.GetTrashedBackups(userID)
+}
+
+func (s *BackupService) RecoverBackup(userID uuid.UUID, id string) (*Backup, error) {
+	backup, err := s.backupRepo.GetTrashedBackup(id)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.backupOwner(backup, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.backupRepo.RecoverBackup(id); err != nil {
+		return nil, err
+	}
+	s.recordAudit(conn.UserID, userID.String(), audit.BackupRecovered, backup, nil)
+
+	return s.backupRepo.GetBackup(id)
+}
+
+// PurgeBackup deletes a trashed backup right away instead of waiting for the
+// purge job
+func (s *BackupService) PurgeBackup(userID uuid.UUID, id string) error {
+	backup, err := s.backupRepo.GetTrashedBackup(id)
+	if err != nil {
+		return err
+	}
+	conn, err := s.backupOwner(backup, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.purgeBackup(backup, conn, userID.String())
+}
+
+func (h *BackupHandler) PinBackup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	var req PinBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backup, err := h.backupService.PinBackup(userID, backupID, req.Pinned)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	message := "Backup unpinned successfully"
+	if req.Pinned {
+		message = "Backup pinned successfully"
+	}
+	response.SendSuccess(w, message, backup)
+}
+
+func (h *BackupHandler) SetLegalHold(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	var req LegalHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Enabled && strings.TrimSpace(req.Reason) == "" {
+		response.SendError(w, http.StatusBadRequest, "reason is required to place a legal hold")
+		return
+	}
+
+	backup, err := h.backupService.SetLegalHold(userID, backupID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	message := "Legal hold released successfully"
+	if req.Enabled {
+		message = "Legal hold placed successfully"
+	}
+	response.SendSuccess(w, message, backup)
+}
+
+func (h *BackupHandler) DeleteBackup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	if err := h.backupService.DeleteBackup(userID, backupID); err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		if err == errBackupProtected {
+			response.SendError(w, http.StatusConflict, err.Error())
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup moved to trash successfully", nil)
+}
+
+func (h *BackupHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backups, err := h.backupService.ListTrash(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Trash retrieved successfully", backups)
+}
+
+func (h *BackupHandler) RecoverBackup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	backup, err := h.backupService.RecoverBackup(userID, backupID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found in trash")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup recovered successfully", backup)
+}
+
+func (h *BackupHandler) PurgeBackup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	if err := h.backupService.PurgeBackup(userID, backupID); err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found in trash")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup purged successfully", nil)
+}
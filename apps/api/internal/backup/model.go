@@ -6,49 +6,181 @@ import (
 	"github.com/google/uuid"
 )
 
-// BackupSchedule represents a backup schedule configuration
+// BackupSchedule represents a backup schedule configuration. A connection can
+// have several schedules, each producing its own backups.
 type BackupSchedule struct {
-	ID             uuid.UUID  `json:"id"`
-	ConnectionID   string     `json:"connection_id"`
-	Enabled        bool       `json:"enabled"`
-	CronSchedule   string     `json:"cron_schedule"`
-	RetentionDays  int        `json:"retention_days"`
+	ID           uuid.UUID `json:"id"`
+	ConnectionID string    `json:"connection_id"`
+	Name         string    `json:"name"`
+	Enabled      bool      `json:"enabled"`
+	CronSchedule string    `json:"cron_schedule"`
+	// Timezone is the IANA zone the cron expression is evaluated in; empty
+	// means the server's local zone
+	Timezone      string        `json:"timezone"`
+	RetentionDays int           `json:"retention_days"`
+	Options       BackupOptions `json:"options"`
+	Destinations  []string      `json:"destinations"`
+	RetryPolicy   RetryPolicy   `json:"retry_policy"`
+	// MisfirePolicy decides what happens to a run missed while the server was down
+	MisfirePolicy string `json:"misfire_policy"`
+	// MisfireGraceMinutes is how late a missed run may still start under
+	// MisfireRunIfWithin
+	MisfireGraceMinutes int               `json:"misfire_grace_minutes"`
+	Notifications       NotificationRules `json:"notifications"`
+	// PolicyID is set on schedules managed by a backup policy; they change
+	// with the policy and can't be edited on their own
+	PolicyID       *string    `json:"policy_id"`
 	NextRunTime    *time.Time `json:"next_run_time"`
 	LastBackupTime *time.Time `json:"last_backup_time"`
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 }
 
+// BackupOptions controls what a scheduled backup dumps
+type BackupOptions struct {
+	// SchemaOnly dumps table definitions without data
+	SchemaOnly bool `json:"schema_only"`
+	// Databases overrides the connection's selected databases
+	Databases []string `json:"databases,omitempty"`
+	// Compression compresses dump files, see CompressionGzip
+	Compression string `json:"compression,omitempty"`
+}
+
+// NotificationRules decides which scheduled run outcomes notify the owner
+type NotificationRules struct {
+	OnFailure bool `json:"on_failure"`
+	OnSuccess bool `json:"on_success"`
+}
+
+// defaultNotificationRules keeps the historical behaviour of only reporting
+// failures
+var defaultNotificationRules = NotificationRules{OnFailure: true}
+
+// RetryPolicy controls how a failed scheduled run is retried
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt too; 0 or 1 disables retries
+	MaxAttempts int `json:"max_attempts"`
+	// BackoffSeconds is the delay before the first retry, doubled for each
+	// further one
+	BackoffSeconds int `json:"backoff_seconds"`
+	// RetryOn lists the error classes worth retrying, see ErrorClassConnection.
+	// Defaults to connection and timeout errors.
+	RetryOn []string `json:"retry_on,omitempty"`
+}
+
+// Classes of backup errors a retry policy can select
+const (
+	// ErrorClassConnection covers refused, reset and unreachable connections
+	ErrorClassConnection = "connection"
+	// ErrorClassTimeout covers database and SSH dial timeouts
+	ErrorClassTimeout = "timeout"
+	// ErrorClassAuth covers rejected credentials, which rarely fix themselves
+	ErrorClassAuth  = "auth"
+	ErrorClassOther = "other"
+)
+
+var defaultRetryOn = []string{ErrorClassConnection, ErrorClassTimeout}
+
+// What to do on startup with a scheduled run that was missed
+const (
+	// MisfireRunOnce runs a single catch-up backup however late it is
+	MisfireRunOnce = "run_once"
+	// MisfireSkip drops missed runs and waits for the next fire time
+	MisfireSkip = "skip"
+	// MisfireRunIfWithin catches up only if the run was missed by less than
+	// the schedule's grace period
+	MisfireRunIfWithin = "run_if_within"
+)
+
+// Places a schedule can store its backups. An empty destination list keeps
+// the behaviour of the user's storage settings.
+const (
+	DestinationLocal = "local"
+	DestinationS3    = "s3"
+)
+
 // Backup represents a single backup record
 type Backup struct {
 	ID            uuid.UUID  `json:"id"`
 	ConnectionID  string     `json:"connection_id"`
 	ScheduleID    *string    `json:"schedule_id"`
+	DatabaseName  string     `json:"database_name"`
 	Status        string     `json:"status"`
 	Path          string     `json:"path"`
 	S3ObjectKey   *string    `json:"s3_object_key"`
+	S3Bucket      *string    `json:"s3_bucket"`
+	StorageTier   string     `json:"storage_tier"`
+	Compression   string     `json:"compression"`
 	Size          int64      `json:"size"`
 	StartedTime   time.Time  `json:"started_time"`
 	CompletedTime *time.Time `json:"completed_time"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
+	// Pinned and LegalHold protect a backup from retention and deletion
+	Pinned          bool    `json:"pinned"`
+	LegalHold       bool    `json:"legal_hold"`
+	LegalHoldReason *string `json:"legal_hold_reason"`
+	// DeletedAt is set while the backup is in the trash, PurgeAfter is when
+	// the purge job deletes it for good
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	PurgeAfter   *time.Time `json:"purge_after,omitempty"`
+	DeleteReason *string    `json:"delete_reason,omitempty"`
+	// Labels are key/value pairs for finding backups, Notes is free text
+	Labels map[string]string `json:"labels"`
+	Notes  *string           `json:"notes"`
+	// Checksum is the hex SHA-256 of the stored backup file
+	Checksum *string `json:"checksum"`
+	// Masked backups were written through a masking profile, which
+	// MaskingProfileID names
+	Masked           bool    `json:"masked"`
+	MaskingProfileID *string `json:"masking_profile_id"`
+	// Imported backups were uploaded rather than taken by Velld. Format is
+	// the dump format detected on upload.
+	Imported         bool    `json:"imported"`
+	Format           *string `json:"format"`
+	OriginalFilename *string `json:"original_filename"`
+}
+
+// protected reports whether retention and deletion must leave the backup alone
+func (b *Backup) protected() bool {
+	return b.Pinned || b.LegalHold
+}
+
+// s3BucketName returns the bucket holding the backup's S3 object, or "" when
+// it lives in the user's default bucket
+func (b *Backup) s3BucketName() string {
+	if b.S3Bucket == nil {
+		return ""
+	}
+	return *b.S3Bucket
 }
 
 // BackupList represents a backup in list view with additional info
 type BackupList struct {
-	ID            uuid.UUID `json:"id"`
-	ConnectionID  string    `json:"connection_id"`
-	DatabaseType  string    `json:"database_type"`
-	DatabaseName  string    `json:"database_name"`
-	ScheduleID    *string   `json:"schedule_id"`
-	Status        string    `json:"status"`
-	Path          string    `json:"path"`
-	S3ObjectKey   *string   `json:"s3_object_key"`
-	Size          int64     `json:"size"`
-	StartedTime   string    `json:"started_time"`
-	CompletedTime string    `json:"completed_time"`
-	CreatedAt     string    `json:"created_at"`
-	UpdatedAt     string    `json:"updated_at"`
+	ID            uuid.UUID         `json:"id"`
+	ConnectionID  string            `json:"connection_id"`
+	DatabaseType  string            `json:"database_type"`
+	DatabaseName  string            `json:"database_name"`
+	ScheduleID    *string           `json:"schedule_id"`
+	Status        string            `json:"status"`
+	Path          string            `json:"path"`
+	S3ObjectKey   *string           `json:"s3_object_key"`
+	S3Bucket      *string           `json:"s3_bucket"`
+	StorageTier   string            `json:"storage_tier"`
+	Compression   string            `json:"compression"`
+	Size          int64             `json:"size"`
+	StartedTime   string            `json:"started_time"`
+	CompletedTime string            `json:"completed_time"`
+	CreatedAt     string            `json:"created_at"`
+	UpdatedAt     string            `json:"updated_at"`
+	Pinned        bool              `json:"pinned"`
+	LegalHold     bool              `json:"legal_hold"`
+	Labels        map[string]string `json:"labels"`
+	Notes         *string           `json:"notes"`
+	Masked        bool              `json:"masked"`
+	Imported      bool              `json:"imported"`
+	Checksum      *string           `json:"checksum"`
+	Format        *string           `json:"format"`
 }
 
 // BackupRequest represents a request to create a backup
@@ -58,9 +190,11 @@ type BackupRequest struct {
 
 // ScheduleBackupRequest represents a request to create a backup schedule
 type ScheduleBackupRequest struct {
-	ConnectionID  string `json:"connection_id"`
-	CronSchedule  string `json:"cron_schedule"`
-	RetentionDays int    `json:"retention_days"`
+	ConnectionID string `json:"connection_id"`
+	CronSchedule string `json:"cron_schedule"`
+	// Timezone is left unchanged on an existing schedule when omitted
+	Timezone      *string `json:"timezone"`
+	RetentionDays int     `json:"retention_days"`
 }
 
 // BackupStats represents backup statistics
@@ -90,13 +224,642 @@ type BackupListRequest struct {
 
 // BackupListOptions represents options for listing backups
 type BackupListOptions struct {
-	UserID uuid.UUID
-	Limit  int
-	Offset int
-	Search string
+	UserID       uuid.UUID
+	Limit        int
+	Offset       int
+	Search       string
+	ConnectionID string
+	DatabaseName string
+	Status       string
+	ScheduleID   string
+	Labels       []LabelFilter
+	// CreatedAfter is inclusive, CreatedBefore exclusive
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinSize       *int64
+	MaxSize       *int64
+	Sort          string
+	Order         string
+}
+
+// LabelFilter matches backups carrying a label. A nil Value matches any value.
+type LabelFilter struct {
+	Key   string
+	Value *string
+}
+
+// Sort options of the backup catalog
+const (
+	BackupSortCreatedAt     = "created_at"
+	BackupSortCompletedTime = "completed_time"
+	BackupSortSize          = "size"
+	BackupSortDatabaseName  = "database_name"
+	BackupSortStatus        = "status"
+)
+
+const (
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
+)
+
+// UpdateBackupMetadataRequest changes the labels and notes of a backup. Nil
+// fields are left unchanged.
+type UpdateBackupMetadataRequest struct {
+	Labels *map[string]string `json:"labels"`
+	Notes  *string            `json:"notes"`
+}
+
+// ScheduleRequest represents a request to create or update a backup schedule
+type ScheduleRequest struct {
+	ConnectionID  string        `json:"connection_id"`
+	Name          string        `json:"name"`
+	Enabled       *bool         `json:"enabled"`
+	CronSchedule  string        `json:"cron_schedule"`
+	Timezone      string        `json:"timezone"`
+	RetentionDays int           `json:"retention_days"`
+	Options       BackupOptions `json:"options"`
+	Destinations  []string      `json:"destinations"`
+	RetryPolicy   RetryPolicy   `json:"retry_policy"`
+	// MisfirePolicy defaults to MisfireRunOnce
+	MisfirePolicy       string `json:"misfire_policy"`
+	MisfireGraceMinutes int    `json:"misfire_grace_minutes"`
+	// Notifications defaults to notifying on failure only
+	Notifications *NotificationRules `json:"notifications"`
 }
 
 type UpdateScheduleRequest struct {
-	CronSchedule  string `json:"cron_schedule"`
-	RetentionDays int    `json:"retention_days"`
+	CronSchedule string `json:"cron_schedule"`
+	// Timezone is left unchanged when omitted
+	Timezone      *string `json:"timezone"`
+	RetentionDays int     `json:"retention_days"`
+}
+
+// ScheduleRunTime is an upcoming run of a schedule
+type ScheduleRunTime struct {
+	Local time.Time `json:"local"`
+	UTC   time.Time `json:"utc"`
+}
+
+// SchedulePreview lists the next runs of a cron expression
+type SchedulePreview struct {
+	CronSchedule string            `json:"cron_schedule"`
+	Timezone     string            `json:"timezone"`
+	NextRuns     []ScheduleRunTime `json:"next_runs"`
+}
+
+// Storage tiers a backup artifact can live in
+const (
+	// StorageTierLocal means the file is on local disk (and possibly in S3)
+	StorageTierLocal = "local"
+	// StorageTierS3 means the file only exists in S3
+	StorageTierS3 = "s3"
+	// StorageTierArchive means the file was moved to an archive bucket or storage class
+	StorageTierArchive = "archive"
+)
+
+// LifecycleRule moves a connection's backups between storage tiers as they age.
+// A zero number of days disables that transition.
+type LifecycleRule struct {
+	ConnectionID string `json:"connection_id"`
+	Enabled      bool   `json:"enabled"`
+	// LocalDays is how long backups stay on local disk before only the S3 copy is kept
+	LocalDays int `json:"local_days"`
+	// S3Days is how long backups stay in the standard S3 tier before being archived
+	S3Days int `json:"s3_days"`
+	// ArchiveDays is the age at which backups are deleted from the archive
+	ArchiveDays         int       `json:"archive_days"`
+	ArchiveStorageClass *string   `json:"archive_storage_class"`
+	ArchiveBucket       *string   `json:"archive_bucket"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+type UpdateLifecycleRuleRequest struct {
+	Enabled             bool    `json:"enabled"`
+	LocalDays           int     `json:"local_days"`
+	S3Days              int     `json:"s3_days"`
+	ArchiveDays         int     `json:"archive_days"`
+	ArchiveStorageClass *string `json:"archive_storage_class"`
+	ArchiveBucket       *string `json:"archive_bucket"`
+}
+
+// Reasons a backup was moved to the trash
+const (
+	TrashReasonManual    = "manual"
+	TrashReasonRetention = "retention"
+	TrashReasonLifecycle = "lifecycle"
+)
+
+type PinBackupRequest struct {
+	Pinned bool `json:"pinned"`
+}
+
+type LegalHoldRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// RetentionRule is a grandfather-father-son retention rule for a connection.
+// A backup is kept when any count selects it; the rest are pruned. When
+// enabled it replaces the flat RetentionDays cutoff of the connection's
+// schedules.
+type RetentionRule struct {
+	ConnectionID string `json:"connection_id"`
+	Enabled      bool   `json:"enabled"`
+	// KeepLast keeps the newest backups regardless of when they were taken
+	KeepLast int `json:"keep_last"`
+	// KeepDaily, KeepWeekly, KeepMonthly and KeepYearly keep the newest backup
+	// of that many of the most recent days, ISO weeks, months and years that
+	// have backups
+	KeepDaily   int `json:"keep_daily"`
+	KeepWeekly  int `json:"keep_weekly"`
+	KeepMonthly int `json:"keep_monthly"`
+	KeepYearly  int `json:"keep_yearly"`
+	// MinKeep is the fewest backups kept per retention group whatever their age
+	MinKeep int `json:"min_keep"`
+	// Timezone is the IANA zone periods are evaluated in; empty means the
+	// server's local zone
+	Timezone  string    `json:"timezone"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type UpdateRetentionRuleRequest struct {
+	Enabled     bool   `json:"enabled"`
+	KeepLast    int    `json:"keep_last"`
+	KeepDaily   int    `json:"keep_daily"`
+	KeepWeekly  int    `json:"keep_weekly"`
+	KeepMonthly int    `json:"keep_monthly"`
+	KeepYearly  int    `json:"keep_yearly"`
+	MinKeep     int    `json:"min_keep"`
+	Timezone    string `json:"timezone"`
+}
+
+// RetentionDecision is what a retention rule decided for one backup and why
+type RetentionDecision struct {
+	BackupID     uuid.UUID `json:"backup_id"`
+	DatabaseName string    `json:"database_name"`
+	ScheduleID   *string   `json:"schedule_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Size         int64     `json:"size"`
+	Keep         bool      `json:"keep"`
+	Reasons      []string  `json:"reasons"`
+}
+
+// RetentionPlan lists the decisions of a retention rule over a connection's
+// successful backups
+type RetentionPlan struct {
+	ConnectionID string               `json:"connection_id"`
+	Rule         *RetentionRule       `json:"rule"`
+	DryRun       bool                 `json:"dry_run"`
+	KeptCount    int                  `json:"kept_count"`
+	PrunedCount  int                  `json:"pruned_count"`
+	PrunedSize   int64                `json:"pruned_size"`
+	Decisions    []*RetentionDecision `json:"decisions"`
+}
+
+// RPOPolicy is a connection's recovery point objective: its newest successful
+// backup must never be older than MaxAgeHours. Breached tracks the state the
+// monitor last saw so breach and recovery are each reported once.
+type RPOPolicy struct {
+	ConnectionID  string     `json:"connection_id"`
+	Enabled       bool       `json:"enabled"`
+	MaxAgeHours   int        `json:"max_age_hours"`
+	Breached      bool       `json:"breached"`
+	BreachedSince *time.Time `json:"breached_since"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type UpdateRPOPolicyRequest struct {
+	Enabled     bool `json:"enabled"`
+	MaxAgeHours int  `json:"max_age_hours"`
+}
+
+// RPOBreach is a period in which a connection had no recent enough backup.
+// EndedAt is nil while the breach is ongoing.
+type RPOBreach struct {
+	ID           uuid.UUID  `json:"id"`
+	ConnectionID string     `json:"connection_id"`
+	MaxAgeHours  int        `json:"max_age_hours"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+}
+
+// RPO compliance states of a connection
+const (
+	RPOStatusCompliant = "compliant"
+	RPOStatusBreached  = "breached"
+	// RPOStatusUnmonitored means no enabled RPO policy exists
+	RPOStatusUnmonitored = "unmonitored"
+)
+
+// RPOReport summarises a connection's RPO compliance over the last WindowDays
+type RPOReport struct {
+	ConnectionID   string     `json:"connection_id"`
+	Status         string     `json:"status"`
+	MaxAgeHours    int        `json:"max_age_hours"`
+	LastBackupTime *time.Time `json:"last_backup_time"`
+	// BackupAgeHours is the age of the newest successful backup
+	BackupAgeHours *float64   `json:"backup_age_hours"`
+	BreachedSince  *time.Time `json:"breached_since"`
+	WindowDays     int        `json:"window_days"`
+	WindowStart    time.Time  `json:"window_start"`
+	BreachCount    int        `json:"breach_count"`
+	BreachedHours  float64    `json:"breached_hours"`
+	// CompliancePercent is the share of the monitored window spent within the RPO
+	CompliancePercent float64      `json:"compliance_percent"`
+	Breaches          []*RPOBreach `json:"breaches"`
+}
+
+// What happens to a scheduled run that falls inside a blackout window
+const (
+	// BlackoutActionSkip drops the run
+	BlackoutActionSkip = "skip"
+	// BlackoutActionDefer runs the backup once the window ends
+	BlackoutActionDefer = "defer"
+)
+
+// BlackoutWindow blocks scheduled backups for a period of time. Windows are
+// either recurring (a cron expression marking each start plus a duration) or
+// a one-off date range, and apply to all of a user's schedules, one
+// connection's schedules or a single schedule.
+type BlackoutWindow struct {
+	ID              uuid.UUID  `json:"id"`
+	UserID          uuid.UUID  `json:"user_id"`
+	ConnectionID    *string    `json:"connection_id"`
+	ScheduleID      *string    `json:"schedule_id"`
+	Name            string     `json:"name"`
+	CronSchedule    *string    `json:"cron_schedule"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Timezone        string     `json:"timezone"`
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	Action          string     `json:"action"`
+	Enabled         bool       `json:"enabled"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type BlackoutWindowRequest struct {
+	ConnectionID    *string    `json:"connection_id"`
+	ScheduleID      *string    `json:"schedule_id"`
+	Name            string     `json:"name"`
+	CronSchedule    *string    `json:"cron_schedule"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Timezone        string     `json:"timezone"`
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	Action          string     `json:"action"`
+	Enabled         *bool      `json:"enabled"`
+}
+
+// Outcomes of a scheduled run
+const (
+	ScheduleRunRunning   = "running"
+	ScheduleRunCompleted = "completed"
+	ScheduleRunFailed    = "failed"
+	ScheduleRunSkipped   = "skipped"
+	ScheduleRunDeferred  = "deferred"
+)
+
+// What started a schedule run
+const (
+	RunTriggerSchedule = "schedule"
+	RunTriggerManual   = "manual"
+)
+
+// ScheduleRun records one firing of a schedule and what came of it
+type ScheduleRun struct {
+	ID           uuid.UUID `json:"id"`
+	ScheduleID   string    `json:"schedule_id"`
+	ConnectionID string    `json:"connection_id"`
+	TriggeredBy  string    `json:"triggered_by"`
+	// BackupIDs lists the backups the run produced, one per database
+	BackupIDs []string `json:"backup_ids"`
+	Status    string   `json:"status"`
+	// Reason explains skipped and deferred runs
+	Reason *string `json:"reason"`
+	// Attempts counts how often the run tried to back up, including retries
+	Attempts int `json:"attempts"`
+	// AttemptErrors holds the error of every failed attempt
+	AttemptErrors []string   `json:"attempt_errors"`
+	Error         *string    `json:"error"`
+	ScheduledTime time.Time  `json:"scheduled_time"`
+	StartedAt     *time.Time `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// BackupPolicy bundles schedule settings so they can be applied to many
+// connections at once. Every targeted connection gets a schedule managed by
+// the policy.
+type BackupPolicy struct {
+	ID                  uuid.UUID         `json:"id"`
+	UserID              uuid.UUID         `json:"user_id"`
+	Name                string            `json:"name"`
+	CronSchedule        string            `json:"cron_schedule"`
+	Timezone            string            `json:"timezone"`
+	RetentionDays       int               `json:"retention_days"`
+	Options             BackupOptions     `json:"options"`
+	Destinations        []string          `json:"destinations"`
+	RetryPolicy         RetryPolicy       `json:"retry_policy"`
+	MisfirePolicy       string            `json:"misfire_policy"`
+	MisfireGraceMinutes int               `json:"misfire_grace_minutes"`
+	Notifications       NotificationRules `json:"notifications"`
+	// RPOMaxAgeHours enables RPO monitoring on every targeted connection; 0
+	// leaves their RPO policies alone
+	RPOMaxAgeHours int `json:"rpo_max_age_hours"`
+	// ConnectionIDs and Tags select the connections the policy applies to
+	ConnectionIDs []string  `json:"connection_ids"`
+	Tags          []string  `json:"tags"`
+	ScheduleCount int       `json:"schedule_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// PolicyScheduleChanges are the schedule writes that bring a policy's
+// schedules in line with its settings and targets
+type PolicyScheduleChanges struct {
+	Create []*BackupSchedule
+	Update []*BackupSchedule
+	Remove []string
+}
+
+type BackupPolicyRequest struct {
+	Name                string             `json:"name"`
+	CronSchedule        string             `json:"cron_schedule"`
+	Timezone            string             `json:"timezone"`
+	RetentionDays       int                `json:"retention_days"`
+	Options             BackupOptions      `json:"options"`
+	Destinations        []string           `json:"destinations"`
+	RetryPolicy         RetryPolicy        `json:"retry_policy"`
+	MisfirePolicy       string             `json:"misfire_policy"`
+	MisfireGraceMinutes int                `json:"misfire_grace_minutes"`
+	Notifications       *NotificationRules `json:"notifications"`
+	RPOMaxAgeHours      int                `json:"rpo_max_age_hours"`
+	ConnectionIDs       []string           `json:"connection_ids"`
+	Tags                []string           `json:"tags"`
+}
+
+// Policy target types
+const (
+	PolicyTargetConnection = "connection"
+	PolicyTargetTag        = "tag"
+)
+
+// States of a restore job
+const (
+	RestoreJobQueued    = "queued"
+	RestoreJobRunning   = "running"
+	RestoreJobCompleted = "completed"
+	RestoreJobFailed    = "failed"
+)
+
+// RestoreJob records one restore of a backup into a connection. Queued and
+// running jobs hold the lock on their target database.
+type RestoreJob struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// StartedBy is the user ID that requested the restore
+	StartedBy      string `json:"started_by"`
+	BackupID       string `json:"backup_id"`
+	ConnectionID   string `json:"connection_id"`
+	TargetDatabase string `json:"target_database"`
+	// Options is the restore request without its confirmation token
+	Options RestoreRequest `json:"options"`
+	Status  string         `json:"status"`
+	// SnapshotBackupID is the backup of the target taken before the restore
+	// started, which the job can be reverted to
+	SnapshotBackupID *string `json:"snapshot_backup_id"`
+	// RevertsJobID is set on jobs that revert another job to its snapshot
+	RevertsJobID *string `json:"reverts_job_id"`
+	// Output is the tail of the restore tool's output. It is left out of
+	// job listings.
+	Output          string     `json:"output,omitempty"`
+	Error           *string    `json:"error"`
+	QueuedAt        time.Time  `json:"queued_at"`
+	StartedAt       *time.Time `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+	DurationSeconds *float64   `json:"duration_seconds"`
+}
+
+// RevertRestoreRequest reverts a restore job to its pre-restore snapshot.
+// The revert drops the target, so it needs a token from the revert
+// confirmation endpoint.
+type RevertRestoreRequest struct {
+	ConfirmationToken string `json:"confirmation_token"`
+}
+
+type RestoreJobListOptions struct {
+	UserID       uuid.UUID
+	ConnectionID string
+	Status       string
+	Limit        int
+	Offset       int
+}
+
+// Outcomes of a restore preflight check
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+	PreflightSkip = "skip"
+)
+
+// Restore preflight checks
+const (
+	PreflightCheckDiskSpace      = "disk_space"
+	PreflightCheckChecksum       = "checksum"
+	PreflightCheckRestoreTool    = "restore_tool"
+	PreflightCheckConnectivity   = "connectivity"
+	PreflightCheckPrivileges     = "privileges"
+	PreflightCheckTargetDatabase = "target_database"
+	PreflightCheckDumpScope      = "dump_scope"
+)
+
+type PreflightCheck struct {
+	Name    string                 `json:"name"`
+	Status  string                 `json:"status"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// RestorePreflightReport is the outcome of checking a restore without
+// running it
+type RestorePreflightReport struct {
+	BackupID       string `json:"backup_id"`
+	ConnectionID   string `json:"connection_id"`
+	TargetDatabase string `json:"target_database"`
+	// Ready is false when a check failed; warnings don't block a restore
+	Ready     bool              `json:"ready"`
+	Checks    []*PreflightCheck `json:"checks"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+// RefreshPipeline refreshes a target database from a source: it takes a
+// fresh backup of the source, restores it over the target and runs SQL
+// scripts against the copy, on demand or on a cron schedule
+type RefreshPipeline struct {
+	ID                 uuid.UUID `json:"id"`
+	UserID             uuid.UUID `json:"user_id"`
+	Name               string    `json:"name"`
+	SourceConnectionID string    `json:"source_connection_id"`
+	// SourceDatabase defaults to the database of the source connection
+	SourceDatabase     string          `json:"source_database"`
+	TargetConnectionID string          `json:"target_connection_id"`
+	TargetDatabase     string          `json:"target_database"`
+	Options            RefreshOptions  `json:"options"`
+	PostRestoreScripts []RefreshScript `json:"post_restore_scripts"`
+	// CronSchedule is nil for pipelines that only run on demand
+	CronSchedule *string    `json:"cron_schedule"`
+	Timezone     string     `json:"timezone"`
+	Enabled      bool       `json:"enabled"`
+	NextRunTime  *time.Time `json:"next_run_time"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RefreshOptions are passed on to the restore of a refresh
+type RefreshOptions struct {
+	Owner    string `json:"owner,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	// SafetySnapshot defaults as for restores, on for production targets
+	SafetySnapshot *bool `json:"safety_snapshot,omitempty"`
+	// MaskingProfileID masks the target after the restore. The profile must
+	// belong to the source connection.
+	MaskingProfileID string `json:"masking_profile_id,omitempty"`
+}
+
+// RefreshScript is SQL run against the target once it is restored, such as
+// resetting passwords or disabling jobs
+type RefreshScript struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+}
+
+type RefreshPipelineRequest struct {
+	Name               string          `json:"name"`
+	SourceConnectionID string          `json:"source_connection_id"`
+	SourceDatabase     string          `json:"source_database"`
+	TargetConnectionID string          `json:"target_connection_id"`
+	TargetDatabase     string          `json:"target_database"`
+	Options            RefreshOptions  `json:"options"`
+	PostRestoreScripts []RefreshScript `json:"post_restore_scripts"`
+	CronSchedule       *string         `json:"cron_schedule"`
+	Timezone           string          `json:"timezone"`
+	Enabled            *bool           `json:"enabled"`
+}
+
+// Steps of a refresh run
+const (
+	RefreshStepBackup      = "backup"
+	RefreshStepRestore     = "restore"
+	RefreshStepPostRestore = "post_restore_sql"
+)
+
+// States of refresh runs and their steps. Only steps are pending or skipped.
+const (
+	RefreshPending   = "pending"
+	RefreshRunning   = "running"
+	RefreshCompleted = "completed"
+	RefreshFailed    = "failed"
+	RefreshSkipped   = "skipped"
+)
+
+// RefreshRun records one run of a refresh pipeline and each of its steps
+type RefreshRun struct {
+	ID          uuid.UUID `json:"id"`
+	PipelineID  string    `json:"pipeline_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	TriggeredBy string    `json:"triggered_by"`
+	Status      string    `json:"status"`
+	// BackupID is the backup of the source taken by the run
+	BackupID *string `json:"backup_id"`
+	// RestoreJobID is the restore job that replaced the target
+	RestoreJobID    *string        `json:"restore_job_id"`
+	Steps           []*RefreshStep `json:"steps"`
+	Error           *string        `json:"error"`
+	StartedAt       time.Time      `json:"started_at"`
+	FinishedAt      *time.Time     `json:"finished_at"`
+	DurationSeconds *float64       `json:"duration_seconds"`
+}
+
+type RefreshStep struct {
+	Name string `json:"name"`
+	// Script names the post-restore script a post_restore_sql step runs
+	Script     string     `json:"script,omitempty"`
+	Status     string     `json:"status"`
+	Error      *string    `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// Masking strategies of a masking rule
+const (
+	// MaskHash replaces a value with its hex SHA-256, so equal values stay
+	// equal and joins still line up
+	MaskHash = "hash"
+	MaskNull = "null"
+	// MaskFakeEmail replaces a value with user_<hash>@example.com
+	MaskFakeEmail = "fake_email"
+	// MaskKeepDomain replaces the local part of an email with user_<hash>
+	MaskKeepDomain = "keep_domain"
+	// MaskTruncate keeps the first Length characters of a value
+	MaskTruncate = "truncate"
+)
+
+// MaskingProfile is a set of rules that scrub personal data from backups of
+// a connection before they reach other environments
+type MaskingProfile struct {
+	ID           uuid.UUID     `json:"id"`
+	UserID       uuid.UUID     `json:"user_id"`
+	ConnectionID string        `json:"connection_id"`
+	Name         string        `json:"name"`
+	Rules        []MaskingRule `json:"rules"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// MaskingRule masks one column, or for MongoDB one document field
+type MaskingRule struct {
+	// Table is "table" or, for PostgreSQL, "schema.table". A table without a
+	// schema matches it in every schema. For MongoDB it is the collection.
+	Table string `json:"table"`
+	// Column is the column name, or for MongoDB a dotted field path
+	Column   string `json:"column"`
+	Strategy string `json:"strategy"`
+	// Length is how many characters the truncate strategy keeps
+	Length int `json:"length,omitempty"`
+}
+
+type MaskingProfileRequest struct {
+	ConnectionID string        `json:"connection_id"`
+	Name         string        `json:"name"`
+	Rules        []MaskingRule `json:"rules"`
+}
+
+// Dump formats detected when a backup is imported
+const (
+	BackupFormatSQL          = "sql"
+	BackupFormatPgCustom     = "pg_custom"
+	BackupFormatMongoArchive = "mongo_archive"
+	BackupFormatRDB          = "rdb"
+)
+
+// ImportBackupRequest holds the form fields sent with an uploaded dump
+type ImportBackupRequest struct {
+	ConnectionID string
+	DatabaseName string
+	// TakenAt is when the dump was taken. It defaults to the upload time and
+	// is what retention counts the backup's age from.
+	TakenAt  *time.Time
+	Filename string
+	Metadata UpdateBackupMetadataRequest
+}
+
+// MaskBackupRequest asks for a masked copy of a backup
+type MaskBackupRequest struct {
+	ProfileID string `json:"profile_id"`
 }
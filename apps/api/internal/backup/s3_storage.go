@@ -2,16 +2,27 @@ package backup
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 )
 
+// errObjectLocked is returned for objects whose object lock retention hasn't
+// expired yet
+var errObjectLocked = errors.New("object is locked")
+
+// maxCopyObjectSize is the largest object S3 copies in a single request
+const maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
 type S3Config struct {
 	Endpoint   string
 	Region     string
@@ -20,12 +31,24 @@ type S3Config struct {
 	SecretKey  string
 	UseSSL     bool
 	PathPrefix string
+	// SSEMode is "", "SSE-S3" or "SSE-KMS"
+	SSEMode     string
+	SSEKMSKeyID string
+	// StorageClass is passed through to the provider (e.g. STANDARD_IA, GLACIER_IR)
+	StorageClass string
+	// ObjectLockMode is "", "GOVERNANCE" or "COMPLIANCE"
+	ObjectLockMode string
 }
 
 type S3Storage struct {
 	client *minio.Client
 	bucket string
 	prefix string
+
+	// Applied to every object written
+	sse          encrypt.ServerSide
+	storageClass string
+	lockMode     minio.RetentionMode
 }
 
 func NewS3Storage(config S3Config) (*S3Storage, error) {
@@ -38,6 +61,31 @@ func NewS3Storage(config S3Config) (*S3Storage, error) {
 		return nil, fmt.Errorf("failed to create S3 client: %w", err)
 	}
 
+	var sse encrypt.ServerSide
+	switch strings.ToUpper(config.SSEMode) {
+	case "":
+	case "SSE-S3":
+		sse = encrypt.NewSSE()
+	case "SSE-KMS":
+		if config.SSEKMSKeyID == "" {
+			return nil, fmt.Errorf("SSE-KMS requires a KMS key ID")
+		}
+		sse, err = encrypt.NewSSEKMS(config.SSEKMSKeyID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure SSE-KMS: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported S3 server-side encryption mode: %s", config.SSEMode)
+	}
+
+	var lockMode minio.RetentionMode
+	if config.ObjectLockMode != "" {
+		lockMode = minio.RetentionMode(strings.ToUpper(config.ObjectLockMode))
+		if !lockMode.IsValid() {
+			return nil, fmt.Errorf("unsupported S3 object lock mode: %s", config.ObjectLockMode)
+		}
+	}
+
 	ctx := context.Background()
 	exists, err := client.BucketExists(ctx, config.Bucket)
 	if err != nil {
@@ -47,6 +95,9 @@ func NewS3Storage(config S3Config) (*S3Storage, error) {
 	if !exists {
 		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{
 			Region: config.Region,
+
+			// Object lock can only be enabled when the bucket is created
+			ObjectLocking: lockMode != "",
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create bucket: %w", err)
@@ -57,9 +108,63 @@ func NewS3Storage(config S3Config) (*S3Storage, error) {
 		client: client,
 		bucket: config.Bucket,
 		prefix: config.PathPrefix,
+
+		sse:          sse,
+		storageClass: strings.ToUpper(config.StorageClass),
+		lockMode:     lockMode,
 	}, nil
 }
 
+// Bucket returns the bucket this storage writes to
+func (s *S3Storage) Bucket() string {
+	return s.bucket
+}
+
+// WithBucket returns a copy of the storage that targets another bucket with
+// the same credentials and upload settings
+func (s *S3Storage) WithBucket(bucket string) *S3Storage {
+	if bucket == "" || bucket == s.bucket {
+		return s
+	}
+	clone := *s
+	clone.bucket = bucket
+	return &clone
+}
+
+// EnsureBucket creates the bucket if it does not exist yet
+func (s *S3Storage) EnsureBucket(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket existence: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{ObjectLocking: s.lockMode != ""}); err != nil {
+		return fmt.Errorf("failed to create bucket: %w", err)
+	}
+	return nil
+}
+
+// putObjectOptions builds the upload options for the configured encryption,
+// storage class and object lock. A zero retainUntil leaves retention to the
+// bucket's default lock configuration.
+func (s *S3Storage) putObjectOptions(retainUntil time.Time) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{
+		ContentType:          "application/octet-stream",
+		ServerSideEncryption: s.sse,
+		StorageClass:         s.storageClass,
+	}
+
+	if s.lockMode != "" && !retainUntil.IsZero() {
+		opts.Mode = s.lockMode
+		opts.RetainUntilDate = retainUntil.UTC()
+	}
+
+	return opts
+}
+
 func (s *S3Storage) UploadFile(ctx context.Context, localPath string) (string, error) {
 	file, err := os.Open(localPath)
 	if err != nil {
@@ -75,9 +180,7 @@ func (s *S3Storage) UploadFile(ctx context.Context, localPath string) (string, e
 	fileName := filepath.Base(localPath)
 	objectKey := s.getObjectKey(fileName)
 
-	_, err = s.client.PutObject(ctx, s.bucket, objectKey, file, fileInfo.Size(), minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
-	})
+	_, err = s.client.PutObject(ctx, s.bucket, objectKey, file, fileInfo.Size(), s.putObjectOptions(time.Time{}))
 	if err != nil {
 		return "", fmt.Errorf("failed to upload to S3: %w", err)
 	}
@@ -85,8 +188,10 @@ func (s *S3Storage) UploadFile(ctx context.Context, localPath string) (string, e
 	return objectKey, nil
 }
 
-// UploadFileWithPath uploads a file to S3 with a custom subfolder path
-func (s *S3Storage) UploadFileWithPath(ctx context.Context, localPath string, subfolder string) (string, error) {
+// UploadFileAs uploads a file to S3 under relativeKey below the configured prefix.
+// When object lock is enabled and retainUntil is set, the object is written
+// with a retention period that expires at retainUntil.
+func (s *S3Storage) UploadFileAs(ctx context.Context, localPath string, relativeKey string, retainUntil time.Time) (string, error) {
 	file, err := os.Open(localPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open file: %w", err)
@@ -98,12 +203,9 @@ func (s *S3Storage) UploadFileWithPath(ctx context.Context, localPath string, su
 		return "", fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	fileName := filepath.Base(localPath)
-	objectKey := s.getObjectKeyWithPath(fileName, subfolder)
+	objectKey := s.getObjectKey(relativeKey)
 
-	_, err = s.client.PutObject(ctx, s.bucket, objectKey, file, fileInfo.Size(), minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
-	})
+	_, err = s.client.PutObject(ctx, s.bucket, objectKey, file, fileInfo.Size(), s.putObjectOptions(retainUntil))
 	if err != nil {
 		return "", fmt.Errorf("failed to upload to S3: %w", err)
 	}
@@ -132,6 +234,37 @@ func (s *S3Storage) DownloadFile(ctx context.Context, objectKey, localPath strin
 	return nil
 }
 
+// OpenObject returns a seekable reader for an object together with its
+// metadata. The caller must close the returned object.
+func (s *S3Storage) OpenObject(ctx context.Context, objectKey string) (*minio.Object, minio.ObjectInfo, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, fmt.Errorf("failed to get object from S3: %w", err)
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, minio.ObjectInfo{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return object, info, nil
+}
+
+// PresignedDownloadURL returns a short-lived URL that downloads the object
+// directly from the bucket as an attachment named fileName
+func (s *S3Storage) PresignedDownloadURL(ctx context.Context, objectKey, fileName string, expires time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	params.Set("response-content-type", "application/octet-stream")
+
+	presignedURL, err := s.client.PresignedGetObject(ctx, s.bucket, objectKey, expires, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object: %w", err)
+	}
+	return presignedURL.String(), nil
+}
+
 func (s *S3Storage) DeleteFile(ctx context.Context, objectKey string) error {
 	err := s.client.RemoveObject(ctx, s.bucket, objectKey, minio.RemoveObjectOptions{})
 	if err != nil {
@@ -140,6 +273,25 @@ func (s *S3Storage) DeleteFile(ctx context.Context, objectKey string) error {
 	return nil
 }
 
+// GetRetainUntil returns the object lock retain-until date of an object, or
+// the zero time if the object is not under retention.
+func (s *S3Storage) GetRetainUntil(ctx context.Context, objectKey string) (time.Time, error) {
+	_, retainUntil, err := s.client.GetObjectRetention(ctx, s.bucket, objectKey, "")
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "ObjectLockConfigurationNotFoundError", "NoSuchObjectLockConfiguration", "InvalidRequest":
+			// Bucket without object lock, nothing can be retained
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to get object retention: %w", err)
+	}
+
+	if retainUntil == nil {
+		return time.Time{}, nil
+	}
+	return *retainUntil, nil
+}
+
 func (s *S3Storage) ListFiles(ctx context.Context) ([]string, error) {
 	var files []string
 
@@ -188,36 +340,114 @@ func (s *S3Storage) getObjectKey(fileName string) string {
 	return fmt.Sprintf("%s/%s", prefix, fileName)
 }
 
-func (s *S3Storage) getObjectKeyWithPath(fileName string, subfolder string) string {
-	// Build path: prefix/subfolder/fileName
-	var parts []string
-	
-	if s.prefix != "" {
-		parts = append(parts, strings.TrimSuffix(s.prefix, "/"))
+// ObjectKey returns the full object key for a key relative to the configured prefix
+func (s *S3Storage) ObjectKey(relativeKey string) string {
+	return s.getObjectKey(relativeKey)
+}
+
+// TransitionObject moves an object into another bucket and/or storage class
+// with a server side copy. Any object lock retention on the source is carried
+// over. Objects still under retention can't leave their bucket, since the
+// source couldn't be deleted after the copy; errObjectLocked is returned for
+// them.
+func (s *S3Storage) TransitionObject(ctx context.Context, objectKey string, dst *S3Storage, storageClass string) error {
+	storageClass = strings.ToUpper(storageClass)
+	if storageClass == "" {
+		storageClass = dst.storageClass
 	}
-	
-	if subfolder != "" {
-		parts = append(parts, strings.Trim(subfolder, "/"))
+	if dst.bucket == s.bucket && storageClass == "" {
+		// Nothing would change, and S3 refuses to copy an object onto itself
+		return nil
+	}
+
+	retainUntil, err := s.GetRetainUntil(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+	if dst.bucket != s.bucket && retainUntil.After(time.Now()) {
+		return fmt.Errorf("%w until %s", errObjectLocked, retainUntil.Format(time.RFC3339))
+	}
+
+	info, err := s.client.StatObject(ctx, s.bucket, objectKey, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to stat object: %w", err)
 	}
-	
-	parts = append(parts, strings.TrimPrefix(fileName, "/"))
-	
-	return strings.Join(parts, "/")
-}
 
-// MoveFile moves/renames an object in S3 (copy then delete)
-func (s *S3Storage) MoveFile(ctx context.Context, oldKey, newKey string) error {
-	// Copy to new location
 	src := minio.CopySrcOptions{
 		Bucket: s.bucket,
-		Object: oldKey,
+		Object: objectKey,
 	}
+	if err := s.copyObject(ctx, dst.copyDestOptions(objectKey, storageClass, retainUntil), src, info.Size); err != nil {
+		return fmt.Errorf("failed to copy object to %s: %w", dst.bucket, err)
+	}
+
+	if dst.bucket != s.bucket {
+		if err := s.client.RemoveObject(ctx, s.bucket, objectKey, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to delete source object: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// copyDestOptions gives a server side copy the encryption, storage class and
+// retention putObjectOptions gives an upload
+func (s *S3Storage) copyDestOptions(objectKey, storageClass string, retainUntil time.Time) minio.CopyDestOptions {
+	opts := s.putObjectOptions(retainUntil)
+	if storageClass != "" {
+		opts.StorageClass = storageClass
+	}
+
 	dst := minio.CopyDestOptions{
+		Bucket:          s.bucket,
+		Object:          objectKey,
+		Encryption:      opts.ServerSideEncryption,
+		ContentType:     opts.ContentType,
+		Mode:            opts.Mode,
+		RetainUntilDate: opts.RetainUntilDate,
+	}
+	if opts.StorageClass != "" {
+		// A copy only takes a storage class along with replaced metadata
+		dst.ReplaceMetadata = true
+		dst.UserMetadata = map[string]string{"X-Amz-Storage-Class": opts.StorageClass}
+	}
+	return dst
+}
+
+// copyObject copies an object server side. A single copy request is limited
+// to 5 GiB, larger objects are copied part by part.
+func (s *S3Storage) copyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions, size int64) error {
+	var err error
+	if size > maxCopyObjectSize {
+		_, err = s.client.ComposeObject(ctx, dst, src)
+	} else {
+		_, err = s.client.CopyObject(ctx, dst, src)
+	}
+	return err
+}
+
+// MoveFile moves/renames an object in S3 (copy then delete). An object under
+// retention can't be deleted, so it is left where it is.
+func (s *S3Storage) MoveFile(ctx context.Context, oldKey, newKey string) error {
+	retainUntil, err := s.GetRetainUntil(ctx, oldKey)
+	if err != nil {
+		return err
+	}
+	if retainUntil.After(time.Now()) {
+		return fmt.Errorf("%w until %s", errObjectLocked, retainUntil.Format(time.RFC3339))
+	}
+
+	info, err := s.client.StatObject(ctx, s.bucket, oldKey, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	// Copy to new location, keeping the class of archived objects
+	src := minio.CopySrcOptions{
 		Bucket: s.bucket,
-		Object: newKey,
+		Object: oldKey,
 	}
-	
-	_, err := s.client.CopyObject(ctx, dst, src)
+	err = s.copyObject(ctx, s.copyDestOptions(newKey, info.StorageClass, time.Time{}), src, info.Size)
 	if err != nil {
 		return fmt.Errorf("failed to copy object: %w", err)
 	}
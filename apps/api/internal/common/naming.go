@@ -0,0 +1,118 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultBackupPathTemplate reproduces the original <connection>/<db>_<timestamp>.sql layout
+const DefaultBackupPathTemplate = "{connection}/{db}_{date:20060102_150405}.sql"
+
+// NamingContext holds the values available to backup naming templates
+type NamingContext struct {
+	Connection string
+	Database   string
+	Type       string
+	Time       time.Time
+	Schedule   string
+	ID         string
+}
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z]+)(?::([^}]*))?\}`)
+
+var unsafePathChars = regexp.MustCompile(`[/\\:*?"<>|\x00-\x1f]+`)
+
+// RenderNamingTemplate expands a backup naming template into a slash separated
+// relative path. Supported placeholders are {connection}, {db}, {type},
+// {date:layout} (Go time layout), {schedule} and {id}.
+func RenderNamingTemplate(template string, ctx NamingContext) (string, error) {
+	if strings.TrimSpace(template) == "" {
+		template = DefaultBackupPathTemplate
+	}
+
+	var renderErr error
+	rendered := placeholderPattern.ReplaceAllStringFunc(template, func(match string) string {
+		parts := placeholderPattern.FindStringSubmatch(match)
+		name, arg := parts[1], parts[2]
+
+		switch name {
+		case "connection":
+			return SanitizeConnectionName(ctx.Connection)
+		case "db":
+			return sanitizePathSegment(ctx.Database, "default")
+		case "type":
+			return sanitizePathSegment(ctx.Type, "unknown")
+		case "date":
+			if arg == "" {
+				arg = "20060102_150405"
+			}
+			// Layouts may contain "/" to build date based folders
+			segments := strings.Split(ctx.Time.Format(arg), "/")
+			for i, segment := range segments {
+				segments[i] = sanitizePathSegment(segment, "_")
+			}
+			return strings.Join(segments, "/")
+		case "schedule":
+			return sanitizePathSegment(ctx.Schedule, "manual")
+		case "id":
+			return sanitizePathSegment(ctx.ID, "")
+		default:
+			renderErr = fmt.Errorf("unknown placeholder %s in naming template", match)
+			return match
+		}
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+
+	cleaned := path.Clean(strings.ReplaceAll(rendered, "\\", "/"))
+	if cleaned == "." || strings.HasPrefix(cleaned, "/") || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("naming template %q must render to a relative path inside the backup directory", template)
+	}
+	if strings.HasSuffix(rendered, "/") {
+		return "", fmt.Errorf("naming template %q must end with a file name", template)
+	}
+
+	return cleaned, nil
+}
+
+// ValidateNamingTemplate checks that a template only uses known placeholders,
+// renders to a safe relative path and names every backup differently. A
+// template without {id} or a {date} down to the second would overwrite the
+// previous backup's file while its record still points at it.
+func ValidateNamingTemplate(template string) error {
+	ctx := NamingContext{
+		Connection: "connection",
+		Database:   "database",
+		Type:       "postgresql",
+		Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Schedule:   "schedule",
+		ID:         "00000000-0000-0000-0000-000000000001",
+	}
+	first, err := RenderNamingTemplate(template, ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.Time = ctx.Time.Add(time.Second)
+	ctx.ID = "00000000-0000-0000-0000-000000000002"
+	second, err := RenderNamingTemplate(template, ctx)
+	if err != nil {
+		return err
+	}
+	if first == second {
+		return fmt.Errorf("naming template %q must include {id} or a {date} with seconds so backups don't overwrite each other", template)
+	}
+	return nil
+}
+
+func sanitizePathSegment(value, fallback string) string {
+	value = strings.Trim(unsafePathChars.ReplaceAllString(value, "_"), "_. ")
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,134 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderNamingTemplate(t *testing.T) {
+	ctx := NamingContext{
+		Connection: "Prod DB",
+		Database:   "sales",
+		Type:       "postgresql",
+		Time:       time.Date(2024, 3, 9, 14, 5, 6, 0, time.UTC),
+		Schedule:   "nightly",
+		ID:         "1234-abcd",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		ctx      NamingContext
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "empty template uses the default layout",
+			template: "",
+			ctx:      ctx,
+			want:     "prod_db/sales_20240309_140506.sql",
+		},
+		{
+			name:     "all placeholders",
+			template: "{type}/{connection}/{schedule}/{db}-{id}.sql",
+			ctx:      ctx,
+			want:     "postgresql/prod_db/nightly/sales-1234-abcd.sql",
+		},
+		{
+			name:     "date layout with folders",
+			template: "{db}/{date:2006/01/02}/{date:150405}.sql",
+			ctx:      ctx,
+			want:     "sales/2024/03/09/140506.sql",
+		},
+		{
+			name:     "date without layout",
+			template: "{db}_{date}.sql",
+			ctx:      ctx,
+			want:     "sales_20240309_140506.sql",
+		},
+		{
+			name:     "unsafe characters are replaced",
+			template: "{db}.sql",
+			ctx:      NamingContext{Database: `a/b\c:d*e`},
+			want:     "a_b_c_d_e.sql",
+		},
+		{
+			name:     "missing values fall back",
+			template: "{db}/{type}/{schedule}.sql",
+			ctx:      NamingContext{},
+			want:     "default/unknown/manual.sql",
+		},
+		{
+			name:     "dot segments are cleaned",
+			template: "./{db}//backup.sql",
+			ctx:      ctx,
+			want:     "sales/backup.sql",
+		},
+		{
+			name:     "unknown placeholder",
+			template: "{db}_{host}.sql",
+			ctx:      ctx,
+			wantErr:  "unknown placeholder {host}",
+		},
+		{
+			name:     "absolute path",
+			template: "/var/backups/{db}.sql",
+			ctx:      ctx,
+			wantErr:  "must render to a relative path",
+		},
+		{
+			name:     "escapes the backup directory",
+			template: "../{db}.sql",
+			ctx:      ctx,
+			wantErr:  "must render to a relative path",
+		},
+		{
+			name:     "ends with a folder",
+			template: "{db}/",
+			ctx:      ctx,
+			wantErr:  "must end with a file name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderNamingTemplate(tt.template, tt.ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RenderNamingTemplate(%q) error = %v, want %q", tt.template, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderNamingTemplate(%q): %v", tt.template, err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderNamingTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNamingTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{template: DefaultBackupPathTemplate},
+		{template: "{db}/{id}.sql"},
+		{template: "{connection}/{date:2006-01-02T15-04-05}.sql"},
+		// Backups of the same minute or database would share a file
+		{template: "{db}/{date:2006-01-02_1504}.sql", wantErr: true},
+		{template: "{connection}/{db}.sql", wantErr: true},
+		{template: "latest.sql", wantErr: true},
+		{template: "{db}_{bogus}.sql", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateNamingTemplate(tt.template)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateNamingTemplate(%q) error = %v, want error %t", tt.template, err, tt.wantErr)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/common/response"
@@ -12,7 +13,9 @@ import (
 
 type BackupService interface {
 	CleanupS3BackupsForConnection(connectionID string) error
-	RenameS3FolderForConnection(connectionID string, oldName string, newName string) error
+	RelocateBackupsForConnection(connectionID string) error
+	ApplyPoliciesForConnection(connectionID string) error
+	RemoveConnectionFromPolicies(connectionID string) error
 }
 
 type ConnectionHandler struct {
@@ -56,6 +59,11 @@ func (h *ConnectionHandler) SaveConnection(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if err := validateNamingSettings(config.BackupDir, config.PathTemplate, config.S3KeyTemplate); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	userID, err := common.GetUserIDFromContext(r.Context())
 	if err != nil {
 		response.SendError(w, http.StatusBadRequest, err.Error())
@@ -129,17 +137,23 @@ func (h *ConnectionHandler) UpdateConnection(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if err := validateNamingSettings(config.BackupDir, config.PathTemplate, config.S3KeyTemplate); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	storedConn, err := h.service.UpdateConnection(config, userID)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Rename S3 folder if connection name changed
-	if existingConn.Name != config.Name && h.backupService != nil {
-		if err := h.backupService.RenameS3FolderForConnection(config.ID, existingConn.Name, config.Name); err != nil {
-			fmt.Printf("Warning: Failed to rename S3 folder for connection %s: %v\n", config.ID, err)
-			// Continue even if S3 rename fails
+	// Move backups to their new location if the connection name or naming changed
+	namingChanged := config.BackupDir != nil || config.PathTemplate != nil || config.S3KeyTemplate != nil
+	if (existingConn.Name != config.Name || namingChanged) && h.backupService != nil {
+		if err := h.backupService.RelocateBackupsForConnection(config.ID); err != nil {
+			fmt.Printf("Warning: Failed to relocate backups for connection %s: %v\n", config.ID, err)
+			// Continue even if relocation fails
 		}
 	}
 
@@ -156,20 +170,41 @@ func (h *ConnectionHandler) UpdateConnectionSettings(w http.ResponseWriter, r *h
 		return
 	}
 
-	var req struct {
-		S3CleanupOnRetention *bool `json:"s3_cleanup_on_retention"`
+	var req ConnectionSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := validateNamingSettings(req.BackupDir, req.PathTemplate, req.S3KeyTemplate); err != nil {
 		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if req.Tags != nil {
+		if _, err := NormalizeTags(*req.Tags); err != nil {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
-	if err := h.service.UpdateConnectionSettings(id, req.S3CleanupOnRetention); err != nil {
+	if err := h.service.UpdateConnectionSettings(id, req); err != nil {
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	if req.namingChanged() && h.backupService != nil {
+		if err := h.backupService.RelocateBackupsForConnection(id); err != nil {
+			fmt.Printf("Warning: Failed to relocate backups for connection %s: %v\n", id, err)
+		}
+	}
+
+	// Policies targeting tags may now cover a different set of connections
+	if req.Tags != nil && h.backupService != nil {
+		if err := h.backupService.ApplyPoliciesForConnection(id); err != nil {
+			fmt.Printf("Warning: Failed to apply backup policies to connection %s: %v\n", id, err)
+		}
+	}
+
 	response.SendSuccess(w, "Connection settings updated successfully", nil)
 }
 
@@ -198,6 +233,12 @@ func (h *ConnectionHandler) DeleteConnection(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if h.backupService != nil {
+		if err := h.backupService.RemoveConnectionFromPolicies(id); err != nil {
+			fmt.Printf("Warning: Failed to remove connection %s from backup policies: %v\n", id, err)
+		}
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -250,3 +291,21 @@ func (h *ConnectionHandler) UpdateSelectedDatabases(w http.ResponseWriter, r *ht
 		"message": "Selected databases updated successfully",
 	})
 }
+
+// validateNamingSettings checks the per-connection backup location settings
+func validateNamingSettings(backupDir, pathTemplate, s3KeyTemplate *string) error {
+	if backupDir != nil && *backupDir != "" && strings.TrimSpace(*backupDir) == "" {
+		return fmt.Errorf("backup_dir must not be blank")
+	}
+	if pathTemplate != nil && *pathTemplate != "" {
+		if err := common.ValidateNamingTemplate(*pathTemplate); err != nil {
+			return fmt.Errorf("invalid path_template: %w", err)
+		}
+	}
+	if s3KeyTemplate != nil && *s3KeyTemplate != "" {
+		if err := common.ValidateNamingTemplate(*s3KeyTemplate); err != nil {
+			return fmt.Errorf("invalid s3_key_template: %w", err)
+		}
+	}
+	return nil
+}
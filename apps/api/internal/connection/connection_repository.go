@@ -2,6 +2,8 @@ package connection
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/google/uuid"
@@ -66,9 +68,10 @@ func (r *ConnectionRepository) Save(conn StoredConnection) error {
 			id, name, type, host, port, username, password, 
 			database_name, ssl, database_size, created_at, updated_at, 
 			last_connected_at, user_id, status, ssh_enabled, ssh_host, 
-			ssh_port, ssh_username, ssh_password, ssh_private_key, s3_cleanup_on_retention
+			ssh_port, ssh_username, ssh_password, ssh_private_key, s3_cleanup_on_retention,
+			backup_dir, path_template, s3_key_template
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25
 		)`
 
 	_, err = r.db.Exec(
@@ -95,6 +98,9 @@ func (r *ConnectionRepository) Save(conn StoredConnection) error {
 		sshPassword,
 		sshPrivateKey,
 		s3CleanupInt,
+		conn.BackupDir,
+		conn.PathTemplate,
+		conn.S3KeyTemplate,
 	)
 
 	return err
@@ -105,6 +111,7 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 	var encryptedUsername, encryptedPassword string
 	var encryptedSSHPassword, encryptedSSHPrivateKey sql.NullString
 	var selectedDatabasesStr sql.NullString
+	var tagsStr string
 	var sslInt, sshEnabledInt, s3CleanupInt int
 
 	query := `SELECT 
@@ -112,7 +119,11 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 		database_size, created_at, updated_at, last_connected_at, user_id, status,
 		ssh_enabled, ssh_host, ssh_port, ssh_username, ssh_password, ssh_private_key,
 		COALESCE(selected_databases, '') as selected_databases,
-		COALESCE(s3_cleanup_on_retention, 1) as s3_cleanup_on_retention
+		COALESCE(s3_cleanup_on_retention, 1) as s3_cleanup_on_retention,
+		COALESCE(backup_dir, '') as backup_dir,
+		COALESCE(path_template, '') as path_template,
+		COALESCE(s3_key_template, '') as s3_key_template,
+		COALESCE(tags, '') as tags
 	FROM connections WHERE id = $1`
 
 	err := r.db.QueryRow(query, id).Scan(
@@ -139,11 +150,19 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 		&encryptedSSHPrivateKey,
 		&selectedDatabasesStr,
 		&s3CleanupInt,
+		&conn.BackupDir,
+		&conn.PathTemplate,
+		&conn.S3KeyTemplate,
+		&tagsStr,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if conn.Tags, err = decodeTags(tagsStr); err != nil {
+		return nil, err
+	}
+
 	conn.SSL = sslInt != 0
 	conn.SSHEnabled = sshEnabledInt != 0
 	conn.S3CleanupOnRetention = s3CleanupInt != 0
@@ -238,8 +257,10 @@ func (r *ConnectionRepository) Update(conn StoredConnection) error {
 			username = $5, password = $6, database_name = $7, 
 			ssl = $8, ssh_enabled = $9, ssh_host = $10, ssh_port = $11,
 			ssh_username = $12, ssh_password = $13, ssh_private_key = $14,
-			database_size = $15, s3_cleanup_on_retention = $16, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $17`
+			database_size = $15, s3_cleanup_on_retention = $16,
+			backup_dir = $17, path_template = $18, s3_key_template = $19,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $20`
 
 	_, err = r.db.Exec(
 		query,
@@ -259,6 +280,9 @@ func (r *ConnectionRepository) Update(conn StoredConnection) error {
 		sshPrivateKey,
 		conn.DatabaseSize,
 		s3CleanupInt,
+		conn.BackupDir,
+		conn.PathTemplate,
+		conn.S3KeyTemplate,
 		conn.ID,
 	)
 
@@ -274,21 +298,30 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 			c.host,
 			c.status,
 			c.database_size,
-			b.completed_time as last_backup_time,
-			COALESCE(bs.enabled, false) as backup_enabled,
+			(
+				SELECT MAX(completed_time)
+				FROM backups
+				WHERE connection_id = c.id AND deleted_at IS NULL
+			) as last_backup_time,
+			EXISTS (
+				SELECT 1 FROM backup_schedules
+				WHERE connection_id = c.id AND enabled = true
+			) as backup_enabled,
 			bs.cron_schedule,
 			bs.retention_days,
-			COALESCE(c.s3_cleanup_on_retention, 1) as s3_cleanup_on_retention
+			(
+				SELECT COUNT(*) FROM backup_schedules
+				WHERE connection_id = c.id AND enabled = true
+			) as schedule_count,
+			COALESCE(c.s3_cleanup_on_retention, 1) as s3_cleanup_on_retention,
+			COALESCE(c.tags, '') as tags
 		FROM connections c
-		LEFT JOIN backup_schedules bs ON c.id = bs.connection_id AND bs.enabled = true
-		LEFT JOIN backups b ON c.id = b.connection_id
-			AND b.completed_time = (
-				SELECT MAX(completed_time)
-				FROM backups
-				WHERE connection_id = c.id
-			)
+		LEFT JOIN backup_schedules bs ON bs.id = (
+			SELECT id FROM backup_schedules
+			WHERE connection_id = c.id AND enabled = true
+			ORDER BY created_at DESC LIMIT 1
+		)
 		WHERE c.user_id = $1
-		GROUP BY c.id, c.name, c.type, c.host, c.status, c.database_size, b.completed_time, bs.enabled, bs.cron_schedule, bs.retention_days, c.s3_cleanup_on_retention
 	`
 
 	rows, err := r.db.Query(query, userID)
@@ -304,6 +337,7 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 		var cronSchedule sql.NullString
 		var retentionDays sql.NullInt64
 		var s3CleanupInt int
+		var tagsStr string
 
 		err := rows.Scan(
 			&conn.ID,
@@ -316,12 +350,17 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 			&conn.BackupEnabled,
 			&cronSchedule,
 			&retentionDays,
+			&conn.ScheduleCount,
 			&s3CleanupInt,
+			&tagsStr,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		if conn.Tags, err = decodeTags(tagsStr); err != nil {
+			return nil, err
+		}
 		if lastBackupTime.Valid {
 			conn.LastBackupTime = &lastBackupTime.String
 		}
@@ -361,3 +400,29 @@ func (r *ConnectionRepository) UpdateSelectedDatabases(id string, databases []st
 	_, err := r.db.Exec(query, dbString, id)
 	return err
 }
+
+func (r *ConnectionRepository) UpdateTags(id string, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE connections SET tags = $1, updated_at = datetime('now') WHERE id = $2`
+	_, err = r.db.Exec(query, string(tagsJSON), id)
+	return err
+}
+
+// decodeTags parses the JSON tags column, which is empty for untagged connections
+func decodeTags(tagsStr string) ([]string, error) {
+	tags := []string{}
+	if tagsStr == "" {
+		return tags, nil
+	}
+	if err := json.Unmarshal([]byte(tagsStr), &tags); err != nil {
+		return nil, fmt.Errorf("error parsing connection tags: %v", err)
+	}
+	return tags, nil
+}
@@ -2,6 +2,7 @@ package connection
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -63,6 +64,16 @@ func (s *ConnectionService) SaveConnection(config ConnectionConfig, userID uuid.
 		DatabaseSize:  dbSize,
 	}
 
+	if config.BackupDir != nil {
+		storedConn.BackupDir = *config.BackupDir
+	}
+	if config.PathTemplate != nil {
+		storedConn.PathTemplate = *config.PathTemplate
+	}
+	if config.S3KeyTemplate != nil {
+		storedConn.S3KeyTemplate = *config.S3KeyTemplate
+	}
+
 	if err := s.repo.Save(storedConn); err != nil {
 		return nil, err
 	}
@@ -115,12 +126,24 @@ func (s *ConnectionService) UpdateConnection(config ConnectionConfig, userID uui
 		Status:               "connected",
 		DatabaseSize:         dbSize,
 		S3CleanupOnRetention: existingConn.S3CleanupOnRetention, // preserve existing value
+		BackupDir:            existingConn.BackupDir,
+		PathTemplate:         existingConn.PathTemplate,
+		S3KeyTemplate:        existingConn.S3KeyTemplate,
 	}
 
 	// Update S3 cleanup setting if provided
 	if config.S3CleanupOnRetention != nil {
 		storedConn.S3CleanupOnRetention = *config.S3CleanupOnRetention
 	}
+	if config.BackupDir != nil {
+		storedConn.BackupDir = *config.BackupDir
+	}
+	if config.PathTemplate != nil {
+		storedConn.PathTemplate = *config.PathTemplate
+	}
+	if config.S3KeyTemplate != nil {
+		storedConn.S3KeyTemplate = *config.S3KeyTemplate
+	}
 
 	if err := s.repo.Update(storedConn); err != nil {
 		return nil, err
@@ -130,17 +153,37 @@ func (s *ConnectionService) UpdateConnection(config ConnectionConfig, userID uui
 }
 
 // UpdateConnectionSettings updates connection settings without testing the connection
-func (s *ConnectionService) UpdateConnectionSettings(id string, s3CleanupOnRetention *bool) error {
+func (s *ConnectionService) UpdateConnectionSettings(id string, settings ConnectionSettings) error {
 	existingConn, err := s.repo.GetConnection(id)
 	if err != nil {
 		return fmt.Errorf("failed to get connection: %w", err)
 	}
 
-	if s3CleanupOnRetention != nil {
-		existingConn.S3CleanupOnRetention = *s3CleanupOnRetention
+	if settings.S3CleanupOnRetention != nil {
+		existingConn.S3CleanupOnRetention = *settings.S3CleanupOnRetention
+	}
+	if settings.BackupDir != nil {
+		existingConn.BackupDir = strings.TrimSpace(*settings.BackupDir)
+	}
+	if settings.PathTemplate != nil {
+		existingConn.PathTemplate = strings.TrimSpace(*settings.PathTemplate)
+	}
+	if settings.S3KeyTemplate != nil {
+		existingConn.S3KeyTemplate = strings.TrimSpace(*settings.S3KeyTemplate)
 	}
 
-	return s.repo.Update(*existingConn)
+	if err := s.repo.Update(*existingConn); err != nil {
+		return err
+	}
+
+	if settings.Tags != nil {
+		tags, err := NormalizeTags(*settings.Tags)
+		if err != nil {
+			return err
+		}
+		return s.repo.UpdateTags(id, tags)
+	}
+	return nil
 }
 
 func (s *ConnectionService) DeleteConnection(id string) error {
@@ -1,54 +1,106 @@
 package connection
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type StoredConnection struct {
-	ID                string     `json:"id"`
-	Name              string     `json:"name"`
-	Type              string     `json:"type"`
-	Host              string     `json:"host"`
-	Port              int        `json:"port"`
-	Username          string     `json:"username"`
-	Password          string     `json:"password"`
-	DatabaseName      string     `json:"database_name"`
-	SelectedDatabases []string   `json:"selected_databases"`
-	SSL               bool       `json:"ssl"`
-	SSHEnabled        bool       `json:"ssh_enabled"`
-	SSHHost           string     `json:"ssh_host"`
-	SSHPort           int        `json:"ssh_port"`
-	SSHUsername       string     `json:"ssh_username"`
-	SSHPassword            string     `json:"ssh_password"`
-	SSHPrivateKey          string     `json:"ssh_private_key"`
-	S3CleanupOnRetention   bool       `json:"s3_cleanup_on_retention"`
-	CreatedAt              string     `json:"created_at"`
-	UpdatedAt              string     `json:"updated_at"`
-	LastConnectedAt        *time.Time `json:"last_connected_at"`
-	UserID                 uuid.UUID  `json:"user_id"`
-	Status                 string     `json:"status"`
-	DatabaseSize           int64      `json:"database_size"`
+	ID                   string     `json:"id"`
+	Name                 string     `json:"name"`
+	Type                 string     `json:"type"`
+	Host                 string     `json:"host"`
+	Port                 int        `json:"port"`
+	Username             string     `json:"username"`
+	Password             string     `json:"password"`
+	DatabaseName         string     `json:"database_name"`
+	SelectedDatabases    []string   `json:"selected_databases"`
+	Tags                 []string   `json:"tags"`
+	SSL                  bool       `json:"ssl"`
+	SSHEnabled           bool       `json:"ssh_enabled"`
+	SSHHost              string     `json:"ssh_host"`
+	SSHPort              int        `json:"ssh_port"`
+	SSHUsername          string     `json:"ssh_username"`
+	SSHPassword          string     `json:"ssh_password"`
+	SSHPrivateKey        string     `json:"ssh_private_key"`
+	S3CleanupOnRetention bool       `json:"s3_cleanup_on_retention"`
+	BackupDir            string     `json:"backup_dir"`
+	PathTemplate         string     `json:"path_template"`
+	S3KeyTemplate        string     `json:"s3_key_template"`
+	CreatedAt            string     `json:"created_at"`
+	UpdatedAt            string     `json:"updated_at"`
+	LastConnectedAt      *time.Time `json:"last_connected_at"`
+	UserID               uuid.UUID  `json:"user_id"`
+	Status               string     `json:"status"`
+	DatabaseSize         int64      `json:"database_size"`
 }
 
 type ConnectionConfig struct {
-	ID                   string `json:"id"`
-	Name                 string `json:"name"`
-	Type                 string `json:"type"`
-	Host                 string `json:"host"`
-	Port                 int    `json:"port"`
-	Username             string `json:"username"`
-	Password             string `json:"password"`
-	Database             string `json:"database"`
-	SSL                  bool   `json:"ssl"`
-	SSHEnabled           bool   `json:"ssh_enabled"`
-	SSHHost              string `json:"ssh_host"`
-	SSHPort              int    `json:"ssh_port"`
-	SSHUsername          string `json:"ssh_username"`
-	SSHPassword          string `json:"ssh_password"`
-	SSHPrivateKey        string `json:"ssh_private_key"`
-	S3CleanupOnRetention *bool  `json:"s3_cleanup_on_retention,omitempty"`
+	ID                   string  `json:"id"`
+	Name                 string  `json:"name"`
+	Type                 string  `json:"type"`
+	Host                 string  `json:"host"`
+	Port                 int     `json:"port"`
+	Username             string  `json:"username"`
+	Password             string  `json:"password"`
+	Database             string  `json:"database"`
+	SSL                  bool    `json:"ssl"`
+	SSHEnabled           bool    `json:"ssh_enabled"`
+	SSHHost              string  `json:"ssh_host"`
+	SSHPort              int     `json:"ssh_port"`
+	SSHUsername          string  `json:"ssh_username"`
+	SSHPassword          string  `json:"ssh_password"`
+	SSHPrivateKey        string  `json:"ssh_private_key"`
+	S3CleanupOnRetention *bool   `json:"s3_cleanup_on_retention,omitempty"`
+	BackupDir            *string `json:"backup_dir,omitempty"`
+	PathTemplate         *string `json:"path_template,omitempty"`
+	S3KeyTemplate        *string `json:"s3_key_template,omitempty"`
+}
+
+// ConnectionSettings holds per-connection options that can be changed without
+// re-testing the connection. Nil fields are left unchanged.
+type ConnectionSettings struct {
+	S3CleanupOnRetention *bool `json:"s3_cleanup_on_retention"`
+	// BackupDir overrides the server's local backup root for this connection
+	BackupDir *string `json:"backup_dir"`
+	// PathTemplate names local backup files relative to the backup root
+	PathTemplate *string `json:"path_template"`
+	// S3KeyTemplate names S3 objects relative to the path prefix, defaults to PathTemplate
+	S3KeyTemplate *string `json:"s3_key_template"`
+	// Tags group connections so backup policies can target them
+	Tags *[]string `json:"tags"`
+}
+
+// maxTagLength caps the length of a connection tag
+const maxTagLength = 64
+
+// NormalizeTags trims and lowercases tags and drops duplicates, so tags match
+// regardless of how they were typed
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, fmt.Errorf("tags must not be empty")
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// namingChanged reports whether the settings touch where backups are stored
+func (s ConnectionSettings) namingChanged() bool {
+	return s.BackupDir != nil || s.PathTemplate != nil || s.S3KeyTemplate != nil
 }
 
 type ConnectionStats struct {
@@ -62,15 +114,17 @@ type ConnectionStats struct {
 }
 
 type ConnectionListItem struct {
-	ID             string  `json:"id"`
-	Name           string  `json:"name"`
-	Type           string  `json:"type"`
-	Host           string  `json:"host"`
-	Status         string  `json:"status"`
-	DatabaseSize   int64   `json:"database_size"`
-	LastBackupTime       *string `json:"last_backup_time"`
-	BackupEnabled        bool    `json:"backup_enabled"`
-	CronSchedule         *string `json:"cron_schedule"`
-	RetentionDays        *int    `json:"retention_days"`
-	S3CleanupOnRetention bool    `json:"s3_cleanup_on_retention"`
+	ID                   string   `json:"id"`
+	Name                 string   `json:"name"`
+	Type                 string   `json:"type"`
+	Host                 string   `json:"host"`
+	Status               string   `json:"status"`
+	DatabaseSize         int64    `json:"database_size"`
+	LastBackupTime       *string  `json:"last_backup_time"`
+	BackupEnabled        bool     `json:"backup_enabled"`
+	CronSchedule         *string  `json:"cron_schedule"`
+	RetentionDays        *int     `json:"retention_days"`
+	ScheduleCount        int      `json:"schedule_count"`
+	S3CleanupOnRetention bool     `json:"s3_cleanup_on_retention"`
+	Tags                 []string `json:"tags"`
 }
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding S3 encryption, storage class and object lock settings to user_settings';
+
+ALTER TABLE user_settings ADD COLUMN s3_sse_mode TEXT;
+ALTER TABLE user_settings ADD COLUMN s3_sse_kms_key_id TEXT;
+ALTER TABLE user_settings ADD COLUMN s3_storage_class TEXT;
+ALTER TABLE user_settings ADD COLUMN s3_object_lock_mode TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing S3 encryption, storage class and object lock settings from user_settings';
+
+ALTER TABLE user_settings DROP COLUMN s3_sse_mode;
+ALTER TABLE user_settings DROP COLUMN s3_sse_kms_key_id;
+ALTER TABLE user_settings DROP COLUMN s3_storage_class;
+ALTER TABLE user_settings DROP COLUMN s3_object_lock_mode;
+
+-- +goose StatementEnd
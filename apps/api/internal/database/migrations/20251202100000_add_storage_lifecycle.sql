@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding storage tiers and lifecycle rules';
+
+CREATE TABLE lifecycle_rules (
+    connection_id TEXT PRIMARY KEY REFERENCES connections(id),
+    enabled BOOLEAN DEFAULT TRUE,
+    local_days INTEGER DEFAULT 0,
+    s3_days INTEGER DEFAULT 0,
+    archive_days INTEGER DEFAULT 0,
+    archive_storage_class TEXT,
+    archive_bucket TEXT,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE backups ADD COLUMN storage_tier TEXT DEFAULT 'local';
+ALTER TABLE backups ADD COLUMN s3_bucket TEXT;
+
+-- Uploaded backups of users purging local copies only exist in S3
+UPDATE backups SET storage_tier = 's3'
+WHERE COALESCE(s3_object_key, '') != ''
+AND connection_id IN (
+    SELECT c.id FROM connections c
+    JOIN user_settings us ON us.user_id = c.user_id
+    WHERE us.s3_purge_local
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing storage tiers and lifecycle rules';
+
+DROP TABLE lifecycle_rules;
+
+ALTER TABLE backups DROP COLUMN storage_tier;
+ALTER TABLE backups DROP COLUMN s3_bucket;
+
+-- +goose StatementEnd
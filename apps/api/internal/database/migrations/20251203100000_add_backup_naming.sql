@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup directory and naming templates';
+
+ALTER TABLE connections ADD COLUMN backup_dir TEXT;
+ALTER TABLE connections ADD COLUMN path_template TEXT;
+ALTER TABLE connections ADD COLUMN s3_key_template TEXT;
+
+ALTER TABLE backups ADD COLUMN database_name TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup directory and naming templates';
+
+ALTER TABLE connections DROP COLUMN backup_dir;
+ALTER TABLE connections DROP COLUMN path_template;
+ALTER TABLE connections DROP COLUMN s3_key_template;
+
+ALTER TABLE backups DROP COLUMN database_name;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding named schedules with backup options and destinations';
+
+ALTER TABLE backup_schedules ADD COLUMN name TEXT;
+ALTER TABLE backup_schedules ADD COLUMN options TEXT;
+ALTER TABLE backup_schedules ADD COLUMN destinations TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing named schedules with backup options and destinations';
+
+ALTER TABLE backup_schedules DROP COLUMN name;
+ALTER TABLE backup_schedules DROP COLUMN options;
+ALTER TABLE backup_schedules DROP COLUMN destinations;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding timezone to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN timezone TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing timezone from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN timezone;
+
+-- +goose StatementEnd
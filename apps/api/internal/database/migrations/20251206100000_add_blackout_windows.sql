@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding blackout windows and schedule run history';
+
+CREATE TABLE blackout_windows (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    connection_id TEXT REFERENCES connections(id),
+    schedule_id TEXT REFERENCES backup_schedules(id),
+    name TEXT NOT NULL,
+    cron_schedule TEXT,
+    duration_minutes INTEGER DEFAULT 0,
+    timezone TEXT,
+    starts_at TEXT,
+    ends_at TEXT,
+    action TEXT DEFAULT 'skip',
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_blackout_windows_user_id ON blackout_windows(user_id);
+
+CREATE TABLE schedule_runs (
+    id TEXT PRIMARY KEY,
+    schedule_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL REFERENCES connections(id),
+    backup_id TEXT,
+    status TEXT NOT NULL,
+    reason TEXT,
+    scheduled_time TEXT NOT NULL,
+    started_at TEXT,
+    finished_at TEXT,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_schedule_runs_schedule_id ON schedule_runs(schedule_id, scheduled_time);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing blackout windows and schedule run history';
+
+DROP TABLE schedule_runs;
+DROP TABLE blackout_windows;
+
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup ids, errors and triggers to schedule runs';
+
+ALTER TABLE schedule_runs ADD COLUMN backup_ids TEXT;
+ALTER TABLE schedule_runs ADD COLUMN error TEXT;
+ALTER TABLE schedule_runs ADD COLUMN triggered_by TEXT DEFAULT 'schedule';
+
+UPDATE schedule_runs SET backup_ids = json_array(backup_id) WHERE backup_id IS NOT NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup ids, errors and triggers from schedule runs';
+
+ALTER TABLE schedule_runs DROP COLUMN backup_ids;
+ALTER TABLE schedule_runs DROP COLUMN error;
+ALTER TABLE schedule_runs DROP COLUMN triggered_by;
+
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding misfire policy to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN misfire_policy TEXT DEFAULT 'run_once';
+ALTER TABLE backup_schedules ADD COLUMN misfire_grace_minutes INTEGER DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing misfire policy from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN misfire_grace_minutes;
+ALTER TABLE backup_schedules DROP COLUMN misfire_policy;
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding scheduler leases and schedule fire claims';
+
+CREATE TABLE scheduler_leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    expires_at TEXT NOT NULL
+);
+
+CREATE TABLE schedule_claims (
+    schedule_id TEXT NOT NULL,
+    fire_time TEXT NOT NULL,
+    holder TEXT NOT NULL,
+    claimed_at TEXT NOT NULL,
+    PRIMARY KEY (schedule_id, fire_time)
+);
+
+CREATE INDEX idx_schedule_claims_claimed_at ON schedule_claims(claimed_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing scheduler leases and schedule fire claims';
+
+DROP INDEX IF EXISTS idx_schedule_claims_claimed_at;
+DROP TABLE IF EXISTS schedule_claims;
+DROP TABLE IF EXISTS scheduler_leases;
+
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding retry policy to backup schedules and attempts to schedule runs';
+
+ALTER TABLE backup_schedules ADD COLUMN retry_policy TEXT;
+ALTER TABLE schedule_runs ADD COLUMN attempts INTEGER DEFAULT 0;
+ALTER TABLE schedule_runs ADD COLUMN attempt_errors TEXT;
+
+UPDATE schedule_runs SET attempts = 1 WHERE status IN ('completed', 'failed');
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing retry policy from backup schedules and attempts from schedule runs';
+
+ALTER TABLE schedule_runs DROP COLUMN attempt_errors;
+ALTER TABLE schedule_runs DROP COLUMN attempts;
+ALTER TABLE backup_schedules DROP COLUMN retry_policy;
+
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding RPO policies and breach history';
+
+CREATE TABLE rpo_policies (
+    connection_id TEXT PRIMARY KEY REFERENCES connections(id),
+    enabled BOOLEAN DEFAULT TRUE,
+    max_age_hours INTEGER NOT NULL,
+    breached BOOLEAN DEFAULT FALSE,
+    breached_since TEXT,
+    last_checked_at TEXT,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE rpo_breaches (
+    id TEXT PRIMARY KEY,
+    connection_id TEXT NOT NULL REFERENCES connections(id),
+    max_age_hours INTEGER NOT NULL,
+    started_at TEXT NOT NULL,
+    ended_at TEXT
+);
+
+CREATE INDEX idx_rpo_breaches_connection_id ON rpo_breaches(connection_id, started_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing RPO policies and breach history';
+
+DROP INDEX IF EXISTS idx_rpo_breaches_connection_id;
+DROP TABLE IF EXISTS rpo_breaches;
+DROP TABLE IF EXISTS rpo_policies;
+
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup policies, connection tags, compression and notification rules';
+
+CREATE TABLE backup_policies (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    cron_schedule TEXT NOT NULL,
+    timezone TEXT,
+    retention_days INTEGER NOT NULL,
+    options TEXT,
+    destinations TEXT,
+    retry_policy TEXT,
+    notifications TEXT,
+    misfire_policy TEXT DEFAULT 'run_once',
+    misfire_grace_minutes INTEGER DEFAULT 0,
+    rpo_max_age_hours INTEGER DEFAULT 0,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE backup_policy_targets (
+    policy_id TEXT NOT NULL REFERENCES backup_policies(id),
+    target_type TEXT NOT NULL,
+    target TEXT NOT NULL,
+    PRIMARY KEY (policy_id, target_type, target)
+);
+
+ALTER TABLE backup_schedules ADD COLUMN policy_id TEXT REFERENCES backup_policies(id);
+ALTER TABLE backup_schedules ADD COLUMN notifications TEXT;
+ALTER TABLE backups ADD COLUMN compression TEXT;
+ALTER TABLE connections ADD COLUMN tags TEXT;
+
+CREATE INDEX idx_backup_policies_user_id ON backup_policies(user_id);
+CREATE INDEX idx_backup_schedules_policy_id ON backup_schedules(policy_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup policies, connection tags, compression and notification rules';
+
+DROP INDEX IF EXISTS idx_backup_schedules_policy_id;
+DROP INDEX IF EXISTS idx_backup_policies_user_id;
+
+ALTER TABLE connections DROP COLUMN tags;
+ALTER TABLE backups DROP COLUMN compression;
+ALTER TABLE backup_schedules DROP COLUMN notifications;
+ALTER TABLE backup_schedules DROP COLUMN policy_id;
+
+DROP TABLE IF EXISTS backup_policy_targets;
+DROP TABLE IF EXISTS backup_policies;
+
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding grandfather-father-son retention rules';
+
+CREATE TABLE retention_rules (
+    connection_id TEXT PRIMARY KEY REFERENCES connections(id),
+    enabled BOOLEAN DEFAULT TRUE,
+    keep_last INTEGER DEFAULT 0,
+    keep_daily INTEGER DEFAULT 0,
+    keep_weekly INTEGER DEFAULT 0,
+    keep_monthly INTEGER DEFAULT 0,
+    keep_yearly INTEGER DEFAULT 0,
+    min_keep INTEGER DEFAULT 0,
+    timezone TEXT,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing grandfather-father-son retention rules';
+
+DROP TABLE IF EXISTS retention_rules;
+
+-- +goose StatementEnd
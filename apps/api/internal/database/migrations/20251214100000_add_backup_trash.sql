@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup pinning, legal hold, trash and audit log';
+
+ALTER TABLE backups ADD COLUMN pinned BOOLEAN DEFAULT FALSE;
+ALTER TABLE backups ADD COLUMN legal_hold BOOLEAN DEFAULT FALSE;
+ALTER TABLE backups ADD COLUMN legal_hold_reason TEXT;
+ALTER TABLE backups ADD COLUMN deleted_at TEXT;
+ALTER TABLE backups ADD COLUMN purge_after TEXT;
+ALTER TABLE backups ADD COLUMN delete_reason TEXT;
+
+ALTER TABLE user_settings ADD COLUMN trash_retention_days INTEGER DEFAULT 7;
+
+CREATE TABLE audit_log (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    details TEXT,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_backups_purge_after ON backups(purge_after);
+CREATE INDEX idx_audit_log_user_id ON audit_log(user_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup pinning, legal hold, trash and audit log';
+
+DROP INDEX IF EXISTS idx_audit_log_user_id;
+DROP INDEX IF EXISTS idx_backups_purge_after;
+
+DROP TABLE IF EXISTS audit_log;
+
+ALTER TABLE user_settings DROP COLUMN trash_retention_days;
+
+ALTER TABLE backups DROP COLUMN delete_reason;
+ALTER TABLE backups DROP COLUMN purge_after;
+ALTER TABLE backups DROP COLUMN deleted_at;
+ALTER TABLE backups DROP COLUMN legal_hold_reason;
+ALTER TABLE backups DROP COLUMN legal_hold;
+ALTER TABLE backups DROP COLUMN pinned;
+
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup labels and notes';
+
+ALTER TABLE backups ADD COLUMN labels TEXT;
+ALTER TABLE backups ADD COLUMN notes TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup labels and notes';
+
+ALTER TABLE backups DROP COLUMN notes;
+ALTER TABLE backups DROP COLUMN labels;
+
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding restore jobs';
+
+CREATE TABLE restore_jobs (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    started_by TEXT NOT NULL,
+    backup_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    target_database TEXT NOT NULL,
+    options TEXT,
+    status TEXT NOT NULL,
+    output TEXT,
+    error TEXT,
+    queued_at TEXT NOT NULL,
+    started_at TEXT,
+    finished_at TEXT,
+    heartbeat_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_restore_jobs_user_id ON restore_jobs(user_id, queued_at);
+
+-- Only one queued or running restore may target a database at a time
+CREATE UNIQUE INDEX idx_restore_jobs_active_target ON restore_jobs(connection_id, target_database)
+    WHERE status IN ('queued', 'running');
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing restore jobs';
+
+DROP INDEX IF EXISTS idx_restore_jobs_active_target;
+DROP INDEX IF EXISTS idx_restore_jobs_user_id;
+DROP TABLE IF EXISTS restore_jobs;
+
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding pre-restore snapshots to restore jobs';
+
+ALTER TABLE restore_jobs ADD COLUMN snapshot_backup_id TEXT;
+ALTER TABLE restore_jobs ADD COLUMN reverts_job_id TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing pre-restore snapshots from restore jobs';
+
+ALTER TABLE restore_jobs DROP COLUMN snapshot_backup_id;
+ALTER TABLE restore_jobs DROP COLUMN reverts_job_id;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding checksums to backups';
+
+ALTER TABLE backups ADD COLUMN checksum TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing checksums from backups';
+
+ALTER TABLE backups DROP COLUMN checksum;
+
+-- +goose StatementEnd
@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding refresh pipelines';
+
+CREATE TABLE refresh_pipelines (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    source_connection_id TEXT NOT NULL,
+    source_database TEXT,
+    target_connection_id TEXT NOT NULL,
+    target_database TEXT NOT NULL,
+    options TEXT,
+    post_restore_scripts TEXT,
+    cron_schedule TEXT,
+    timezone TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    -- Fixed width UTC, so due pipelines are found by comparing strings
+    next_run_at TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_refresh_pipelines_user_id ON refresh_pipelines(user_id);
+
+CREATE TABLE refresh_runs (
+    id TEXT PRIMARY KEY,
+    pipeline_id TEXT NOT NULL REFERENCES refresh_pipelines(id),
+    user_id TEXT NOT NULL REFERENCES users(id),
+    triggered_by TEXT NOT NULL,
+    status TEXT NOT NULL,
+    backup_id TEXT,
+    restore_job_id TEXT,
+    steps TEXT,
+    error TEXT,
+    started_at TEXT NOT NULL,
+    finished_at TEXT,
+    heartbeat_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_refresh_runs_pipeline_id ON refresh_runs(pipeline_id, started_at);
+
+-- A pipeline runs once at a time
+CREATE UNIQUE INDEX idx_refresh_runs_active_pipeline ON refresh_runs(pipeline_id)
+    WHERE status = 'running';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing refresh pipelines';
+
+DROP INDEX IF EXISTS idx_refresh_runs_active_pipeline;
+DROP INDEX IF EXISTS idx_refresh_runs_pipeline_id;
+DROP TABLE IF EXISTS refresh_runs;
+DROP INDEX IF EXISTS idx_refresh_pipelines_user_id;
+DROP TABLE IF EXISTS refresh_pipelines;
+
+-- +goose StatementEnd
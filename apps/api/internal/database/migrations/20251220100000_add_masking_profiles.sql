@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding masking profiles';
+
+CREATE TABLE masking_profiles (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    connection_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    rules TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_masking_profiles_user_id ON masking_profiles(user_id);
+
+ALTER TABLE backups ADD COLUMN masked BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE backups ADD COLUMN masking_profile_id TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing masking profiles';
+
+ALTER TABLE backups DROP COLUMN masking_profile_id;
+ALTER TABLE backups DROP COLUMN masked;
+DROP INDEX IF EXISTS idx_masking_profiles_user_id;
+DROP TABLE IF EXISTS masking_profiles;
+
+-- +goose StatementEnd
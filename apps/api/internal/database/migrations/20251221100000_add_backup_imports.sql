@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding imported backups';
+
+ALTER TABLE backups ADD COLUMN imported BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE backups ADD COLUMN format TEXT;
+ALTER TABLE backups ADD COLUMN original_filename TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing imported backups';
+
+ALTER TABLE backups DROP COLUMN original_filename;
+ALTER TABLE backups DROP COLUMN format;
+ALTER TABLE backups DROP COLUMN imported;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding deferred schedule runs';
+
+ALTER TABLE backup_schedules ADD COLUMN deferred_run_time TEXT;
+
+CREATE INDEX idx_backup_schedules_deferred_run_time ON backup_schedules(deferred_run_time);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing deferred schedule runs';
+
+DROP INDEX IF EXISTS idx_backup_schedules_deferred_run_time;
+
+ALTER TABLE backup_schedules DROP COLUMN deferred_run_time;
+
+-- +goose StatementEnd
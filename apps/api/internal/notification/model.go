@@ -10,8 +10,14 @@ import (
 type NotificationType string
 
 const (
-	BackupFailed    NotificationType = "backup_failed"
-	BackupCompleted NotificationType = "backup_completed"
+	BackupFailed     NotificationType = "backup_failed"
+	BackupCompleted  NotificationType = "backup_completed"
+	RPOBreached      NotificationType = "rpo_breached"
+	RPORecovered     NotificationType = "rpo_recovered"
+	RestoreCompleted NotificationType = "restore_completed"
+	RestoreFailed    NotificationType = "restore_failed"
+	RefreshCompleted NotificationType = "refresh_completed"
+	RefreshFailed    NotificationType = "refresh_failed"
 )
 
 type NotificationStatus string
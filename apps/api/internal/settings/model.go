@@ -31,6 +31,15 @@ type UserSettings struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	EnvConfigured map[string]bool `json:"env_configured,omitempty"`
+
+	// Server-side encryption, storage class and object lock (WORM) settings
+	S3SSEMode        *string `json:"s3_sse_mode,omitempty"`
+	S3SSEKMSKeyID    *string `json:"s3_sse_kms_key_id,omitempty"`
+	S3StorageClass   *string `json:"s3_storage_class,omitempty"`
+	S3ObjectLockMode *string `json:"s3_object_lock_mode,omitempty"`
+
+	// TrashRetentionDays is how long deleted backups can be recovered
+	TrashRetentionDays int `json:"trash_retention_days"`
 }
 
 type UpdateSettingsRequest struct {
@@ -53,4 +62,32 @@ type UpdateSettingsRequest struct {
 	S3UseSSL     *bool   `json:"s3_use_ssl,omitempty"`
 	S3PathPrefix *string `json:"s3_path_prefix,omitempty"`
 	S3PurgeLocal *bool   `json:"s3_purge_local,omitempty"`
+	// Server-side encryption, storage class and object lock (WORM) settings
+	S3SSEMode        *string `json:"s3_sse_mode,omitempty"`
+	S3SSEKMSKeyID    *string `json:"s3_sse_kms_key_id,omitempty"`
+	S3StorageClass   *string `json:"s3_storage_class,omitempty"`
+	S3ObjectLockMode *string `json:"s3_object_lock_mode,omitempty"`
+	// TrashRetentionDays is how long deleted backups can be recovered
+	TrashRetentionDays *int `json:"trash_retention_days,omitempty"`
 }
+
+// DefaultTrashRetentionDays is the recovery window of deleted backups when a
+// user hasn't chosen one; MaxTrashRetentionDays caps it
+const (
+	DefaultTrashRetentionDays = 7
+	MaxTrashRetentionDays     = 365
+)
+
+// Accepted values for S3SSEMode
+const (
+	S3SSEModeNone = ""
+	S3SSEModeS3   = "SSE-S3"
+	S3SSEModeKMS  = "SSE-KMS"
+)
+
+// Accepted values for S3ObjectLockMode
+const (
+	S3ObjectLockNone       = ""
+	S3ObjectLockGovernance = "GOVERNANCE"
+	S3ObjectLockCompliance = "COMPLIANCE"
+)
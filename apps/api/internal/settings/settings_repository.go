@@ -25,7 +25,8 @@ func (r *SettingsRepository) GetUserSettings(userID uuid.UUID) (*UserSettings, e
                webhook_url, email, smtp_host, smtp_port, smtp_username, 
                smtp_password, s3_enabled, s3_endpoint, s3_region, s3_bucket,
                s3_access_key, s3_secret_key, s3_use_ssl, s3_path_prefix, s3_purge_local,
-               created_at, updated_at
+               s3_sse_mode, s3_sse_kms_key_id, s3_storage_class, s3_object_lock_mode,
+               COALESCE(trash_retention_days, 7), created_at, updated_at
         FROM user_settings
         WHERE user_id = $1`, userID).Scan(
 		&settings.ID, &settings.UserID, &settings.NotifyDashboard,
@@ -35,18 +36,20 @@ func (r *SettingsRepository) GetUserSettings(userID uuid.UUID) (*UserSettings, e
 		&settings.S3Enabled, &settings.S3Endpoint, &settings.S3Region, &settings.S3Bucket,
 		&settings.S3AccessKey, &settings.S3SecretKey, &settings.S3UseSSL, &settings.S3PathPrefix,
 		&settings.S3PurgeLocal,
-		&createdAtStr, &updatedAtStr)
+		&settings.S3SSEMode, &settings.S3SSEKMSKeyID, &settings.S3StorageClass, &settings.S3ObjectLockMode,
+		&settings.TrashRetentionDays, &createdAtStr, &updatedAtStr)
 
 	if err == sql.ErrNoRows {
 		// Create default settings if none exist
 		now := time.Now()
 		settings = &UserSettings{
-			ID:              uuid.New(),
-			UserID:          userID,
-			NotifyDashboard: true,
-			S3UseSSL:        true,
-			CreatedAt:       now,
-			UpdatedAt:       now,
+			ID:                 uuid.New(),
+			UserID:             userID,
+			NotifyDashboard:    true,
+			S3UseSSL:           true,
+			TrashRetentionDays: DefaultTrashRetentionDays,
+			CreatedAt:          now,
+			UpdatedAt:          now,
 		}
 		return settings, r.CreateUserSettings(settings)
 	}
@@ -76,8 +79,9 @@ func (r *SettingsRepository) CreateUserSettings(settings *UserSettings) error {
             webhook_url, email, smtp_host, smtp_port, smtp_username, 
             smtp_password, s3_enabled, s3_endpoint, s3_region, s3_bucket,
             s3_access_key, s3_secret_key, s3_use_ssl, s3_path_prefix, s3_purge_local,
-            created_at, updated_at
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)`,
+            s3_sse_mode, s3_sse_kms_key_id, s3_storage_class, s3_object_lock_mode,
+            trash_retention_days, created_at, updated_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27)`,
 		settings.ID, settings.UserID, settings.NotifyDashboard,
 		settings.NotifyEmail, settings.NotifyWebhook, settings.WebhookURL,
 		settings.Email, settings.SMTPHost, settings.SMTPPort,
@@ -85,7 +89,8 @@ func (r *SettingsRepository) CreateUserSettings(settings *UserSettings) error {
 		settings.S3Enabled, settings.S3Endpoint, settings.S3Region, settings.S3Bucket,
 		settings.S3AccessKey, settings.S3SecretKey, settings.S3UseSSL, settings.S3PathPrefix,
 		settings.S3PurgeLocal,
-		settings.CreatedAt, settings.UpdatedAt)
+		settings.S3SSEMode, settings.S3SSEKMSKeyID, settings.S3StorageClass, settings.S3ObjectLockMode,
+		settings.TrashRetentionDays, settings.CreatedAt, settings.UpdatedAt)
 	return err
 }
 
@@ -98,15 +103,18 @@ func (r *SettingsRepository) UpdateUserSettings(settings *UserSettings) error {
             smtp_username = $8, smtp_password = $9, s3_enabled = $10,
             s3_endpoint = $11, s3_region = $12, s3_bucket = $13,
             s3_access_key = $14, s3_secret_key = $15, s3_use_ssl = $16,
-            s3_path_prefix = $17, s3_purge_local = $18, updated_at = $19
-        WHERE user_id = $20`,
+            s3_path_prefix = $17, s3_purge_local = $18,
+            s3_sse_mode = $19, s3_sse_kms_key_id = $20, s3_storage_class = $21,
+            s3_object_lock_mode = $22, trash_retention_days = $23, updated_at = $24
+        WHERE user_id = $25`,
 		settings.NotifyDashboard, settings.NotifyEmail, settings.NotifyWebhook,
 		settings.WebhookURL, settings.Email, settings.SMTPHost, settings.SMTPPort,
 		settings.SMTPUsername, settings.SMTPPassword,
 		settings.S3Enabled, settings.S3Endpoint, settings.S3Region, settings.S3Bucket,
 		settings.S3AccessKey, settings.S3SecretKey, settings.S3UseSSL, settings.S3PathPrefix,
 		settings.S3PurgeLocal,
-		settings.UpdatedAt, settings.UserID)
+		settings.S3SSEMode, settings.S3SSEKMSKeyID, settings.S3StorageClass, settings.S3ObjectLockMode,
+		settings.TrashRetentionDays, settings.UpdatedAt, settings.UserID)
 	return err
 }
 
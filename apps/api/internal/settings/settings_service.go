@@ -1,8 +1,10 @@
 package settings
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/google/uuid"
@@ -155,6 +157,39 @@ func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettin
 	if req.S3PurgeLocal != nil {
 		settings.S3PurgeLocal = *req.S3PurgeLocal
 	}
+	if req.S3SSEMode != nil {
+		mode := strings.ToUpper(strings.TrimSpace(*req.S3SSEMode))
+		if mode != S3SSEModeNone && mode != S3SSEModeS3 && mode != S3SSEModeKMS {
+			return nil, fmt.Errorf("invalid s3_sse_mode %q: must be empty, %s or %s", *req.S3SSEMode, S3SSEModeS3, S3SSEModeKMS)
+		}
+		settings.S3SSEMode = &mode
+	}
+	if req.S3SSEKMSKeyID != nil {
+		settings.S3SSEKMSKeyID = req.S3SSEKMSKeyID
+	}
+	if req.S3StorageClass != nil {
+		storageClass := strings.ToUpper(strings.TrimSpace(*req.S3StorageClass))
+		settings.S3StorageClass = &storageClass
+	}
+	if req.S3ObjectLockMode != nil {
+		mode := strings.ToUpper(strings.TrimSpace(*req.S3ObjectLockMode))
+		if mode != S3ObjectLockNone && mode != S3ObjectLockGovernance && mode != S3ObjectLockCompliance {
+			return nil, fmt.Errorf("invalid s3_object_lock_mode %q: must be empty, %s or %s", *req.S3ObjectLockMode, S3ObjectLockGovernance, S3ObjectLockCompliance)
+		}
+		settings.S3ObjectLockMode = &mode
+	}
+
+	if req.TrashRetentionDays != nil {
+		if *req.TrashRetentionDays < 1 || *req.TrashRetentionDays > MaxTrashRetentionDays {
+			return nil, fmt.Errorf("trash_retention_days must be between 1 and %d", MaxTrashRetentionDays)
+		}
+		settings.TrashRetentionDays = *req.TrashRetentionDays
+	}
+
+	if settings.S3SSEMode != nil && *settings.S3SSEMode == S3SSEModeKMS &&
+		(settings.S3SSEKMSKeyID == nil || *settings.S3SSEKMSKeyID == "") {
+		return nil, fmt.Errorf("s3_sse_kms_key_id is required when s3_sse_mode is %s", S3SSEModeKMS)
+	}
 
 	if err := s.repo.UpdateUserSettings(settings); err != nil {
 		return nil, err